@@ -56,6 +56,7 @@ func main() {
 		WithWebhooks(ctx, corewebhooks.NewWebhooks()...).
 		WithControllers(ctx, controllers.NewControllers(
 			ctx,
+			op.Clock,
 			op.GetClient(),
 			aksCloudProvider,
 			op.InstanceProvider,
@@ -26,24 +26,534 @@ import (
 
 // AKSNodeClassSpec is the top level specification for the AKS Karpenter Provider.
 // This will contain configuration necessary to launch instances in AKS.
+// +kubebuilder:validation:XValidation:message="imageSelector and imageVersion are mutually exclusive",rule="!has(self.imageSelector) || !has(self.imageVersion)"
+// +kubebuilder:validation:XValidation:message="sharedImageGalleryID is mutually exclusive with imageSelector and imageVersion",rule="!has(self.sharedImageGalleryID) || (!has(self.imageSelector) && !has(self.imageVersion))"
 type AKSNodeClassSpec struct {
 	// +kubebuilder:default=128
 	// +kubebuilder:validation:Minimum=100
 	// osDiskSizeGB is the size of the OS disk in GB.
 	OSDiskSizeGB *int32 `json:"osDiskSizeGB,omitempty"`
+	// EphemeralOSDiskPlacement is where ephemeral OS disks are placed: the cache disk, the resource (temp) disk or the NVMe disk of the VM.
+	// Instance types without room for the OS disk in that location can't be launched. By default, the OS disk is ephemeral
+	// when it fits the local storage of the instance type, which Azure places it on.
+	// +kubebuilder:validation:Enum:={CacheDisk,ResourceDisk,NvmeDisk}
+	// +optional
+	EphemeralOSDiskPlacement *string `json:"ephemeralOSDiskPlacement,omitempty"`
 	// ImageID is the ID of the image that instances use.
 	// Not exposed in the API yet
 	ImageID *string `json:"-"`
 	// ImageFamily is the image family that instances use.
-	// +kubebuilder:default=Ubuntu2204
+	// Defaults to the default image family of the controller (default-image-family), Ubuntu2204 unless configured otherwise.
 	// +kubebuilder:validation:Enum:={Ubuntu2204,AzureLinux}
 	ImageFamily *string `json:"imageFamily,omitempty"`
 	// ImageVersion is the image version that instances use.
 	// +optional
 	ImageVersion *string `json:"imageVersion,omitempty"`
+	// ImageSelector selects the image version by gallery artifact tags; all entries must match.
+	// The latest matching version of the most preferred compatible image definition is used.
+	// +kubebuilder:validation:MaxProperties=16
+	// +kubebuilder:validation:XValidation:message="imageSelector keys must not be empty",rule="self.all(k, k != '')"
+	// +optional
+	ImageSelector map[string]string `json:"imageSelector,omitempty"`
+	// PreferMinimalImage prefers the minimal variant of the image family default images, which boots faster,
+	// when one is compatible with the instance type. Instance types that need components missing from
+	// the minimal variant (e.g. GPU drivers) keep using the full image.
+	// +optional
+	PreferMinimalImage *bool `json:"preferMinimalImage,omitempty"`
+	// ImageGeneration forces the Hyper-V generation of the image family default images, rather than preferring
+	// Gen2 images for instance types supporting both; e.g. for GPU drivers that only work on one generation.
+	// Instance types or GPU drivers not supporting the generation are rejected.
+	// +kubebuilder:validation:Enum:={Gen1,Gen2}
+	// +optional
+	ImageGeneration *string `json:"imageGeneration,omitempty"`
+	// SharedImageGalleryID is the resource ID of an Azure Compute Gallery image definition or image version
+	// that instances use instead of the image family default images, e.g.
+	// /subscriptions/{subscription}/resourceGroups/{resourceGroup}/providers/Microsoft.Compute/galleries/{gallery}/images/{image}[/versions/{version}].
+	// The image must support the architecture of the instance type; the image family still determines node bootstrapping.
+	// +optional
+	SharedImageGalleryID *string `json:"sharedImageGalleryID,omitempty"`
 	// Tags to be applied on Azure resources like instances.
+	// Values may reference metadata of the NodeClaim of the instance, resolved when launching it:
+	// {{ .NodeClaim.Name }}, {{ .NodeClaim.Labels.<key> }} and {{ .NodeClaim.Annotations.<key> }}, e.g. "{{ .NodeClaim.Labels.team }}".
+	// Launching fails if the NodeClaim does not have a referenced label or annotation.
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
+	// Annotations to be applied on nodes, in addition to those of the NodePool. Kubelet cannot register nodes with annotations,
+	// so node bootstrapping applies them as soon as the node registers.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// HostnameTemplate is the template of the hostname nodes set at boot, which is also the name of their node,
+	// e.g. "{{ .NodeClaim.Labels.team }}-{{ .InstanceType }}-{{ .NodeClaim.Name }}". It must reference {{ .NodeClaim.Name }},
+	// keeping hostnames unique, and may reference {{ .NodeClaim.Labels.<key> }}, {{ .InstanceType }}, the VM size lowercased
+	// with hyphens for underscores (e.g. standard-d4s-v5), and {{ .Zone }}, the availability zone number of the VM resolved
+	// at boot, or 0 for VMs without one. Launching fails if the NodeClaim does not have a referenced label, or if the hostname
+	// is not a valid RFC 1123 label of at most 63 characters. Hostnames are left to AKS defaults if unset.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	HostnameTemplate *string `json:"hostnameTemplate,omitempty"`
+	// GPU configures node bootstrapping for GPU-enabled instance types.
+	// Settings are ignored for instance types without a GPU.
+	// +optional
+	GPU *GPU `json:"gpu,omitempty"`
+	// Conntrack configures the node's connection tracking table.
+	// +optional
+	Conntrack *Conntrack `json:"conntrack,omitempty"`
+	// MTU is the maximum transmission unit of the node's primary network interface,
+	// also applied to the pod network when the CNI is configured by node bootstrapping (kubenet).
+	// Azure virtual networks support up to 3900 on VMs with accelerated networking. The MTU persists across reboots.
+	// +kubebuilder:validation:Minimum=1280
+	// +kubebuilder:validation:Maximum=3900
+	// +optional
+	MTU *int32 `json:"mtu,omitempty"`
+	// MaxPods is the maximum number of pods on nodes, which must not exceed the ceiling of the cluster network plugin:
+	// 30 for Azure CNI with pods in the node subnet and 250 otherwise, such as with Azure CNI Overlay.
+	// Defaults to the max pods of the network plugin.
+	// +kubebuilder:validation:Minimum=10
+	// +kubebuilder:validation:Maximum=250
+	// +optional
+	MaxPods *int32 `json:"maxPods,omitempty"`
+	// SandboxRuntime installs a sandboxed container runtime on the node and registers it with containerd.
+	// Pods run in the sandbox by selecting a RuntimeClass with the matching handler ("runsc" for gvisor).
+	// Only supported with the Ubuntu2204 image family.
+	// +kubebuilder:validation:Enum:={gvisor}
+	// +optional
+	SandboxRuntime *string `json:"sandboxRuntime,omitempty"`
+	// RuntimeHandlers configures the containerd runtime handlers of the node.
+	// +optional
+	RuntimeHandlers *RuntimeHandlers `json:"runtimeHandlers,omitempty"`
+	// DNSServers are the IP addresses of DNS servers the node resolves names with, configured as the global DNS servers
+	// of systemd-resolved ahead of the DNS servers of the virtual network. Pods with the Default DNS policy use them too.
+	// +kubebuilder:validation:MaxItems=3
+	// +optional
+	DNSServers []string `json:"dnsServers,omitempty"`
+	// DNSSearchDomains are the domains the node appends to single-label names when resolving them.
+	// +kubebuilder:validation:MaxItems=6
+	// +optional
+	DNSSearchDomains []string `json:"dnsSearchDomains,omitempty"`
+	// DNSStubListener enables the stub listener of systemd-resolved on 127.0.0.53, which /etc/resolv.conf points
+	// the node at. When false, the node resolves names with the upstream DNS servers listed in /etc/resolv.conf directly.
+	// Disabling it is only supported with the Ubuntu2204 image family.
+	// +kubebuilder:default=true
+	// +optional
+	DNSStubListener *bool `json:"dnsStubListener,omitempty"`
+	// FallbackSubnetIDs are the resource IDs of subnets nodes are launched into, in order, when the subnet of the cluster
+	// has no IPs left for them, e.g.
+	// /subscriptions/{subscription}/resourceGroups/{resourceGroup}/providers/Microsoft.Network/virtualNetworks/{vnet}/subnets/{subnet}.
+	// They must be in the virtual network of the cluster subnet.
+	// +kubebuilder:validation:MaxItems=8
+	// +optional
+	FallbackSubnetIDs []string `json:"fallbackSubnetIDs,omitempty"`
+	// DisableIPv6 disables IPv6 on the node interfaces, through the net.ipv6.conf.all and net.ipv6.conf.default sysctls,
+	// for IPv4-only clusters whose workloads misbehave with IPv6 addresses present. The loopback interface keeps ::1.
+	// Not supported on dual-stack clusters.
+	// +optional
+	DisableIPv6 *bool `json:"disableIPv6,omitempty"`
+	// APIServerName overrides the host name of the API server nodes join, which is that of the cluster endpoint by default,
+	// e.g. for private setups where nodes reach the API server through another name. It may include a port (host:port)
+	// for API servers not listening on 443, which is only supported with the kubeadm bootstrap profile.
+	// +optional
+	APIServerName *string `json:"apiServerName,omitempty"`
+	// NetworkProfile applies a curated set of network sysctls to the node.
+	// +optional
+	NetworkProfile *NetworkProfile `json:"networkProfile,omitempty"`
+	// LinuxConfig configures the Linux kernel of nodes.
+	// +optional
+	LinuxConfig *LinuxConfig `json:"linuxConfig,omitempty"`
+	// TCPCongestionControl is the default TCP congestion control algorithm of the node (net.ipv4.tcp_congestion_control),
+	// whose kernel module is loaded at boot; e.g. bbr for high-latency, high-bandwidth networks.
+	// htcp and dctcp are only supported with the Ubuntu2204 image family.
+	// +kubebuilder:validation:Enum:={bbr,cubic,reno,htcp,dctcp}
+	// +optional
+	TCPCongestionControl *string `json:"tcpCongestionControl,omitempty"`
+	// AcceleratedNetworking enables Accelerated Networking (SR-IOV) on the network interface of instances.
+	// It is enabled by default for instance types which support it; set to false to disable it.
+	// Setting it to true does not enable it for instance types which do not support it.
+	// +optional
+	AcceleratedNetworking *bool `json:"acceleratedNetworking,omitempty"`
+	// MetadataLabels labels nodes with metadata of their instance type, when it is known at launch (the instance type
+	// requirement has a single value): the SKU family (karpenter.azure.com/sku-family), the availability zone
+	// (karpenter.azure.com/zone) and the capacity type (karpenter.sh/capacity-type). Labels requested otherwise take precedence.
+	// It is enabled by default; set to false to disable it.
+	// +optional
+	MetadataLabels *bool `json:"metadataLabels,omitempty"`
+	// SecurityProfile configures the security features of instances, such as Trusted Launch (secure boot and vTPM)
+	// and encryption at host. Instance types or images not supporting a requested feature are rejected.
+	// +optional
+	SecurityProfile *SecurityProfile `json:"securityProfile,omitempty"`
+	// ProximityPlacementGroupID is the resource ID of the proximity placement group instances are co-located in, for
+	// latency-sensitive workloads. It must be in the subscription and region instances are launched in.
+	// +kubebuilder:validation:Pattern=`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/proximityPlacementGroups/[^/]+$`
+	// +optional
+	ProximityPlacementGroupID *string `json:"proximityPlacementGroupID,omitempty"`
+	// BootDiagnostics enables Azure boot diagnostics on instances, capturing their serial console log and screenshots,
+	// e.g. to troubleshoot nodes which fail to join the cluster.
+	// +optional
+	BootDiagnostics *BootDiagnostics `json:"bootDiagnostics,omitempty"`
+	// KubeletIdentity is the user-assigned identity the kubelet (and its image credential provider) uses,
+	// instead of the default kubelet identity of the cluster. It must be one of the node identities assigned to instances.
+	// +optional
+	KubeletIdentity *KubeletIdentity `json:"kubeletIdentity,omitempty"`
+	// NodeIdentities are the resource IDs of user-assigned identities assigned to instances,
+	// in addition to the node identities configured for the cluster.
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	NodeIdentities []string `json:"nodeIdentities,omitempty"`
+	// SystemAssignedIdentity enables the system-assigned identity of instances.
+	// +optional
+	SystemAssignedIdentity *bool `json:"systemAssignedIdentity,omitempty"`
+	// EntropySource installs and enables an entropy daemon on the node:
+	// rngd feeds the kernel entropy pool from the hardware RNG, haveged from CPU timing jitter.
+	// haveged is only supported with the Ubuntu2204 image family.
+	// +kubebuilder:validation:Enum:={rngd,haveged}
+	// +optional
+	EntropySource *string `json:"entropySource,omitempty"`
+	// SwapAccounting enables memory accounting by default for all systemd units, for the cgroup v2 memory controller
+	// to account their memory and swap usage. Requires cgroup v2, so it is only supported with the Ubuntu2204 image family.
+	// +optional
+	SwapAccounting *bool `json:"swapAccounting,omitempty"`
+	// RoCE configures RDMA over Converged Ethernet on the node, for GPUDirect RDMA and other RDMA workloads:
+	// it installs rdma-core, loads the RDMA kernel modules (and nvidia_peermem on GPU nodes), lifts the
+	// containerd locked memory limit and applies ARP sysctls for multi-interface nodes.
+	// It is ignored for instance types without an RDMA capable network interface.
+	// +optional
+	RoCE *bool `json:"roce,omitempty"`
+	// AdditionalCAs are PEM encoded CA certificates the node trusts in addition to the cluster CA, e.g. of internal
+	// proxies, private registries or webhooks. They are added to the trust store of the node and to the hosts of the
+	// registry mirrors containerd pulls from.
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	AdditionalCAs []string `json:"additionalCAs,omitempty"`
+	// ContainerdConfig configures containerd on the node.
+	// +optional
+	ContainerdConfig *ContainerdConfig `json:"containerdConfig,omitempty"`
+	// ImagePullConfig are the credentials the kubelet pulls images of private registries with, for nodes without
+	// workload identity or an attached ACR. They are written to the kubelet credential file (/var/lib/kubelet/config.json),
+	// readable only by root, and are redacted from logged user data. They are readable by anyone who can read AKSNodeClasses.
+	// +kubebuilder:validation:MaxItems=16
+	// +listType=map
+	// +listMapKey=registry
+	// +optional
+	ImagePullConfig []ImagePullConfig `json:"imagePullConfig,omitempty"`
+	// PrePullImages are container images node bootstrapping pulls into containerd once the node has started, to reduce
+	// the startup latency of pods with large images, e.g. "mcr.microsoft.com/azureml/openmpi4.1.0-cuda11.8-cudnn8-ubuntu22.04:latest".
+	// Nodes register with the karpenter.azure.com/readiness-command:NoSchedule taint, which Karpenter removes once the images are pulled
+	// (and the readiness command, if any, succeeded), unless prePullImagesInBackground is set. Images are pulled
+	// anonymously or with the credentials of the image pull config of their registry; failing to pull an image does not fail the node.
+	// +kubebuilder:validation:MaxItems=32
+	// +listType=set
+	// +optional
+	PrePullImages []string `json:"prePullImages,omitempty"`
+	// PrePullImagesInBackground pulls the images of prePullImages in the background, without keeping workloads off the node until then.
+	// +optional
+	PrePullImagesInBackground *bool `json:"prePullImagesInBackground,omitempty"`
+	// LocalStorage mounts the local NVMe disks of the node at boot, for a local static provisioner to discover them.
+	// Only supported by instance types with local NVMe disks, such as the Lsv3 series; launching other instance types fails.
+	// +optional
+	LocalStorage *LocalStorage `json:"localStorage,omitempty"`
+	// OOMScoreAdj sets the OOM score adjustment of system daemons, via systemd drop-ins applied at boot.
+	// +optional
+	OOMScoreAdj *OOMScoreAdj `json:"oomScoreAdj,omitempty"`
+	// Kubelet configures the kubelet of nodes, in addition to the kubelet configuration of the NodePool.
+	// +optional
+	Kubelet *Kubelet `json:"kubelet,omitempty"`
+	// ReadinessCommand is run at the end of node bootstrapping to validate the node before workloads schedule onto it.
+	// Nodes register with the karpenter.azure.com/readiness-command:NoSchedule taint, which Karpenter only removes once the command exits 0;
+	// if it fails or times out the taint remains.
+	// +optional
+	ReadinessCommand *ReadinessCommand `json:"readinessCommand,omitempty"`
+	// Registration tunes how long node bootstrapping waits for the kubelet to register the node with the API server,
+	// and how often it restarts the kubelet to retry, for high-latency connections such as private links.
+	// +optional
+	Registration *Registration `json:"registration,omitempty"`
+	// SystemdUnits are written to /etc/systemd/system at boot, e.g. to run a node health agent on every node without a DaemonSet.
+	// Units of the node bootstrapping itself, such as kubelet.service, cannot be overridden.
+	// +kubebuilder:validation:MaxItems=16
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	SystemdUnits []SystemdUnit `json:"systemdUnits,omitempty"`
+}
+
+// SystemdUnit is a systemd unit written by node bootstrapping.
+type SystemdUnit struct {
+	// Name is the file name of the unit, including its type suffix, e.g. node-health-agent.service.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9:_.@-]+\.(service|socket|timer|path|target)$`
+	// +kubebuilder:validation:MaxLength=255
+	// +required
+	Name string `json:"name"`
+	// Content is the unit file.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=16384
+	// +required
+	Content string `json:"content"`
+	// Enabled enables and starts the unit once it is written, true by default; disabled units are only written,
+	// for other units (e.g. a timer) to start them.
+	// +kubebuilder:default=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// Registration contains the registration timeout and retries of node bootstrapping.
+type Registration struct {
+	// TimeoutSeconds is how long each registration attempt waits for the node to register.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=30
+	// +kubebuilder:validation:Maximum=3600
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// RetryCount is how many times the kubelet is restarted to retry registering after an attempt times out.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	RetryCount *int32 `json:"retryCount,omitempty"`
+}
+
+// ReadinessCommand is a command validating the node, run by node bootstrapping.
+type ReadinessCommand struct {
+	// Command is the bash script to run as root on the node.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=4096
+	// +required
+	Command string `json:"command"`
+	// TimeoutSeconds is how long the command may run before it is considered failed.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=3600
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// OOMScoreAdj contains OOM score adjustments of system daemons, from -1000 (never OOM-killed) to 1000 (OOM-killed first).
+// Unset adjustments keep the defaults of the image.
+type OOMScoreAdj struct {
+	// Kubelet is the OOM score adjustment of the kubelet.
+	// +kubebuilder:validation:Minimum=-1000
+	// +kubebuilder:validation:Maximum=1000
+	// +optional
+	Kubelet *int32 `json:"kubelet,omitempty"`
+	// Containerd is the OOM score adjustment of containerd. Container processes do not inherit it.
+	// +kubebuilder:validation:Minimum=-1000
+	// +kubebuilder:validation:Maximum=1000
+	// +optional
+	Containerd *int32 `json:"containerd,omitempty"`
+}
+
+// Kubelet contains kubelet settings of nodes.
+type Kubelet struct {
+	// FeatureGates enables or disables kubelet feature gates by name, such as alpha features for testing.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// CgroupDriver is the cgroup driver of the kubelet and containerd, which are always configured with the same one;
+	// systemd, the default of node images, or cgroupfs. Not supported with the kubeadm bootstrap profile, whose images
+	// configure containerd themselves.
+	// +kubebuilder:validation:Enum:={systemd,cgroupfs}
+	// +optional
+	CgroupDriver *string `json:"cgroupDriver,omitempty"`
+}
+
+// RuntimeHandlers configures the containerd runtime handlers registered on the node.
+type RuntimeHandlers struct {
+	// Default is the handler of pods selecting no RuntimeClass, runc by default; runsc runs all pods of the node in the
+	// gvisor sandbox, and requires the gvisor sandbox runtime. Not supported on GPU instance types, whose default is the
+	// NVIDIA container runtime.
+	// +kubebuilder:validation:Enum:={runc,runsc}
+	// +optional
+	Default *string `json:"default,omitempty"`
+	// Labels labels the node with karpenter.azure.com/runtime-handler-{handler}=true for each handler registered on it,
+	// for RuntimeClasses to schedule pods onto nodes with their handler.
+	// +optional
+	Labels *bool `json:"labels,omitempty"`
+}
+
+// LocalStorage contains the local disk settings of the node.
+type LocalStorage struct {
+	// DiscoveryPath is the directory each local NVMe disk is formatted (unless it already has a filesystem) and mounted in,
+	// at {discoveryPath}/nvme{index}; it should match the discovery directory of the local static provisioner.
+	// +kubebuilder:default="/mnt/disks"
+	// +kubebuilder:validation:Pattern=`^/[a-zA-Z0-9._/-]*$`
+	// +optional
+	DiscoveryPath *string `json:"discoveryPath,omitempty"`
+	// RAID0 stripes the local NVMe disks of instance types with more than one into a single RAID 0 array, formatted and
+	// mounted at {discoveryPath}/raid0 instead of each disk, for a single large volume. Instance types with one disk mount it as is.
+	// +optional
+	RAID0 *bool `json:"raid0,omitempty"`
+}
+
+// ContainerdConfig contains containerd settings of the node.
+type ContainerdConfig struct {
+	// RegistryMirrors are the mirrors containerd pulls images of a registry through.
+	// +kubebuilder:validation:MaxItems=32
+	// +listType=map
+	// +listMapKey=registry
+	// +optional
+	RegistryMirrors []RegistryMirror `json:"registryMirrors,omitempty"`
+	// CNIBinDir is the absolute path of the directory containerd looks for CNI plugin binaries in, /opt/cni/bin by default,
+	// for CNI installations (e.g. BYO CNI) which install their plugins elsewhere.
+	// +optional
+	CNIBinDir *string `json:"cniBinDir,omitempty"`
+	// CNIConfDir is the absolute path of the directory containerd looks for CNI network configurations in, /etc/cni/net.d by default.
+	// +optional
+	CNIConfDir *string `json:"cniConfDir,omitempty"`
+	// MaxConcurrentDownloads is the number of image layers containerd pulls at the same time, 3 by default.
+	// Lowering it limits the load on registries when many nodes pull images at once.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrentDownloads *int32 `json:"maxConcurrentDownloads,omitempty"`
+}
+
+// RegistryMirror configures the mirrors of a container registry, written to the containerd
+// hosts configuration of the registry (/etc/containerd/certs.d/{registry}/hosts.toml).
+type RegistryMirror struct {
+	// Registry is the host (and optional port) of the mirrored registry, e.g. docker.io.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9.-]+(:[0-9]+)?$`
+	// +required
+	Registry string `json:"registry"`
+	// Endpoints are the URLs of the mirrors, tried in order before falling back to the registry itself.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=8
+	// +required
+	Endpoints []string `json:"endpoints"`
+}
+
+// ImagePullConfig contains the credentials of a private registry.
+type ImagePullConfig struct {
+	// Registry is the host (and optional port) of the private registry, e.g. myregistry.example.com.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9.-]+(:[0-9]+)?$`
+	// +required
+	Registry string `json:"registry"`
+	// Auth is the base64 encoded username:password pair authenticating to the registry, as in the auths of a docker config.json.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=4096
+	// +required
+	Auth string `json:"auth"`
+}
+
+// GPU contains node bootstrapping settings that only apply to GPU-enabled instance types.
+type GPU struct {
+	// PersistenceMode enables NVIDIA persistence mode by enabling the nvidia-persistenced service at boot,
+	// keeping the driver initialized to avoid re-initialization latency, also across reboots.
+	// +optional
+	PersistenceMode *bool `json:"persistenceMode,omitempty"`
+	// MIGProfile partitions each GPU into Multi-Instance GPU instances of the profile at boot, e.g. MIG1g for 7 instances
+	// of 1 compute slice each, and labels the node with karpenter.azure.com/gpu-mig-profile. Only supported by MIG-capable
+	// instance types (A100); launching other instance types fails.
+	// +kubebuilder:validation:Enum:={MIG1g,MIG2g,MIG3g,MIG4g,MIG7g}
+	// +optional
+	MIGProfile *string `json:"migProfile,omitempty"`
+	// DriverVersion installs the NVIDIA driver version rather than the one derived from the instance type, e.g. the CUDA 470
+	// driver for workloads built against an older CUDA version. Instance types needing the GRID driver only support the GRID
+	// driver and others only the CUDA drivers; overriding the driver is only supported by the Ubuntu2204 image family.
+	// +kubebuilder:validation:Enum:={cuda-470.82.01,cuda-550.54.15,grid-535.161.08}
+	// +optional
+	DriverVersion *string `json:"driverVersion,omitempty"`
+}
+
+// Conntrack contains the node's connection tracking settings.
+type Conntrack struct {
+	// Max is the maximum number of tracked connections (net.netfilter.nf_conntrack_max).
+	// When unset, it is scaled by the memory of the instance type.
+	// +kubebuilder:validation:Minimum=65536
+	// +kubebuilder:validation:Maximum=16777216
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+	// TCPTimeouts configures how long tracked TCP connections are kept in each state.
+	// +optional
+	TCPTimeouts *ConntrackTCPTimeouts `json:"tcpTimeouts,omitempty"`
+}
+
+// ConntrackTCPTimeouts contains conntrack timeouts for TCP connection states, in seconds.
+// Unset timeouts keep the kernel defaults.
+type ConntrackTCPTimeouts struct {
+	// EstablishedSeconds is the timeout for established connections (net.netfilter.nf_conntrack_tcp_timeout_established).
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:validation:Maximum=432000
+	// +optional
+	EstablishedSeconds *int32 `json:"establishedSeconds,omitempty"`
+	// CloseWaitSeconds is the timeout for connections in CLOSE_WAIT (net.netfilter.nf_conntrack_tcp_timeout_close_wait).
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=86400
+	// +optional
+	CloseWaitSeconds *int32 `json:"closeWaitSeconds,omitempty"`
+}
+
+// KubeletIdentity references a user-assigned managed identity.
+type KubeletIdentity struct {
+	// ClientID is the client ID of the identity.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+	// +required
+	ClientID string `json:"clientID"`
+	// ResourceID is the resource ID of the identity, e.g.
+	// /subscriptions/{subscription}/resourceGroups/{resourceGroup}/providers/Microsoft.ManagedIdentity/userAssignedIdentities/{name}.
+	// +required
+	ResourceID string `json:"resourceID"`
+}
+
+// LinuxConfig contains Linux kernel settings of nodes.
+type LinuxConfig struct {
+	// Sysctls are kernel parameters the node applies at boot, limited to those AKS allows customizing,
+	// such as net.core.somaxconn and fs.inotify.max_user_watches.
+	// They take precedence over the kernel parameters of the networkProfile.
+	// +optional
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+}
+
+// NetworkProfile is a named set of network sysctls, with individual values overridable.
+type NetworkProfile struct {
+	// Name of the profile. high-throughput raises socket buffer limits and the netdev backlog.
+	// +kubebuilder:validation:Enum:={high-throughput}
+	// +required
+	Name string `json:"name"`
+	// CoreRMemMax overrides the maximum socket receive buffer size in bytes (net.core.rmem_max).
+	// +kubebuilder:validation:Minimum=212992
+	// +optional
+	CoreRMemMax *int32 `json:"coreRMemMax,omitempty"`
+	// CoreWMemMax overrides the maximum socket send buffer size in bytes (net.core.wmem_max).
+	// +kubebuilder:validation:Minimum=212992
+	// +optional
+	CoreWMemMax *int32 `json:"coreWMemMax,omitempty"`
+	// TCPRMem overrides the minimum, default and maximum TCP receive buffer sizes in bytes (net.ipv4.tcp_rmem).
+	// +kubebuilder:validation:Pattern=`^[0-9]+ [0-9]+ [0-9]+$`
+	// +optional
+	TCPRMem *string `json:"tcpRMem,omitempty"`
+	// TCPWMem overrides the minimum, default and maximum TCP send buffer sizes in bytes (net.ipv4.tcp_wmem).
+	// +kubebuilder:validation:Pattern=`^[0-9]+ [0-9]+ [0-9]+$`
+	// +optional
+	TCPWMem *string `json:"tcpWMem,omitempty"`
+	// NetdevMaxBacklog overrides the maximum number of packets queued on the input side of a network device (net.core.netdev_max_backlog).
+	// +kubebuilder:validation:Minimum=1000
+	// +kubebuilder:validation:Maximum=1048576
+	// +optional
+	NetdevMaxBacklog *int32 `json:"netdevMaxBacklog,omitempty"`
+}
+
+// BootDiagnostics contains the boot diagnostics settings of instances.
+type BootDiagnostics struct {
+	// Enabled enables boot diagnostics, true by default.
+	// +kubebuilder:default=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// StorageURI is the blob endpoint of the storage account boot diagnostics are stored in, e.g. https://mystorageaccount.blob.core.windows.net/.
+	// The storage account must be in the region and subscription of the instances. Managed storage is used if not set.
+	// +kubebuilder:validation:Pattern=`^https://[a-z0-9]{3,24}\.blob\.[a-z0-9.-]+/?$`
+	// +optional
+	StorageURI *string `json:"storageURI,omitempty"`
+}
+
+// SecurityProfile contains the security features of instances.
+type SecurityProfile struct {
+	// SecureBoot launches instances with Trusted Launch and UEFI secure boot, which only boots signed kernels and drivers.
+	// Requires an instance type supporting Trusted Launch (karpenter.azure.com/sku-trustedlaunch-capable) and a Gen2 image.
+	// +optional
+	SecureBoot *bool `json:"secureBoot,omitempty"`
+	// VTPM launches instances with Trusted Launch and a virtual Trusted Platform Module, for measured boot and attestation.
+	// Requires an instance type supporting Trusted Launch (karpenter.azure.com/sku-trustedlaunch-capable) and a Gen2 image.
+	// +optional
+	VTPM *bool `json:"vtpm,omitempty"`
+	// EncryptionAtHost encrypts the temporary disk and the OS disk caches of instances at the host.
+	// Requires an instance type supporting it (karpenter.azure.com/sku-encryptionathost-capable), and the
+	// EncryptionAtHost feature to be registered on the subscription.
+	// +optional
+	EncryptionAtHost *bool `json:"encryptionAtHost,omitempty"`
 }
 
 // AKSNodeClass is the Schema for the AKSNodeClass API
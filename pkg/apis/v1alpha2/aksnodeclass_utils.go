@@ -16,9 +16,302 @@ limitations under the License.
 
 package v1alpha2
 
+import (
+	"net"
+	"strconv"
+
+	"github.com/samber/lo"
+)
+
 func (in *AKSNodeClassSpec) GetImageVersion() string {
 	if in.ImageVersion == nil {
 		return ""
 	}
 	return *in.ImageVersion
 }
+
+func (in *AKSNodeClassSpec) IsMinimalImagePreferred() bool {
+	return lo.FromPtr(in.PreferMinimalImage)
+}
+
+// GetImageHyperVGeneration returns the Hyper-V generation (sku-hyperv-generation) the image generation is forced to, if any
+func (in *AKSNodeClassSpec) GetImageHyperVGeneration() string {
+	switch lo.FromPtr(in.ImageGeneration) {
+	case ImageGenerationGen1:
+		return HyperVGenerationV1
+	case ImageGenerationGen2:
+		return HyperVGenerationV2
+	default:
+		return ""
+	}
+}
+
+func (in *AKSNodeClassSpec) GetConntrackMax() *int32 {
+	if in.Conntrack == nil {
+		return nil
+	}
+	return in.Conntrack.Max
+}
+
+func (in *AKSNodeClassSpec) GetConntrackTCPTimeouts() ConntrackTCPTimeouts {
+	if in.Conntrack == nil || in.Conntrack.TCPTimeouts == nil {
+		return ConntrackTCPTimeouts{}
+	}
+	return *in.Conntrack.TCPTimeouts
+}
+
+func (in *AKSNodeClassSpec) GetSandboxRuntime() string {
+	return lo.FromPtr(in.SandboxRuntime)
+}
+
+// GetRuntimeHandlers returns the containerd runtime handlers registered on nodes: runc, and that of the sandbox runtime
+func (in *AKSNodeClassSpec) GetRuntimeHandlers() []string {
+	if in.GetSandboxRuntime() == SandboxRuntimeGVisor {
+		return []string{RuntimeHandlerRunc, RuntimeHandlerRunsc}
+	}
+	return []string{RuntimeHandlerRunc}
+}
+
+// GetDefaultRuntimeHandler returns the configured handler of pods selecting no RuntimeClass, empty for the default
+func (in *AKSNodeClassSpec) GetDefaultRuntimeHandler() string {
+	if in.RuntimeHandlers == nil {
+		return ""
+	}
+	return lo.FromPtr(in.RuntimeHandlers.Default)
+}
+
+func (in *AKSNodeClassSpec) IsRuntimeHandlerLabelsEnabled() bool {
+	return in.RuntimeHandlers != nil && lo.FromPtr(in.RuntimeHandlers.Labels)
+}
+
+func (in *AKSNodeClassSpec) GetEntropySource() string {
+	return lo.FromPtr(in.EntropySource)
+}
+
+func (in *AKSNodeClassSpec) GetTCPCongestionControl() string {
+	return lo.FromPtr(in.TCPCongestionControl)
+}
+
+func (in *AKSNodeClassSpec) IsDNSStubListenerDisabled() bool {
+	return !lo.FromPtrOr(in.DNSStubListener, true)
+}
+
+func (in *AKSNodeClassSpec) IsIPv6Disabled() bool {
+	return lo.FromPtr(in.DisableIPv6)
+}
+
+func (in *AKSNodeClassSpec) IsSwapAccountingEnabled() bool {
+	return lo.FromPtr(in.SwapAccounting)
+}
+
+func (in *AKSNodeClassSpec) IsRoCEEnabled() bool {
+	return lo.FromPtr(in.RoCE)
+}
+
+// GetRegistryMirrors returns the mirror endpoints of each mirrored registry
+func (in *AKSNodeClassSpec) GetRegistryMirrors() map[string][]string {
+	if in.ContainerdConfig == nil || len(in.ContainerdConfig.RegistryMirrors) == 0 {
+		return nil
+	}
+	return lo.SliceToMap(in.ContainerdConfig.RegistryMirrors, func(mirror RegistryMirror) (string, []string) {
+		return mirror.Registry, mirror.Endpoints
+	})
+}
+
+// GetImagePullCredentials returns the base64 encoded username:password credentials of each private registry
+func (in *AKSNodeClassSpec) GetImagePullCredentials() map[string]string {
+	if len(in.ImagePullConfig) == 0 {
+		return nil
+	}
+	return lo.SliceToMap(in.ImagePullConfig, func(config ImagePullConfig) (string, string) {
+		return config.Registry, config.Auth
+	})
+}
+
+// GetCNIDirs returns the configured CNI plugin binary and network configuration directories, empty for the defaults
+func (in *AKSNodeClassSpec) GetCNIDirs() (string, string) {
+	if in.ContainerdConfig == nil {
+		return "", ""
+	}
+	return lo.FromPtr(in.ContainerdConfig.CNIBinDir), lo.FromPtr(in.ContainerdConfig.CNIConfDir)
+}
+
+// GetMaxConcurrentDownloads returns the number of layers containerd pulls concurrently, 0 for the containerd default
+func (in *AKSNodeClassSpec) GetMaxConcurrentDownloads() int32 {
+	if in.ContainerdConfig == nil {
+		return 0
+	}
+	return lo.FromPtr(in.ContainerdConfig.MaxConcurrentDownloads)
+}
+
+// GetLocalStorageDiscoveryPath returns the directory local disks are mounted in, empty when they are not mounted
+func (in *AKSNodeClassSpec) GetLocalStorageDiscoveryPath() string {
+	if in.LocalStorage == nil {
+		return ""
+	}
+	return lo.FromPtrOr(in.LocalStorage.DiscoveryPath, defaultLocalStorageDiscoveryPath)
+}
+
+// IsLocalStorageRAID0Enabled returns whether the local disks are striped into a RAID 0 array
+func (in *AKSNodeClassSpec) IsLocalStorageRAID0Enabled() bool {
+	return in.LocalStorage != nil && lo.FromPtr(in.LocalStorage.RAID0)
+}
+
+// GetSysctls returns the configured kernel parameters of nodes
+func (in *AKSNodeClassSpec) GetSysctls() map[string]string {
+	if in.LinuxConfig == nil {
+		return nil
+	}
+	return in.LinuxConfig.Sysctls
+}
+
+// GetKubeletFeatureGates returns the kubelet feature gates enabled or disabled by name
+func (in *AKSNodeClassSpec) GetKubeletFeatureGates() map[string]bool {
+	if in.Kubelet == nil {
+		return nil
+	}
+	return in.Kubelet.FeatureGates
+}
+
+// GetKubeletCgroupDriver returns the cgroup driver of the kubelet and containerd, empty for the default of the node image
+func (in *AKSNodeClassSpec) GetKubeletCgroupDriver() string {
+	if in.Kubelet == nil {
+		return ""
+	}
+	return lo.FromPtr(in.Kubelet.CgroupDriver)
+}
+
+// GetOOMScoreAdj returns the configured OOM score adjustment of each system daemon
+func (in *AKSNodeClassSpec) GetOOMScoreAdj() map[string]int32 {
+	if in.OOMScoreAdj == nil {
+		return nil
+	}
+	oomScoreAdj := map[string]int32{}
+	if in.OOMScoreAdj.Kubelet != nil {
+		oomScoreAdj["kubelet"] = *in.OOMScoreAdj.Kubelet
+	}
+	if in.OOMScoreAdj.Containerd != nil {
+		oomScoreAdj["containerd"] = *in.OOMScoreAdj.Containerd
+	}
+	return oomScoreAdj
+}
+
+// GetAPIServerHostPort returns the host and port of the API server name override, with port 0 when it has none
+func (in *AKSNodeClassSpec) GetAPIServerHostPort() (string, int32) {
+	if in.APIServerName == nil {
+		return "", 0
+	}
+	host, port, err := net.SplitHostPort(*in.APIServerName)
+	if err != nil {
+		return *in.APIServerName, 0
+	}
+	portNumber, _ := strconv.ParseInt(port, 10, 32) // validated
+	return host, int32(portNumber)
+}
+
+func (in *AKSNodeClassSpec) GetReadinessCommand() string {
+	if in.ReadinessCommand == nil {
+		return ""
+	}
+	return in.ReadinessCommand.Command
+}
+
+func (in *AKSNodeClassSpec) GetReadinessCommandTimeoutSeconds() int32 {
+	if in.ReadinessCommand == nil {
+		return 0
+	}
+	return lo.FromPtrOr(in.ReadinessCommand.TimeoutSeconds, defaultReadinessCommandTimeoutSeconds)
+}
+
+// IsPrePullImagesInBackground returns whether the images to pre-pull are pulled without keeping workloads off the node until then
+func (in *AKSNodeClassSpec) IsPrePullImagesInBackground() bool {
+	return lo.FromPtr(in.PrePullImagesInBackground)
+}
+
+// IsEnabled returns whether the systemd unit is enabled and started once it is written
+func (in *SystemdUnit) IsEnabled() bool {
+	return lo.FromPtrOr(in.Enabled, true)
+}
+
+// GetRegistrationTimeoutSeconds returns how long node bootstrapping waits for the node to register, 0 when not tuned
+func (in *AKSNodeClassSpec) GetRegistrationTimeoutSeconds() int32 {
+	if in.Registration == nil {
+		return 0
+	}
+	return lo.FromPtrOr(in.Registration.TimeoutSeconds, defaultRegistrationTimeoutSeconds)
+}
+
+func (in *AKSNodeClassSpec) GetRegistrationRetryCount() int32 {
+	if in.Registration == nil {
+		return 0
+	}
+	return lo.FromPtr(in.Registration.RetryCount)
+}
+
+func (in *AKSNodeClassSpec) IsAcceleratedNetworkingDisabled() bool {
+	return !lo.FromPtrOr(in.AcceleratedNetworking, true)
+}
+
+func (in *AKSNodeClassSpec) IsMetadataLabelsDisabled() bool {
+	return !lo.FromPtrOr(in.MetadataLabels, true)
+}
+
+// IsTrustedLaunchEnabled returns whether instances are launched with Trusted Launch, for secure boot or a vTPM
+func (in *AKSNodeClassSpec) IsTrustedLaunchEnabled() bool {
+	return in.IsSecureBootEnabled() || in.IsVTPMEnabled()
+}
+
+func (in *AKSNodeClassSpec) IsSecureBootEnabled() bool {
+	if in.SecurityProfile == nil {
+		return false
+	}
+	return lo.FromPtr(in.SecurityProfile.SecureBoot)
+}
+
+func (in *AKSNodeClassSpec) IsVTPMEnabled() bool {
+	if in.SecurityProfile == nil {
+		return false
+	}
+	return lo.FromPtr(in.SecurityProfile.VTPM)
+}
+
+func (in *AKSNodeClassSpec) IsEncryptionAtHostEnabled() bool {
+	if in.SecurityProfile == nil {
+		return false
+	}
+	return lo.FromPtr(in.SecurityProfile.EncryptionAtHost)
+}
+
+// GetProximityPlacementGroupID returns the resource ID of the proximity placement group of instances, empty for none
+func (in *AKSNodeClassSpec) GetProximityPlacementGroupID() string {
+	return lo.FromPtr(in.ProximityPlacementGroupID)
+}
+
+// GetBootDiagnostics returns whether boot diagnostics are enabled, and the storage URI they are stored at, empty for managed storage
+func (in *AKSNodeClassSpec) GetBootDiagnostics() (bool, string) {
+	if in.BootDiagnostics == nil || !lo.FromPtrOr(in.BootDiagnostics.Enabled, true) {
+		return false, ""
+	}
+	return true, lo.FromPtr(in.BootDiagnostics.StorageURI)
+}
+
+func (in *AKSNodeClassSpec) IsGPUPersistenceModeEnabled() bool {
+	if in.GPU == nil {
+		return false
+	}
+	return lo.FromPtr(in.GPU.PersistenceMode)
+}
+
+func (in *AKSNodeClassSpec) GetGPUMIGProfile() string {
+	if in.GPU == nil {
+		return ""
+	}
+	return lo.FromPtr(in.GPU.MIGProfile)
+}
+
+func (in *AKSNodeClassSpec) GetGPUDriverVersion() string {
+	if in.GPU == nil {
+		return ""
+	}
+	return lo.FromPtr(in.GPU.DriverVersion)
+}
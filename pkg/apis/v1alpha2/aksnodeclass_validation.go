@@ -0,0 +1,612 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// Azure resource tag limits, see https://learn.microsoft.com/azure/azure-resource-manager/management/tag-resources#limitations
+	maxTagKeyLength    = 512
+	maxTagValueLength  = 256
+	invalidTagKeyRunes = `<>%&\?/`
+
+	// the IPv6 minimum, and the Azure virtual network maximum with accelerated networking,
+	// see https://learn.microsoft.com/azure/virtual-network/how-to-virtual-machine-mtu
+	minMTU = 1280
+	maxMTU = 3900
+
+	minMaxPods = 10
+	maxMaxPods = 250
+
+	maxNodeIdentities = 32
+
+	maxDNSServers       = 3
+	maxDNSSearchDomains = 6
+	maxDNSDomainLength  = 253
+
+	maxFallbackSubnetIDs = 8
+
+	maxReadinessCommandLength             = 4096
+	minReadinessCommandTimeoutSeconds     = 1
+	maxReadinessCommandTimeoutSeconds     = 3600
+	defaultReadinessCommandTimeoutSeconds = 300
+
+	minRegistrationTimeoutSeconds     = 30
+	maxRegistrationTimeoutSeconds     = 3600
+	defaultRegistrationTimeoutSeconds = 300
+	minRegistrationRetryCount         = 1
+	maxRegistrationRetryCount         = 10
+
+	minAPIServerPort = 1
+	maxAPIServerPort = 65535
+
+	defaultLocalStorageDiscoveryPath = "/mnt/disks"
+
+	minOOMScoreAdj = -1000
+	maxOOMScoreAdj = 1000
+
+	maxSystemdUnits             = 16
+	maxSystemdUnitNameLength    = 255
+	maxSystemdUnitContentLength = 16384
+
+	maxImagePullConfigs       = 16
+	maxImagePullAuthLength    = 4096
+	maxRegistryHostNameLength = 253
+
+	maxPrePullImages = 32
+	// maxImageNameLength is the maximum length of the name of image references, without the tag and digest
+	maxImageNameLength = 255
+)
+
+var (
+	imageGenerations  = []string{ImageGenerationGen1, ImageGenerationGen2}
+	sandboxRuntimes   = []string{SandboxRuntimeGVisor}
+	runtimeHandlers   = []string{RuntimeHandlerRunc, RuntimeHandlerRunsc}
+	migProfiles       = []string{MIGProfile1g, MIGProfile2g, MIGProfile3g, MIGProfile4g, MIGProfile7g}
+	gpuDriverVersions = []string{GPUDriverVersionCUDA470, GPUDriverVersionCUDA550, GPUDriverVersionGRID535}
+	entropySources    = []string{EntropySourceRngd, EntropySourceHaveged}
+	cgroupDrivers     = []string{CgroupDriverSystemd, CgroupDriverCgroupfs}
+	networkProfiles   = []string{NetworkProfileHighThroughput}
+	osDiskPlacements  = []string{EphemeralOSDiskPlacementCacheDisk, EphemeralOSDiskPlacementResourceDisk, EphemeralOSDiskPlacementNVMeDisk}
+	// allowedSysctls are the kernel parameters AKS allows customizing,
+	// see https://learn.microsoft.com/azure/aks/custom-node-configuration#linux-os-custom-configuration
+	// nf_conntrack_max is configured through conntrack instead.
+	allowedSysctls = []string{
+		"fs.aio-max-nr",
+		"fs.file-max",
+		"fs.inotify.max_user_watches",
+		"fs.nr_open",
+		"kernel.threads-max",
+		"net.core.netdev_max_backlog",
+		"net.core.optmem_max",
+		"net.core.rmem_default",
+		"net.core.rmem_max",
+		"net.core.somaxconn",
+		"net.core.wmem_default",
+		"net.core.wmem_max",
+		"net.ipv4.ip_local_port_range",
+		"net.ipv4.neigh.default.gc_thresh1",
+		"net.ipv4.neigh.default.gc_thresh2",
+		"net.ipv4.neigh.default.gc_thresh3",
+		"net.ipv4.tcp_fin_timeout",
+		"net.ipv4.tcp_keepalive_intvl",
+		"net.ipv4.tcp_keepalive_probes",
+		"net.ipv4.tcp_keepalive_time",
+		"net.ipv4.tcp_max_syn_backlog",
+		"net.ipv4.tcp_max_tw_buckets",
+		"net.ipv4.tcp_tw_reuse",
+		"net.netfilter.nf_conntrack_buckets",
+		"vm.max_map_count",
+		"vm.swappiness",
+		"vm.vfs_cache_pressure",
+	}
+
+	tcpCongestionControls = []string{TCPCongestionControlBBR, TCPCongestionControlCubic, TCPCongestionControlReno, TCPCongestionControlHTCP, TCPCongestionControlDCTCP}
+
+	registryRegex = regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]+)?$`)
+	// dnsDomainRegex matches DNS names of dot-separated labels, with an optional trailing dot
+	dnsDomainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`)
+	subnetIDRegex  = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Network/virtualNetworks/[^/]+/subnets/[^/]+$`)
+	// proximityPlacementGroupIDRegex matches the resource IDs of proximity placement groups
+	proximityPlacementGroupIDRegex = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/proximityPlacementGroups/[^/]+$`)
+	// absolutePathRegex matches absolute paths of characters which need no quoting in configuration files and scripts
+	absolutePathRegex = regexp.MustCompile(`^/[a-zA-Z0-9._/-]*$`)
+	// imageReferenceRegex matches image references of the distribution reference grammar: a name of an optional registry host
+	// and lowercase path components, with an optional tag and sha256 digest, capturing the name
+	imageReferenceRegex = regexp.MustCompile(`^((?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+		`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*)(?::[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+	// HostnameTemplateReferenceRegex matches the references of the hostname template, capturing the referenced field
+	// and the label key
+	HostnameTemplateReferenceRegex = regexp.MustCompile(`\{\{\s*\.(NodeClaim\.Name|NodeClaim\.Labels\.([^\s{}]+)|InstanceType|Zone)\s*\}\}`)
+	// hostnameTemplateTextRegex matches the text of hostname templates outside of references
+	hostnameTemplateTextRegex = regexp.MustCompile(`^[a-z0-9-]*$`)
+	// TagTemplateReferenceRegex matches the references of tag values to the NodeClaim metadata, capturing the referenced
+	// field (Name, Labels or Annotations) and the label or annotation key
+	TagTemplateReferenceRegex = regexp.MustCompile(`\{\{\s*\.NodeClaim\.(Name|Labels|Annotations)(?:\.([^\s{}]+))?\s*\}\}`)
+	// sysctlValueRegex matches the values of the allowed sysctls, which are all numeric
+	sysctlValueRegex = regexp.MustCompile(`^[0-9]+([ \t]+[0-9]+)*$`)
+	clientIDRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// systemdUnitNameRegex matches the file names of systemd units of the types node bootstrapping may write
+	systemdUnitNameRegex = regexp.MustCompile(`^[a-zA-Z0-9:_.@-]+\.(service|socket|timer|path|target)$`)
+	// reservedSystemdUnits are the units of the node bootstrapping, which systemd units must not override
+	reservedSystemdUnits = []string{"kubelet.service", "containerd.service", "spot-eviction-handler.service", "remove-startup-taints.service"}
+
+	// storageBlobEndpointRegex matches the blob endpoints of storage accounts, in any Azure cloud
+	storageBlobEndpointRegex = regexp.MustCompile(`^https://[a-z0-9]{3,24}\.blob\.[a-z0-9.-]+/?$`)
+)
+
+// Validate checks the AKSNodeClass spec independently of the instance type it is launched with,
+// mirroring the CRD validation for objects that did not go through the API server
+func (in *AKSNodeClass) Validate() error {
+	return multierr.Combine(
+		in.Spec.validateImage(),
+		in.Spec.validateTags(),
+		in.Spec.validateAnnotations(),
+		in.Spec.validateHostnameTemplate(),
+		in.Spec.validateNetwork(),
+		in.Spec.validateIdentities(),
+		in.Spec.validateBootDiagnostics(),
+		in.Spec.validateNodeSetup(),
+		in.Spec.validateAdditionalCAs(),
+		in.Spec.validateContainerdConfig(),
+		in.Spec.validateImagePullConfig(),
+		in.Spec.validatePrePullImages(),
+		in.Spec.validateLocalStorage(),
+		in.Spec.validateReadinessCommand(),
+		in.Spec.validateRegistration(),
+		in.Spec.validateSystemdUnits(),
+	)
+}
+
+func (in *AKSNodeClassSpec) validateImage() error {
+	var errs error
+	if in.ImageFamily != nil && !lo.Contains(ImageFamilies, *in.ImageFamily) {
+		errs = multierr.Append(errs, fmt.Errorf("imageFamily %q is not one of %s", *in.ImageFamily, strings.Join(ImageFamilies, ", ")))
+	}
+	if len(in.ImageSelector) > 0 && in.ImageVersion != nil {
+		errs = multierr.Append(errs, fmt.Errorf("imageSelector and imageVersion are mutually exclusive"))
+	}
+	if in.SharedImageGalleryID != nil && (len(in.ImageSelector) > 0 || in.ImageVersion != nil) {
+		errs = multierr.Append(errs, fmt.Errorf("sharedImageGalleryID is mutually exclusive with imageSelector and imageVersion"))
+	}
+	if in.ImageGeneration != nil && !lo.Contains(imageGenerations, *in.ImageGeneration) {
+		errs = multierr.Append(errs, fmt.Errorf("imageGeneration %q is not one of %s", *in.ImageGeneration, strings.Join(imageGenerations, ", ")))
+	}
+	if in.SharedImageGalleryID != nil && in.ImageGeneration != nil {
+		errs = multierr.Append(errs, fmt.Errorf("sharedImageGalleryID is mutually exclusive with imageGeneration"))
+	}
+	if _, ok := in.ImageSelector[""]; ok {
+		errs = multierr.Append(errs, fmt.Errorf("imageSelector keys must not be empty"))
+	}
+	if in.EphemeralOSDiskPlacement != nil && !lo.Contains(osDiskPlacements, *in.EphemeralOSDiskPlacement) {
+		errs = multierr.Append(errs, fmt.Errorf("ephemeralOSDiskPlacement %q is not one of %s", *in.EphemeralOSDiskPlacement, strings.Join(osDiskPlacements, ", ")))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateAdditionalCAs() error {
+	var errs error
+	for i, ca := range in.AdditionalCAs {
+		block, rest := pem.Decode([]byte(ca))
+		if block == nil || block.Type != "CERTIFICATE" || strings.TrimSpace(string(rest)) != "" {
+			errs = multierr.Append(errs, fmt.Errorf("additionalCAs[%d] is not a single PEM encoded certificate", i))
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("additionalCAs[%d] is not a valid certificate, %w", i, err))
+		}
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateTags() error {
+	var errs error
+	for k, v := range in.Tags {
+		switch {
+		case k == "":
+			errs = multierr.Append(errs, fmt.Errorf("tag keys must not be empty"))
+		case len(k) > maxTagKeyLength:
+			errs = multierr.Append(errs, fmt.Errorf("tag key %q is longer than %d characters", k, maxTagKeyLength))
+		case strings.ContainsAny(k, invalidTagKeyRunes):
+			errs = multierr.Append(errs, fmt.Errorf("tag key %q must not contain any of %s", k, invalidTagKeyRunes))
+		}
+		if len(v) > maxTagValueLength {
+			errs = multierr.Append(errs, fmt.Errorf("value of tag %q is longer than %d characters", k, maxTagValueLength))
+		}
+		if err := validateTagTemplate(v); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("value of tag %q, %w", k, err))
+		}
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateAnnotations() error {
+	var errs error
+	for k := range in.Annotations {
+		if msgs := validation.IsQualifiedName(k); len(msgs) > 0 {
+			errs = multierr.Append(errs, fmt.Errorf("annotation key %q is invalid, %s", k, strings.Join(msgs, "; ")))
+		}
+	}
+	return errs
+}
+
+// validateTagTemplate checks the references of a tag value to the NodeClaim metadata: the name, or a label or annotation key
+func validateTagTemplate(value string) error {
+	for _, match := range TagTemplateReferenceRegex.FindAllStringSubmatch(value, -1) {
+		if (match[1] == "Name") != (match[2] == "") {
+			return fmt.Errorf("%s is not a valid reference, only {{ .NodeClaim.Name }}, {{ .NodeClaim.Labels.<key> }} and {{ .NodeClaim.Annotations.<key> }} are supported", match[0])
+		}
+	}
+	if rest := TagTemplateReferenceRegex.ReplaceAllString(value, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf("%q has an invalid reference, only {{ .NodeClaim.Name }}, {{ .NodeClaim.Labels.<key> }} and {{ .NodeClaim.Annotations.<key> }} are supported", value)
+	}
+	return nil
+}
+
+// validateHostnameTemplate checks the references of the hostname template, and that the rest of it is made of characters
+// of RFC 1123 labels; whether the resolved hostname is a valid label is checked when launching
+func (in *AKSNodeClassSpec) validateHostnameTemplate() error {
+	if in.HostnameTemplate == nil {
+		return nil
+	}
+	var errs error
+	references := HostnameTemplateReferenceRegex.FindAllStringSubmatch(*in.HostnameTemplate, -1)
+	if !lo.ContainsBy(references, func(match []string) bool { return match[1] == "NodeClaim.Name" }) {
+		errs = multierr.Append(errs, fmt.Errorf("hostnameTemplate %q does not reference {{ .NodeClaim.Name }}, which keeps hostnames unique", *in.HostnameTemplate))
+	}
+	for _, match := range references {
+		if match[2] == "" {
+			continue
+		}
+		if msgs := validation.IsQualifiedName(match[2]); len(msgs) > 0 {
+			errs = multierr.Append(errs, fmt.Errorf("hostnameTemplate references label key %q, which is invalid, %s", match[2], strings.Join(msgs, "; ")))
+		}
+	}
+	if rest := HostnameTemplateReferenceRegex.ReplaceAllString(*in.HostnameTemplate, ""); !hostnameTemplateTextRegex.MatchString(rest) {
+		errs = multierr.Append(errs, fmt.Errorf("hostnameTemplate %q has characters other than lowercase alphanumerics and '-' outside of references, "+
+			"only {{ .NodeClaim.Name }}, {{ .NodeClaim.Labels.<key> }}, {{ .InstanceType }} and {{ .Zone }} are supported", *in.HostnameTemplate))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateNetwork() error {
+	var errs error
+	if in.MTU != nil && (*in.MTU < minMTU || *in.MTU > maxMTU) {
+		errs = multierr.Append(errs, fmt.Errorf("mtu %d is not between %d and %d", *in.MTU, minMTU, maxMTU))
+	}
+	if in.MaxPods != nil && (*in.MaxPods < minMaxPods || *in.MaxPods > maxMaxPods) {
+		errs = multierr.Append(errs, fmt.Errorf("maxPods %d is not between %d and %d", *in.MaxPods, minMaxPods, maxMaxPods))
+	}
+	if in.NetworkProfile != nil && !lo.Contains(networkProfiles, in.NetworkProfile.Name) {
+		errs = multierr.Append(errs, fmt.Errorf("networkProfile name %q is not one of %s", in.NetworkProfile.Name, strings.Join(networkProfiles, ", ")))
+	}
+	if in.TCPCongestionControl != nil && !lo.Contains(tcpCongestionControls, *in.TCPCongestionControl) {
+		errs = multierr.Append(errs, fmt.Errorf("tcpCongestionControl %q is not one of %s", *in.TCPCongestionControl, strings.Join(tcpCongestionControls, ", ")))
+	}
+	if len(in.DNSServers) > maxDNSServers {
+		errs = multierr.Append(errs, fmt.Errorf("dnsServers has %d entries, more than the maximum of %d", len(in.DNSServers), maxDNSServers))
+	}
+	for _, server := range in.DNSServers {
+		if net.ParseIP(server) == nil {
+			errs = multierr.Append(errs, fmt.Errorf("dnsServers entry %q is not an IP address", server))
+		}
+	}
+	if len(in.DNSSearchDomains) > maxDNSSearchDomains {
+		errs = multierr.Append(errs, fmt.Errorf("dnsSearchDomains has %d entries, more than the maximum of %d", len(in.DNSSearchDomains), maxDNSSearchDomains))
+	}
+	if in.ProximityPlacementGroupID != nil && !proximityPlacementGroupIDRegex.MatchString(*in.ProximityPlacementGroupID) {
+		errs = multierr.Append(errs, fmt.Errorf("proximityPlacementGroupID %q is not a proximity placement group resource ID", *in.ProximityPlacementGroupID))
+	}
+	for _, domain := range in.DNSSearchDomains {
+		if len(domain) > maxDNSDomainLength || !dnsDomainRegex.MatchString(domain) {
+			errs = multierr.Append(errs, fmt.Errorf("dnsSearchDomains entry %q is not a DNS domain", domain))
+		}
+	}
+	for key, value := range in.GetSysctls() {
+		if !lo.Contains(allowedSysctls, key) {
+			errs = multierr.Append(errs, fmt.Errorf("linuxConfig sysctl %q is not allowed, only %s", key, strings.Join(allowedSysctls, ", ")))
+		} else if !sysctlValueRegex.MatchString(value) {
+			errs = multierr.Append(errs, fmt.Errorf("linuxConfig sysctl %s value %q is not one or more whitespace-separated numbers", key, value))
+		}
+	}
+	if len(in.FallbackSubnetIDs) > maxFallbackSubnetIDs {
+		errs = multierr.Append(errs, fmt.Errorf("fallbackSubnetIDs has %d entries, more than the maximum of %d", len(in.FallbackSubnetIDs), maxFallbackSubnetIDs))
+	}
+	for _, subnetID := range in.FallbackSubnetIDs {
+		if !subnetIDRegex.MatchString(subnetID) {
+			errs = multierr.Append(errs, fmt.Errorf("fallbackSubnetIDs entry %q is not a subnet resource ID", subnetID))
+		}
+	}
+	if in.APIServerName != nil {
+		errs = multierr.Append(errs, validateAPIServerName(*in.APIServerName))
+	}
+	return errs
+}
+
+// validateAPIServerName checks the API server name is a host name or IPv4 address, with an optional port
+func validateAPIServerName(apiServerName string) error {
+	if strings.Contains(apiServerName, "/") {
+		return fmt.Errorf("apiServerName %q is not a host with an optional port", apiServerName)
+	}
+	host := apiServerName
+	if strings.Contains(apiServerName, ":") {
+		var port string
+		var err error
+		if host, port, err = net.SplitHostPort(apiServerName); err != nil {
+			return fmt.Errorf("apiServerName %q is not a host with an optional port", apiServerName)
+		}
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber < minAPIServerPort || portNumber > maxAPIServerPort {
+			return fmt.Errorf("apiServerName port %q is not between %d and %d", port, minAPIServerPort, maxAPIServerPort)
+		}
+	}
+	if len(host) > maxDNSDomainLength || strings.HasSuffix(host, ".") || !dnsDomainRegex.MatchString(host) {
+		return fmt.Errorf("apiServerName host %q is not a host name or IPv4 address", host)
+	}
+	return nil
+}
+
+func (in *AKSNodeClassSpec) validateIdentities() error {
+	var errs error
+	if len(in.NodeIdentities) > maxNodeIdentities {
+		errs = multierr.Append(errs, fmt.Errorf("nodeIdentities has %d entries, more than the maximum of %d", len(in.NodeIdentities), maxNodeIdentities))
+	}
+	if in.KubeletIdentity != nil {
+		if !clientIDRegex.MatchString(in.KubeletIdentity.ClientID) {
+			errs = multierr.Append(errs, fmt.Errorf("kubeletIdentity clientID %q is not a GUID", in.KubeletIdentity.ClientID))
+		}
+		if in.KubeletIdentity.ResourceID == "" {
+			errs = multierr.Append(errs, fmt.Errorf("kubeletIdentity resourceID must not be empty"))
+		}
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateBootDiagnostics() error {
+	if in.BootDiagnostics == nil || in.BootDiagnostics.StorageURI == nil {
+		return nil
+	}
+	var errs error
+	if !storageBlobEndpointRegex.MatchString(*in.BootDiagnostics.StorageURI) {
+		errs = multierr.Append(errs, fmt.Errorf("bootDiagnostics storageURI %q is not the https blob endpoint of a storage account", *in.BootDiagnostics.StorageURI))
+	}
+	if !lo.FromPtrOr(in.BootDiagnostics.Enabled, true) {
+		errs = multierr.Append(errs, fmt.Errorf("bootDiagnostics storageURI is set, but boot diagnostics are disabled"))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateNodeSetup() error {
+	var errs error
+	if in.SandboxRuntime != nil && !lo.Contains(sandboxRuntimes, *in.SandboxRuntime) {
+		errs = multierr.Append(errs, fmt.Errorf("sandboxRuntime %q is not one of %s", *in.SandboxRuntime, strings.Join(sandboxRuntimes, ", ")))
+	}
+	if migProfile := in.GetGPUMIGProfile(); migProfile != "" && !lo.Contains(migProfiles, migProfile) {
+		errs = multierr.Append(errs, fmt.Errorf("gpu migProfile %q is not one of %s", migProfile, strings.Join(migProfiles, ", ")))
+	}
+	if driverVersion := in.GetGPUDriverVersion(); driverVersion != "" && !lo.Contains(gpuDriverVersions, driverVersion) {
+		errs = multierr.Append(errs, fmt.Errorf("gpu driverVersion %q is not one of %s", driverVersion, strings.Join(gpuDriverVersions, ", ")))
+	}
+	if defaultHandler := in.GetDefaultRuntimeHandler(); defaultHandler != "" {
+		if !lo.Contains(runtimeHandlers, defaultHandler) {
+			errs = multierr.Append(errs, fmt.Errorf("runtimeHandlers default %q is not one of %s", defaultHandler, strings.Join(runtimeHandlers, ", ")))
+		} else if !lo.Contains(in.GetRuntimeHandlers(), defaultHandler) {
+			errs = multierr.Append(errs, fmt.Errorf("runtimeHandlers default %q is not registered on the node, it requires the gvisor sandboxRuntime", defaultHandler))
+		}
+	}
+	if in.EntropySource != nil && !lo.Contains(entropySources, *in.EntropySource) {
+		errs = multierr.Append(errs, fmt.Errorf("entropySource %q is not one of %s", *in.EntropySource, strings.Join(entropySources, ", ")))
+	}
+	for daemon, oomScoreAdj := range in.GetOOMScoreAdj() {
+		if oomScoreAdj < minOOMScoreAdj || oomScoreAdj > maxOOMScoreAdj {
+			errs = multierr.Append(errs, fmt.Errorf("oomScoreAdj %s %d is not between %d and %d", daemon, oomScoreAdj, minOOMScoreAdj, maxOOMScoreAdj))
+		}
+	}
+	for name := range in.GetKubeletFeatureGates() {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "=,") {
+			errs = multierr.Append(errs, fmt.Errorf("kubelet featureGates name %q must be non-empty and must not contain '=' or ','", name))
+		}
+	}
+	if in.Kubelet != nil && in.Kubelet.CgroupDriver != nil && !lo.Contains(cgroupDrivers, *in.Kubelet.CgroupDriver) {
+		errs = multierr.Append(errs, fmt.Errorf("kubelet cgroupDriver %q is not one of %s", *in.Kubelet.CgroupDriver, strings.Join(cgroupDrivers, ", ")))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateContainerdConfig() error {
+	if in.ContainerdConfig == nil {
+		return nil
+	}
+	var errs error
+	for _, mirror := range in.ContainerdConfig.RegistryMirrors {
+		if !registryRegex.MatchString(mirror.Registry) {
+			errs = multierr.Append(errs, fmt.Errorf("registry mirror registry %q is not a host", mirror.Registry))
+		}
+		if len(mirror.Endpoints) == 0 {
+			errs = multierr.Append(errs, fmt.Errorf("registry mirror of %q has no endpoints", mirror.Registry))
+		}
+		for _, endpoint := range mirror.Endpoints {
+			u, err := url.Parse(endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = multierr.Append(errs, fmt.Errorf("registry mirror endpoint %q of %q is not an http(s) URL", endpoint, mirror.Registry))
+			}
+		}
+	}
+	errs = multierr.Append(errs, validateCNIDir("cniBinDir", in.ContainerdConfig.CNIBinDir))
+	errs = multierr.Append(errs, validateCNIDir("cniConfDir", in.ContainerdConfig.CNIConfDir))
+	if downloads := in.ContainerdConfig.MaxConcurrentDownloads; downloads != nil && *downloads < 1 {
+		errs = multierr.Append(errs, fmt.Errorf("containerdConfig maxConcurrentDownloads %d is not positive", *downloads))
+	}
+	return errs
+}
+
+func validateCNIDir(name string, dir *string) error {
+	if dir != nil && (!absolutePathRegex.MatchString(*dir) || path.Clean(*dir) != *dir) {
+		return fmt.Errorf("containerdConfig %s %q is not a clean absolute path", name, *dir)
+	}
+	return nil
+}
+
+func (in *AKSNodeClassSpec) validateLocalStorage() error {
+	if in.LocalStorage == nil || in.LocalStorage.DiscoveryPath == nil {
+		return nil
+	}
+	if dir := *in.LocalStorage.DiscoveryPath; !absolutePathRegex.MatchString(dir) || path.Clean(dir) != dir || dir == "/" {
+		return fmt.Errorf("localStorage discoveryPath %q is not a clean absolute path other than /", dir)
+	}
+	return nil
+}
+
+func (in *AKSNodeClassSpec) validateReadinessCommand() error {
+	if in.ReadinessCommand == nil {
+		return nil
+	}
+	var errs error
+	switch command := in.ReadinessCommand.Command; {
+	case strings.TrimSpace(command) == "":
+		errs = multierr.Append(errs, fmt.Errorf("readinessCommand command must not be empty"))
+	case len(command) > maxReadinessCommandLength:
+		errs = multierr.Append(errs, fmt.Errorf("readinessCommand command is longer than %d characters", maxReadinessCommandLength))
+	case strings.ContainsRune(command, 0):
+		errs = multierr.Append(errs, fmt.Errorf("readinessCommand command must not contain NUL characters"))
+	}
+	if timeout := in.ReadinessCommand.TimeoutSeconds; timeout != nil && (*timeout < minReadinessCommandTimeoutSeconds || *timeout > maxReadinessCommandTimeoutSeconds) {
+		errs = multierr.Append(errs, fmt.Errorf("readinessCommand timeoutSeconds %d is not between %d and %d", *timeout, minReadinessCommandTimeoutSeconds, maxReadinessCommandTimeoutSeconds))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateRegistration() error {
+	if in.Registration == nil {
+		return nil
+	}
+	var errs error
+	if timeout := in.Registration.TimeoutSeconds; timeout != nil && (*timeout < minRegistrationTimeoutSeconds || *timeout > maxRegistrationTimeoutSeconds) {
+		errs = multierr.Append(errs, fmt.Errorf("registration timeoutSeconds %d is not between %d and %d", *timeout, minRegistrationTimeoutSeconds, maxRegistrationTimeoutSeconds))
+	}
+	if retries := in.Registration.RetryCount; retries != nil && (*retries < minRegistrationRetryCount || *retries > maxRegistrationRetryCount) {
+		errs = multierr.Append(errs, fmt.Errorf("registration retryCount %d is not between %d and %d", *retries, minRegistrationRetryCount, maxRegistrationRetryCount))
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validateSystemdUnits() error {
+	var errs error
+	if len(in.SystemdUnits) > maxSystemdUnits {
+		errs = multierr.Append(errs, fmt.Errorf("systemdUnits has %d units, more than the maximum of %d", len(in.SystemdUnits), maxSystemdUnits))
+	}
+	names := map[string]bool{}
+	for _, unit := range in.SystemdUnits {
+		switch {
+		case len(unit.Name) > maxSystemdUnitNameLength || !systemdUnitNameRegex.MatchString(unit.Name):
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits name %q is not a service, socket, timer, path or target unit name", unit.Name))
+		case lo.Contains(reservedSystemdUnits, unit.Name):
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits name %q is a unit of node bootstrapping", unit.Name))
+		case names[unit.Name]:
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits name %q is duplicated", unit.Name))
+		}
+		names[unit.Name] = true
+		switch {
+		case strings.TrimSpace(unit.Content) == "":
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits content of %q must not be empty", unit.Name))
+		case len(unit.Content) > maxSystemdUnitContentLength:
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits content of %q is longer than %d characters", unit.Name, maxSystemdUnitContentLength))
+		case strings.ContainsRune(unit.Content, 0):
+			errs = multierr.Append(errs, fmt.Errorf("systemdUnits content of %q must not contain NUL characters", unit.Name))
+		}
+	}
+	return errs
+}
+
+// validateImagePullConfig checks the registries and credentials of the image pull configuration; errors never include
+// the credentials themselves
+func (in *AKSNodeClassSpec) validateImagePullConfig() error {
+	var errs error
+	if len(in.ImagePullConfig) > maxImagePullConfigs {
+		errs = multierr.Append(errs, fmt.Errorf("imagePullConfig has %d registries, more than the maximum of %d", len(in.ImagePullConfig), maxImagePullConfigs))
+	}
+	registries := map[string]bool{}
+	for _, config := range in.ImagePullConfig {
+		switch {
+		case !isRegistryHost(config.Registry):
+			errs = multierr.Append(errs, fmt.Errorf("imagePullConfig registry %q is not a host name with an optional port", config.Registry))
+		case registries[config.Registry]:
+			errs = multierr.Append(errs, fmt.Errorf("imagePullConfig registry %q is duplicated", config.Registry))
+		}
+		registries[config.Registry] = true
+		if len(config.Auth) > maxImagePullAuthLength {
+			errs = multierr.Append(errs, fmt.Errorf("imagePullConfig auth of %q is longer than %d characters", config.Registry, maxImagePullAuthLength))
+			continue
+		}
+		credentials, err := base64.StdEncoding.DecodeString(config.Auth)
+		if username, _, ok := strings.Cut(string(credentials), ":"); err != nil || !ok || username == "" {
+			errs = multierr.Append(errs, fmt.Errorf("imagePullConfig auth of %q is not a base64 encoded username:password", config.Registry))
+		}
+	}
+	return errs
+}
+
+func (in *AKSNodeClassSpec) validatePrePullImages() error {
+	var errs error
+	if len(in.PrePullImages) > maxPrePullImages {
+		errs = multierr.Append(errs, fmt.Errorf("prePullImages has %d images, more than the maximum of %d", len(in.PrePullImages), maxPrePullImages))
+	}
+	images := map[string]bool{}
+	for _, image := range in.PrePullImages {
+		match := imageReferenceRegex.FindStringSubmatch(image)
+		switch {
+		case match == nil:
+			errs = multierr.Append(errs, fmt.Errorf("prePullImages image %q is not a valid image reference", image))
+		case len(match[1]) > maxImageNameLength:
+			errs = multierr.Append(errs, fmt.Errorf("prePullImages image %q has a name longer than %d characters", image, maxImageNameLength))
+		case images[image]:
+			errs = multierr.Append(errs, fmt.Errorf("prePullImages image %q is duplicated", image))
+		}
+		images[image] = true
+	}
+	if in.PrePullImagesInBackground != nil && len(in.PrePullImages) == 0 {
+		errs = multierr.Append(errs, fmt.Errorf("prePullImagesInBackground is set, but there are no prePullImages"))
+	}
+	return errs
+}
+
+// isRegistryHost returns whether the registry is a DNS name or IPv4 address, with an optional port
+func isRegistryHost(registry string) bool {
+	host, port := registry, ""
+	if i := strings.LastIndex(registry, ":"); i >= 0 {
+		host, port = registry[:i], registry[i+1:]
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return false
+		}
+	}
+	return len(host) <= maxRegistryHostNameLength && !strings.HasSuffix(host, ".") && dnsDomainRegex.MatchString(host)
+}
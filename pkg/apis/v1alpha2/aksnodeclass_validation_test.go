@@ -0,0 +1,338 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+// testCA is a self-signed CA certificate
+const testCA = `-----BEGIN CERTIFICATE-----
+MIIBjTCCATOgAwIBAgIUOvXpWBY/fQNYiIVvJ3ifmWwORiUwCgYIKoZIzj0EAwIw
+GzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTAgFw0yNjEwMTQxNTUzNDVaGA8y
+MTI2MDkyMDE1NTM0NVowGzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTBZMBMG
+ByqGSM49AgEGCCqGSM49AwEHA0IABF3oQJQ84Is34S6pq5geRZgGlpOrTgRg7P8n
+hvlNFCtYDeH7EI5zgoAxRMGp/+ILPo08v2wSUBrdxPEa+AMsH9ejUzBRMB0GA1Ud
+DgQWBBSaqkZWlhj9Ff73G2fXFG+xpN77MzAfBgNVHSMEGDAWgBSaqkZWlhj9Ff73
+G2fXFG+xpN77MzAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCIQDy
+25z+n1qmkFFg1taG5EviqA4ThRMJTs8W20C+QQJ9KgIgGCrryOXiFz9YQ/5JrumK
+fU91JhEvQB21twyI7M6djdQ=
+-----END CERTIFICATE-----`
+
+var _ = Describe("AKSNodeClass Validate", func() {
+	var nodeClass *v1alpha2.AKSNodeClass
+
+	BeforeEach(func() {
+		nodeClass = &v1alpha2.AKSNodeClass{
+			Spec: v1alpha2.AKSNodeClassSpec{
+				ImageFamily:       lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily),
+				ImageVersion:      lo.ToPtr("202405.27.0"),
+				ImageGeneration:   lo.ToPtr(v1alpha2.ImageGenerationGen2),
+				Tags:              map[string]string{"team": "platform"},
+				MTU:               lo.ToPtr(int32(1500)),
+				NetworkProfile:    &v1alpha2.NetworkProfile{Name: v1alpha2.NetworkProfileHighThroughput},
+				DNSServers:        []string{"10.1.0.4", "fd00::53"},
+				DNSSearchDomains:  []string{"corp.example.com", "example.com."},
+				APIServerName:     lo.ToPtr("api.internal.example.com:6443"),
+				FallbackSubnetIDs: []string{"/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet/subnets/fallback"},
+				KubeletIdentity: &v1alpha2.KubeletIdentity{
+					ClientID:   "11111111-2222-3333-4444-555555555555",
+					ResourceID: "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet",
+				},
+				GPU:                  &v1alpha2.GPU{MIGProfile: lo.ToPtr(v1alpha2.MIGProfile3g)},
+				SandboxRuntime:       lo.ToPtr(v1alpha2.SandboxRuntimeGVisor),
+				RuntimeHandlers:      &v1alpha2.RuntimeHandlers{Default: lo.ToPtr(v1alpha2.RuntimeHandlerRunsc), Labels: lo.ToPtr(true)},
+				EntropySource:        lo.ToPtr(v1alpha2.EntropySourceRngd),
+				TCPCongestionControl: lo.ToPtr(v1alpha2.TCPCongestionControlBBR),
+				ContainerdConfig: &v1alpha2.ContainerdConfig{
+					RegistryMirrors:        []v1alpha2.RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com"}}},
+					CNIBinDir:              lo.ToPtr("/opt/custom-cni/bin"),
+					CNIConfDir:             lo.ToPtr("/etc/custom-cni/net.d"),
+					MaxConcurrentDownloads: lo.ToPtr(int32(10)),
+				},
+				LocalStorage:     &v1alpha2.LocalStorage{DiscoveryPath: lo.ToPtr("/mnt/local-disks")},
+				OOMScoreAdj:      &v1alpha2.OOMScoreAdj{Kubelet: lo.ToPtr(int32(-999)), Containerd: lo.ToPtr(int32(-1000))},
+				LinuxConfig:      &v1alpha2.LinuxConfig{Sysctls: map[string]string{"net.core.somaxconn": "16384", "net.ipv4.ip_local_port_range": "1024 65000"}},
+				Kubelet:          &v1alpha2.Kubelet{FeatureGates: map[string]bool{"InPlacePodVerticalScaling": true, "KubeletTracing": false}, CgroupDriver: lo.ToPtr(v1alpha2.CgroupDriverSystemd)},
+				ReadinessCommand: &v1alpha2.ReadinessCommand{Command: "systemctl is-active kubelet", TimeoutSeconds: lo.ToPtr(int32(60))},
+				Registration:     &v1alpha2.Registration{TimeoutSeconds: lo.ToPtr(int32(600)), RetryCount: lo.ToPtr(int32(3))},
+				AdditionalCAs:    []string{testCA},
+				SystemdUnits: []v1alpha2.SystemdUnit{
+					{Name: "node-health-agent.service", Content: "[Service]\nExecStart=/usr/local/bin/node-health-agent\n"},
+					{Name: "node-health-agent@check.timer", Content: "[Timer]\nOnCalendar=hourly\n", Enabled: lo.ToPtr(false)},
+				},
+				HostnameTemplate: lo.ToPtr("{{ .NodeClaim.Labels.team }}-{{ .InstanceType }}-{{ .Zone }}-{{ .NodeClaim.Name }}"),
+				BootDiagnostics:  &v1alpha2.BootDiagnostics{StorageURI: lo.ToPtr("https://diagnostics.blob.core.usgovcloudapi.net/")},
+				ImagePullConfig: []v1alpha2.ImagePullConfig{
+					{Registry: "registry.example.com:5000", Auth: "cHVsbGVyOnMzY3IzdA=="},
+					{Registry: "10.0.0.4", Auth: "cHVsbGVyOnMzY3IzdA=="},
+				},
+				PrePullImages: []string{"registry.example.com:5000/team/agent:v1.2.3", "nginx@sha256:" + strings.Repeat("a", 64)},
+			},
+		}
+	})
+
+	It("should accept a valid spec", func() {
+		Expect(nodeClass.Validate()).To(Succeed())
+	})
+
+	It("should accept an empty spec", func() {
+		Expect((&v1alpha2.AKSNodeClass{}).Validate()).To(Succeed())
+	})
+
+	DescribeTable("should reject an invalid spec",
+		func(mutate func(*v1alpha2.AKSNodeClassSpec), expectedErr string) {
+			mutate(&nodeClass.Spec)
+			Expect(nodeClass.Validate()).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("unknown image family", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImageFamily = lo.ToPtr("Windows2022") },
+			`imageFamily "Windows2022" is not one of Ubuntu2204, AzureLinux`),
+		Entry("image selector with image version", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImageSelector = map[string]string{"tier": "hardened"} },
+			"imageSelector and imageVersion are mutually exclusive"),
+		Entry("shared image gallery image with image version", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.SharedImageGalleryID = lo.ToPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/g/images/i")
+		},
+			"sharedImageGalleryID is mutually exclusive with imageSelector and imageVersion"),
+		Entry("unknown image generation", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImageGeneration = lo.ToPtr("Gen3") },
+			`imageGeneration "Gen3" is not one of Gen1, Gen2`),
+		Entry("shared image gallery image with image generation", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ImageVersion = nil
+			spec.SharedImageGalleryID = lo.ToPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/g/images/i")
+		},
+			"sharedImageGalleryID is mutually exclusive with imageGeneration"),
+		Entry("unknown ephemeral OS disk placement", func(spec *v1alpha2.AKSNodeClassSpec) { spec.EphemeralOSDiskPlacement = lo.ToPtr("TempDisk") },
+			`ephemeralOSDiskPlacement "TempDisk" is not one of CacheDisk, ResourceDisk, NvmeDisk`),
+		Entry("annotation key with invalid characters", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.Annotations = map[string]string{"example.com/team name": "value"}
+		},
+			`annotation key "example.com/team name" is invalid`),
+		Entry("empty tag key", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags[""] = "value" },
+			"tag keys must not be empty"),
+		Entry("tag key with invalid characters", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags["team/name"] = "value" },
+			`tag key "team/name" must not contain any of`),
+		Entry("tag key too long", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags[strings.Repeat("k", 513)] = "value" },
+			"is longer than 512 characters"),
+		Entry("tag value too long", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags["team"] = strings.Repeat("v", 257) },
+			`value of tag "team" is longer than 256 characters`),
+		Entry("tag value referencing an unknown field", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags["team"] = "{{ .NodeClaim.Namespace }}" },
+			`value of tag "team", "{{ .NodeClaim.Namespace }}" has an invalid reference`),
+		Entry("tag value referencing labels without a key", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Tags["team"] = "{{ .NodeClaim.Labels }}" },
+			`value of tag "team", {{ .NodeClaim.Labels }} is not a valid reference`),
+		Entry("mtu out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.MTU = lo.ToPtr(int32(576)) },
+			"mtu 576 is not between 1280 and 3900"),
+		Entry("mtu above the Azure maximum", func(spec *v1alpha2.AKSNodeClassSpec) { spec.MTU = lo.ToPtr(int32(9000)) },
+			"mtu 9000 is not between 1280 and 3900"),
+		Entry("maxPods out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.MaxPods = lo.ToPtr(int32(300)) },
+			"maxPods 300 is not between 10 and 250"),
+		Entry("unknown network profile", func(spec *v1alpha2.AKSNodeClassSpec) { spec.NetworkProfile.Name = "low-latency" },
+			`networkProfile name "low-latency" is not one of high-throughput`),
+		Entry("disallowed sysctl", func(spec *v1alpha2.AKSNodeClassSpec) { spec.LinuxConfig.Sysctls["kernel.panic"] = "10" },
+			`linuxConfig sysctl "kernel.panic" is not allowed, only fs.aio-max-nr, `),
+		Entry("non-numeric sysctl value", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.LinuxConfig.Sysctls["vm.swappiness"] = "10\nkernel.panic=10"
+		}, `linuxConfig sysctl vm.swappiness value "10\nkernel.panic=10" is not one or more whitespace-separated numbers`),
+		Entry("DNS server not an IP", func(spec *v1alpha2.AKSNodeClassSpec) { spec.DNSServers = []string{"10.1.0.4", "dns.example.com"} },
+			`dnsServers entry "dns.example.com" is not an IP address`),
+		Entry("DNS server with a port", func(spec *v1alpha2.AKSNodeClassSpec) { spec.DNSServers = []string{"10.1.0.4:53"} },
+			`dnsServers entry "10.1.0.4:53" is not an IP address`),
+		Entry("too many DNS servers", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.DNSServers = []string{"10.1.0.4", "10.1.0.5", "10.1.0.6", "10.1.0.7"}
+		},
+			"dnsServers has 4 entries, more than the maximum of 3"),
+		Entry("DNS search domain not a domain", func(spec *v1alpha2.AKSNodeClassSpec) { spec.DNSSearchDomains = []string{"corp_example.com"} },
+			`dnsSearchDomains entry "corp_example.com" is not a DNS domain`),
+		Entry("too many DNS search domains", func(spec *v1alpha2.AKSNodeClassSpec) { spec.DNSSearchDomains = make([]string, 7) },
+			"dnsSearchDomains has 7 entries, more than the maximum of 6"),
+		Entry("fallback subnet ID not a subnet", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.FallbackSubnetIDs = []string{"/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet"}
+		}, `fallbackSubnetIDs entry "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet" is not a subnet resource ID`),
+		Entry("too many fallback subnets", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.FallbackSubnetIDs = lo.Times(9, func(i int) string { return spec.FallbackSubnetIDs[0] })
+		}, "fallbackSubnetIDs has 9 entries, more than the maximum of 8"),
+		Entry("API server name with a scheme", func(spec *v1alpha2.AKSNodeClassSpec) { spec.APIServerName = lo.ToPtr("https://api.example.com") },
+			`apiServerName "https://api.example.com" is not a host with an optional port`),
+		Entry("API server name with a port out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.APIServerName = lo.ToPtr("api.example.com:65536") },
+			`apiServerName port "65536" is not between 1 and 65535`),
+		Entry("API server name with port 0", func(spec *v1alpha2.AKSNodeClassSpec) { spec.APIServerName = lo.ToPtr("api.example.com:0") },
+			`apiServerName port "0" is not between 1 and 65535`),
+		Entry("API server name not a host", func(spec *v1alpha2.AKSNodeClassSpec) { spec.APIServerName = lo.ToPtr("api_server:6443") },
+			`apiServerName host "api_server" is not a host name or IPv4 address`),
+		Entry("kubelet identity client ID not a GUID", func(spec *v1alpha2.AKSNodeClassSpec) { spec.KubeletIdentity.ClientID = "kubelet" },
+			`kubeletIdentity clientID "kubelet" is not a GUID`),
+		Entry("too many node identities", func(spec *v1alpha2.AKSNodeClassSpec) { spec.NodeIdentities = make([]string, 33) },
+			"nodeIdentities has 33 entries, more than the maximum of 32"),
+		Entry("unknown sandbox runtime", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SandboxRuntime = lo.ToPtr("kata") },
+			`sandboxRuntime "kata" is not one of gvisor`),
+		Entry("unknown MIG profile", func(spec *v1alpha2.AKSNodeClassSpec) { spec.GPU.MIGProfile = lo.ToPtr("MIG5g") },
+			`gpu migProfile "MIG5g" is not one of MIG1g, MIG2g, MIG3g, MIG4g, MIG7g`),
+		Entry("unknown GPU driver version", func(spec *v1alpha2.AKSNodeClassSpec) { spec.GPU.DriverVersion = lo.ToPtr("cuda-535") },
+			`gpu driverVersion "cuda-535" is not one of cuda-470.82.01, cuda-550.54.15, grid-535.161.08`),
+		Entry("unknown default runtime handler", func(spec *v1alpha2.AKSNodeClassSpec) { spec.RuntimeHandlers.Default = lo.ToPtr("kata") },
+			`runtimeHandlers default "kata" is not one of runc, runsc`),
+		Entry("default runtime handler without its sandbox runtime", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SandboxRuntime = nil },
+			`runtimeHandlers default "runsc" is not registered on the node, it requires the gvisor sandboxRuntime`),
+		Entry("unknown entropy source", func(spec *v1alpha2.AKSNodeClassSpec) { spec.EntropySource = lo.ToPtr("jitterentropy") },
+			`entropySource "jitterentropy" is not one of rngd, haveged`),
+		Entry("unknown tcp congestion control", func(spec *v1alpha2.AKSNodeClassSpec) { spec.TCPCongestionControl = lo.ToPtr("vegas") },
+			`tcpCongestionControl "vegas" is not one of bbr, cubic, reno, htcp, dctcp`),
+		Entry("additional CA that is not PEM", func(spec *v1alpha2.AKSNodeClassSpec) { spec.AdditionalCAs[0] = "not a certificate" },
+			"additionalCAs[0] is not a single PEM encoded certificate"),
+		Entry("additional CA that is a private key", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.AdditionalCAs[0] = strings.Replace(testCA, "CERTIFICATE", "PRIVATE KEY", 2)
+		}, "additionalCAs[0] is not a single PEM encoded certificate"),
+		Entry("additional CA bundling several certificates", func(spec *v1alpha2.AKSNodeClassSpec) { spec.AdditionalCAs[0] = testCA + "\n" + testCA },
+			"additionalCAs[0] is not a single PEM encoded certificate"),
+		Entry("additional CA with a corrupt certificate", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.AdditionalCAs[0] = "-----BEGIN CERTIFICATE-----\nMIIBjTCCATOgAwIBAgIU\n-----END CERTIFICATE-----"
+		}, "additionalCAs[0] is not a valid certificate"),
+		Entry("registry mirror registry with a scheme", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.RegistryMirrors[0].Registry = "https://docker.io"
+		}, `registry mirror registry "https://docker.io" is not a host`),
+		Entry("registry mirror without endpoints", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.RegistryMirrors[0].Endpoints = nil
+		}, `registry mirror of "docker.io" has no endpoints`),
+		Entry("registry mirror endpoint without a scheme", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.RegistryMirrors[0].Endpoints = []string{"mirror.example.com"}
+		}, `registry mirror endpoint "mirror.example.com" of "docker.io" is not an http(s) URL`),
+		Entry("registry mirror endpoint with an unsupported scheme", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.RegistryMirrors[0].Endpoints = []string{"ftp://mirror.example.com"}
+		}, `registry mirror endpoint "ftp://mirror.example.com" of "docker.io" is not an http(s) URL`),
+		Entry("zero max concurrent downloads", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.MaxConcurrentDownloads = lo.ToPtr(int32(0))
+		},
+			"containerdConfig maxConcurrentDownloads 0 is not positive"),
+		Entry("relative CNI bin dir", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ContainerdConfig.CNIBinDir = lo.ToPtr("opt/cni/bin") },
+			`containerdConfig cniBinDir "opt/cni/bin" is not a clean absolute path`),
+		Entry("CNI conf dir with a parent reference", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ContainerdConfig.CNIConfDir = lo.ToPtr("/etc/cni/../net.d")
+		},
+			`containerdConfig cniConfDir "/etc/cni/../net.d" is not a clean absolute path`),
+		Entry("CNI conf dir with a quote", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ContainerdConfig.CNIConfDir = lo.ToPtr(`/etc/cni"`) },
+			`containerdConfig cniConfDir "/etc/cni\"" is not a clean absolute path`),
+		Entry("relative local storage discovery path", func(spec *v1alpha2.AKSNodeClassSpec) { spec.LocalStorage.DiscoveryPath = lo.ToPtr("mnt/disks") },
+			`localStorage discoveryPath "mnt/disks" is not a clean absolute path other than /`),
+		Entry("root local storage discovery path", func(spec *v1alpha2.AKSNodeClassSpec) { spec.LocalStorage.DiscoveryPath = lo.ToPtr("/") },
+			`localStorage discoveryPath "/" is not a clean absolute path other than /`),
+		Entry("kubelet OOM score adjustment out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.OOMScoreAdj.Kubelet = lo.ToPtr(int32(-1001)) },
+			"oomScoreAdj kubelet -1001 is not between -1000 and 1000"),
+		Entry("containerd OOM score adjustment out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.OOMScoreAdj.Containerd = lo.ToPtr(int32(1001)) },
+			"oomScoreAdj containerd 1001 is not between -1000 and 1000"),
+		Entry("empty kubelet feature gate name", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Kubelet.FeatureGates[""] = true },
+			`kubelet featureGates name "" must be non-empty`),
+		Entry("kubelet feature gate name with a separator", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Kubelet.FeatureGates["A=true,B"] = true },
+			`kubelet featureGates name "A=true,B" must be non-empty and must not contain '=' or ','`),
+		Entry("blank readiness command", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ReadinessCommand.Command = " \n" },
+			"readinessCommand command must not be empty"),
+		Entry("readiness command too long", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ReadinessCommand.Command = strings.Repeat("c", 4097) },
+			"readinessCommand command is longer than 4096 characters"),
+		Entry("readiness command with a NUL character", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ReadinessCommand.Command = "true\x00" },
+			"readinessCommand command must not contain NUL characters"),
+		Entry("readiness command timeout out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ReadinessCommand.TimeoutSeconds = lo.ToPtr(int32(0)) },
+			"readinessCommand timeoutSeconds 0 is not between 1 and 3600"),
+		Entry("registration timeout out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Registration.TimeoutSeconds = lo.ToPtr(int32(10)) },
+			"registration timeoutSeconds 10 is not between 30 and 3600"),
+		Entry("registration retry count out of range", func(spec *v1alpha2.AKSNodeClassSpec) { spec.Registration.RetryCount = lo.ToPtr(int32(0)) },
+			"registration retryCount 0 is not between 1 and 10"),
+		Entry("unsupported kubelet cgroup driver", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.Kubelet = &v1alpha2.Kubelet{CgroupDriver: lo.ToPtr("docker")}
+		}, `kubelet cgroupDriver "docker" is not one of systemd, cgroupfs`),
+		Entry("hostname template not referencing the NodeClaim name", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.HostnameTemplate = lo.ToPtr("{{ .NodeClaim.Labels.team }}-{{ .Zone }}")
+		}, `hostnameTemplate "{{ .NodeClaim.Labels.team }}-{{ .Zone }}" does not reference {{ .NodeClaim.Name }}, which keeps hostnames unique`),
+		Entry("hostname template with uppercase text", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.HostnameTemplate = lo.ToPtr("Node-{{ .NodeClaim.Name }}")
+		}, `hostnameTemplate "Node-{{ .NodeClaim.Name }}" has characters other than lowercase alphanumerics and '-' outside of references`),
+		Entry("hostname template with an unsupported reference", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.HostnameTemplate = lo.ToPtr("{{ .NodeClaim.Annotations.team }}-{{ .NodeClaim.Name }}")
+		}, `only {{ .NodeClaim.Name }}, {{ .NodeClaim.Labels.<key> }}, {{ .InstanceType }} and {{ .Zone }} are supported`),
+		Entry("hostname template referencing an invalid label key", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.HostnameTemplate = lo.ToPtr("{{ .NodeClaim.Labels.-team }}-{{ .NodeClaim.Name }}")
+		}, `hostnameTemplate references label key "-team", which is invalid`),
+		Entry("proximity placement group ID of another resource type", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ProximityPlacementGroupID = lo.ToPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/test")
+		}, `proximityPlacementGroupID "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/test" is not a proximity placement group resource ID`),
+		Entry("systemd unit name without a unit type", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[0].Name = "node-health-agent" },
+			`systemdUnits name "node-health-agent" is not a service, socket, timer, path or target unit name`),
+		Entry("systemd unit name with a path", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[0].Name = "../kubelet.service" },
+			`systemdUnits name "../kubelet.service" is not a service, socket, timer, path or target unit name`),
+		Entry("systemd unit of node bootstrapping", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[0].Name = "kubelet.service" },
+			`systemdUnits name "kubelet.service" is a unit of node bootstrapping`),
+		Entry("duplicate systemd unit", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[1].Name = spec.SystemdUnits[0].Name },
+			`systemdUnits name "node-health-agent.service" is duplicated`),
+		Entry("blank systemd unit content", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[0].Content = " \n" },
+			`systemdUnits content of "node-health-agent.service" must not be empty`),
+		Entry("systemd unit content too long", func(spec *v1alpha2.AKSNodeClassSpec) { spec.SystemdUnits[0].Content = strings.Repeat("c", 16385) },
+			`systemdUnits content of "node-health-agent.service" is longer than 16384 characters`),
+		Entry("boot diagnostics storage URI over http", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.BootDiagnostics = &v1alpha2.BootDiagnostics{StorageURI: lo.ToPtr("http://diagnostics.blob.core.windows.net/")}
+		}, `bootDiagnostics storageURI "http://diagnostics.blob.core.windows.net/" is not the https blob endpoint of a storage account`),
+		Entry("boot diagnostics storage URI of a container", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.BootDiagnostics = &v1alpha2.BootDiagnostics{StorageURI: lo.ToPtr("https://diagnostics.blob.core.windows.net/logs")}
+		}, `bootDiagnostics storageURI "https://diagnostics.blob.core.windows.net/logs" is not the https blob endpoint of a storage account`),
+		Entry("boot diagnostics storage URI while disabled", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.BootDiagnostics = &v1alpha2.BootDiagnostics{Enabled: lo.ToPtr(false), StorageURI: lo.ToPtr("https://diagnostics.blob.core.windows.net/")}
+		}, "bootDiagnostics storageURI is set, but boot diagnostics are disabled"),
+		Entry("image pull registry with a scheme", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ImagePullConfig[0].Registry = "https://registry.example.com"
+		},
+			`imagePullConfig registry "https://registry.example.com" is not a host name with an optional port`),
+		Entry("image pull registry with an empty label", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImagePullConfig[0].Registry = "registry..example.com" },
+			`imagePullConfig registry "registry..example.com" is not a host name with an optional port`),
+		Entry("image pull registry with an invalid port", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImagePullConfig[0].Registry = "registry.example.com:70000" },
+			`imagePullConfig registry "registry.example.com:70000" is not a host name with an optional port`),
+		Entry("duplicate image pull registry", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.ImagePullConfig[1].Registry = spec.ImagePullConfig[0].Registry
+		},
+			`imagePullConfig registry "registry.example.com:5000" is duplicated`),
+		Entry("image pull auth not base64 encoded", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImagePullConfig[0].Auth = "puller:s3cr3t" },
+			`imagePullConfig auth of "registry.example.com:5000" is not a base64 encoded username:password`),
+		Entry("image pull auth without a password", func(spec *v1alpha2.AKSNodeClassSpec) { spec.ImagePullConfig[0].Auth = "cHVsbGVy" },
+			`imagePullConfig auth of "registry.example.com:5000" is not a base64 encoded username:password`),
+		Entry("pre-pull image with an uppercase name", func(spec *v1alpha2.AKSNodeClassSpec) { spec.PrePullImages[0] = "Nginx:latest" },
+			`prePullImages image "Nginx:latest" is not a valid image reference`),
+		Entry("pre-pull image with an empty tag", func(spec *v1alpha2.AKSNodeClassSpec) { spec.PrePullImages[0] = "nginx:" },
+			`prePullImages image "nginx:" is not a valid image reference`),
+		Entry("duplicate pre-pull image", func(spec *v1alpha2.AKSNodeClassSpec) { spec.PrePullImages[1] = spec.PrePullImages[0] },
+			`prePullImages image "registry.example.com:5000/team/agent:v1.2.3" is duplicated`),
+		Entry("pre-pulling in the background without images", func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.PrePullImages = nil
+			spec.PrePullImagesInBackground = lo.ToPtr(true)
+		},
+			"prePullImagesInBackground is set, but there are no prePullImages"),
+	)
+
+	It("should not report image pull credentials", func() {
+		nodeClass.Spec.ImagePullConfig[0].Auth = "puller:s3cr3t"
+		err := nodeClass.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("s3cr3t"))
+	})
+
+	It("should report every invalid field", func() {
+		nodeClass.Spec.ImageFamily = lo.ToPtr("Windows2022")
+		nodeClass.Spec.MTU = lo.ToPtr(int32(576))
+		err := nodeClass.Validate()
+		Expect(err).To(MatchError(ContainSubstring("imageFamily")))
+		Expect(err).To(MatchError(ContainSubstring("mtu")))
+	})
+})
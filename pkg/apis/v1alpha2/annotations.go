@@ -19,4 +19,8 @@ package v1alpha2
 // Annotations
 var (
 	AnnotationInPlaceUpdateHash = Group + "/in-place-update-hash"
+	// AnnotationReadinessCommandSucceeded is set by node bootstrapping on nodes whose readiness command succeeded and
+	// whose images to pre-pull in the foreground are pulled, for Karpenter to remove the TaintKeyReadinessCommand taint,
+	// which nodes are not allowed to remove themselves
+	AnnotationReadinessCommandSucceeded = Group + "/readiness-command-succeeded"
 )
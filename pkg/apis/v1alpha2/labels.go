@@ -39,6 +39,7 @@ func init() {
 		LabelSKUStorageEphemeralOSMaxSize,
 
 		LabelSKUEncryptionAtHostSupported,
+		LabelSKUTrustedLaunchSupported,
 
 		LabelSKUGPUName,
 		LabelSKUGPUManufacturer,
@@ -60,6 +61,9 @@ var (
 
 	RestrictedLabels = sets.New(
 		LabelSKUHyperVGeneration,
+		LabelSKUStorageCacheDiskMaxSize,
+		LabelSKUStorageResourceDiskMaxSize,
+		LabelSKUStorageNVMeDiskMaxSize,
 	)
 
 	AllowUndefinedLabels = func(options scheduling.CompatibilityOptions) scheduling.CompatibilityOptions {
@@ -72,7 +76,14 @@ var (
 
 	HyperVGenerationV1 = "1"
 	HyperVGenerationV2 = "2"
-	ManufacturerNvidia = "nvidia"
+
+	ImageGenerationGen1 = "Gen1"
+	ImageGenerationGen2 = "Gen2"
+
+	EphemeralOSDiskPlacementCacheDisk    = "CacheDisk"
+	EphemeralOSDiskPlacementResourceDisk = "ResourceDisk"
+	EphemeralOSDiskPlacementNVMeDisk     = "NvmeDisk"
+	ManufacturerNvidia                   = "nvidia"
 
 	LabelSKUName    = Group + "/sku-name"    // Standard_A1_v2
 	LabelSKUFamily  = Group + "/sku-family"  // A
@@ -89,6 +100,7 @@ var (
 	LabelSKUStorageEphemeralOSMaxSize = Group + "/sku-storage-ephemeralos-maxsize" // calculated as max(sku.CachedDiskBytes, sku.MaxResourceVolumeMB)
 
 	LabelSKUEncryptionAtHostSupported = Group + "/sku-encryptionathost-capable" // sku.EncryptionAtHostSupported
+	LabelSKUTrustedLaunchSupported    = Group + "/sku-trustedlaunch-capable"    // Gen2 sizes without sku.TrustedLaunchDisabled
 
 	// GPU labels
 	LabelSKUGPUName         = Group + "/sku-gpu-name"         // ie GPU Accelerator type we parse from vmSize
@@ -97,6 +109,23 @@ var (
 
 	// Internal/restricted labels
 	LabelSKUHyperVGeneration = Group + "/sku-hyperv-generation" // sku.HyperVGenerations
+	// capacity in GB of each ephemeral OS disk placement
+	LabelSKUStorageCacheDiskMaxSize    = Group + "/sku-storage-cachedisk-maxsize"    // sku.CachedDiskBytes
+	LabelSKUStorageResourceDiskMaxSize = Group + "/sku-storage-resourcedisk-maxsize" // sku.MaxResourceVolumeMB
+	LabelSKUStorageNVMeDiskMaxSize     = Group + "/sku-storage-nvmedisk-maxsize"     // sku.NvmeDiskSizeInMiB
+
+	// LabelEphemeralOSDisk is set on nodes to whether their OS disk is ephemeral (placed on local storage of the VM)
+	LabelEphemeralOSDisk = Group + "/ephemeral-os-disk"
+
+	// LabelGPUMIGProfile is set on nodes to the Multi-Instance GPU profile their GPUs are partitioned with, when configured
+	LabelGPUMIGProfile = Group + "/gpu-mig-profile"
+
+	// LabelRuntimeHandlerPrefix prefixes the labels of the containerd runtime handlers registered on nodes, when enabled
+	LabelRuntimeHandlerPrefix = Group + "/runtime-handler-"
+
+	// TaintKeyReadinessCommand is registered on nodes of AKSNodeClasses with a readiness command or images to pre-pull,
+	// and removed by Karpenter once node bootstrapping sets AnnotationReadinessCommandSucceeded on the node
+	TaintKeyReadinessCommand = Group + "/readiness-command"
 
 	// AKS labels
 	AKSLabelDomain = "kubernetes.azure.com"
@@ -108,3 +137,51 @@ const (
 	Ubuntu2204ImageFamily = "Ubuntu2204"
 	AzureLinuxImageFamily = "AzureLinux"
 )
+
+// ImageFamilies are the supported image families
+var ImageFamilies = []string{Ubuntu2204ImageFamily, AzureLinuxImageFamily}
+
+const (
+	SandboxRuntimeGVisor = "gvisor"
+)
+
+const (
+	MIGProfile1g = "MIG1g"
+	MIGProfile2g = "MIG2g"
+	MIGProfile3g = "MIG3g"
+	MIGProfile4g = "MIG4g"
+	MIGProfile7g = "MIG7g"
+)
+
+const (
+	GPUDriverVersionCUDA470 = "cuda-470.82.01"
+	GPUDriverVersionCUDA550 = "cuda-550.54.15"
+	GPUDriverVersionGRID535 = "grid-535.161.08"
+)
+
+const (
+	RuntimeHandlerRunc  = "runc"
+	RuntimeHandlerRunsc = "runsc"
+)
+
+const (
+	NetworkProfileHighThroughput = "high-throughput"
+)
+
+const (
+	TCPCongestionControlBBR   = "bbr"
+	TCPCongestionControlCubic = "cubic"
+	TCPCongestionControlReno  = "reno"
+	TCPCongestionControlHTCP  = "htcp"
+	TCPCongestionControlDCTCP = "dctcp"
+)
+
+const (
+	EntropySourceRngd    = "rngd"
+	EntropySourceHaveged = "haveged"
+)
+
+const (
+	CgroupDriverSystemd  = "systemd"
+	CgroupDriverCgroupfs = "cgroupfs"
+)
@@ -90,6 +90,11 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.EphemeralOSDiskPlacement != nil {
+		in, out := &in.EphemeralOSDiskPlacement, &out.EphemeralOSDiskPlacement
+		*out = new(string)
+		**out = **in
+	}
 	if in.ImageID != nil {
 		in, out := &in.ImageID, &out.ImageID
 		*out = new(string)
@@ -105,6 +110,28 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ImageSelector != nil {
+		in, out := &in.ImageSelector, &out.ImageSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PreferMinimalImage != nil {
+		in, out := &in.PreferMinimalImage, &out.PreferMinimalImage
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ImageGeneration != nil {
+		in, out := &in.ImageGeneration, &out.ImageGeneration
+		*out = new(string)
+		**out = **in
+	}
+	if in.SharedImageGalleryID != nil {
+		in, out := &in.SharedImageGalleryID, &out.SharedImageGalleryID
+		*out = new(string)
+		**out = **in
+	}
 	if in.Tags != nil {
 		in, out := &in.Tags, &out.Tags
 		*out = make(map[string]string, len(*in))
@@ -112,6 +139,205 @@ func (in *AKSNodeClassSpec) DeepCopyInto(out *AKSNodeClassSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HostnameTemplate != nil {
+		in, out := &in.HostnameTemplate, &out.HostnameTemplate
+		*out = new(string)
+		**out = **in
+	}
+	if in.GPU != nil {
+		in, out := &in.GPU, &out.GPU
+		*out = new(GPU)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conntrack != nil {
+		in, out := &in.Conntrack, &out.Conntrack
+		*out = new(Conntrack)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxPods != nil {
+		in, out := &in.MaxPods, &out.MaxPods
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SandboxRuntime != nil {
+		in, out := &in.SandboxRuntime, &out.SandboxRuntime
+		*out = new(string)
+		**out = **in
+	}
+	if in.RuntimeHandlers != nil {
+		in, out := &in.RuntimeHandlers, &out.RuntimeHandlers
+		*out = new(RuntimeHandlers)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNSServers != nil {
+		in, out := &in.DNSServers, &out.DNSServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNSSearchDomains != nil {
+		in, out := &in.DNSSearchDomains, &out.DNSSearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNSStubListener != nil {
+		in, out := &in.DNSStubListener, &out.DNSStubListener
+		*out = new(bool)
+		**out = **in
+	}
+	if in.FallbackSubnetIDs != nil {
+		in, out := &in.FallbackSubnetIDs, &out.FallbackSubnetIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DisableIPv6 != nil {
+		in, out := &in.DisableIPv6, &out.DisableIPv6
+		*out = new(bool)
+		**out = **in
+	}
+	if in.APIServerName != nil {
+		in, out := &in.APIServerName, &out.APIServerName
+		*out = new(string)
+		**out = **in
+	}
+	if in.NetworkProfile != nil {
+		in, out := &in.NetworkProfile, &out.NetworkProfile
+		*out = new(NetworkProfile)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LinuxConfig != nil {
+		in, out := &in.LinuxConfig, &out.LinuxConfig
+		*out = new(LinuxConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TCPCongestionControl != nil {
+		in, out := &in.TCPCongestionControl, &out.TCPCongestionControl
+		*out = new(string)
+		**out = **in
+	}
+	if in.AcceleratedNetworking != nil {
+		in, out := &in.AcceleratedNetworking, &out.AcceleratedNetworking
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MetadataLabels != nil {
+		in, out := &in.MetadataLabels, &out.MetadataLabels
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SecurityProfile != nil {
+		in, out := &in.SecurityProfile, &out.SecurityProfile
+		*out = new(SecurityProfile)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProximityPlacementGroupID != nil {
+		in, out := &in.ProximityPlacementGroupID, &out.ProximityPlacementGroupID
+		*out = new(string)
+		**out = **in
+	}
+	if in.BootDiagnostics != nil {
+		in, out := &in.BootDiagnostics, &out.BootDiagnostics
+		*out = new(BootDiagnostics)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeletIdentity != nil {
+		in, out := &in.KubeletIdentity, &out.KubeletIdentity
+		*out = new(KubeletIdentity)
+		**out = **in
+	}
+	if in.NodeIdentities != nil {
+		in, out := &in.NodeIdentities, &out.NodeIdentities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SystemAssignedIdentity != nil {
+		in, out := &in.SystemAssignedIdentity, &out.SystemAssignedIdentity
+		*out = new(bool)
+		**out = **in
+	}
+	if in.EntropySource != nil {
+		in, out := &in.EntropySource, &out.EntropySource
+		*out = new(string)
+		**out = **in
+	}
+	if in.SwapAccounting != nil {
+		in, out := &in.SwapAccounting, &out.SwapAccounting
+		*out = new(bool)
+		**out = **in
+	}
+	if in.RoCE != nil {
+		in, out := &in.RoCE, &out.RoCE
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AdditionalCAs != nil {
+		in, out := &in.AdditionalCAs, &out.AdditionalCAs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ContainerdConfig != nil {
+		in, out := &in.ContainerdConfig, &out.ContainerdConfig
+		*out = new(ContainerdConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullConfig != nil {
+		in, out := &in.ImagePullConfig, &out.ImagePullConfig
+		*out = make([]ImagePullConfig, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrePullImages != nil {
+		in, out := &in.PrePullImages, &out.PrePullImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrePullImagesInBackground != nil {
+		in, out := &in.PrePullImagesInBackground, &out.PrePullImagesInBackground
+		*out = new(bool)
+		**out = **in
+	}
+	if in.LocalStorage != nil {
+		in, out := &in.LocalStorage, &out.LocalStorage
+		*out = new(LocalStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OOMScoreAdj != nil {
+		in, out := &in.OOMScoreAdj, &out.OOMScoreAdj
+		*out = new(OOMScoreAdj)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Kubelet != nil {
+		in, out := &in.Kubelet, &out.Kubelet
+		*out = new(Kubelet)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessCommand != nil {
+		in, out := &in.ReadinessCommand, &out.ReadinessCommand
+		*out = new(ReadinessCommand)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Registration != nil {
+		in, out := &in.Registration, &out.Registration
+		*out = new(Registration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SystemdUnits != nil {
+		in, out := &in.SystemdUnits, &out.SystemdUnits
+		*out = make([]SystemdUnit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AKSNodeClassSpec.
@@ -139,6 +365,86 @@ func (in *AKSNodeClassStatus) DeepCopy() *AKSNodeClassStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Conntrack) DeepCopyInto(out *Conntrack) {
+	*out = *in
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TCPTimeouts != nil {
+		in, out := &in.TCPTimeouts, &out.TCPTimeouts
+		*out = new(ConntrackTCPTimeouts)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Conntrack.
+func (in *Conntrack) DeepCopy() *Conntrack {
+	if in == nil {
+		return nil
+	}
+	out := new(Conntrack)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConntrackTCPTimeouts) DeepCopyInto(out *ConntrackTCPTimeouts) {
+	*out = *in
+	if in.EstablishedSeconds != nil {
+		in, out := &in.EstablishedSeconds, &out.EstablishedSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CloseWaitSeconds != nil {
+		in, out := &in.CloseWaitSeconds, &out.CloseWaitSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConntrackTCPTimeouts.
+func (in *ConntrackTCPTimeouts) DeepCopy() *ConntrackTCPTimeouts {
+	if in == nil {
+		return nil
+	}
+	out := new(ConntrackTCPTimeouts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GPU) DeepCopyInto(out *GPU) {
+	*out = *in
+	if in.PersistenceMode != nil {
+		in, out := &in.PersistenceMode, &out.PersistenceMode
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MIGProfile != nil {
+		in, out := &in.MIGProfile, &out.MIGProfile
+		*out = new(string)
+		**out = **in
+	}
+	if in.DriverVersion != nil {
+		in, out := &in.DriverVersion, &out.DriverVersion
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GPU.
+func (in *GPU) DeepCopy() *GPU {
+	if in == nil {
+		return nil
+	}
+	out := new(GPU)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Image) DeepCopyInto(out *Image) {
 	*out = *in
@@ -160,3 +466,374 @@ func (in *Image) DeepCopy() *Image {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeletIdentity) DeepCopyInto(out *KubeletIdentity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeletIdentity.
+func (in *KubeletIdentity) DeepCopy() *KubeletIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeletIdentity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkProfile) DeepCopyInto(out *NetworkProfile) {
+	*out = *in
+	if in.CoreRMemMax != nil {
+		in, out := &in.CoreRMemMax, &out.CoreRMemMax
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CoreWMemMax != nil {
+		in, out := &in.CoreWMemMax, &out.CoreWMemMax
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TCPRMem != nil {
+		in, out := &in.TCPRMem, &out.TCPRMem
+		*out = new(string)
+		**out = **in
+	}
+	if in.TCPWMem != nil {
+		in, out := &in.TCPWMem, &out.TCPWMem
+		*out = new(string)
+		**out = **in
+	}
+	if in.NetdevMaxBacklog != nil {
+		in, out := &in.NetdevMaxBacklog, &out.NetdevMaxBacklog
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkProfile.
+func (in *NetworkProfile) DeepCopy() *NetworkProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerdConfig) DeepCopyInto(out *ContainerdConfig) {
+	*out = *in
+	if in.RegistryMirrors != nil {
+		in, out := &in.RegistryMirrors, &out.RegistryMirrors
+		*out = make([]RegistryMirror, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CNIBinDir != nil {
+		in, out := &in.CNIBinDir, &out.CNIBinDir
+		*out = new(string)
+		**out = **in
+	}
+	if in.CNIConfDir != nil {
+		in, out := &in.CNIConfDir, &out.CNIConfDir
+		*out = new(string)
+		**out = **in
+	}
+	if in.MaxConcurrentDownloads != nil {
+		in, out := &in.MaxConcurrentDownloads, &out.MaxConcurrentDownloads
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerdConfig.
+func (in *ContainerdConfig) DeepCopy() *ContainerdConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerdConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePullConfig) DeepCopyInto(out *ImagePullConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePullConfig.
+func (in *ImagePullConfig) DeepCopy() *ImagePullConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePullConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OOMScoreAdj) DeepCopyInto(out *OOMScoreAdj) {
+	*out = *in
+	if in.Kubelet != nil {
+		in, out := &in.Kubelet, &out.Kubelet
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Containerd != nil {
+		in, out := &in.Containerd, &out.Containerd
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OOMScoreAdj.
+func (in *OOMScoreAdj) DeepCopy() *OOMScoreAdj {
+	if in == nil {
+		return nil
+	}
+	out := new(OOMScoreAdj)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessCommand) DeepCopyInto(out *ReadinessCommand) {
+	*out = *in
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCommand.
+func (in *ReadinessCommand) DeepCopy() *ReadinessCommand {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessCommand)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryMirror) DeepCopyInto(out *RegistryMirror) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryMirror.
+func (in *RegistryMirror) DeepCopy() *RegistryMirror {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryMirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuntimeHandlers) DeepCopyInto(out *RuntimeHandlers) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(string)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeHandlers.
+func (in *RuntimeHandlers) DeepCopy() *RuntimeHandlers {
+	if in == nil {
+		return nil
+	}
+	out := new(RuntimeHandlers)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Registration) DeepCopyInto(out *Registration) {
+	*out = *in
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RetryCount != nil {
+		in, out := &in.RetryCount, &out.RetryCount
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Registration.
+func (in *Registration) DeepCopy() *Registration {
+	if in == nil {
+		return nil
+	}
+	out := new(Registration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SystemdUnit) DeepCopyInto(out *SystemdUnit) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemdUnit.
+func (in *SystemdUnit) DeepCopy() *SystemdUnit {
+	if in == nil {
+		return nil
+	}
+	out := new(SystemdUnit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalStorage) DeepCopyInto(out *LocalStorage) {
+	*out = *in
+	if in.DiscoveryPath != nil {
+		in, out := &in.DiscoveryPath, &out.DiscoveryPath
+		*out = new(string)
+		**out = **in
+	}
+	if in.RAID0 != nil {
+		in, out := &in.RAID0, &out.RAID0
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalStorage.
+func (in *LocalStorage) DeepCopy() *LocalStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecurityProfile) DeepCopyInto(out *SecurityProfile) {
+	*out = *in
+	if in.SecureBoot != nil {
+		in, out := &in.SecureBoot, &out.SecureBoot
+		*out = new(bool)
+		**out = **in
+	}
+	if in.VTPM != nil {
+		in, out := &in.VTPM, &out.VTPM
+		*out = new(bool)
+		**out = **in
+	}
+	if in.EncryptionAtHost != nil {
+		in, out := &in.EncryptionAtHost, &out.EncryptionAtHost
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityProfile.
+func (in *SecurityProfile) DeepCopy() *SecurityProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(SecurityProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootDiagnostics) DeepCopyInto(out *BootDiagnostics) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.StorageURI != nil {
+		in, out := &in.StorageURI, &out.StorageURI
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootDiagnostics.
+func (in *BootDiagnostics) DeepCopy() *BootDiagnostics {
+	if in == nil {
+		return nil
+	}
+	out := new(BootDiagnostics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Kubelet) DeepCopyInto(out *Kubelet) {
+	*out = *in
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.CgroupDriver != nil {
+		in, out := &in.CgroupDriver, &out.CgroupDriver
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Kubelet.
+func (in *Kubelet) DeepCopy() *Kubelet {
+	if in == nil {
+		return nil
+	}
+	out := new(Kubelet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LinuxConfig) DeepCopyInto(out *LinuxConfig) {
+	*out = *in
+	if in.Sysctls != nil {
+		in, out := &in.Sysctls, &out.Sysctls
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LinuxConfig.
+func (in *LinuxConfig) DeepCopy() *LinuxConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LinuxConfig)
+	in.DeepCopyInto(out)
+	return out
+}
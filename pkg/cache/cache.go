@@ -22,6 +22,15 @@ const (
 	// KubernetesVersionTTL is the time before the detected Kubernetes version is removed from cache,
 	// to be re-detected next time it is needed.
 	KubernetesVersionTTL = 15 * time.Minute
+	// CABundleTTL is the time before the discovered cluster CA bundle is removed from cache,
+	// to be re-discovered next time it is needed. Kept short so rotated CAs reach new nodes quickly.
+	CABundleTTL = 5 * time.Minute
+	// SubnetTTL is the time before the available IPs of a subnet are removed from cache,
+	// to be looked up again next time they are needed. Kept short as every launched node uses some of them.
+	SubnetTTL = 1 * time.Minute
+	// ProximityPlacementGroupTTL is the time before the region of a proximity placement group is removed from cache,
+	// to be looked up again next time it is needed. The region of a proximity placement group cannot change.
+	ProximityPlacementGroupTTL = 1 * time.Hour
 	// UnavailableOfferingsTTL is the time before offerings that were marked as unavailable
 	// are removed from the cache and are available for launch again
 	UnavailableOfferingsTTL = 3 * time.Minute
@@ -17,7 +17,10 @@ limitations under the License.
 package events
 
 import (
+	"fmt"
+
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/events"
@@ -40,3 +43,18 @@ func NodeClaimFailedToResolveNodeClass(nodeClaim *v1beta1.NodeClaim) events.Even
 		DedupeValues:   []string{string(nodeClaim.UID)},
 	}
 }
+
+// launchTemplateResolvedRateLimiter caps the LaunchTemplateResolved events of all NodeClaims, for them not to flood
+// the API server when many nodes launch at once
+var launchTemplateResolvedRateLimiter = flowcontrol.NewTokenBucketRateLimiter(1, 10)
+
+func NodeClaimLaunchTemplateResolved(nodeClaim *v1beta1.NodeClaim, imageID, arch, templateHash string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           v1.EventTypeNormal,
+		Reason:         "LaunchTemplateResolved",
+		Message:        fmt.Sprintf("Resolved launch template, image %s, architecture %s, template hash %s", imageID, arch, templateHash),
+		DedupeValues:   []string{string(nodeClaim.UID), templateHash},
+		RateLimiter:    launchTemplateResolvedRateLimiter,
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+// Controller removes the readiness taint from nodes once node bootstrapping annotates them as ready. The NodeRestriction
+// admission plugin does not allow nodes to remove taints of their own, so the node signals readiness with an annotation instead.
+type Controller struct {
+	kubeClient client.Client
+}
+
+var _ corecontroller.TypedController[*v1.Node] = &Controller{}
+
+func NewController(kubeClient client.Client) corecontroller.Controller {
+	return corecontroller.Typed[*v1.Node](kubeClient, &Controller{
+		kubeClient: kubeClient,
+	})
+}
+
+func (c *Controller) Name() string {
+	return "node.readiness"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, node *v1.Node) (reconcile.Result, error) {
+	if !node.DeletionTimestamp.IsZero() || !isReady(node) {
+		return reconcile.Result{}, nil
+	}
+	if !lo.ContainsBy(node.Spec.Taints, isReadinessTaint) {
+		return reconcile.Result{}, nil
+	}
+
+	stored := node.DeepCopy()
+	node.Spec.Taints = lo.Reject(node.Spec.Taints, func(taint v1.Taint, _ int) bool { return isReadinessTaint(taint) })
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	logging.FromContext(ctx).With("taint", v1alpha2.TaintKeyReadinessCommand).Infof("removed readiness taint")
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.NewControllerManagedBy(m).For(
+		&v1.Node{},
+		builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			_, ok := o.GetAnnotations()[v1alpha2.AnnotationReadinessCommandSucceeded]
+			return ok
+		})),
+	).WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
+
+// isReady returns whether node bootstrapping annotated the node as ready for workloads
+func isReady(node *v1.Node) bool {
+	return node.Annotations[v1alpha2.AnnotationReadinessCommandSucceeded] == "true"
+}
+
+func isReadinessTaint(taint v1.Taint) bool {
+	return taint.Key == v1alpha2.TaintKeyReadinessCommand
+}
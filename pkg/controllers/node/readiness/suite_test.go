@@ -0,0 +1,106 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/node/readiness"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var readinessController corecontroller.Controller
+
+var readinessTaint = v1.Taint{Key: v1alpha2.TaintKeyReadinessCommand, Effect: v1.TaintEffectNoSchedule}
+var otherTaint = v1.Taint{Key: "example.com/agent-not-ready", Effect: v1.TaintEffectNoSchedule}
+
+func TestReadiness(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/Node/Readiness")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx, stop = context.WithCancel(ctx)
+
+	readinessController = readiness.NewController(env.Client)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("Readiness", func() {
+	// the node only annotates itself, as it may not remove its own taints
+	It("should remove the readiness taint of nodes annotated as ready", func() {
+		node := coretest.Node(coretest.NodeOptions{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{v1alpha2.AnnotationReadinessCommandSucceeded: "true"}},
+			Taints:     []v1.Taint{readinessTaint, otherTaint},
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, readinessController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ConsistOf(otherTaint))
+	})
+	It("should keep the readiness taint of nodes not annotated as ready", func() {
+		node := coretest.Node(coretest.NodeOptions{
+			Taints: []v1.Taint{readinessTaint, otherTaint},
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, readinessController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ConsistOf(readinessTaint, otherTaint))
+	})
+	It("should keep the taints of annotated nodes without the readiness taint", func() {
+		node := coretest.Node(coretest.NodeOptions{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{v1alpha2.AnnotationReadinessCommandSucceeded: "true"}},
+			Taints:     []v1.Taint{otherTaint},
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, readinessController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ConsistOf(otherTaint))
+	})
+})
@@ -0,0 +1,112 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package startuptaint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// Controller removes the startup taints of the NodePool nodes still have once the startup taint removal timeout passed
+// since they registered, for nodes not to stay unschedulable when the controller expected to remove a startup taint never does.
+// The NodeRestriction admission plugin does not allow nodes to remove taints of their own, so Karpenter removes them.
+type Controller struct {
+	kubeClient client.Client
+	clock      clock.Clock
+}
+
+var _ corecontroller.TypedController[*v1.Node] = &Controller{}
+
+func NewController(kubeClient client.Client, clk clock.Clock) corecontroller.Controller {
+	return corecontroller.Typed[*v1.Node](kubeClient, &Controller{
+		kubeClient: kubeClient,
+		clock:      clk,
+	})
+}
+
+func (c *Controller) Name() string {
+	return "node.startuptaint"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, node *v1.Node) (reconcile.Result, error) {
+	timeout := options.FromContext(ctx).StartupTaintRemovalTimeout
+	if timeout <= 0 || !node.DeletionTimestamp.IsZero() || node.Spec.ProviderID == "" {
+		return reconcile.Result{}, nil
+	}
+	nodeClaimList := &corev1beta1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList, client.MatchingFields{"status.providerID": node.Spec.ProviderID}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodeClaims, %w", err)
+	}
+	if len(nodeClaimList.Items) != 1 {
+		return reconcile.Result{}, nil
+	}
+	removable := getRemovableStartupTaints(&nodeClaimList.Items[0], node)
+	if len(removable) == 0 {
+		return reconcile.Result{}, nil
+	}
+	if remaining := timeout - c.clock.Since(node.CreationTimestamp.Time); remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+
+	stored := node.DeepCopy()
+	node.Spec.Taints = lo.Reject(node.Spec.Taints, func(taint v1.Taint, _ int) bool { return containsTaint(removable, taint) })
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	logging.FromContext(ctx).With("taints", lo.Map(removable, func(taint v1.Taint, _ int) string { return taint.ToString() })).
+		Infof("removed startup taints after the startup taint removal timeout of %s", timeout)
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.NewControllerManagedBy(m).For(
+		&v1.Node{},
+		builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			_, ok := o.GetLabels()[corev1beta1.NodePoolLabelKey]
+			return ok
+		})),
+	).WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
+
+// getRemovableStartupTaints returns the startup taints of the nodeClaim the node still has, except for those which are also
+// taints of the nodeClaim: the registered taint is the same, and must be kept
+func getRemovableStartupTaints(nodeClaim *corev1beta1.NodeClaim, node *v1.Node) []v1.Taint {
+	return lo.Filter(node.Spec.Taints, func(taint v1.Taint, _ int) bool {
+		return containsTaint(nodeClaim.Spec.StartupTaints, taint) && !containsTaint(nodeClaim.Spec.Taints, taint)
+	})
+}
+
+// containsTaint returns whether the taints have one of the key and effect of the taint
+func containsTaint(taints []v1.Taint, taint v1.Taint) bool {
+	return lo.ContainsBy(taints, func(t v1.Taint) bool { return t.MatchTaint(&taint) })
+}
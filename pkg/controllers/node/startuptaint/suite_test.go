@@ -0,0 +1,133 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package startuptaint_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	clock "k8s.io/utils/clock/testing"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	corecontroller "sigs.k8s.io/karpenter/pkg/operator/controller"
+	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
+	"sigs.k8s.io/karpenter/pkg/operator/scheme"
+	coretest "sigs.k8s.io/karpenter/pkg/test"
+	. "sigs.k8s.io/karpenter/pkg/test/expectations"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis"
+	"github.com/Azure/karpenter-provider-azure/pkg/controllers/node/startuptaint"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
+)
+
+var ctx context.Context
+var stop context.CancelFunc
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var startupTaintController corecontroller.Controller
+
+var agentNotReadyTaint = v1.Taint{Key: "example.com/agent-not-ready", Effect: v1.TaintEffectNoSchedule}
+var dedicatedTaint = v1.Taint{Key: "example.com/dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+
+func TestStartupTaint(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers/Node/StartupTaint")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coreoptions.ToContext(ctx, coretest.Options())
+
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...), coretest.WithFieldIndexers(coretest.NodeClaimFieldIndexer(ctx)))
+	ctx, stop = context.WithCancel(ctx)
+
+	fakeClock = clock.NewFakeClock(time.Now())
+	startupTaintController = startuptaint.NewController(env.Client, fakeClock)
+})
+
+var _ = AfterSuite(func() {
+	stop()
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	ctx = options.ToContext(ctx, test.Options(test.OptionsFields{StartupTaintRemovalTimeout: lo.ToPtr(10 * time.Minute)}))
+	fakeClock.SetTime(time.Now())
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("StartupTaint", func() {
+	var nodeClaim *corev1beta1.NodeClaim
+	var node *v1.Node
+
+	BeforeEach(func() {
+		nodeClaim, node = coretest.NodeClaimAndNode(corev1beta1.NodeClaim{
+			Spec: corev1beta1.NodeClaimSpec{
+				Taints:        []v1.Taint{dedicatedTaint},
+				StartupTaints: []v1.Taint{agentNotReadyTaint, {Key: dedicatedTaint.Key, Effect: dedicatedTaint.Effect}},
+			},
+		})
+		// the kubelet registers with the taints of both, which are unique by key and effect
+		node.Spec.Taints = []v1.Taint{dedicatedTaint, agentNotReadyTaint}
+	})
+
+	It("should keep startup taints until the timeout passed", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+
+		result := ExpectReconcileSucceeded(ctx, startupTaintController, client.ObjectKeyFromObject(node))
+		Expect(result.RequeueAfter).To(BeNumerically("~", 10*time.Minute, time.Minute))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ContainElement(agentNotReadyTaint))
+	})
+	// the node may not remove its own taints, so it is left to Karpenter
+	It("should remove the startup taints nodes still have after the timeout", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		fakeClock.Step(11 * time.Minute)
+
+		ExpectReconcileSucceeded(ctx, startupTaintController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		// startup taints which are also taints of the nodeClaim are kept
+		Expect(node.Spec.Taints).To(ConsistOf(dedicatedTaint))
+	})
+	It("should keep startup taints without a timeout", func() {
+		ctx = options.ToContext(ctx, test.Options())
+		ExpectApplied(ctx, env.Client, nodeClaim, node)
+		fakeClock.Step(time.Hour)
+
+		ExpectReconcileSucceeded(ctx, startupTaintController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ContainElement(agentNotReadyTaint))
+	})
+	It("should keep the taints of nodes without a nodeClaim", func() {
+		ExpectApplied(ctx, env.Client, node)
+		fakeClock.Step(time.Hour)
+
+		ExpectReconcileSucceeded(ctx, startupTaintController, client.ObjectKeyFromObject(node))
+		node = ExpectExists(ctx, env.Client, node)
+		Expect(node.Spec.Taints).To(ContainElement(agentNotReadyTaint))
+	})
+})
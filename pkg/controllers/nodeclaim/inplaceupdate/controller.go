@@ -153,7 +153,10 @@ func calculateVMPatch(
 		return nil // No update to perform
 	}
 
-	identity := instance.ConvertToVirtualMachineIdentity(toAdd)
+	// keep the system-assigned identity, as the identity type of the patch replaces the current one
+	systemAssigned := currentVM.Identity != nil && lo.Contains([]armcompute.ResourceIdentityType{
+		armcompute.ResourceIdentityTypeSystemAssigned, armcompute.ResourceIdentityTypeSystemAssignedUserAssigned}, lo.FromPtr(currentVM.Identity.Type))
+	identity := instance.ConvertToVirtualMachineIdentity(toAdd, systemAssigned)
 
 	return &armcompute.VirtualMachineUpdate{
 		Identity: identity,
@@ -223,6 +223,24 @@ var _ = Describe("Unit tests", func() {
 
 			Expect(update).To(BeNil())
 		})
+
+		It("should keep the system-assigned identity when adding identities", func() {
+			currentVM := &armcompute.VirtualMachine{
+				Identity: &armcompute.VirtualMachineIdentity{
+					Type: lo.ToPtr(armcompute.ResourceIdentityTypeSystemAssigned),
+				},
+			}
+
+			options := test.Options()
+			options.NodeIdentities = []string{
+				"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1",
+			}
+			update := calculateVMPatch(options, currentVM)
+
+			Expect(update).ToNot(BeNil())
+			Expect(update.Identity.Type).To(Equal(lo.ToPtr(armcompute.ResourceIdentityTypeSystemAssignedUserAssigned)))
+			Expect(update.Identity.UserAssignedIdentities).To(HaveKey("/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1"))
+		})
 	})
 })
 
@@ -0,0 +1,68 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+)
+
+type GalleryImagesBehavior struct {
+	GalleryImages sync.Map
+}
+
+// assert that the fake implements the interface
+var _ imagefamily.GalleryImagesAPI = &GalleryImagesAPI{}
+
+type GalleryImagesAPI struct {
+	GalleryImagesBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *GalleryImagesAPI) Reset() {
+	if api == nil {
+		return
+	}
+	api.GalleryImages.Range(func(k, v any) bool {
+		api.GalleryImages.Delete(k)
+		return true
+	})
+}
+
+// Store adds a gallery image, keyed by its ID
+func (api *GalleryImagesAPI) Store(subscriptionID, resourceGroupName, galleryName, galleryImageName string, galleryImage armcompute.GalleryImage) {
+	api.GalleryImages.Store(MakeGalleryImageID(subscriptionID, resourceGroupName, galleryName, galleryImageName), galleryImage)
+}
+
+func (api *GalleryImagesAPI) Get(_ context.Context, subscriptionID, resourceGroupName, galleryName, galleryImageName string) (armcompute.GalleryImage, error) {
+	galleryImage, ok := api.GalleryImages.Load(MakeGalleryImageID(subscriptionID, resourceGroupName, galleryName, galleryImageName))
+	if !ok {
+		return armcompute.GalleryImage{}, fmt.Errorf("not found")
+	}
+	return galleryImage.(armcompute.GalleryImage), nil
+}
+
+func MakeGalleryImageID(subscriptionID, resourceGroupName, galleryName, galleryImageName string) string {
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s"
+	return strings.ToLower(fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, galleryName, galleryImageName))
+}
@@ -0,0 +1,63 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+type ProximityPlacementGroupsBehavior struct {
+	ProximityPlacementGroups sync.Map
+}
+
+// assert that the fake implements the interface
+var _ launchtemplate.ProximityPlacementGroupsAPI = &ProximityPlacementGroupsAPI{}
+
+type ProximityPlacementGroupsAPI struct {
+	ProximityPlacementGroupsBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *ProximityPlacementGroupsAPI) Reset() {
+	api.ProximityPlacementGroups.Range(func(k, v any) bool {
+		api.ProximityPlacementGroups.Delete(k)
+		return true
+	})
+}
+
+func (api *ProximityPlacementGroupsAPI) Get(_ context.Context, resourceGroupName string, proximityPlacementGroupName string, _ *armcompute.ProximityPlacementGroupsClientGetOptions) (armcompute.ProximityPlacementGroupsClientGetResponse, error) {
+	id := MakeProximityPlacementGroupID(resourceGroupName, proximityPlacementGroupName)
+	proximityPlacementGroup, ok := api.ProximityPlacementGroups.Load(id)
+	if !ok {
+		return armcompute.ProximityPlacementGroupsClientGetResponse{}, fmt.Errorf("not found")
+	}
+	return armcompute.ProximityPlacementGroupsClientGetResponse{
+		ProximityPlacementGroup: proximityPlacementGroup.(armcompute.ProximityPlacementGroup),
+	}, nil
+}
+
+func MakeProximityPlacementGroupID(resourceGroupName, proximityPlacementGroupName string) string {
+	const subscriptionID = "subscriptionID" // not important for fake
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/proximityPlacementGroups/%s"
+
+	return fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, proximityPlacementGroupName)
+}
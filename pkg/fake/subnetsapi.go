@@ -0,0 +1,63 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
+)
+
+type SubnetsBehavior struct {
+	Subnets sync.Map
+}
+
+// assert that the fake implements the interface
+var _ launchtemplate.SubnetsAPI = &SubnetsAPI{}
+
+type SubnetsAPI struct {
+	SubnetsBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute each other.
+func (api *SubnetsAPI) Reset() {
+	api.Subnets.Range(func(k, v any) bool {
+		api.Subnets.Delete(k)
+		return true
+	})
+}
+
+func (api *SubnetsAPI) Get(_ context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, _ *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+	id := MakeSubnetID(resourceGroupName, virtualNetworkName, subnetName)
+	subnet, ok := api.Subnets.Load(id)
+	if !ok {
+		return armnetwork.SubnetsClientGetResponse{}, fmt.Errorf("not found")
+	}
+	return armnetwork.SubnetsClientGetResponse{
+		Subnet: subnet.(armnetwork.Subnet),
+	}, nil
+}
+
+func MakeSubnetID(resourceGroupName, virtualNetworkName, subnetName string) string {
+	const subscriptionID = "subscriptionID" // not important for fake
+	const idFormat = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s/subnets/%s"
+
+	return fmt.Sprintf(idFormat, subscriptionID, resourceGroupName, virtualNetworkName, subnetName)
+}
@@ -19,6 +19,7 @@ package metrics
 import (
 	"github.com/prometheus/client_golang/prometheus"
 	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/karpenter/pkg/metrics"
 )
 
 var (
@@ -31,10 +32,30 @@ var (
 		},
 		[]string{"family"},
 	)
+	LaunchTemplateGenerationDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: launchTemplateSubsystem,
+			Name:      "generation_duration_seconds",
+			Help:      "Duration of launch template generation in seconds.",
+			Buckets:   metrics.DurationBuckets(),
+		},
+	)
+	LaunchTemplateGenerationErrorCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: launchTemplateSubsystem,
+			Name:      "generation_error_count",
+			Help:      "The number of errors encountered while generating a launch template, by the stage that failed.",
+		},
+		[]string{"stage"},
+	)
 )
 
 func init() {
 	crmetrics.Registry.MustRegister(
 		ImageSelectionErrorCount,
+		LaunchTemplateGenerationDuration,
+		LaunchTemplateGenerationErrorCount,
 	)
 }
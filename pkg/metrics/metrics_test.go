@@ -46,3 +46,20 @@ var _ = Describe("Image Selection Error Metrics", func() {
 		})
 	})
 })
+
+var _ = Describe("Launch Template Generation Metrics", func() {
+	BeforeEach(func() {
+		metrics.LaunchTemplateGenerationErrorCount.Reset()
+	})
+
+	Describe("LaunchTemplateGenerationErrorCount", func() {
+		It("should have no errors initially", func() {
+			Expect(testutil.CollectAndCount(metrics.LaunchTemplateGenerationErrorCount)).To(Equal(0))
+		})
+
+		It("should increment the error count for a stage", func() {
+			metrics.LaunchTemplateGenerationErrorCount.WithLabelValues("resolve").Inc()
+			Expect(testutil.ToFloat64(metrics.LaunchTemplateGenerationErrorCount.WithLabelValues("resolve"))).To(Equal(float64(1)))
+		})
+	})
+})
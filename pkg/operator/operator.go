@@ -26,6 +26,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/transport"
+	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/operator/scheme"
@@ -76,6 +77,10 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 	vnetGUID, err := getVnetGUID(azConfig, options.FromContext(ctx).SubnetID)
 	lo.Must0(err, "getting VNET GUID")
 
+	if options.FromContext(ctx).DisableManagedClusterTag {
+		logging.FromContext(ctx).Warnf("managed cluster tag %q is disabled, Karpenter may fail to discover and garbage collect the resources it creates", "karpenter.azure.com/cluster")
+	}
+
 	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
 	pricingProvider := pricing.NewProvider(
 		ctx,
@@ -88,6 +93,7 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		cache.New(azurecache.KubernetesVersionTTL,
 			azurecache.DefaultCleanupInterval),
 		azClient.ImageVersionsClient,
+		azClient.GalleryImagesClient,
 		azConfig.Location,
 	)
 	imageResolver := imagefamily.New(
@@ -98,7 +104,13 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		ctx,
 		imageResolver,
 		imageProvider,
-		lo.Must(getCABundle(operator.GetConfig())),
+		nil,
+		func() (*string, error) { return getCABundle(operator.GetConfig()) },
+		cache.New(azurecache.CABundleTTL, azurecache.DefaultCleanupInterval),
+		azClient.SubnetsClient,
+		cache.New(azurecache.SubnetTTL, azurecache.DefaultCleanupInterval),
+		azClient.ProximityPlacementGroupsClient,
+		cache.New(azurecache.ProximityPlacementGroupTTL, azurecache.DefaultCleanupInterval),
 		options.FromContext(ctx).ClusterEndpoint,
 		azConfig.TenantID,
 		azConfig.SubscriptionID,
@@ -107,6 +119,7 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		azConfig.Location,
 		vnetGUID,
 	)
+	lo.Must0(launchTemplateProvider.Validate(ctx), "validating launch template provider")
 	instanceTypeProvider := instancetype.NewProvider(
 		azConfig.Location,
 		cache.New(instancetype.InstanceTypesCacheTTL, azurecache.DefaultCleanupInterval),
@@ -125,6 +138,7 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		launchTemplateProvider,
 		loadBalancerProvider,
 		unavailableOfferingsCache,
+		operator.EventRecorder,
 		azConfig.Location,
 		azConfig.NodeResourceGroup,
 		options.FromContext(ctx).SubnetID,
@@ -26,47 +26,90 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
 	"sigs.k8s.io/karpenter/pkg/utils/env"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 )
 
 func init() {
 	coreoptions.Injectables = append(coreoptions.Injectables, &Options{})
 }
 
-type nodeIdentitiesValue []string
+// commaSeparatedStringsValue is a flag value of comma separated strings
+type commaSeparatedStringsValue []string
 
-func newNodeIdentitiesValue(val string, p *[]string) *nodeIdentitiesValue {
+func newCommaSeparatedStringsValue(val string, p *[]string) *commaSeparatedStringsValue {
 	*p = []string{}
 	if val != "" {
 		*p = strings.Split(val, ",")
 	}
-	return (*nodeIdentitiesValue)(p)
+	return (*commaSeparatedStringsValue)(p)
 }
 
-func (s *nodeIdentitiesValue) Set(val string) error {
-	*s = nodeIdentitiesValue(strings.Split(val, ","))
+func (s *commaSeparatedStringsValue) Set(val string) error {
+	*s = []string{}
+	if val != "" {
+		*s = commaSeparatedStringsValue(strings.Split(val, ","))
+	}
 	return nil
 }
 
-func (s *nodeIdentitiesValue) Get() any { return []string(*s) }
+func (s *commaSeparatedStringsValue) Get() any { return []string(*s) }
 
-func (s *nodeIdentitiesValue) String() string { return strings.Join(*s, ",") }
+func (s *commaSeparatedStringsValue) String() string { return strings.Join(*s, ",") }
 
 type optionsKey struct{}
 
+const NetworkPluginModeOverlay = "overlay"
+
+const (
+	// LabelConflictPolicyWarn logs the labels of nodeClaims overridden by labels Karpenter computes for nodes
+	LabelConflictPolicyWarn = "warn"
+	// LabelConflictPolicyError fails launching nodes whose nodeClaim labels collide with labels Karpenter computes for nodes
+	LabelConflictPolicyError = "error"
+)
+
+// defaultRequirementTags are the nodeClaim requirements recorded as VM tags, for auditing why an instance type was chosen
+var defaultRequirementTags = []string{"karpenter.sh/capacity-type", "kubernetes.io/arch", "topology.kubernetes.io/zone"}
+
 type Options struct {
 	ClusterName                    string
 	ClusterEndpoint                string // => APIServerName in bootstrap, except needs to be w/o https/port
 	VMMemoryOverheadPercent        float64
 	ClusterID                      string
 	KubeletClientTLSBootstrapToken string   // => TLSBootstrapToken in bootstrap (may need to be per node/nodepool)
+	SecureTLSBootstrapping         bool     // => SecureTLSBootstrappingEnabled in bootstrap, which then omits the bootstrap token
+	OIDCIssuerURL                  string   // => OIDCIssuerURL in bootstrap, for workload identity
 	SSHPublicKey                   string   // ssh.publicKeys.keyData => VM SSH public key // TODO: move to v1alpha2.AKSNodeClass?
 	NetworkPlugin                  string   // => NetworkPlugin in bootstrap
 	NetworkPolicy                  string   // => NetworkPolicy in bootstrap
+	NetworkPluginMode              string   // => "overlay" for Azure CNI Overlay, empty for Azure CNI with pods in the node subnet
+	IPv6DualStack                  bool     // => Whether the cluster is dual-stack, where nodes must not disable IPv6
+	ServiceCIDR                    string   // => Service CIDR of the cluster, which the cluster DNS IP is validated against
+	ClusterDNSIP                   string   // => --cluster-dns of the kubelet, the IP of the kube-dns service
+	BootstrapProfile               string   // => Bootstrap contract of node user data, "aks" or "kubeadm" for self-managed control planes
 	NodeIdentities                 []string // => Applied onto each VM
+	DisableManagedClusterTag       bool     // => Omits the karpenter.azure.com/cluster tag from each VM
+	NodeClaimTags                  bool     // => Tags each VM with the names of its NodeClaim and NodePool
+	RequirementTags                []string // => Keys of the nodeClaim requirements whose values are tagged onto each VM
+	TagKeySeparator                string   // => Replaces the characters ARM does not allow in tag keys, such as the / of label keys
+	TagKeyPrefix                   string   // => Prepended to the keys of the tags of each VM, other than those Karpenter discovers VMs by
+	ApprovedImageDigests           []string // => Digests of the only images nodes may be launched from, if any
+	DefaultImageFamily             string   // => Image family of the AKSNodeClasses that don't specify one
+	LabelConflictPolicy            string   // => "warn" or "error" on nodeClaim labels colliding with labels computed for nodes
+
+	StartupTaintRemovalTimeout time.Duration // => Karpenter removes the remaining startup taints of nodes after it, if positive
+	LaunchTemplateEvents       bool          // => Records an event on each NodeClaim its launch template is resolved for
+
+	NodeHTTPProxy          string   // => HTTPProxyURLs in bootstrap
+	NodeHTTPSProxy         string   // => HTTPSProxyURLs in bootstrap
+	NodeNoProxy            []string // => NoProxyURLs in bootstrap, in addition to the Azure platform endpoints
+	NodeHTTPProxyTrustedCA string   // => HTTPProxyTrustedCA in bootstrap (base64 encoded)
 
 	SubnetID string // => VnetSubnetID to use (for nodes in Azure CNI Overlay and Azure CNI + pod subnet; for for nodes and pods in Azure CNI), unless overridden via AKSNodeClass
 
@@ -77,12 +120,33 @@ func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	fs.StringVar(&o.ClusterName, "cluster-name", env.WithDefaultString("CLUSTER_NAME", ""), "[REQUIRED] The kubernetes cluster name for resource tags.")
 	fs.StringVar(&o.ClusterEndpoint, "cluster-endpoint", env.WithDefaultString("CLUSTER_ENDPOINT", ""), "[REQUIRED] The external kubernetes cluster endpoint for new nodes to connect with.")
 	fs.Float64Var(&o.VMMemoryOverheadPercent, "vm-memory-overhead-percent", env.WithDefaultFloat64("VM_MEMORY_OVERHEAD_PERCENT", 0.075), "The VM memory overhead as a percent that will be subtracted from the total memory for all instance types.")
-	fs.StringVar(&o.KubeletClientTLSBootstrapToken, "kubelet-bootstrap-token", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN", ""), "[REQUIRED] The bootstrap token for new nodes to join the cluster.")
+	fs.StringVar(&o.KubeletClientTLSBootstrapToken, "kubelet-bootstrap-token", env.WithDefaultString("KUBELET_BOOTSTRAP_TOKEN", ""), "[REQUIRED] The bootstrap token for new nodes to join the cluster, unless secure-tls-bootstrapping is enabled.")
+	fs.BoolVar(&o.SecureTLSBootstrapping, "secure-tls-bootstrapping", env.WithDefaultBool("SECURE_TLS_BOOTSTRAPPING", false), "Whether new nodes join the cluster with secure TLS bootstrapping, authenticating with the kubelet identity to have their kubelet client certificate signing request approved, rather than with the bootstrap token. The bootstrap token is then not required, and omitted from node user data.")
+	fs.StringVar(&o.OIDCIssuerURL, "oidc-issuer-url", env.WithDefaultString("OIDC_ISSUER_URL", ""), "The HTTPS URL of the OIDC issuer of the cluster, for workloads on new nodes to federate their service account tokens with workload identity. Empty if the cluster has no OIDC issuer.")
 	fs.StringVar(&o.SSHPublicKey, "ssh-public-key", env.WithDefaultString("SSH_PUBLIC_KEY", ""), "[REQUIRED] VM SSH public key.")
 	fs.StringVar(&o.NetworkPlugin, "network-plugin", env.WithDefaultString("NETWORK_PLUGIN", "azure"), "The network plugin used by the cluster.")
 	fs.StringVar(&o.NetworkPolicy, "network-policy", env.WithDefaultString("NETWORK_POLICY", ""), "The network policy used by the cluster.")
+	fs.StringVar(&o.NetworkPluginMode, "network-plugin-mode", env.WithDefaultString("NETWORK_PLUGIN_MODE", NetworkPluginModeOverlay), "The network plugin mode used by the cluster with the azure network plugin, \"overlay\" or empty for the node subnet.")
+	fs.BoolVar(&o.IPv6DualStack, "ipv6-dual-stack", env.WithDefaultBool("IPV6_DUAL_STACK", false), "Whether the cluster is dual-stack (IPv4 and IPv6). Nodes of dual-stack clusters can't disable IPv6.")
+	fs.StringVar(&o.ServiceCIDR, "service-cidr", env.WithDefaultString("SERVICE_CIDR", "10.0.0.0/16"), "The service CIDR of the cluster, which the cluster DNS IP must be within. Defaults to that of AKS.")
+	fs.StringVar(&o.ClusterDNSIP, "cluster-dns-ip", env.WithDefaultString("CLUSTER_DNS_IP", "10.0.0.10"), "The IP of the kube-dns service of the cluster, which new nodes resolve cluster DNS names with. Defaults to that of AKS, and must be set for clusters with another service CIDR.")
+	fs.StringVar(&o.BootstrapProfile, "bootstrap-profile", env.WithDefaultString("BOOTSTRAP_PROFILE", bootstrap.ProfileAKS), "The bootstrap contract new nodes join the cluster with: \"aks\" for AKS clusters, or \"kubeadm\" for self-managed control planes, joining with kubeadm join and the kubelet bootstrap token. Images of the kubeadm profile must ship kubeadm, the kubelet and containerd.")
 	fs.StringVar(&o.SubnetID, "vnet-subnet-id", env.WithDefaultString("VNET_SUBNET_ID", ""), "The default subnet ID to use for new nodes. This must be a valid ARM resource ID for subnet that does not overlap with the service CIDR or the pod CIDR")
-	fs.Var(newNodeIdentitiesValue(env.WithDefaultString("NODE_IDENTITIES", ""), &o.NodeIdentities), "node-identities", "User assigned identities for nodes.")
+	fs.Var(newCommaSeparatedStringsValue(env.WithDefaultString("NODE_IDENTITIES", ""), &o.NodeIdentities), "node-identities", "User assigned identities for nodes.")
+	fs.StringVar(&o.NodeHTTPProxy, "node-http-proxy", env.WithDefaultString("NODE_HTTP_PROXY", ""), "The HTTP proxy URL for outbound connections from new nodes.")
+	fs.StringVar(&o.NodeHTTPSProxy, "node-https-proxy", env.WithDefaultString("NODE_HTTPS_PROXY", ""), "The HTTPS proxy URL for outbound connections from new nodes.")
+	fs.Var(newCommaSeparatedStringsValue(env.WithDefaultString("NODE_NO_PROXY", ""), &o.NodeNoProxy), "node-no-proxy", "Comma separated destinations new nodes connect to without the proxy.")
+	fs.StringVar(&o.NodeHTTPProxyTrustedCA, "node-http-proxy-trusted-ca", env.WithDefaultString("NODE_HTTP_PROXY_TRUSTED_CA", ""), "The base64 encoded CA certificate of the proxy, added to the trust store of new nodes.")
+	fs.Var(newCommaSeparatedStringsValue(env.WithDefaultString("REQUIREMENT_TAGS", strings.Join(defaultRequirementTags, ",")), &o.RequirementTags), "requirement-tags", "Comma separated keys of the nodeClaim requirements (such as the capacity type, architecture and zone) whose values are tagged onto each VM, for auditing. Empty to omit these tags.")
+	fs.Var(newCommaSeparatedStringsValue(env.WithDefaultString("APPROVED_IMAGE_DIGESTS", ""), &o.ApprovedImageDigests), "approved-image-digests", "Comma separated sha256 digests of the images nodes may be launched from, where the digest of an image is that of its lowercase image version ID. Empty to allow any image.")
+	fs.StringVar(&o.DefaultImageFamily, "default-image-family", env.WithDefaultString("DEFAULT_IMAGE_FAMILY", v1alpha2.Ubuntu2204ImageFamily), "The image family of nodes whose AKSNodeClass doesn't specify one, one of "+strings.Join(v1alpha2.ImageFamilies, ", ")+".")
+	fs.StringVar(&o.LabelConflictPolicy, "label-conflict-policy", env.WithDefaultString("LABEL_CONFLICT_POLICY", LabelConflictPolicyWarn), "What to do when a label of a nodeClaim, from its NodePool, collides with a different value of a label Karpenter computes for nodes, such as the kubernetes.azure.com/* labels of the node subnet: \"warn\" logs the collision and launches the node with the computed label, \"error\" fails launching the node.")
+	fs.DurationVar(&o.StartupTaintRemovalTimeout, "startup-taint-removal-timeout", env.WithDefaultDuration("STARTUP_TAINT_REMOVAL_TIMEOUT", 0), "The time after a node registers at which Karpenter removes the startup taints of its NodePool the node still has, for nodes not to stay unschedulable when the controller expected to remove a startup taint never does. 0 to keep startup taints until removed.")
+	fs.BoolVar(&o.LaunchTemplateEvents, "launch-template-events", env.WithDefaultBool("LAUNCH_TEMPLATE_EVENTS", false), "Whether to record an event on each NodeClaim once its launch template is resolved, with the image, architecture and template hash. Events are rate limited.")
+	fs.BoolVar(&o.NodeClaimTags, "nodeclaim-tags", env.WithDefaultBool("NODECLAIM_TAGS", true), "Whether to tag VMs with the names of their NodeClaim (karpenter.sh/nodeclaim) and NodePool (karpenter.sh/nodepool), to trace VMs back to them.")
+	fs.StringVar(&o.TagKeySeparator, "tag-key-separator", env.WithDefaultString("TAG_KEY_SEPARATOR", "_"), "The string replacing the characters ARM does not allow in the keys of VM tags, such as the / of the label keys of requirement tags, for Azure Policy regimes which disallow the _ default. It must not contain any of <>%&\\?/.")
+	fs.StringVar(&o.TagKeyPrefix, "tag-key-prefix", env.WithDefaultString("TAG_KEY_PREFIX", ""), "A prefix of the keys of VM tags, including those of AKSNodeClasses, for Azure Policy regimes which require one. Tags Karpenter discovers VMs by (karpenter.azure.com_cluster and karpenter.sh_nodepool) are not prefixed. It must not contain any of <>%&\\?/.")
+	fs.BoolVar(&o.DisableManagedClusterTag, "disable-managed-cluster-tag", env.WithDefaultBool("DISABLE_MANAGED_CLUSTER_TAG", false), "Do not tag VMs with the karpenter.azure.com/cluster tag. WARNING: this may break discovery and garbage collection of Karpenter-managed resources.")
 }
 
 func (o Options) GetAPIServerName() string {
@@ -17,21 +17,46 @@ limitations under the License.
 package options
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/go-playground/validator/v10"
+	"github.com/samber/lo"
 	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+var imageDigestRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// invalidTagKeyRunes are the characters ARM does not allow in tag keys
+const invalidTagKeyRunes = `<>%&\?/`
+
 func (o Options) Validate() error {
 	validate := validator.New()
 	return multierr.Combine(
 		o.validateRequiredFields(),
 		o.validateEndpoint(),
+		o.validateOIDCIssuerURL(),
 		o.validateVMMemoryOverheadPercent(),
 		o.validateVnetSubnetID(),
+		o.validateNetworkPluginMode(),
+		o.validateClusterDNSIP(),
+		o.validateBootstrapProfile(),
+		o.validateNodeHTTPProxy(),
+		o.validateRequirementTags(),
+		o.validateTagKeySanitization(),
+		o.validateApprovedImageDigests(),
+		o.validateDefaultImageFamily(),
+		o.validateLabelConflictPolicy(),
+		o.validateStartupTaintRemovalTimeout(),
 		validate.Struct(o),
 	)
 }
@@ -44,6 +69,107 @@ func (o Options) validateVnetSubnetID() error {
 	return nil
 }
 
+func (o Options) validateNetworkPluginMode() error {
+	if o.NetworkPluginMode != "" && o.NetworkPluginMode != NetworkPluginModeOverlay {
+		return fmt.Errorf("network-plugin-mode \"%s\" is invalid, must be \"%s\" or empty", o.NetworkPluginMode, NetworkPluginModeOverlay)
+	}
+	return nil
+}
+
+func (o Options) validateClusterDNSIP() error {
+	_, serviceCIDR, err := net.ParseCIDR(o.ServiceCIDR)
+	if err != nil {
+		return fmt.Errorf("service-cidr \"%s\" is not a valid CIDR", o.ServiceCIDR)
+	}
+	clusterDNSIP := net.ParseIP(o.ClusterDNSIP)
+	if clusterDNSIP == nil {
+		return fmt.Errorf("cluster-dns-ip \"%s\" is not a valid IP", o.ClusterDNSIP)
+	}
+	if !serviceCIDR.Contains(clusterDNSIP) {
+		return fmt.Errorf("cluster-dns-ip \"%s\" is not within service-cidr \"%s\"", o.ClusterDNSIP, o.ServiceCIDR)
+	}
+	return nil
+}
+
+func (o Options) validateBootstrapProfile() error {
+	if _, ok := bootstrap.Profiles[o.BootstrapProfile]; !ok {
+		profiles := lo.Keys(bootstrap.Profiles)
+		sort.Strings(profiles)
+		return fmt.Errorf("bootstrap-profile \"%s\" is invalid, must be one of %s", o.BootstrapProfile, strings.Join(profiles, ", "))
+	}
+	if o.BootstrapProfile == bootstrap.ProfileKubeadm && o.KubeletClientTLSBootstrapToken == "" {
+		return fmt.Errorf("bootstrap-profile \"%s\" requires kubelet-bootstrap-token", o.BootstrapProfile)
+	}
+	return nil
+}
+
+func (o Options) validateNodeHTTPProxy() error {
+	for name, proxy := range map[string]string{"node-http-proxy": o.NodeHTTPProxy, "node-https-proxy": o.NodeHTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || !proxyURL.IsAbs() || proxyURL.Hostname() == "" {
+			return fmt.Errorf("%s \"%s\" is not a valid proxy URL", name, proxy)
+		}
+	}
+	if o.NodeHTTPProxyTrustedCA != "" {
+		if _, err := base64.StdEncoding.DecodeString(o.NodeHTTPProxyTrustedCA); err != nil {
+			return fmt.Errorf("node-http-proxy-trusted-ca is not base64 encoded: %w", err)
+		}
+	}
+	return nil
+}
+
+func (o Options) validateRequirementTags() error {
+	for _, key := range o.RequirementTags {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("requirement-tags entry \"%s\" is not a valid label key: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+func (o Options) validateTagKeySanitization() error {
+	if strings.ContainsAny(o.TagKeySeparator, invalidTagKeyRunes) {
+		return fmt.Errorf("tag-key-separator \"%s\" must not contain any of %s", o.TagKeySeparator, invalidTagKeyRunes)
+	}
+	if strings.ContainsAny(o.TagKeyPrefix, invalidTagKeyRunes) {
+		return fmt.Errorf("tag-key-prefix \"%s\" must not contain any of %s", o.TagKeyPrefix, invalidTagKeyRunes)
+	}
+	return nil
+}
+
+func (o Options) validateApprovedImageDigests() error {
+	for _, digest := range o.ApprovedImageDigests {
+		if !imageDigestRegex.MatchString(digest) {
+			return fmt.Errorf("approved-image-digests entry \"%s\" is not a sha256 digest, expected sha256:<64 lowercase hex characters>", digest)
+		}
+	}
+	return nil
+}
+
+func (o Options) validateDefaultImageFamily() error {
+	if !lo.Contains(v1alpha2.ImageFamilies, o.DefaultImageFamily) {
+		return fmt.Errorf("default-image-family \"%s\" is not one of %s", o.DefaultImageFamily, strings.Join(v1alpha2.ImageFamilies, ", "))
+	}
+	return nil
+}
+
+func (o Options) validateLabelConflictPolicy() error {
+	if o.LabelConflictPolicy != LabelConflictPolicyWarn && o.LabelConflictPolicy != LabelConflictPolicyError {
+		return fmt.Errorf("label-conflict-policy \"%s\" is invalid, must be \"%s\" or \"%s\"", o.LabelConflictPolicy, LabelConflictPolicyWarn, LabelConflictPolicyError)
+	}
+	return nil
+}
+
+func (o Options) validateStartupTaintRemovalTimeout() error {
+	if o.StartupTaintRemovalTimeout < 0 {
+		return fmt.Errorf("startup-taint-removal-timeout cannot be negative")
+	}
+	return nil
+}
+
 func (o Options) validateEndpoint() error {
 	if o.ClusterEndpoint == "" {
 		return nil
@@ -57,6 +183,17 @@ func (o Options) validateEndpoint() error {
 	return nil
 }
 
+func (o Options) validateOIDCIssuerURL() error {
+	if o.OIDCIssuerURL == "" {
+		return nil
+	}
+	issuer, err := url.Parse(o.OIDCIssuerURL)
+	if err != nil || issuer.Scheme != "https" || issuer.Hostname() == "" {
+		return fmt.Errorf("oidc-issuer-url \"%s\" is not a valid HTTPS URL", o.OIDCIssuerURL)
+	}
+	return nil
+}
+
 func (o Options) validateVMMemoryOverheadPercent() error {
 	if o.VMMemoryOverheadPercent < 0 {
 		return fmt.Errorf("vm-memory-overhead-percent cannot be negative")
@@ -71,7 +208,7 @@ func (o Options) validateRequiredFields() error {
 	if o.ClusterName == "" {
 		return fmt.Errorf("missing field, cluster-name")
 	}
-	if o.KubeletClientTLSBootstrapToken == "" {
+	if o.KubeletClientTLSBootstrapToken == "" && !o.SecureTLSBootstrapping {
 		return fmt.Errorf("missing field, kubelet-bootstrap-token")
 	}
 	if o.SSHPublicKey == "" {
@@ -21,6 +21,7 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -48,10 +49,31 @@ var _ = Describe("Options", func() {
 		"VM_MEMORY_OVERHEAD_PERCENT",
 		"CLUSTER_ID",
 		"KUBELET_BOOTSTRAP_TOKEN",
+		"SECURE_TLS_BOOTSTRAPPING",
+		"BOOTSTRAP_PROFILE",
+		"OIDC_ISSUER_URL",
 		"SSH_PUBLIC_KEY",
 		"NETWORK_PLUGIN",
 		"NETWORK_POLICY",
+		"NETWORK_PLUGIN_MODE",
+		"IPV6_DUAL_STACK",
+		"SERVICE_CIDR",
+		"CLUSTER_DNS_IP",
 		"NODE_IDENTITIES",
+		"DISABLE_MANAGED_CLUSTER_TAG",
+		"NODECLAIM_TAGS",
+		"TAG_KEY_SEPARATOR",
+		"TAG_KEY_PREFIX",
+		"REQUIREMENT_TAGS",
+		"APPROVED_IMAGE_DIGESTS",
+		"DEFAULT_IMAGE_FAMILY",
+		"LABEL_CONFLICT_POLICY",
+		"STARTUP_TAINT_REMOVAL_TIMEOUT",
+		"LAUNCH_TEMPLATE_EVENTS",
+		"NODE_HTTP_PROXY",
+		"NODE_HTTPS_PROXY",
+		"NODE_NO_PROXY",
+		"NODE_HTTP_PROXY_TRUSTED_CA",
 	}
 
 	var fs *coreoptions.FlagSet
@@ -88,10 +110,31 @@ var _ = Describe("Options", func() {
 			os.Setenv("CLUSTER_ENDPOINT", "https://environment-cluster-id-value-for-testing")
 			os.Setenv("VM_MEMORY_OVERHEAD_PERCENT", "0.3")
 			os.Setenv("KUBELET_BOOTSTRAP_TOKEN", "env-bootstrap-token")
+			os.Setenv("SECURE_TLS_BOOTSTRAPPING", "true")
+			os.Setenv("BOOTSTRAP_PROFILE", "kubeadm")
+			os.Setenv("OIDC_ISSUER_URL", "https://eastus.oic.prod-aks.azure.com/00000000-0000-0000-0000-000000000000/11111111-1111-1111-1111-111111111111/")
 			os.Setenv("SSH_PUBLIC_KEY", "env-ssh-public-key")
 			os.Setenv("NETWORK_PLUGIN", "env-network-plugin")
 			os.Setenv("NETWORK_POLICY", "env-network-policy")
+			os.Setenv("NETWORK_PLUGIN_MODE", "")
+			os.Setenv("IPV6_DUAL_STACK", "true")
+			os.Setenv("SERVICE_CIDR", "172.16.0.0/16")
+			os.Setenv("CLUSTER_DNS_IP", "172.16.0.10")
 			os.Setenv("NODE_IDENTITIES", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1,/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2")
+			os.Setenv("DISABLE_MANAGED_CLUSTER_TAG", "true")
+			os.Setenv("NODECLAIM_TAGS", "false")
+			os.Setenv("TAG_KEY_SEPARATOR", "-")
+			os.Setenv("TAG_KEY_PREFIX", "aks-")
+			os.Setenv("REQUIREMENT_TAGS", "karpenter.sh/capacity-type,topology.kubernetes.io/zone")
+			os.Setenv("STARTUP_TAINT_REMOVAL_TIMEOUT", "10m")
+			os.Setenv("LAUNCH_TEMPLATE_EVENTS", "true")
+			os.Setenv("DEFAULT_IMAGE_FAMILY", "AzureLinux")
+			os.Setenv("LABEL_CONFLICT_POLICY", "error")
+			os.Setenv("APPROVED_IMAGE_DIGESTS", "sha256:6c0c1e4b5d0f8a7a3f1b2e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b")
+			os.Setenv("NODE_HTTP_PROXY", "http://proxy.internal:3128")
+			os.Setenv("NODE_HTTPS_PROXY", "http://proxy.internal:3129")
+			os.Setenv("NODE_NO_PROXY", "10.0.0.0/8,.internal")
+			os.Setenv("NODE_HTTP_PROXY_TRUSTED_CA", "Y2EtYnVuZGxl")
 			os.Setenv("VNET_SUBNET_ID", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub")
 			fs = &coreoptions.FlagSet{
 				FlagSet: flag.NewFlagSet("karpenter", flag.ContinueOnError),
@@ -105,13 +148,59 @@ var _ = Describe("Options", func() {
 				VMMemoryOverheadPercent:        lo.ToPtr(0.3),
 				ClusterID:                      lo.ToPtr("46593302"),
 				KubeletClientTLSBootstrapToken: lo.ToPtr("env-bootstrap-token"),
+				SecureTLSBootstrapping:         lo.ToPtr(true),
+				BootstrapProfile:               lo.ToPtr("kubeadm"),
+				OIDCIssuerURL:                  lo.ToPtr("https://eastus.oic.prod-aks.azure.com/00000000-0000-0000-0000-000000000000/11111111-1111-1111-1111-111111111111/"),
 				SSHPublicKey:                   lo.ToPtr("env-ssh-public-key"),
 				NetworkPlugin:                  lo.ToPtr("env-network-plugin"),
 				NetworkPolicy:                  lo.ToPtr("env-network-policy"),
+				NetworkPluginMode:              lo.ToPtr(""),
+				IPv6DualStack:                  lo.ToPtr(true),
+				ServiceCIDR:                    lo.ToPtr("172.16.0.0/16"),
+				ClusterDNSIP:                   lo.ToPtr("172.16.0.10"),
 				SubnetID:                       lo.ToPtr("/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
 				NodeIdentities:                 []string{"/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid1", "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/envid2"},
+				DisableManagedClusterTag:       lo.ToPtr(true),
+				NodeClaimTags:                  lo.ToPtr(false),
+				TagKeySeparator:                lo.ToPtr("-"),
+				TagKeyPrefix:                   lo.ToPtr("aks-"),
+				RequirementTags:                []string{"karpenter.sh/capacity-type", "topology.kubernetes.io/zone"},
+				StartupTaintRemovalTimeout:     lo.ToPtr(10 * time.Minute),
+				LaunchTemplateEvents:           lo.ToPtr(true),
+				ApprovedImageDigests:           []string{"sha256:6c0c1e4b5d0f8a7a3f1b2e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b"},
+				DefaultImageFamily:             lo.ToPtr("AzureLinux"),
+				LabelConflictPolicy:            lo.ToPtr("error"),
+				NodeHTTPProxy:                  lo.ToPtr("http://proxy.internal:3128"),
+				NodeHTTPSProxy:                 lo.ToPtr("http://proxy.internal:3129"),
+				NodeNoProxy:                    []string{"10.0.0.0/8", ".internal"},
+				NodeHTTPProxyTrustedCA:         lo.ToPtr("Y2EtYnVuZGxl"),
 			}))
 		})
+		It("should default requirement tags to the capacity type, architecture and zone", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.RequirementTags).To(Equal([]string{"karpenter.sh/capacity-type", "kubernetes.io/arch", "topology.kubernetes.io/zone"}))
+		})
+		It("should omit requirement tags when set to empty", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--requirement-tags", "",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opts.RequirementTags).To(BeEmpty())
+		})
 	})
 
 	Context("Validation", func() {
@@ -142,6 +231,41 @@ var _ = Describe("Options", func() {
 			)
 			Expect(err).To(MatchError(ContainSubstring("missing field, kubelet-bootstrap-token")))
 		})
+		It("should not require kubeletClientTLSBootstrapToken with secure TLS bootstrapping", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--secure-tls-bootstrapping",
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should fail when the bootstrap profile is unknown", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--bootstrap-profile", "eks",
+			)
+			Expect(err).To(MatchError(ContainSubstring("bootstrap-profile \"eks\" is invalid, must be one of aks, kubeadm")))
+		})
+		It("should fail when the kubeadm bootstrap profile has no bootstrap token", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--vnet-subnet-id", "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub",
+				"--secure-tls-bootstrapping",
+				"--bootstrap-profile", "kubeadm",
+			)
+			Expect(err).To(MatchError(ContainSubstring("bootstrap-profile \"kubeadm\" requires kubelet-bootstrap-token")))
+		})
 		It("should fail validation when SSHPublicKey not included", func() {
 			err := opts.Parse(
 				fs,
@@ -194,6 +318,159 @@ var _ = Describe("Options", func() {
 			)
 			Expect(err).To(MatchError(ContainSubstring("vm-memory-overhead-percent cannot be negative")))
 		})
+		It("should fail when oidcIssuerURL is not an HTTPS URL", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--oidc-issuer-url", "http://eastus.oic.prod-aks.azure.com/issuer/",
+			)
+			Expect(err).To(MatchError(ContainSubstring("oidc-issuer-url \"http://eastus.oic.prod-aks.azure.com/issuer/\" is not a valid HTTPS URL")))
+		})
+		It("should fail when nodeHTTPProxy is invalid (not absolute)", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--node-http-proxy", "proxy.internal:3128",
+			)
+			Expect(err).To(MatchError(ContainSubstring("node-http-proxy \"proxy.internal:3128\" is not a valid proxy URL")))
+		})
+		It("should fail when nodeHTTPProxyTrustedCA is not base64 encoded", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--node-http-proxy-trusted-ca", "-----BEGIN CERTIFICATE-----",
+			)
+			Expect(err).To(MatchError(ContainSubstring("node-http-proxy-trusted-ca is not base64 encoded")))
+		})
+		It("should fail when a requirement tag is not a label key", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--requirement-tags", "karpenter.sh/capacity-type,zone?",
+			)
+			Expect(err).To(MatchError(ContainSubstring("requirement-tags entry \"zone?\" is not a valid label key")))
+		})
+		It("should fail when the cluster DNS IP is not within the service CIDR", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--service-cidr", "172.16.0.0/16",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cluster-dns-ip \"10.0.0.10\" is not within service-cidr \"172.16.0.0/16\"")))
+		})
+		It("should fail when the cluster DNS IP is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--cluster-dns-ip", "10.0.0",
+			)
+			Expect(err).To(MatchError(ContainSubstring("cluster-dns-ip \"10.0.0\" is not a valid IP")))
+		})
+		It("should fail when the tag key separator contains characters ARM does not allow", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--tag-key-separator", "/",
+			)
+			Expect(err).To(MatchError(ContainSubstring("tag-key-separator \"/\" must not contain any of")))
+		})
+		It("should fail when the tag key prefix contains characters ARM does not allow", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--tag-key-prefix", "aks?",
+			)
+			Expect(err).To(MatchError(ContainSubstring("tag-key-prefix \"aks?\" must not contain any of")))
+		})
+		It("should fail when the startup taint removal timeout is negative", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--startup-taint-removal-timeout", "-1m",
+			)
+			Expect(err).To(MatchError(ContainSubstring("startup-taint-removal-timeout cannot be negative")))
+		})
+		It("should fail when an approved image digest is not a sha256 digest", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--approved-image-digests", "sha256:6C0C1E4B5D0F8A7A3F1B2E9D8C7B6A5F4E3D2C1B0A9F8E7D6C5B4A3F2E1D0C9B",
+			)
+			Expect(err).To(MatchError(ContainSubstring("approved-image-digests entry \"sha256:6C0C1E4B5D0F8A7A3F1B2E9D8C7B6A5F4E3D2C1B0A9F8E7D6C5B4A3F2E1D0C9B\" is not a sha256 digest")))
+
+			err = opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--approved-image-digests", "6c0c1e4b5d0f8a7a3f1b2e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b",
+			)
+			Expect(err).To(MatchError(ContainSubstring("is not a sha256 digest")))
+		})
+		It("should fail when the default image family is unknown", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--default-image-family", "Windows2022",
+			)
+			Expect(err).To(MatchError(ContainSubstring("default-image-family \"Windows2022\" is not one of Ubuntu2204, AzureLinux")))
+		})
+		It("should fail when the label conflict policy is unknown", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--label-conflict-policy", "ignore",
+			)
+			Expect(err).To(MatchError(ContainSubstring("label-conflict-policy \"ignore\" is invalid, must be \"warn\" or \"error\"")))
+		})
+		It("should fail when networkPluginMode is invalid", func() {
+			err := opts.Parse(
+				fs,
+				"--cluster-name", "my-name",
+				"--cluster-endpoint", "https://karpenter-000000000000.hcp.westus2.staging.azmk8s.io",
+				"--kubelet-bootstrap-token", "flag-bootstrap-token",
+				"--ssh-public-key", "flag-ssh-public-key",
+				"--network-plugin-mode", "podsubnet",
+			)
+			Expect(err).To(MatchError(ContainSubstring("network-plugin-mode \"podsubnet\" is invalid")))
+		})
 	})
 })
 
@@ -204,8 +481,29 @@ func expectOptionsEqual(optsA *options.Options, optsB *options.Options) {
 	Expect(optsA.VMMemoryOverheadPercent).To(Equal(optsB.VMMemoryOverheadPercent))
 	Expect(optsA.ClusterID).To(Equal(optsB.ClusterID))
 	Expect(optsA.KubeletClientTLSBootstrapToken).To(Equal(optsB.KubeletClientTLSBootstrapToken))
+	Expect(optsA.SecureTLSBootstrapping).To(Equal(optsB.SecureTLSBootstrapping))
+	Expect(optsA.BootstrapProfile).To(Equal(optsB.BootstrapProfile))
+	Expect(optsA.OIDCIssuerURL).To(Equal(optsB.OIDCIssuerURL))
 	Expect(optsA.SSHPublicKey).To(Equal(optsB.SSHPublicKey))
 	Expect(optsA.NetworkPlugin).To(Equal(optsB.NetworkPlugin))
 	Expect(optsA.NetworkPolicy).To(Equal(optsB.NetworkPolicy))
+	Expect(optsA.NetworkPluginMode).To(Equal(optsB.NetworkPluginMode))
 	Expect(optsA.NodeIdentities).To(Equal(optsB.NodeIdentities))
+	Expect(optsA.DisableManagedClusterTag).To(Equal(optsB.DisableManagedClusterTag))
+	Expect(optsA.NodeClaimTags).To(Equal(optsB.NodeClaimTags))
+	Expect(optsA.TagKeySeparator).To(Equal(optsB.TagKeySeparator))
+	Expect(optsA.TagKeyPrefix).To(Equal(optsB.TagKeyPrefix))
+	Expect(optsA.RequirementTags).To(Equal(optsB.RequirementTags))
+	Expect(optsA.ApprovedImageDigests).To(Equal(optsB.ApprovedImageDigests))
+	Expect(optsA.IPv6DualStack).To(Equal(optsB.IPv6DualStack))
+	Expect(optsA.ServiceCIDR).To(Equal(optsB.ServiceCIDR))
+	Expect(optsA.ClusterDNSIP).To(Equal(optsB.ClusterDNSIP))
+	Expect(optsA.StartupTaintRemovalTimeout).To(Equal(optsB.StartupTaintRemovalTimeout))
+	Expect(optsA.LaunchTemplateEvents).To(Equal(optsB.LaunchTemplateEvents))
+	Expect(optsA.DefaultImageFamily).To(Equal(optsB.DefaultImageFamily))
+	Expect(optsA.LabelConflictPolicy).To(Equal(optsB.LabelConflictPolicy))
+	Expect(optsA.NodeHTTPProxy).To(Equal(optsB.NodeHTTPProxy))
+	Expect(optsA.NodeHTTPSProxy).To(Equal(optsB.NodeHTTPSProxy))
+	Expect(optsA.NodeNoProxy).To(Equal(optsB.NodeNoProxy))
+	Expect(optsA.NodeHTTPProxyTrustedCA).To(Equal(optsB.NodeHTTPProxyTrustedCA))
 }
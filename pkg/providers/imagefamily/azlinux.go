@@ -74,19 +74,68 @@ func (u AzureLinux) DefaultImages() []DefaultImageOutput {
 
 // UserData returns the default userdata script for the image Family
 func (u AzureLinux) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, _ *cloudprovider.InstanceType) bootstrap.Bootstrapper {
-	return bootstrap.AKS{
+	return bootstrap.ForProfile(u.Options.BootstrapProfile, bootstrap.AKS{
 		Options: bootstrap.Options{
 			ClusterName:      u.Options.ClusterName,
 			ClusterEndpoint:  u.Options.ClusterEndpoint,
 			KubeletConfig:    kubeletConfig,
 			Taints:           taints,
 			Labels:           labels,
+			Annotations:      u.Options.Annotations,
 			CABundle:         caBundle,
 			GPUNode:          u.Options.GPUNode,
 			GPUDriverVersion: u.Options.GPUDriverVersion,
 			// GPUImageSHA: u.Options.GPUImageSHA - GPU image SHA only applies to Ubuntu
 			// See: https://github.com/Azure/AgentBaker/blob/f393d6e4d689d9204d6000c85623ad9b764e2a29/vhdbuilder/packer/install-dependencies.sh#L201
-			SubnetID: u.Options.SubnetID,
+			GPUPersistenceMode:     u.Options.GPUPersistenceMode,
+			GPUMIGProfile:          u.Options.GPUMIGProfile,
+			SubnetID:               u.Options.SubnetID,
+			Hostname:               u.Options.Hostname,
+			MTU:                    u.Options.MTU,
+			DNSServers:             u.Options.DNSServers,
+			DNSSearchDomains:       u.Options.DNSSearchDomains,
+			DisableDNSStubListener: u.Options.DisableDNSStubListener,
+			DisableIPv6:            u.Options.DisableIPv6,
+			TCPCongestionControl:   u.Options.TCPCongestionControl,
+			SandboxRuntime:         u.Options.SandboxRuntime,
+			DefaultRuntimeHandler:  u.Options.DefaultRuntimeHandler,
+			EntropySource:          u.Options.EntropySource,
+			SwapAccounting:         u.Options.SwapAccounting,
+			RoCE:                   u.Options.RoCE,
+			AdditionalCAs:          u.Options.AdditionalCAs,
+			Spot:                   u.Options.Spot,
+
+			ConntrackMax:                   u.Options.ConntrackMax,
+			ConntrackTCPTimeoutEstablished: u.Options.ConntrackTCPTimeoutEstablished,
+			ConntrackTCPTimeoutCloseWait:   u.Options.ConntrackTCPTimeoutCloseWait,
+
+			NetworkSysctls: u.Options.NetworkSysctls,
+			Sysctls:        u.Options.Sysctls,
+
+			RegistryMirrors:           u.Options.RegistryMirrors,
+			ImagePullCredentials:      u.Options.ImagePullCredentials,
+			CNIBinDir:                 u.Options.CNIBinDir,
+			CNIConfDir:                u.Options.CNIConfDir,
+			MaxConcurrentDownloads:    u.Options.MaxConcurrentDownloads,
+			LocalStorageDiscoveryPath: u.Options.LocalStorageDiscoveryPath,
+			LocalStorageRAID0:         u.Options.LocalStorageRAID0,
+
+			OOMScoreAdj:         u.Options.OOMScoreAdj,
+			KubeletFeatureGates: u.Options.KubeletFeatureGates,
+			KubeletCgroupDriver: u.Options.KubeletCgroupDriver,
+
+			ReadinessCommand:               u.Options.ReadinessCommand,
+			SystemdUnits:                   u.Options.SystemdUnits,
+			ReadinessCommandTimeoutSeconds: u.Options.ReadinessCommandTimeoutSeconds,
+			PrePullImages:                  u.Options.PrePullImages,
+			PrePullImagesInBackground:      u.Options.PrePullImagesInBackground,
+			RegistrationTimeoutSeconds:     u.Options.RegistrationTimeoutSeconds,
+			RegistrationRetryCount:         u.Options.RegistrationRetryCount,
+
+			HTTPProxy:          u.Options.HTTPProxy,
+			HTTPSProxy:         u.Options.HTTPSProxy,
+			NoProxy:            u.Options.NoProxy,
+			HTTPProxyTrustedCA: u.Options.HTTPProxyTrustedCA,
 		},
 		Arch:                           u.Options.Arch,
 		TenantID:                       u.Options.TenantID,
@@ -96,9 +145,13 @@ func (u AzureLinux) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, ta
 		ResourceGroup:                  u.Options.ResourceGroup,
 		ClusterID:                      u.Options.ClusterID,
 		APIServerName:                  u.Options.APIServerName,
+		APIServerPort:                  u.Options.APIServerPort,
 		KubeletClientTLSBootstrapToken: u.Options.KubeletClientTLSBootstrapToken,
+		SecureTLSBootstrapping:         u.Options.SecureTLSBootstrapping,
+		OIDCIssuerURL:                  u.Options.OIDCIssuerURL,
 		NetworkPlugin:                  u.Options.NetworkPlugin,
 		NetworkPolicy:                  u.Options.NetworkPolicy,
+		ClusterDNSIP:                   u.Options.ClusterDNSIP,
 		KubernetesVersion:              u.Options.KubernetesVersion,
-	}
+	})
 }
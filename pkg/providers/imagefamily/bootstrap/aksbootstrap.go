@@ -20,10 +20,13 @@ import (
 	"bytes"
 	_ "embed"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/blang/semver/v4"
 	"github.com/samber/lo"
@@ -45,10 +48,18 @@ type AKS struct {
 	ResourceGroup                  string
 	ClusterID                      string
 	APIServerName                  string
+	APIServerPort                  int32
 	KubeletClientTLSBootstrapToken string
-	NetworkPlugin                  string
-	NetworkPolicy                  string
-	KubernetesVersion              string
+	// SecureTLSBootstrapping joins the node with secure TLS bootstrapping, authenticating with the kubelet identity,
+	// rather than with the bootstrap token, which is then omitted
+	SecureTLSBootstrapping bool
+	// OIDCIssuerURL is the OIDC issuer of the cluster, which workloads federate their service account tokens with for workload identity
+	OIDCIssuerURL string
+	NetworkPlugin string
+	NetworkPolicy string
+	// ClusterDNSIP is the IP of the kube-dns service, rendered as the --cluster-dns of the kubelet, empty for the AKS default
+	ClusterDNSIP      string
+	KubernetesVersion string
 }
 
 var _ Bootstrapper = (*AKS)(nil) // assert AKS implements Bootstrapper
@@ -149,6 +160,7 @@ type NodeBootstrapVariables struct {
 	APIServerName                     string   // x   unique per cluster
 	IsVHD                             bool     // s   static-ish
 	GPUNode                           bool     // k   derived from VM size
+	GPUPersistenceMode                bool     // t   user input
 	SGXNode                           bool     // -   unused
 	MIGNode                           bool     // t   user input
 	ConfigGPUDriverIfNeeded           bool     // s   depends on hardware, unnecessary for oss, but aks provisions gpu drivers
@@ -192,7 +204,8 @@ type NodeBootstrapVariables struct {
 	HTTPSProxyURLs                    string   // c   user input [presumably cluster-level]
 	NoProxyURLs                       string   // c   user input [presumably cluster-level]
 	TLSBootstrappingEnabled           bool     // s   static true
-	SecureTLSBootstrappingEnabled     bool     // s   static false
+	SecureTLSBootstrappingEnabled     bool     // c   user input, rather than the bootstrap token
+	OIDCIssuerURL                     string   // c   user input, the OIDC issuer of the cluster for workload identity
 	DHCPv6ServiceFilepath             string   // k   derived from user input [how?]
 	DHCPv6ConfigFilepath              string   // k   derived from user input [how?]
 	THPEnabled                        string   // c   user input [presumably cluster-level][should be bool?]
@@ -216,11 +229,49 @@ type NodeBootstrapVariables struct {
 	TLSBootstrapToken                 string   // X   nodepool or node specific. can be created automatically
 	KubeletFlags                      string   // psX unique per nodepool. partially user-specified, static, and RP-generated
 	KubeletNodeLabels                 string   // pk  node-pool specific. user-specified.
+	KubeletNodeLabelsPostBoot         string   // pk  labels exceeding the --node-labels length limit, applied after registration
+	NodeAnnotations                   string   // pk  user input, shell-quoted key=value pairs applied after registration
 	AzureEnvironmentFilepath          string   // s   can be made static [usually "/etc/kubernetes/azure.json", but my examples use ""?]
 	KubeCACrt                         string   // x   unique per cluster
-	KubenetTemplate                   string   // s   static
+	KubenetTemplate                   string   // s   static, except for the bridge MTU
+	MTU                               int32    // t   user input
+	Hostname                          string   // t   user input, with shell references to the zone resolved at boot
 	ContainerdConfigContent           string   // k   determined by GPU VM size, WASM support, Kata support
 	IsKata                            bool     // n   user-specified
+	GVisorReleaseURL                  string   // t   set when the gvisor sandbox runtime is enabled (user input)
+	DefaultRuntimeHandler             string   // t   containerd runtime handler of pods selecting no RuntimeClass, set when customized (user input)
+	EntropyAptPackage                 string   // t   set when an entropy source is enabled (user input), for Ubuntu
+	EntropyTdnfPackage                string   // t   set when an entropy source is enabled (user input), for AzureLinux
+	EntropyService                    string   // t   set when an entropy source is enabled (user input)
+	TCPCongestionControlModule        string   // t   kernel module of the TCP congestion control algorithm, set when not built in (user input)
+	SwapAccounting                    bool     // t   user input
+	RDMAKernelModules                 string   // t   set when RoCE is enabled (user input), for RDMA capable VM sizes
+	ReadinessCommand                  string   // t   base64 encoded, set when a readiness command is configured (user input)
+	ReadinessCommandTimeoutSeconds    int32    // t   user input
+	RegistrationAttempts              int32    // t   kubelet registration attempts, set when registration is tuned (user input)
+	RegistrationTimeoutSeconds        int32    // t   user input
+	ReadinessTaintKey                 string   // s   static, set when a readiness command or images pulled in the foreground are configured
+	ReadinessAnnotation               string   // s   static, annotated on the node for Karpenter to remove the readiness taint
+	PrePullImager                     string   // s   static base64 script, set when images are pre-pulled
+	PrePullImages                     string   // t   space separated image references to pre-pull (user input)
+	PrePullImagesInBackground         bool     // t   user input
+	SpotEvictionHandler               string   // s   static base64 script, set on spot nodes
+	SpotKubeletConfig                 string   // s   static base64 kubelet drop-in configuring graceful node shutdown, set on spot nodes
+	ResolvedConfig                    string   // t   base64 systemd-resolved drop-in setting DNS servers, search domains and the stub listener (user input)
+	DirectResolvConf                  bool     // t   point /etc/resolv.conf at the upstream DNS servers, with the stub listener disabled (user input)
+
+	ContainerdRegistryHosts   map[string]string // t   base64 hosts.toml of each mirrored registry (user input)
+	KubeletImagePullConfig    string            // t   base64 kubelet credential file of the private registries (user input, secret)
+	AdditionalCAs             string            // t   base64 PEM bundle of the additional CA certificates (user input)
+	CNIBinDir                 string            // t   directory of CNI plugin binaries, set when customized (user input)
+	CNIConfDir                string            // t   directory of CNI network configurations, set when customized (user input)
+	MaxConcurrentDownloads    int32             // t   layers pulled concurrently, set when customized (user input)
+	LocalDiskMounter          string            // s   static base64 script, set when local disks are mounted
+	LocalStorageDiscoveryPath string            // t   directory local disks are mounted in (user input)
+	LocalStorageRAID0         bool              // t   stripe local disks into a RAID 0 array (user input, derived from the instance type)
+	OOMScoreAdjust            map[string]int32  // t   OOMScoreAdjust of each systemd service (user input)
+	SystemdUnits              map[string]string // t   base64 unit file of each systemd unit (user input)
+	EnabledSystemdUnits       string            // t   systemd units enabled and started once written (user input)
 }
 
 var (
@@ -236,6 +287,14 @@ var (
 	sysctlContent []byte
 	//go:embed kubenet-cni.json.gtpl
 	kubenetTemplate []byte
+	//go:embed spot-eviction-handler.sh
+	spotEvictionHandler []byte
+	//go:embed spot-graceful-shutdown.conf
+	spotGracefulShutdownConfig []byte
+	//go:embed mount-local-disks.sh
+	localDiskMounter []byte
+	//go:embed pre-pull-images.sh
+	prePullImager []byte
 
 	// source note: unique per nodepool. partially user-specified, static, and RP-generated
 	// removed --image-pull-progress-deadline=30m  (not in 1.24?)
@@ -274,6 +333,16 @@ var (
 		"--tls-private-key-file":              "/etc/kubernetes/certs/kubeletserver.key",
 	}
 
+	// labels in these domains are applied at registration ahead of any others,
+	// as system components and scheduling may depend on them being present from the start
+	registrationNodeLabelDomains = []string{
+		"kubernetes.azure.com",
+		"karpenter.azure.com",
+		"karpenter.sh",
+		"kubernetes.io",
+		"k8s.io",
+	}
+
 	kubeletNodeLabelsBase = map[string]string{
 		"kubernetes.azure.com/mode": "user",
 	}
@@ -366,6 +435,7 @@ var (
 		NoProxyURLs:                     "",                                                                  // cd
 		TLSBootstrappingEnabled:         true,                                                                // s
 		SecureTLSBootstrappingEnabled:   false,                                                               // s
+		OIDCIssuerURL:                   "",                                                                  // c
 		THPEnabled:                      "",                                                                  // cd
 		THPDefrag:                       "",                                                                  // cd
 		ServicePrincipalFileContent:     base64.StdEncoding.EncodeToString([]byte("msi")),                    // s
@@ -392,8 +462,53 @@ var (
 
 const (
 	globalAKSMirror = "https://acs-mirror.azureedge.net"
+
+	// maxKubeletNodeLabelsLength bounds the length of the kubelet --node-labels value;
+	// labels beyond it are applied after the node registers
+	maxKubeletNodeLabelsLength = 4096
+
+	// defaultMTU is the Azure default MTU, as used by the kubenet CNI template
+	defaultMTU = 1500
+
+	sandboxRuntimeGVisor = "gvisor"
+	gvisorReleaseMirror  = "https://storage.googleapis.com/gvisor/releases/release"
+	gvisorVersion        = "20240513.0"
+
+	// rdmaKernelModules are loaded on RoCE nodes; nvidia_peermem (GPUDirect RDMA) is added on GPU nodes once the driver is installed
+	rdmaKernelModules = "mlx5_ib rdma_ucm ib_uverbs ib_umad"
+
+	// spotPriorityLabel marks spot nodes, as on AKS spot node pools
+	spotPriorityLabel = "kubernetes.azure.com/scalesetpriority"
+	// containerdAdditionalCAsPath is the PEM bundle of the additional CA certificates registry mirror hosts are trusted with
+	containerdAdditionalCAsPath = "/etc/containerd/additional-cas.crt"
+
+	// kubeletConfigDir holds kubelet configuration drop-ins, supported (beta, enabled by default) from Kubernetes 1.30
+	kubeletConfigDir = "/etc/kubernetes/kubelet.conf.d"
 )
 
+// entropySource is how an entropy daemon is installed, per package manager of the image families
+type entropySource struct {
+	aptPackage  string
+	tdnfPackage string
+	service     string
+}
+
+var entropySources = map[string]entropySource{
+	"rngd":    {aptPackage: "rng-tools5", tdnfPackage: "rng-tools", service: "rngd"},
+	"haveged": {aptPackage: "haveged", service: "haveged"},
+}
+
+// tcpCongestionControlModules are the kernel modules of the TCP congestion control algorithms not built into the kernel
+var tcpCongestionControlModules = map[string]string{
+	"bbr":   "tcp_bbr",
+	"htcp":  "tcp_htcp",
+	"dctcp": "tcp_dctcp",
+}
+
+// platformNoProxy are the destinations nodes always reach directly when a proxy is configured:
+// localhost, the Azure platform (WireServer) and the instance metadata service
+var platformNoProxy = []string{"localhost", "127.0.0.1", "168.63.129.16", "169.254.169.254"}
+
 func (a AKS) aksBootstrapScript() (string, error) {
 	// use these as the base / defaults
 	nbv := staticNodeBootstrapVars // don't need deep copy (yet)
@@ -445,7 +560,12 @@ func CredentialProviderURL(kubernetesVersion, arch string) string {
 func (a AKS) applyOptions(nbv *NodeBootstrapVariables) {
 	nbv.KubeCACrt = *a.CABundle
 	nbv.APIServerName = a.APIServerName
-	nbv.TLSBootstrapToken = a.KubeletClientTLSBootstrapToken
+	if a.SecureTLSBootstrapping {
+		nbv.SecureTLSBootstrappingEnabled = true
+	} else {
+		nbv.TLSBootstrapToken = a.KubeletClientTLSBootstrapToken
+	}
+	nbv.OIDCIssuerURL = a.OIDCIssuerURL
 
 	nbv.TenantID = a.TenantID
 	nbv.SubscriptionID = a.SubscriptionID
@@ -470,44 +590,301 @@ func (a AKS) applyOptions(nbv *NodeBootstrapVariables) {
 		nbv.ConfigGPUDriverIfNeeded = true
 		nbv.GPUDriverVersion = a.GPUDriverVersion
 		nbv.GPUImageSHA = a.GPUImageSHA
+		nbv.GPUPersistenceMode = a.GPUPersistenceMode
+		if a.GPUMIGProfile != "" {
+			nbv.MIGNode = true
+			nbv.GPUInstanceProfile = a.GPUMIGProfile
+		}
+	}
+
+	nbv.SysctlContent = base64.StdEncoding.EncodeToString(sysctlContentWith(a.sysctls()))
+
+	// the cgroup v2 setup of AKS images configures the kubelet and containerd (through SystemdCgroup) with the systemd cgroup
+	// driver, which is skipped for the cgroupfs driver, leaving both on cgroupfs
+	if a.KubeletCgroupDriver != "" {
+		nbv.NeedsCgroupV2 = a.KubeletCgroupDriver == v1alpha2.CgroupDriverSystemd
+	}
+
+	if a.Hostname != "" {
+		nbv.Hostname = strings.ReplaceAll(a.Hostname, HostnameZoneReference, "${HOSTNAME_ZONE:-0}")
+	}
+
+	if a.MTU > 0 {
+		nbv.MTU = a.MTU
+		nbv.KubenetTemplate = base64.StdEncoding.EncodeToString(kubenetTemplateWithMTU(a.MTU))
+	}
+
+	if a.HTTPProxy != "" || a.HTTPSProxy != "" {
+		nbv.ShouldConfigureHTTPProxy = true
+		nbv.HTTPProxyURLs = a.HTTPProxy
+		nbv.HTTPSProxyURLs = a.HTTPSProxy
+		nbv.NoProxyURLs = strings.Join(lo.Uniq(append(append([]string{}, platformNoProxy...), a.NoProxy...)), ",")
+	}
+	if a.HTTPProxyTrustedCA != "" {
+		nbv.ShouldConfigureHTTPProxyCA = true
+		nbv.HTTPProxyTrustedCA = a.HTTPProxyTrustedCA
+	}
+
+	if source, ok := entropySources[a.EntropySource]; ok {
+		nbv.EntropyAptPackage = source.aptPackage
+		nbv.EntropyTdnfPackage = source.tdnfPackage
+		nbv.EntropyService = source.service
 	}
+	nbv.TCPCongestionControlModule = tcpCongestionControlModules[a.TCPCongestionControl]
+
+	if a.RoCE {
+		nbv.RDMAKernelModules = rdmaKernelModules
+	}
+
+	if len(a.AdditionalCAs) > 0 {
+		nbv.AdditionalCAs = base64.StdEncoding.EncodeToString([]byte(additionalCABundle(a.AdditionalCAs)))
+	}
+	if len(a.RegistryMirrors) > 0 {
+		nbv.ContainerdRegistryHosts = lo.MapValues(a.RegistryMirrors, func(endpoints []string, registry string) string {
+			return base64.StdEncoding.EncodeToString(containerdRegistryHosts(registry, endpoints, len(a.AdditionalCAs) > 0))
+		})
+	}
+
+	if len(a.ImagePullCredentials) > 0 {
+		nbv.KubeletImagePullConfig = base64.StdEncoding.EncodeToString(kubeletImagePullConfig(a.ImagePullCredentials))
+	}
+
+	nbv.CNIBinDir = a.CNIBinDir
+	nbv.CNIConfDir = a.CNIConfDir
+	nbv.MaxConcurrentDownloads = a.MaxConcurrentDownloads
+
+	if a.LocalStorageDiscoveryPath != "" {
+		nbv.LocalDiskMounter = base64.StdEncoding.EncodeToString(localDiskMounter)
+		nbv.LocalStorageDiscoveryPath = a.LocalStorageDiscoveryPath
+		nbv.LocalStorageRAID0 = a.LocalStorageRAID0
+	}
+
+	nbv.OOMScoreAdjust = a.OOMScoreAdj
+
+	if len(a.SystemdUnits) > 0 {
+		nbv.SystemdUnits = lo.SliceToMap(a.SystemdUnits, func(unit SystemdUnit) (string, string) {
+			return unit.Name, base64.StdEncoding.EncodeToString([]byte(unit.Content))
+		})
+		nbv.EnabledSystemdUnits = strings.Join(lo.FilterMap(a.SystemdUnits, func(unit SystemdUnit, _ int) (string, bool) { return unit.Name, unit.Enabled }), " ")
+	}
+
+	nbv.SwapAccounting = a.SwapAccounting
+
+	if len(a.DNSServers) > 0 || len(a.DNSSearchDomains) > 0 || a.DisableDNSStubListener {
+		nbv.ResolvedConfig = base64.StdEncoding.EncodeToString(resolvedConfig(a.DNSServers, a.DNSSearchDomains, a.DisableDNSStubListener))
+		nbv.DirectResolvConf = a.DisableDNSStubListener
+	}
+
+	if a.RegistrationTimeoutSeconds > 0 {
+		nbv.RegistrationAttempts = a.RegistrationRetryCount + 1
+		nbv.RegistrationTimeoutSeconds = a.RegistrationTimeoutSeconds
+	}
+
+	if a.ReadinessCommand != "" {
+		nbv.ReadinessCommand = base64.StdEncoding.EncodeToString([]byte(a.ReadinessCommand))
+		nbv.ReadinessCommandTimeoutSeconds = a.ReadinessCommandTimeoutSeconds
+		nbv.ReadinessTaintKey = v1alpha2.TaintKeyReadinessCommand
+		nbv.ReadinessAnnotation = v1alpha2.AnnotationReadinessCommandSucceeded
+	}
+
+	if len(a.PrePullImages) > 0 {
+		nbv.PrePullImager = base64.StdEncoding.EncodeToString(prePullImager)
+		nbv.PrePullImages = strings.Join(a.PrePullImages, " ")
+		nbv.PrePullImagesInBackground = a.PrePullImagesInBackground
+		if !a.PrePullImagesInBackground {
+			nbv.ReadinessTaintKey = v1alpha2.TaintKeyReadinessCommand
+			nbv.ReadinessAnnotation = v1alpha2.AnnotationReadinessCommandSucceeded
+		}
+	}
+
+	if a.SandboxRuntime == sandboxRuntimeGVisor {
+		nbv.GVisorReleaseURL = gvisorReleaseURL(a.Arch)
+	}
+	nbv.DefaultRuntimeHandler = a.DefaultRuntimeHandler
 
 	// merge and stringify labels
 	kubeletLabels := lo.Assign(kubeletNodeLabelsBase, a.Labels)
 	getAgentbakerGeneratedLabels(a.ResourceGroup, kubeletLabels)
+	if a.Spot {
+		kubeletLabels[spotPriorityLabel] = "spot"
+	}
 
 	subnetParts, _ := utils.GetVnetSubnetIDComponents(a.SubnetID)
 	nbv.Subnet = subnetParts.SubnetName
 	nbv.VirtualNetworkResourceGroup = subnetParts.ResourceGroupName
 	nbv.VirtualNetwork = subnetParts.VNetName
 
-	nbv.KubeletNodeLabels = strings.Join(lo.MapToSlice(kubeletLabels, func(k, v string) string {
-		return fmt.Sprintf("%s=%s", k, v)
-	}), ",")
+	registrationLabels, postBootLabels := splitNodeLabels(kubeletLabels, maxKubeletNodeLabelsLength)
+	nbv.KubeletNodeLabels = strings.Join(registrationLabels, ",")
+	nbv.KubeletNodeLabelsPostBoot = strings.Join(postBootLabels, " ")
+	nbv.NodeAnnotations = nodeAnnotations(a.Annotations)
 
-	// Assign Per K8s version kubelet flags
+	// Assign Per K8s version kubelet flags, on a copy of the base flags so that they do not leak into other nodes
+	kubeletFlags := lo.Assign(kubeletFlagsBase)
 	credentialProviderURL := CredentialProviderURL(a.KubernetesVersion, a.Arch)
 	if credentialProviderURL != "" { // use OOT credential provider
 		nbv.CredentialProviderDownloadURL = credentialProviderURL
-		kubeletFlagsBase["--image-credential-provider-config"] = "/var/lib/kubelet/credential-provider-config.yaml"
-		kubeletFlagsBase["--image-credential-provider-bin-dir"] = "/var/lib/kubelet/credential-provider"
+		kubeletFlags["--image-credential-provider-config"] = "/var/lib/kubelet/credential-provider-config.yaml"
+		kubeletFlags["--image-credential-provider-bin-dir"] = "/var/lib/kubelet/credential-provider"
 	} else { // Versions Less than 1.30
-		kubeletFlagsBase["--azure-container-registry-config"] = "/etc/kubernetes/azure.json"
+		kubeletFlags["--azure-container-registry-config"] = "/etc/kubernetes/azure.json"
 	}
 	// merge and stringify taints
-	kubeletFlags := lo.Assign(kubeletFlagsBase)
 	if len(a.Taints) > 0 {
 		taintStrs := lo.Map(a.Taints, func(taint v1.Taint, _ int) string { return taint.ToString() })
 		kubeletFlags = lo.Assign(kubeletFlags, map[string]string{"--register-with-taints": strings.Join(taintStrs, ",")})
 	}
 
+	// spot nodes shut down gracefully on eviction, which is only configurable through kubelet configuration drop-ins
+	if a.Spot && semver.MustParse(a.KubernetesVersion).Minor >= 30 {
+		nbv.SpotEvictionHandler = base64.StdEncoding.EncodeToString(spotEvictionHandler)
+		nbv.SpotKubeletConfig = base64.StdEncoding.EncodeToString(spotGracefulShutdownConfig)
+		kubeletFlags["--config-dir"] = kubeletConfigDir
+	}
+
+	if a.ClusterDNSIP != "" {
+		kubeletFlags["--cluster-dns"] = a.ClusterDNSIP
+	}
+
+	if len(a.KubeletFeatureGates) > 0 {
+		kubeletFlags["--feature-gates"] = featureGatesFlag(a.KubeletFeatureGates)
+	}
+
+	if a.KubeletCgroupDriver != "" {
+		kubeletFlags["--cgroup-driver"] = a.KubeletCgroupDriver
+	}
+
 	nodeclaimKubeletConfig := KubeletConfigToMap(a.KubeletConfig)
 	kubeletFlags = lo.Assign(kubeletFlags, nodeclaimKubeletConfig)
 
-	// striginify kubelet flags (including taints)
-	nbv.KubeletFlags = strings.Join(lo.MapToSlice(kubeletFlags, func(k, v string) string {
+	// striginify kubelet flags (including taints), sorted so that the same options always render the same user data
+	kubeletFlagArgs := lo.MapToSlice(kubeletFlags, func(k, v string) string {
 		return fmt.Sprintf("%s=%s", k, v)
-	}), " ")
+	})
+	sort.Strings(kubeletFlagArgs)
+	nbv.KubeletFlags = strings.Join(kubeletFlagArgs, " ")
+}
+
+// featureGatesFlag renders feature gates as the kubelet --feature-gates value, sorted by name
+func featureGatesFlag(featureGates map[string]bool) string {
+	gates := lo.MapToSlice(featureGates, func(name string, enabled bool) string {
+		return fmt.Sprintf("%s=%t", name, enabled)
+	})
+	sort.Strings(gates)
+	return strings.Join(gates, ",")
+}
+
+// gvisorReleaseURL returns the gVisor release directory containing runsc and its containerd shim for the given arch
+func gvisorReleaseURL(arch string) string {
+	return fmt.Sprintf("%s/%s/%s", gvisorReleaseMirror, gvisorVersion, lo.Ternary(arch == "arm64", "aarch64", "x86_64"))
+}
+
+// containerdRegistryHosts returns the containerd hosts configuration of a registry, pulling through the mirror endpoints
+// in order and falling back to the registry itself, see https://github.com/containerd/containerd/blob/main/docs/hosts.md
+func containerdRegistryHosts(registry string, endpoints []string, additionalCAs bool) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "server = %q\n", registryServer(registry))
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&buffer, "\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", endpoint)
+		if additionalCAs {
+			// containerd trusts these on top of the system trust store
+			fmt.Fprintf(&buffer, "  ca = %q\n", containerdAdditionalCAsPath)
+		}
+	}
+	return buffer.Bytes()
+}
+
+// additionalCABundle returns the PEM bundle of the additional CA certificates, one per line
+func additionalCABundle(cas []string) string {
+	return strings.Join(lo.Map(cas, func(ca string, _ int) string { return strings.TrimSpace(ca) + "\n" }), "")
+}
+
+// kubeletImagePullConfig returns the kubelet credential file (a docker config.json) of the registry credentials, see
+// https://kubernetes.io/docs/concepts/containers/images/#configuring-nodes-to-authenticate-to-a-private-registry
+func kubeletImagePullConfig(credentials map[string]string) []byte {
+	type auth struct {
+		Auth string `json:"auth"`
+	}
+	config := struct {
+		Auths map[string]auth `json:"auths"`
+	}{
+		Auths: lo.MapEntries(credentials, func(registry, credential string) (string, auth) {
+			// the kubelet matches Docker Hub images against the legacy index key
+			return lo.Ternary(registry == "docker.io", "https://index.docker.io/v1/", registry), auth{Auth: credential}
+		}),
+	}
+	content, _ := json.Marshal(config) // cannot fail marshaling strings
+	return content
+}
+
+// registryServer returns the upstream URL of a registry; Docker Hub is not served at its registry name
+func registryServer(registry string) string {
+	if registry == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + registry
+}
+
+// resolvedConfig returns the systemd-resolved configuration of the DNS servers, search domains and stub listener; kubelet passes
+// the resolved upstream configuration (--resolv-conf) on to pods with the Default DNS policy
+func resolvedConfig(dnsServers, dnsSearchDomains []string, disableStubListener bool) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("[Resolve]\n")
+	if len(dnsServers) > 0 {
+		fmt.Fprintf(&buffer, "DNS=%s\n", strings.Join(dnsServers, " "))
+	}
+	if len(dnsSearchDomains) > 0 {
+		fmt.Fprintf(&buffer, "Domains=%s\n", strings.Join(dnsSearchDomains, " "))
+	}
+	if disableStubListener {
+		buffer.WriteString("DNSStubListener=no\n")
+	}
+	return buffer.Bytes()
+}
+
+// kubenetTemplateWithMTU returns the kubenet CNI template with the bridge MTU replaced.
+// The template itself is rendered by containerd on the node, so it can't carry our own template values.
+func kubenetTemplateWithMTU(mtu int32) []byte {
+	return bytes.Replace(kubenetTemplate, []byte(fmt.Sprintf(`"mtu": %d`, defaultMTU)), []byte(fmt.Sprintf(`"mtu": %d`, mtu)), 1)
+}
+
+// sysctls returns kernel parameters derived from options, applied in addition to the static sysctl configuration
+func (a AKS) sysctls() map[string]string {
+	sysctls := lo.Assign(a.NetworkSysctls, a.Sysctls)
+	if a.RoCE {
+		// reply to ARP only on the interface owning the address, as RoCE nodes have several interfaces on the same subnet
+		sysctls["net.ipv4.conf.all.arp_ignore"] = "1"
+		sysctls["net.ipv4.conf.all.arp_announce"] = "2"
+	}
+	if a.DisableIPv6 {
+		sysctls["net.ipv6.conf.all.disable_ipv6"] = "1"
+		sysctls["net.ipv6.conf.default.disable_ipv6"] = "1"
+	}
+	if a.TCPCongestionControl != "" {
+		sysctls["net.ipv4.tcp_congestion_control"] = a.TCPCongestionControl
+	}
+	if a.ConntrackMax > 0 {
+		sysctls["net.netfilter.nf_conntrack_max"] = fmt.Sprintf("%d", a.ConntrackMax)
+	}
+	if a.ConntrackTCPTimeoutEstablished > 0 {
+		sysctls["net.netfilter.nf_conntrack_tcp_timeout_established"] = fmt.Sprintf("%d", a.ConntrackTCPTimeoutEstablished)
+	}
+	if a.ConntrackTCPTimeoutCloseWait > 0 {
+		sysctls["net.netfilter.nf_conntrack_tcp_timeout_close_wait"] = fmt.Sprintf("%d", a.ConntrackTCPTimeoutCloseWait)
+	}
+	return sysctls
+}
+
+// sysctlContentWith appends the given kernel parameters, sorted by key, to the static sysctl configuration
+func sysctlContentWith(sysctls map[string]string) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(sysctlContent)
+	keys := lo.Keys(sysctls)
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buffer, "%s=%s\n", k, sysctls[k])
+	}
+	return buffer.Bytes()
 }
 
 func containerdConfigFromNodeBootstrapVars(nbv *NodeBootstrapVariables) (string, error) {
@@ -526,6 +903,52 @@ func getCustomDataFromNodeBootstrapVars(nbv *NodeBootstrapVariables) (string, er
 	return buffer.String(), nil
 }
 
+// splitNodeLabels renders labels as key=value pairs and splits them into those passed to kubelet --node-labels,
+// keeping the comma-joined result within maxLength, and the remainder, to be applied after the node registers.
+// Labels in registrationNodeLabelDomains take priority for registration; ordering is otherwise by key.
+func splitNodeLabels(labels map[string]string, maxLength int) (registration []string, postBoot []string) {
+	keys := lo.Keys(labels)
+	sort.SliceStable(keys, func(i, j int) bool {
+		iPriority, jPriority := isRegistrationNodeLabel(keys[i]), isRegistrationNodeLabel(keys[j])
+		if iPriority != jPriority {
+			return iPriority
+		}
+		return keys[i] < keys[j]
+	})
+
+	length := 0
+	for _, k := range keys {
+		label := fmt.Sprintf("%s=%s", k, labels[k])
+		// account for the separating comma
+		if length+len(label)+lo.Ternary(length > 0, 1, 0) > maxLength {
+			postBoot = append(postBoot, label)
+			continue
+		}
+		length += len(label) + lo.Ternary(length > 0, 1, 0)
+		registration = append(registration, label)
+	}
+	return registration, postBoot
+}
+
+// nodeAnnotations renders annotations as key=value arguments of kubectl, ordered by key. Values are arbitrary, so each argument is single-quoted.
+func nodeAnnotations(annotations map[string]string) string {
+	keys := lo.Keys(annotations)
+	sort.Strings(keys)
+	return strings.Join(lo.Map(keys, func(k string, _ int) string {
+		return "'" + strings.ReplaceAll(k+"="+annotations[k], "'", `'\''`) + "'"
+	}), " ")
+}
+
+func isRegistrationNodeLabel(key string) bool {
+	domain, _, found := strings.Cut(key, "/")
+	if !found {
+		return false
+	}
+	return lo.ContainsBy(registrationNodeLabelDomains, func(d string) bool {
+		return domain == d || strings.HasSuffix(domain, "."+d)
+	})
+}
+
 func getAgentbakerGeneratedLabels(nodeResourceGroup string, nodeLabels map[string]string) {
 	nodeLabels["kubernetes.azure.com/role"] = "agent"
 	nodeLabels["kubernetes.azure.com/cluster"] = normalizeResourceGroupNameForLabel(nodeResourceGroup)
@@ -588,13 +1011,14 @@ func KubeletConfigToMap(kubeletConfig *corev1beta1.KubeletConfiguration) map[str
 }
 
 // joinParameterArgsToMap joins a map of keys and values by their separator. The separator will sit between the
-// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2
+// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2, sorted by argument
 func JoinParameterArgsToMap[K comparable, V any](result map[string]string, name string, m map[K]V, separator string) {
 	var args []string
 
 	for k, v := range m {
 		args = append(args, fmt.Sprintf("%v%s%v", k, separator, v))
 	}
+	sort.Strings(args)
 	if len(args) > 0 {
 		result[name] = strings.Join(args, ",")
 	}
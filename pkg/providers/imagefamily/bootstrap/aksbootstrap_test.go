@@ -17,8 +17,18 @@ limitations under the License.
 package bootstrap
 
 import (
+	"encoding/base64"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/samber/lo"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 )
 
 func TestKubeBinaryURL(t *testing.T) {
@@ -108,3 +118,1201 @@ func TestGetCredentialProviderURL(t *testing.T) {
 		}
 	}
 }
+
+// testAKS returns a minimal AKS bootstrapper that renders successfully
+func testAKS() AKS {
+	return AKS{
+		Options: Options{
+			ClusterName:     "test-cluster",
+			ClusterEndpoint: "https://test-cluster.hcp.eastus.azmk8s.io:443",
+			CABundle:        lo.ToPtr("ca-bundle"),
+		},
+		Arch:              "amd64",
+		KubernetesVersion: "1.30.0",
+	}
+}
+
+func renderScript(t *testing.T, a AKS) string {
+	t.Helper()
+	encoded, err := a.Script()
+	if err != nil {
+		t.Fatalf("unexpected error rendering script: %v", err)
+	}
+	script, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding script: %v", err)
+	}
+	return string(script)
+}
+
+func TestKubeletFlagsDeterministic(t *testing.T) {
+	a := testAKS()
+	a.KubeletConfig = &corev1beta1.KubeletConfiguration{
+		SystemReserved: map[string]string{"cpu": "100m", "memory": "100Mi", "ephemeral-storage": "1Gi"},
+		EvictionHard:   map[string]string{"memory.available": "5%", "nodefs.available": "10%", "imagefs.available": "15%"},
+	}
+	script := renderScript(t, a)
+	for i := 0; i < 10; i++ {
+		if other := renderScript(t, a); other != script {
+			t.Fatalf("expected the same options to render the same script")
+		}
+	}
+	for _, e := range []string{
+		"--eviction-hard=imagefs.available<15%,memory.available<5%,nodefs.available<10%",
+		"--system-reserved=cpu=100m,ephemeral-storage=1Gi,memory=100Mi",
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+}
+
+func TestKubeletFlagsPerKubernetesVersion(t *testing.T) {
+	// flags of one Kubernetes version do not leak into nodes of another
+	a := testAKS()
+	a.KubernetesVersion = "1.29.0"
+	if script := renderScript(t, a); !strings.Contains(script, "--azure-container-registry-config=") {
+		t.Errorf("expected the in-tree credential provider flags for 1.29")
+	}
+	a.KubernetesVersion = "1.30.0"
+	if script := renderScript(t, a); strings.Contains(script, "--azure-container-registry-config=") {
+		t.Errorf("expected no in-tree credential provider flags for 1.30")
+	}
+}
+
+func TestGPUPersistenceMode(t *testing.T) {
+	tests := []struct {
+		name               string
+		gpuNode            bool
+		gpuPersistenceMode bool
+		expected           bool
+	}{
+		{name: "GPU node with persistence mode", gpuNode: true, gpuPersistenceMode: true, expected: true},
+		{name: "GPU node without persistence mode", gpuNode: true, gpuPersistenceMode: false, expected: false},
+		{name: "non-GPU node with persistence mode", gpuNode: false, gpuPersistenceMode: true, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.GPUNode = tt.gpuNode
+			a.GPUPersistenceMode = tt.gpuPersistenceMode
+			script := renderScript(t, a)
+			if actual := strings.Contains(script, "systemctl enable --now nvidia-persistenced\n"); actual != tt.expected {
+				t.Errorf("expected persistence mode step present to be %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestProvisionExitStatus(t *testing.T) {
+	a := testAKS()
+	a.GPUNode = true
+	a.GPUPersistenceMode = true
+	a.ReadinessCommand = "test -d /"
+	a.ReadinessCommandTimeoutSeconds = 10
+	for _, script := range []string{renderScript(t, testAKS()), renderScript(t, a)} {
+		// the steps after provisioning do not mask its failure
+		if !strings.Contains(script, `provision_start.sh"; PROVISION_EXIT=$?`+"\n") || !strings.HasSuffix(script, "\nexit $PROVISION_EXIT\n") {
+			t.Errorf("expected script to exit with the status of provisioning")
+		}
+	}
+}
+
+func TestGPUMIGProfile(t *testing.T) {
+	a := testAKS()
+	a.GPUNode = true
+	script := renderScript(t, a)
+	if !strings.Contains(script, "MIG_NODE=false") || !strings.Contains(script, `GPU_INSTANCE_PROFILE=""`) {
+		t.Errorf("expected no MIG partitioning without a MIG profile")
+	}
+
+	a.GPUMIGProfile = "MIG3g"
+	script = renderScript(t, a)
+	for _, expected := range []string{"MIG_NODE=true", `GPU_INSTANCE_PROFILE="MIG3g"`} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q", expected)
+		}
+	}
+
+	// the profile is ignored on nodes without a GPU
+	a.GPUNode = false
+	script = renderScript(t, a)
+	if !strings.Contains(script, "MIG_NODE=false") {
+		t.Errorf("expected no MIG partitioning on a non-GPU node")
+	}
+}
+
+func TestSplitNodeLabels(t *testing.T) {
+	labels := map[string]string{
+		"b":                          "2",
+		"a":                          "1",
+		"kubernetes.azure.com/mode":  "user",
+		"node.kubernetes.io/foo":     "bar",
+		"example.com/kubernetes.io":  "x",
+		"karpenter.sh/capacity-type": "spot",
+	}
+
+	registration, postBoot := splitNodeLabels(labels, 1000)
+	expected := []string{"karpenter.sh/capacity-type=spot", "kubernetes.azure.com/mode=user", "node.kubernetes.io/foo=bar", "a=1", "b=2", "example.com/kubernetes.io=x"}
+	if strings.Join(registration, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected registration labels %v, got %v", expected, registration)
+	}
+	if len(postBoot) != 0 {
+		t.Errorf("expected no post-boot labels, got %v", postBoot)
+	}
+
+	limit := len(strings.Join(expected[:4], ","))
+	registration, postBoot = splitNodeLabels(labels, limit)
+	if strings.Join(registration, ",") != strings.Join(expected[:4], ",") {
+		t.Errorf("expected registration labels %v, got %v", expected[:4], registration)
+	}
+	if strings.Join(postBoot, ",") != strings.Join(expected[4:], ",") {
+		t.Errorf("expected post-boot labels %v, got %v", expected[4:], postBoot)
+	}
+}
+
+func TestNodeLabelsLengthLimit(t *testing.T) {
+	labels := map[string]string{}
+	for i := 0; i < 500; i++ {
+		labels[fmt.Sprintf("example.com/label-%03d", i)] = strings.Repeat("v", 20)
+	}
+	a := testAKS()
+	a.Labels = labels
+	a.ResourceGroup = "test-resourceGroup"
+
+	nbv := staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	if len(nbv.KubeletNodeLabels) > maxKubeletNodeLabelsLength {
+		t.Errorf("expected node labels to be at most %d characters, got %d", maxKubeletNodeLabelsLength, len(nbv.KubeletNodeLabels))
+	}
+	for _, label := range []string{"kubernetes.azure.com/mode=user", "kubernetes.azure.com/role=agent", "kubernetes.azure.com/cluster=test-resourceGroup"} {
+		if !strings.Contains(nbv.KubeletNodeLabels, label) {
+			t.Errorf("expected %s to be applied at registration", label)
+		}
+	}
+	registered := strings.Split(nbv.KubeletNodeLabels, ",")
+	postBoot := strings.Fields(nbv.KubeletNodeLabelsPostBoot)
+	if len(postBoot) == 0 {
+		t.Fatalf("expected some labels to be applied after boot")
+	}
+	if len(registered)+len(postBoot) != len(labels)+3 {
+		t.Errorf("expected all %d labels to be applied, got %d", len(labels)+3, len(registered)+len(postBoot))
+	}
+
+	script := renderScript(t, a)
+	if !strings.Contains(script, "label node") || !strings.Contains(script, postBoot[len(postBoot)-1]) {
+		t.Errorf("expected post-boot label step in script")
+	}
+	if strings.Contains(renderScript(t, testAKS()), "label node") {
+		t.Errorf("expected no post-boot label step without excess labels")
+	}
+}
+
+func TestNodeAnnotations(t *testing.T) {
+	if strings.Contains(renderScript(t, testAKS()), "annotate node") {
+		t.Errorf("expected no annotation step without annotations")
+	}
+
+	a := testAKS()
+	a.Annotations = map[string]string{"example.com/owner": "team-a", "example.com/description": "it's a node"}
+	script := renderScript(t, a)
+	expected := `kubectl --kubeconfig /var/lib/kubelet/kubeconfig annotate node "$(hostname | tr '[:upper:]' '[:lower:]')" --overwrite 'example.com/description=it'\''s a node' 'example.com/owner=team-a'`
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected script to contain %q", expected)
+	}
+}
+
+func TestSysctls(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(a *AKS)
+		expected []string
+		absent   []string
+	}{
+		{
+			name:   "no conntrack settings",
+			modify: func(a *AKS) {},
+			absent: []string{"nf_conntrack"},
+		},
+		{
+			name: "conntrack max only",
+			modify: func(a *AKS) {
+				a.ConntrackMax = 262144
+			},
+			expected: []string{"net.netfilter.nf_conntrack_max=262144\n"},
+			absent:   []string{"nf_conntrack_tcp_timeout"},
+		},
+		{
+			name: "conntrack max and TCP timeouts",
+			modify: func(a *AKS) {
+				a.ConntrackMax = 524288
+				a.ConntrackTCPTimeoutEstablished = 86400
+				a.ConntrackTCPTimeoutCloseWait = 3600
+			},
+			expected: []string{
+				"net.netfilter.nf_conntrack_max=524288\n",
+				"net.netfilter.nf_conntrack_tcp_timeout_established=86400\n",
+				"net.netfilter.nf_conntrack_tcp_timeout_close_wait=3600\n",
+			},
+		},
+		{
+			name: "network profile sysctls",
+			modify: func(a *AKS) {
+				a.NetworkSysctls = map[string]string{
+					"net.core.rmem_max": "134217728",
+					"net.ipv4.tcp_rmem": "4096 87380 134217728",
+				}
+			},
+			expected: []string{
+				"net.core.rmem_max=134217728\n",
+				"net.ipv4.tcp_rmem=4096 87380 134217728\n",
+			},
+			absent: []string{"nf_conntrack"},
+		},
+		{
+			name: "user sysctls take precedence over the network profile",
+			modify: func(a *AKS) {
+				a.NetworkSysctls = map[string]string{"net.core.rmem_max": "134217728"}
+				a.Sysctls = map[string]string{
+					"net.core.rmem_max":           "268435456",
+					"net.core.somaxconn":          "16384",
+					"fs.inotify.max_user_watches": "1048576",
+				}
+			},
+			expected: []string{
+				"fs.inotify.max_user_watches=1048576\n",
+				"net.core.rmem_max=268435456\n",
+				"net.core.somaxconn=16384\n",
+			},
+			absent: []string{"net.core.rmem_max=134217728"},
+		},
+		{
+			name: "RoCE sysctls",
+			modify: func(a *AKS) {
+				a.RoCE = true
+			},
+			expected: []string{
+				"net.ipv4.conf.all.arp_announce=2\n",
+				"net.ipv4.conf.all.arp_ignore=1\n",
+			},
+		},
+		{
+			name: "IPv6 disabled",
+			modify: func(a *AKS) {
+				a.DisableIPv6 = true
+			},
+			expected: []string{
+				"net.ipv6.conf.all.disable_ipv6=1\n",
+				"net.ipv6.conf.default.disable_ipv6=1\n",
+			},
+			absent: []string{"net.ipv6.conf.lo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			tt.modify(&a)
+			nbv := staticNodeBootstrapVars
+			a.applyOptions(&nbv)
+			content, err := base64.StdEncoding.DecodeString(nbv.SysctlContent)
+			if err != nil {
+				t.Fatalf("unexpected error decoding sysctl content: %v", err)
+			}
+			if !strings.HasPrefix(string(content), string(sysctlContent)) {
+				t.Errorf("expected static sysctl configuration to be preserved")
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(string(content), e) {
+					t.Errorf("expected sysctl content to contain %q, got %q", e, content)
+				}
+			}
+			for _, e := range tt.absent {
+				if strings.Contains(string(content), e) {
+					t.Errorf("expected sysctl content not to contain %q, got %q", e, content)
+				}
+			}
+		})
+	}
+}
+
+func TestMTU(t *testing.T) {
+	a := testAKS()
+	a.MTU = 1400
+	nbv := staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	kubenet, err := base64.StdEncoding.DecodeString(nbv.KubenetTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error decoding kubenet template: %v", err)
+	}
+	if !strings.Contains(string(kubenet), `"mtu": 1400`) || strings.Contains(string(kubenet), `"mtu": 1500`) {
+		t.Errorf("expected kubenet template bridge mtu to be 1400, got %s", kubenet)
+	}
+	script := renderScript(t, a)
+	if !strings.Contains(script, "ip link set dev eth0 mtu 1400") {
+		t.Errorf("expected script to set the interface mtu")
+	}
+	// persisted across reboots by netplan (Ubuntu), or a systemd-networkd drop-in otherwise
+	for _, e := range []string{
+		`printf 'network:\n  version: 2\n  ethernets:\n    eth0:\n      mtu: 1400\n' > /etc/netplan/99-karpenter-mtu.yaml`,
+		`printf '[Link]\nMTUBytes=1400\n' > /etc/systemd/network/10-cloud-init-eth0.network.d/99-karpenter-mtu.conf`,
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+
+	a = testAKS()
+	nbv = staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	if nbv.KubenetTemplate != base64.StdEncoding.EncodeToString(kubenetTemplate) {
+		t.Errorf("expected kubenet template to be unchanged without mtu")
+	}
+	if script := renderScript(t, a); strings.Contains(script, "ip link set dev eth0 mtu") || strings.Contains(script, "karpenter-mtu") {
+		t.Errorf("expected script not to set the interface mtu without mtu")
+	}
+}
+
+func TestEvictionMaxPodGracePeriod(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); strings.Contains(script, "--eviction-max-pod-grace-period") {
+		t.Errorf("expected no --eviction-max-pod-grace-period flag without kubelet configuration")
+	}
+
+	a.KubeletConfig = &corev1beta1.KubeletConfiguration{EvictionMaxPodGracePeriod: lo.ToPtr[int32](120)}
+	if script := renderScript(t, a); !strings.Contains(script, "--eviction-max-pod-grace-period=120") {
+		t.Errorf("expected --eviction-max-pod-grace-period=120 in kubelet flags")
+	}
+
+	a.KubeletConfig.EvictionMaxPodGracePeriod = lo.ToPtr[int32](0)
+	if script := renderScript(t, a); !strings.Contains(script, "--eviction-max-pod-grace-period=0") {
+		t.Errorf("expected --eviction-max-pod-grace-period=0 in kubelet flags")
+	}
+}
+
+func TestGVisorSandboxRuntime(t *testing.T) {
+	a := testAKS()
+	script := renderScript(t, a)
+	if strings.Contains(script, "runsc") {
+		t.Errorf("expected no gVisor setup without a sandbox runtime")
+	}
+
+	a.SandboxRuntime = "gvisor"
+	script = renderScript(t, a)
+	for _, expected := range []string{
+		"https://storage.googleapis.com/gvisor/releases/release/" + gvisorVersion + "/x86_64/runsc",
+		"sha512sum -c runsc.sha512 containerd-shim-runsc-v1.sha512",
+		"/usr/local/bin/",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q", expected)
+		}
+	}
+	if strings.Index(script, "containerd-shim-runsc-v1\" /usr/local/bin/") > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected gVisor to be installed before provisioning")
+	}
+
+	nbv := staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	containerdConfig, err := containerdConfigFromNodeBootstrapVars(&nbv)
+	if err != nil {
+		t.Fatalf("unexpected error rendering containerd config: %v", err)
+	}
+	if !strings.Contains(containerdConfig, "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runsc]\n      runtime_type = \"io.containerd.runsc.v1\"") {
+		t.Errorf("expected runsc runtime in containerd config, got:\n%s", containerdConfig)
+	}
+	if !strings.Contains(containerdConfig, "default_runtime_name = \"runc\"") {
+		t.Errorf("expected runc to remain the default runtime")
+	}
+
+	a.Arch = "arm64"
+	if script := renderScript(t, a); !strings.Contains(script, "/"+gvisorVersion+"/aarch64/runsc") {
+		t.Errorf("expected arm64 gVisor release")
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	a := testAKS()
+	script := renderScript(t, a)
+	if !strings.Contains(script, `SHOULD_CONFIGURE_HTTP_PROXY="false"`) || !strings.Contains(script, `NO_PROXY_URLS=""`) {
+		t.Errorf("expected no proxy configuration by default")
+	}
+
+	a.HTTPProxy = "http://proxy.internal:3128"
+	a.HTTPSProxy = "http://proxy.internal:3129"
+	a.NoProxy = []string{"10.0.0.0/8", ".internal", "localhost"}
+	a.HTTPProxyTrustedCA = "cHJveHktY2E="
+	script = renderScript(t, a)
+	for _, expected := range []string{
+		`SHOULD_CONFIGURE_HTTP_PROXY="true"`,
+		`HTTP_PROXY_URLS="http://proxy.internal:3128"`,
+		`HTTPS_PROXY_URLS="http://proxy.internal:3129"`,
+		`NO_PROXY_URLS="localhost,127.0.0.1,168.63.129.16,169.254.169.254,10.0.0.0/8,.internal"`,
+		`SHOULD_CONFIGURE_HTTP_PROXY_CA="true"`,
+		`HTTP_PROXY_TRUSTED_CA="cHJveHktY2E="`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %s", expected)
+		}
+	}
+}
+
+func TestEntropySource(t *testing.T) {
+	tests := []struct {
+		name          string
+		entropySource string
+		expected      []string
+	}{
+		{
+			name:          "rngd",
+			entropySource: "rngd",
+			expected:      []string{"apt-get install -y rng-tools5 && break", "tdnf install -y rng-tools && break", "systemctl enable --now rngd"},
+		},
+		{
+			name:          "haveged",
+			entropySource: "haveged",
+			expected:      []string{"apt-get install -y haveged && break", "systemctl enable --now haveged"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.EntropySource = tt.entropySource
+			script := renderScript(t, a)
+			for _, e := range tt.expected {
+				if !strings.Contains(script, e) {
+					t.Errorf("expected script to contain %q", e)
+				}
+			}
+		})
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "systemctl enable --now") {
+		t.Errorf("expected no entropy source setup by default")
+	}
+}
+
+func TestTCPCongestionControl(t *testing.T) {
+	a := testAKS()
+	a.TCPCongestionControl = "bbr"
+	if sysctls := a.sysctls(); sysctls["net.ipv4.tcp_congestion_control"] != "bbr" {
+		t.Errorf("expected tcp_congestion_control sysctl bbr, got %q", sysctls["net.ipv4.tcp_congestion_control"])
+	}
+	script := renderScript(t, a)
+	for _, e := range []string{"modprobe tcp_bbr", "echo tcp_bbr > /etc/modules-load.d/tcp-congestion-control.conf"} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+
+	// cubic and reno are built into the kernel
+	a.TCPCongestionControl = "cubic"
+	if script := renderScript(t, a); strings.Contains(script, "modprobe") {
+		t.Errorf("expected no module to be loaded for cubic")
+	}
+
+	if _, ok := testAKS().sysctls()["net.ipv4.tcp_congestion_control"]; ok {
+		t.Errorf("expected no tcp_congestion_control sysctl by default")
+	}
+}
+
+func TestSwapAccounting(t *testing.T) {
+	a := testAKS()
+	a.SwapAccounting = true
+	script := renderScript(t, a)
+	e := "printf '[Manager]\\nDefaultMemoryAccounting=yes\\n' > /etc/systemd/system.conf.d/99-swap-accounting.conf\nsystemctl daemon-reexec\n"
+	if !strings.Contains(script, e) {
+		t.Errorf("expected script to contain %q", e)
+	}
+	// set up before provisioning, without changing the kernel command line or rebooting
+	if strings.Index(script, "99-swap-accounting.conf") > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected memory accounting to be set up before provisioning")
+	}
+	if strings.Contains(script, "update-grub") || strings.Contains(script, "systemctl reboot") {
+		t.Errorf("expected no kernel command line change nor reboot")
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "swap-accounting") {
+		t.Errorf("expected no swap accounting setup by default")
+	}
+}
+
+func TestRoCE(t *testing.T) {
+	tests := []struct {
+		name     string
+		gpuNode  bool
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "non-GPU node",
+			expected: []string{
+				"apt-get install -y rdma-core ibverbs-utils && break",
+				"tdnf install -y rdma-core libibverbs-utils && break",
+				"modprobe -a mlx5_ib rdma_ucm ib_uverbs ib_umad",
+				`echo "mlx5_ib rdma_ucm ib_uverbs ib_umad" | tr ' ' '\n' > /etc/modules-load.d/roce.conf`,
+				`printf '[Service]\nLimitMEMLOCK=infinity\n' > /etc/systemd/system/containerd.service.d/roce.conf`,
+			},
+			absent: []string{"nvidia_peermem"},
+		},
+		{
+			name:     "GPU node",
+			gpuNode:  true,
+			expected: []string{"modprobe nvidia_peermem && echo nvidia_peermem >> /etc/modules-load.d/roce.conf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.RoCE = true
+			a.GPUNode = tt.gpuNode
+			script := renderScript(t, a)
+			for _, e := range tt.expected {
+				if !strings.Contains(script, e) {
+					t.Errorf("expected script to contain %q", e)
+				}
+			}
+			for _, e := range tt.absent {
+				if strings.Contains(script, e) {
+					t.Errorf("expected script not to contain %q", e)
+				}
+			}
+			// RDMA setup happens before provisioning starts containerd, GPUDirect RDMA after the GPU driver is installed
+			provision := strings.Index(script, "provision_start.sh")
+			if strings.Index(script, "modprobe -a") > provision || (tt.gpuNode && strings.Index(script, "modprobe nvidia_peermem") < provision) {
+				t.Errorf("expected RDMA setup to be ordered around provisioning")
+			}
+		})
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "rdma-core") {
+		t.Errorf("expected no RoCE setup by default")
+	}
+}
+
+func TestRegistryMirrors(t *testing.T) {
+	a := testAKS()
+	a.RegistryMirrors = map[string][]string{
+		"docker.io": {"https://mirror-1.example.com", "https://mirror-2.example.com:5000"},
+		"ghcr.io":   {"http://ghcr-mirror.example.com"},
+	}
+	script := renderScript(t, a)
+
+	expectedHosts := map[string]string{
+		"docker.io": `server = "https://registry-1.docker.io"
+
+[host."https://mirror-1.example.com"]
+  capabilities = ["pull", "resolve"]
+
+[host."https://mirror-2.example.com:5000"]
+  capabilities = ["pull", "resolve"]
+`,
+		"ghcr.io": `server = "https://ghcr.io"
+
+[host."http://ghcr-mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+`,
+	}
+	for registry, hosts := range expectedHosts {
+		e := fmt.Sprintf(`echo "%s" | base64 -d > "/etc/containerd/certs.d/%s/hosts.toml"`, base64.StdEncoding.EncodeToString([]byte(hosts)), registry)
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+	// registries are configured in a stable order, before provisioning starts containerd
+	dockerHub, ghcr := strings.Index(script, "certs.d/docker.io/hosts.toml"), strings.Index(script, "certs.d/ghcr.io/hosts.toml")
+	if dockerHub > ghcr || ghcr > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected registry hosts to be written in order before provisioning")
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "hosts.toml") {
+		t.Errorf("expected no registry mirrors by default")
+	}
+}
+
+func TestAdditionalCAs(t *testing.T) {
+	a := testAKS()
+	a.AdditionalCAs = []string{"-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", "-----BEGIN CERTIFICATE-----\nMIIC\n-----END CERTIFICATE-----"}
+	a.RegistryMirrors = map[string][]string{"docker.io": {"https://mirror.example.com"}}
+	script := renderScript(t, a)
+
+	bundle := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n-----BEGIN CERTIFICATE-----\nMIIC\n-----END CERTIFICATE-----\n"
+	hosts := `server = "https://registry-1.docker.io"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/containerd/additional-cas.crt"
+`
+	for _, e := range []string{
+		fmt.Sprintf(`echo "%s" | base64 -d > /etc/containerd/additional-cas.crt`, base64.StdEncoding.EncodeToString([]byte(bundle))),
+		"update-ca-certificates",
+		"update-ca-trust",
+		fmt.Sprintf(`echo "%s" | base64 -d > "/etc/containerd/certs.d/docker.io/hosts.toml"`, base64.StdEncoding.EncodeToString([]byte(hosts))),
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+	// the CAs are trusted before provisioning downloads anything
+	if strings.Index(script, "additional-cas.crt") > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected the additional CAs to be trusted before provisioning")
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "additional-cas.crt") {
+		t.Errorf("expected no additional CAs by default")
+	}
+}
+
+func TestCNIDirs(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(a *AKS)
+		expected      []string
+		absent        []string
+		noCNISettings bool
+	}{
+		{name: "defaults", modify: func(a *AKS) {}, noCNISettings: true},
+		{
+			name: "custom directories",
+			modify: func(a *AKS) {
+				a.CNIBinDir = "/opt/custom-cni/bin"
+				a.CNIConfDir = "/etc/custom-cni/net.d"
+			},
+			expected: []string{`bin_dir = "/opt/custom-cni/bin"`, `conf_dir = "/etc/custom-cni/net.d"`},
+			absent:   []string{"conf_template"},
+		},
+		{
+			name:     "custom bin directory only",
+			modify:   func(a *AKS) { a.CNIBinDir = "/opt/custom-cni/bin" },
+			expected: []string{`bin_dir = "/opt/custom-cni/bin"`, `conf_dir = "/etc/cni/net.d"`},
+		},
+		{
+			name: "custom directories with kubenet",
+			modify: func(a *AKS) {
+				a.NetworkPlugin = "kubenet"
+				a.CNIConfDir = "/etc/custom-cni/net.d"
+			},
+			expected: []string{`bin_dir = "/opt/cni/bin"`, `conf_dir = "/etc/custom-cni/net.d"`, `conf_template = "/etc/containerd/kubenet_template.conf"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			tt.modify(&a)
+			nbv := staticNodeBootstrapVars
+			a.applyOptions(&nbv)
+			containerdConfig, err := containerdConfigFromNodeBootstrapVars(&nbv)
+			if err != nil {
+				t.Fatalf("unexpected error rendering containerd config: %v", err)
+			}
+			if hasCNISettings := strings.Contains(containerdConfig, `[plugins."io.containerd.grpc.v1.cri".cni]`); hasCNISettings == tt.noCNISettings {
+				t.Errorf("expected CNI settings in containerd config to be %t, got:\n%s", !tt.noCNISettings, containerdConfig)
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(containerdConfig, e) {
+					t.Errorf("expected containerd config to contain %q, got:\n%s", e, containerdConfig)
+				}
+			}
+			for _, e := range tt.absent {
+				if strings.Contains(containerdConfig, e) {
+					t.Errorf("expected containerd config not to contain %q, got:\n%s", e, containerdConfig)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentDownloads(t *testing.T) {
+	for _, tt := range []struct {
+		name                   string
+		maxConcurrentDownloads int32
+		expected               string
+	}{
+		{name: "containerd default", maxConcurrentDownloads: 0},
+		{name: "custom", maxConcurrentDownloads: 10, expected: "  max_concurrent_downloads = 10\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.MaxConcurrentDownloads = tt.maxConcurrentDownloads
+			nbv := staticNodeBootstrapVars
+			a.applyOptions(&nbv)
+			containerdConfig, err := containerdConfigFromNodeBootstrapVars(&nbv)
+			if err != nil {
+				t.Fatalf("unexpected error rendering containerd config: %v", err)
+			}
+			if tt.expected == "" && strings.Contains(containerdConfig, "max_concurrent_downloads") {
+				t.Errorf("expected containerd config not to set max_concurrent_downloads, got:\n%s", containerdConfig)
+			}
+			if tt.expected != "" && !strings.Contains(containerdConfig, tt.expected) {
+				t.Errorf("expected containerd config to contain %q, got:\n%s", tt.expected, containerdConfig)
+			}
+		})
+	}
+}
+
+func TestOOMScoreAdj(t *testing.T) {
+	a := testAKS()
+	a.OOMScoreAdj = map[string]int32{"kubelet": -999, "containerd": -500}
+	script := renderScript(t, a)
+	for _, e := range []string{
+		"mkdir -p /etc/systemd/system/containerd.service.d\n" +
+			`printf '[Service]\nOOMScoreAdjust=-500\n' > /etc/systemd/system/containerd.service.d/10-oom-score-adjust.conf` + "\n" +
+			"mkdir -p /etc/systemd/system/kubelet.service.d\n" +
+			`printf '[Service]\nOOMScoreAdjust=-999\n' > /etc/systemd/system/kubelet.service.d/10-oom-score-adjust.conf`,
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+	// the drop-ins are in place before provisioning starts the daemons
+	if strings.Index(script, "10-oom-score-adjust.conf") > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected OOM score adjustments to be configured before provisioning")
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "OOMScoreAdjust") {
+		t.Errorf("expected no OOM score adjustments by default")
+	}
+}
+
+func TestDNSServers(t *testing.T) {
+	tests := []struct {
+		name             string
+		dnsServers       []string
+		dnsSearchDomains []string
+		expected         string
+	}{
+		{
+			name:             "servers and search domains",
+			dnsServers:       []string{"10.1.0.4", "fd00::53"},
+			dnsSearchDomains: []string{"corp.example.com", "example.com"},
+			expected:         "[Resolve]\nDNS=10.1.0.4 fd00::53\nDomains=corp.example.com example.com\n",
+		},
+		{
+			name:       "servers only",
+			dnsServers: []string{"10.1.0.4"},
+			expected:   "[Resolve]\nDNS=10.1.0.4\n",
+		},
+		{
+			name:             "search domains only",
+			dnsSearchDomains: []string{"corp.example.com"},
+			expected:         "[Resolve]\nDomains=corp.example.com\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.DNSServers = tt.dnsServers
+			a.DNSSearchDomains = tt.dnsSearchDomains
+			script := renderScript(t, a)
+			e := fmt.Sprintf(`echo "%s" | base64 -d > /etc/systemd/resolved.conf.d/99-dns.conf`, base64.StdEncoding.EncodeToString([]byte(tt.expected)))
+			if !strings.Contains(script, e) {
+				t.Errorf("expected script to contain %q", e)
+			}
+			// names resolve through the DNS servers before anything is downloaded
+			if strings.Index(script, "systemctl restart systemd-resolved") > strings.Index(script, "provision_start.sh") {
+				t.Errorf("expected DNS to be configured before provisioning")
+			}
+		})
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "resolved.conf.d") {
+		t.Errorf("expected no DNS configuration by default")
+	}
+}
+
+func TestDNSStubListener(t *testing.T) {
+	a := testAKS()
+	a.DisableDNSStubListener = true
+	script := renderScript(t, a)
+	for _, e := range []string{
+		fmt.Sprintf(`echo "%s" | base64 -d > /etc/systemd/resolved.conf.d/99-dns.conf`, base64.StdEncoding.EncodeToString([]byte("[Resolve]\nDNSStubListener=no\n"))),
+		"ln -sf /run/systemd/resolve/resolv.conf /etc/resolv.conf",
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+
+	a.DNSServers = []string{"10.1.0.4"}
+	e := fmt.Sprintf(`echo "%s" | base64 -d`, base64.StdEncoding.EncodeToString([]byte("[Resolve]\nDNS=10.1.0.4\nDNSStubListener=no\n")))
+	if script := renderScript(t, a); !strings.Contains(script, e) {
+		t.Errorf("expected script to contain %q", e)
+	}
+
+	// the stub listener is kept with DNS servers alone
+	a.DisableDNSStubListener = false
+	if script := renderScript(t, a); strings.Contains(script, "/etc/resolv.conf") {
+		t.Errorf("expected /etc/resolv.conf to be kept")
+	}
+}
+
+func TestSpot(t *testing.T) {
+	a := testAKS()
+	a.Spot = true
+	script := renderScript(t, a)
+	for _, e := range []string{
+		"kubernetes.azure.com/scalesetpriority=spot",
+		"--config-dir=/etc/kubernetes/kubelet.conf.d",
+		fmt.Sprintf(`echo "%s" | base64 -d > /etc/kubernetes/kubelet.conf.d/10-spot-graceful-shutdown.conf`, base64.StdEncoding.EncodeToString(spotGracefulShutdownConfig)),
+		fmt.Sprintf(`echo "%s" | base64 -d > /opt/azure/containers/spot-eviction-handler.sh`, base64.StdEncoding.EncodeToString(spotEvictionHandler)),
+		"systemctl enable --now spot-eviction-handler.service",
+	} {
+		if !strings.Contains(script, e) {
+			t.Errorf("expected script to contain %q", e)
+		}
+	}
+	// the kubelet configuration drop-in is written before provisioning starts kubelet, the eviction handler is started after
+	provision := strings.Index(script, "provision_start.sh")
+	if strings.Index(script, "10-spot-graceful-shutdown.conf") > provision || strings.Index(script, "spot-eviction-handler.sh") < provision {
+		t.Errorf("expected spot setup to be ordered around provisioning")
+	}
+
+	// graceful node shutdown needs kubelet configuration drop-ins, only supported from 1.30
+	a.KubernetesVersion = "1.29.5"
+	script = renderScript(t, a)
+	if !strings.Contains(script, "kubernetes.azure.com/scalesetpriority=spot") {
+		t.Errorf("expected spot label before 1.30")
+	}
+	if strings.Contains(script, "--config-dir") || strings.Contains(script, "spot-eviction-handler") {
+		t.Errorf("expected no graceful node shutdown before 1.30")
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "scalesetpriority") || strings.Contains(script, "spot-eviction-handler") {
+		t.Errorf("expected no spot setup by default")
+	}
+}
+
+// runReadinessGate runs the readiness gating of the rendered script, with kubectl faked by a script
+// recording its arguments, and returns the output and the recorded kubectl calls
+func runReadinessGate(t *testing.T, script string) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	start := strings.Index(script, "| base64 -d > /opt/azure/containers/readiness-command.sh")
+	start = strings.LastIndex(script[:start], "\n") + 1
+	end := start + strings.Index(script[start:], "\nfi\n") + len("\nfi\n")
+	dir := t.TempDir()
+	gate := strings.ReplaceAll(script[start:end], "/opt/azure/containers", dir)
+	kubectl := fmt.Sprintf("#!/bin/bash\necho \"$@\" >> %s/kubectl.log\n", dir)
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(kubectl), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", "-c", gate)
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+	output, _ := cmd.CombinedOutput()
+	calls, _ := os.ReadFile(filepath.Join(dir, "kubectl.log"))
+	return string(output), string(calls)
+}
+
+func TestReadinessCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        string
+		timeoutSeconds int32
+		annotated      bool
+	}{
+		{name: "succeeding command", command: "test -d /\necho 'node is ready'", timeoutSeconds: 10, annotated: true},
+		{name: "failing command", command: "echo 'node is not ready'\nexit 1", timeoutSeconds: 10},
+		{name: "timed out command", command: "sleep 10", timeoutSeconds: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAKS()
+			a.ReadinessCommand = tt.command
+			a.ReadinessCommandTimeoutSeconds = tt.timeoutSeconds
+			script := renderScript(t, a)
+			if e := fmt.Sprintf("if timeout %d /bin/bash /opt/azure/containers/readiness-command.sh; then", tt.timeoutSeconds); !strings.Contains(script, e) {
+				t.Errorf("expected script to contain %q", e)
+			}
+			// the readiness command runs once provisioning has started kubelet
+			if strings.Index(script, "readiness-command.sh") < strings.Index(script, "provision_start.sh") {
+				t.Errorf("expected readiness command to run after provisioning")
+			}
+
+			output, calls := runReadinessGate(t, script)
+			// the kubelet identity may not remove taints of its node, so the node is annotated for Karpenter to remove it
+			if strings.Contains(calls, "taint node") {
+				t.Errorf("expected the node not to remove its readiness taint, kubectl calls: %q", calls)
+			}
+			if tt.annotated {
+				if !strings.Contains(calls, "annotate node") || !strings.Contains(calls, "karpenter.azure.com/readiness-command-succeeded=true") {
+					t.Errorf("expected node to be annotated as ready, kubectl calls: %q, output: %q", calls, output)
+				}
+			} else {
+				if calls != "" {
+					t.Errorf("expected readiness taint to remain, kubectl calls: %q", calls)
+				}
+				if !strings.Contains(output, "keeping the karpenter.azure.com/readiness-command taint") {
+					t.Errorf("expected failure to be reported, output: %q", output)
+				}
+			}
+		})
+	}
+
+	if script := renderScript(t, testAKS()); strings.Contains(script, "readiness-command") {
+		t.Errorf("expected no readiness command by default")
+	}
+}
+
+func TestDefaultRuntimeHandler(t *testing.T) {
+	a := testAKS()
+	a.SandboxRuntime = "gvisor"
+	a.DefaultRuntimeHandler = "runsc"
+	nbv := staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	containerdConfig, err := containerdConfigFromNodeBootstrapVars(&nbv)
+	if err != nil {
+		t.Fatalf("unexpected error rendering containerd config: %v", err)
+	}
+	for _, expected := range []string{
+		"default_runtime_name = \"runsc\"",
+		"[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc]",
+		"[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runsc]",
+	} {
+		if !strings.Contains(containerdConfig, expected) {
+			t.Errorf("expected containerd config to contain %q, got:\n%s", expected, containerdConfig)
+		}
+	}
+
+	// GPU nodes keep the NVIDIA container runtime as their default
+	a.GPUNode = true
+	nbv = staticNodeBootstrapVars
+	a.applyOptions(&nbv)
+	containerdConfig, err = containerdConfigFromNodeBootstrapVars(&nbv)
+	if err != nil {
+		t.Fatalf("unexpected error rendering containerd config: %v", err)
+	}
+	if !strings.Contains(containerdConfig, "default_runtime_name = \"nvidia-container-runtime\"") {
+		t.Errorf("expected the NVIDIA container runtime to remain the default on GPU nodes, got:\n%s", containerdConfig)
+	}
+}
+
+func TestClusterDNSIP(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); !strings.Contains(script, "--cluster-dns=10.0.0.10 ") {
+		t.Errorf("expected the AKS default cluster DNS IP")
+	}
+
+	a.ClusterDNSIP = "172.16.0.10"
+	script := renderScript(t, a)
+	if !strings.Contains(script, "--cluster-dns=172.16.0.10 ") {
+		t.Errorf("expected the cluster DNS IP, got:\n%s", script)
+	}
+	if strings.Contains(script, "--cluster-dns=10.0.0.10") {
+		t.Errorf("expected the cluster DNS IP to replace the AKS default")
+	}
+}
+
+func TestKubeletFeatureGates(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); strings.Contains(script, "--feature-gates") {
+		t.Errorf("expected no kubelet feature gates by default")
+	}
+
+	a.KubeletFeatureGates = map[string]bool{"KubeletTracing": false, "InPlacePodVerticalScaling": true}
+	if script := renderScript(t, a); !strings.Contains(script, "--feature-gates=InPlacePodVerticalScaling=true,KubeletTracing=false ") {
+		t.Errorf("expected the kubelet feature gates sorted by name, got:\n%s", script)
+	}
+}
+
+func TestKubeletCgroupDriver(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		cgroupDriver  string
+		flag          string
+		systemdCgroup bool
+	}{
+		{name: "image default", systemdCgroup: true},
+		{name: "systemd", cgroupDriver: v1alpha2.CgroupDriverSystemd, flag: "--cgroup-driver=systemd ", systemdCgroup: true},
+		{name: "cgroupfs", cgroupDriver: v1alpha2.CgroupDriverCgroupfs, flag: "--cgroup-driver=cgroupfs ", systemdCgroup: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, gpuNode := range []bool{false, true} {
+				a := testAKS()
+				a.GPUNode = gpuNode
+				a.KubeletCgroupDriver = tt.cgroupDriver
+				script := renderScript(t, a)
+				if tt.flag == "" && strings.Contains(script, "--cgroup-driver") {
+					t.Errorf("expected no kubelet cgroup driver flag, got:\n%s", script)
+				}
+				if !strings.Contains(script, tt.flag) {
+					t.Errorf("expected kubelet flag %q, got:\n%s", tt.flag, script)
+				}
+				// the cgroup v2 setup of AKS images configures the kubelet with the systemd cgroup driver
+				if expected := fmt.Sprintf(`NEEDS_CGROUPV2="%t"`, tt.systemdCgroup); !strings.Contains(script, expected) {
+					t.Errorf("expected %s, got:\n%s", expected, script)
+				}
+
+				nbv := staticNodeBootstrapVars
+				a.applyOptions(&nbv)
+				containerdConfig, err := containerdConfigFromNodeBootstrapVars(&nbv)
+				if err != nil {
+					t.Fatalf("unexpected error rendering containerd config: %v", err)
+				}
+				if strings.Contains(containerdConfig, "SystemdCgroup = true") != tt.systemdCgroup {
+					t.Errorf("expected SystemdCgroup of containerd to be %t with GPU node %t, got:\n%s", tt.systemdCgroup, gpuNode, containerdConfig)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	a := testAKS()
+	script := renderScript(t, a)
+	if strings.Contains(script, "node not registered within") {
+		t.Errorf("expected no registration wait without registration tuning")
+	}
+
+	a.RegistrationTimeoutSeconds = 600
+	a.RegistrationRetryCount = 2
+	script = renderScript(t, a)
+	for _, expected := range []string{
+		"for i in $(seq 1 3); do",
+		"timeout 600 /bin/bash -c 'until kubectl --kubeconfig /var/lib/kubelet/kubeconfig get node",
+		"node not registered within 600s, restarting kubelet",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q", expected)
+		}
+	}
+	// registration is awaited once provisioning has started the kubelet
+	if strings.Index(script, "node not registered within") < strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected registration to be awaited after provisioning")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); strings.Contains(script, "mount-local-disks") {
+		t.Errorf("expected no local disk mounts by default")
+	}
+
+	a.LocalStorageDiscoveryPath = "/mnt/local-disks"
+	script := renderScript(t, a)
+	for _, expected := range []string{
+		`echo "` + base64.StdEncoding.EncodeToString(localDiskMounter) + `" | base64 -d > /opt/azure/containers/mount-local-disks.sh`,
+		"/bin/bash /opt/azure/containers/mount-local-disks.sh /mnt/local-disks",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q", expected)
+		}
+	}
+	// the disks are mounted before provisioning starts the kubelet, and with it the local static provisioner
+	if strings.Index(script, "mount-local-disks.sh /mnt/local-disks") > strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected local disks to be mounted before provisioning")
+	}
+	for _, expected := range []string{`target="${DISCOVERY_PATH}/nvme${index}"`, "Microsoft NVMe Direct Disk", "mkfs.ext4", "mdadm --create", `"${DISCOVERY_PATH}/raid0"`} {
+		if !strings.Contains(string(localDiskMounter), expected) {
+			t.Errorf("expected local disk mounter to contain %q", expected)
+		}
+	}
+	if strings.Contains(script, "mount-local-disks.sh /mnt/local-disks raid0") {
+		t.Errorf("expected no RAID 0 array by default")
+	}
+
+	a.LocalStorageRAID0 = true
+	if script := renderScript(t, a); !strings.Contains(script, "/bin/bash /opt/azure/containers/mount-local-disks.sh /mnt/local-disks raid0\n") {
+		t.Errorf("expected the local disks to be striped into a RAID 0 array")
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); strings.Contains(script, `base64 -d > "/etc/systemd/system/`) {
+		t.Errorf("expected no systemd units by default")
+	}
+
+	agent := "[Service]\nExecStart=/usr/local/bin/node-health-agent\n"
+	timer := "[Timer]\nOnCalendar=hourly\n"
+	a.SystemdUnits = []SystemdUnit{
+		{Name: "node-health-agent.service", Content: agent, Enabled: true},
+		{Name: "node-health-check.timer", Content: timer},
+	}
+	script := renderScript(t, a)
+	expected := `echo "` + base64.StdEncoding.EncodeToString([]byte(agent)) + `" | base64 -d > "/etc/systemd/system/node-health-agent.service"` + "\n" +
+		`echo "` + base64.StdEncoding.EncodeToString([]byte(timer)) + `" | base64 -d > "/etc/systemd/system/node-health-check.timer"` + "\n" +
+		"systemctl daemon-reload\n" +
+		"systemctl enable --now node-health-agent.service\n"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected script to contain %q", expected)
+	}
+	// the units start once the node is provisioned, for them to rely on the kubelet
+	if strings.Index(script, "node-health-agent.service") < strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected systemd units to be written after provisioning")
+	}
+}
+
+func TestImagePullConfig(t *testing.T) {
+	a := testAKS()
+	if script := renderScript(t, a); strings.Contains(script, "/var/lib/kubelet/config.json") {
+		t.Errorf("expected no kubelet credential file by default")
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("puller:s3cr3t"))
+	a.ImagePullCredentials = map[string]string{"registry.example.com:5000": auth, "docker.io": auth}
+	script := renderScript(t, a)
+	config := `{"auths":{"https://index.docker.io/v1/":{"auth":"` + auth + `"},"registry.example.com:5000":{"auth":"` + auth + `"}}}`
+	expected := "install -m 0600 /dev/null /var/lib/kubelet/config.json\n" +
+		`echo "` + base64.StdEncoding.EncodeToString([]byte(config)) + `" | base64 -d > /var/lib/kubelet/config.json` + "\n"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected script to contain %q", expected)
+	}
+	// the credentials are only present encoded, for the user data to be redacted
+	if strings.Contains(script, auth) {
+		t.Errorf("expected the credentials not to be rendered in plain")
+	}
+}
+
+func TestPrePullImages(t *testing.T) {
+	if script := renderScript(t, testAKS()); strings.Contains(script, "pre-pull-images") {
+		t.Errorf("expected no images pulled by default")
+	}
+
+	a := testAKS()
+	a.PrePullImages = []string{"mcr.microsoft.com/oss/kubernetes/pause:3.9", "nginx@sha256:" + strings.Repeat("a", 64)}
+	script := renderScript(t, a)
+	pull := "/bin/bash /opt/azure/containers/pre-pull-images.sh mcr.microsoft.com/oss/kubernetes/pause:3.9 nginx@sha256:" + strings.Repeat("a", 64) + "\n"
+	if !strings.Contains(script, pull) || strings.Contains(script, "systemd-run --unit=pre-pull-images") {
+		t.Errorf("expected script to pull the images in the foreground with %q", pull)
+	}
+	// images are pulled once provisioning has started containerd, then the node is annotated for Karpenter to remove
+	// the readiness taint, which the kubelet identity may not remove
+	if strings.Index(script, pull) < strings.Index(script, "provision_start.sh") {
+		t.Errorf("expected images to be pulled after provisioning")
+	}
+	ready := "annotate node \"$(hostname | tr '[:upper:]' '[:lower:]')\" --overwrite karpenter.azure.com/readiness-command-succeeded=true && break"
+	if !strings.Contains(script, ready) || strings.Index(script, ready) < strings.Index(script, pull) {
+		t.Errorf("expected the node to be annotated as ready once the images are pulled")
+	}
+	if strings.Contains(script, "taint node") {
+		t.Errorf("expected the node not to remove its readiness taint")
+	}
+
+	// pulled before the readiness command runs, which gates the annotation instead
+	a.ReadinessCommand = "test -d /"
+	a.ReadinessCommandTimeoutSeconds = 10
+	script = renderScript(t, a)
+	if strings.Index(script, pull) > strings.Index(script, "readiness-command.sh") || strings.Count(script, ready) != 1 ||
+		strings.Index(script, ready) < strings.Index(script, "readiness-command.sh") {
+		t.Errorf("expected images to be pulled before the readiness command")
+	}
+
+	a = testAKS()
+	a.PrePullImages = []string{"nginx:1.27"}
+	a.PrePullImagesInBackground = true
+	script = renderScript(t, a)
+	if e := "systemd-run --unit=pre-pull-images /bin/bash /opt/azure/containers/pre-pull-images.sh nginx:1.27\n"; !strings.Contains(script, e) {
+		t.Errorf("expected script to contain %q", e)
+	}
+	if strings.Contains(script, "karpenter.azure.com/readiness-command") {
+		t.Errorf("expected no readiness taint removal with images pulled in the background")
+	}
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	if output, err := exec.Command("bash", "-n", "-c", string(prePullImager)).CombinedOutput(); err != nil {
+		t.Errorf("unexpected error parsing the pre-pull script: %v, output: %q", err, output)
+	}
+}
@@ -23,16 +23,90 @@ import (
 
 // Options is the node bootstrapping parameters passed from Karpenter to the provisioning node
 type Options struct {
-	ClusterName      string
-	ClusterEndpoint  string
-	KubeletConfig    *corev1beta1.KubeletConfiguration
-	Taints           []core.Taint      `hash:"set"`
-	Labels           map[string]string `hash:"set"`
-	CABundle         *string
-	GPUNode          bool
-	GPUDriverVersion string
-	GPUImageSHA      string
-	SubnetID         string
+	ClusterName     string
+	ClusterEndpoint string
+	KubeletConfig   *corev1beta1.KubeletConfiguration
+	Taints          []core.Taint      `hash:"set"`
+	Labels          map[string]string `hash:"set"`
+	// Annotations are applied to the node once it registers
+	Annotations        map[string]string `hash:"set"`
+	CABundle           *string
+	GPUNode            bool
+	GPUDriverVersion   string
+	GPUImageSHA        string
+	GPUPersistenceMode bool
+	GPUMIGProfile      string
+	SubnetID           string
+	// Hostname is the hostname the node sets at boot, with HostnameZoneReference replaced by the availability zone number
+	// of the VM, empty to keep the default hostname
+	Hostname         string
+	MTU              int32
+	DNSServers       []string
+	DNSSearchDomains []string
+	// DisableDNSStubListener points /etc/resolv.conf at the upstream DNS servers rather than the systemd-resolved stub
+	DisableDNSStubListener bool
+	DisableIPv6            bool
+	// TCPCongestionControl is the default TCP congestion control algorithm, empty for the kernel default
+	TCPCongestionControl string
+	SandboxRuntime       string
+	// DefaultRuntimeHandler is the containerd runtime handler of pods selecting no RuntimeClass, empty for runc
+	DefaultRuntimeHandler string
+	EntropySource         string
+	SwapAccounting        bool
+	RoCE                  bool
+	Spot                  bool
+	// AdditionalCAs are PEM encoded CA certificates the node trusts in addition to the cluster CA
+	AdditionalCAs []string
+
+	ConntrackMax                   int32
+	ConntrackTCPTimeoutEstablished int32
+	ConntrackTCPTimeoutCloseWait   int32
+
+	NetworkSysctls map[string]string `hash:"set"`
+	// Sysctls are user-specified kernel parameters, taking precedence over the network sysctls
+	Sysctls map[string]string `hash:"set"`
+
+	RegistryMirrors map[string][]string
+	// ImagePullCredentials are the base64 encoded username:password credentials the kubelet pulls images of each registry with
+	ImagePullCredentials map[string]string
+	CNIBinDir            string
+	CNIConfDir           string
+	// MaxConcurrentDownloads is the number of layers containerd pulls concurrently, 0 for the containerd default
+	MaxConcurrentDownloads int32
+
+	LocalStorageDiscoveryPath string
+	LocalStorageRAID0         bool
+
+	OOMScoreAdj map[string]int32
+	// KubeletFeatureGates enables or disables kubelet feature gates by name
+	KubeletFeatureGates map[string]bool
+	// KubeletCgroupDriver is the cgroup driver of the kubelet and containerd, empty for the default of the node image
+	KubeletCgroupDriver string
+
+	ReadinessCommand               string
+	ReadinessCommandTimeoutSeconds int32
+	// PrePullImages are pulled into containerd once the node has started, before the readiness taint is removed
+	// unless PrePullImagesInBackground
+	PrePullImages             []string
+	PrePullImagesInBackground bool
+
+	RegistrationTimeoutSeconds int32
+	RegistrationRetryCount     int32
+
+	SystemdUnits []SystemdUnit `hash:"set"`
+
+	HTTPProxy          string
+	HTTPSProxy         string
+	NoProxy            []string `hash:"set"`
+	HTTPProxyTrustedCA string
+}
+
+// SystemdUnit is a systemd unit written to /etc/systemd/system by node bootstrapping
+type SystemdUnit struct {
+	Name    string
+	Content string
+	// Enabled enables and starts the unit once it is written
+	Enabled bool
 }
 
 // Bootstrapper can be implemented to generate a bootstrap script
@@ -42,3 +116,37 @@ type Options struct {
 type Bootstrapper interface {
 	Script() (string, error)
 }
+
+// HostnameZoneReference is the reference of hostnames to the availability zone of the VM, which is resolved at boot
+const HostnameZoneReference = "{{ .Zone }}"
+
+const (
+	// ProfileAKS joins nodes with the bootstrap contract of AKS: the node bootstrapping variables of AKS images
+	ProfileAKS = "aks"
+	// ProfileKubeadm joins nodes of self-managed control planes with kubeadm join and a bootstrap token
+	ProfileKubeadm = "kubeadm"
+)
+
+// Profile renders the Bootstrapper of a bootstrap contract from the node bootstrapping parameters
+type Profile func(params AKS) Bootstrapper
+
+// Profiles are the bootstrap contracts nodes can join clusters with, by name
+var Profiles = map[string]Profile{
+	ProfileAKS: func(params AKS) Bootstrapper { return params },
+	ProfileKubeadm: func(params AKS) Bootstrapper {
+		return Kubeadm{
+			Options:        params.Options,
+			APIServerName:  params.APIServerName,
+			APIServerPort:  params.APIServerPort,
+			BootstrapToken: params.KubeletClientTLSBootstrapToken,
+		}
+	},
+}
+
+// ForProfile returns the Bootstrapper of the named bootstrap contract, that of AKS for an empty (or unknown) name
+func ForProfile(name string, params AKS) Bootstrapper {
+	if profile, ok := Profiles[name]; ok {
+		return profile(params)
+	}
+	return params
+}
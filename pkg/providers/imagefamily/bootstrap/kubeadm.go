@@ -0,0 +1,115 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Kubeadm renders the user data of nodes joining a self-managed control plane with kubeadm join, authenticating with a
+// bootstrap token and discovering the cluster CA by the hash of its public key. Unlike AKS images, the image must ship
+// kubeadm, the kubelet and containerd; the kubelet configuration of the cluster (e.g. the cluster DNS) is that kubeadm
+// downloads on join, which the node labels, taints and NodePool kubelet settings are passed on top of.
+type Kubeadm struct {
+	Options
+
+	APIServerName  string
+	APIServerPort  int32
+	BootstrapToken string
+}
+
+var _ Bootstrapper = (*Kubeadm)(nil) // assert Kubeadm implements Bootstrapper
+
+var (
+	//go:embed kubeadm.sh.gtpl
+	kubeadmTemplateText string
+	kubeadmTemplate     = template.Must(template.New("kubeadm").Parse(kubeadmTemplateText))
+)
+
+// kubeadmVariables is the input rendering the kubeadm bootstrap script template
+type kubeadmVariables struct {
+	APIServerEndpoint string
+	BootstrapToken    string
+	CACertHash        string
+	KubeletExtraArgs  map[string]string
+	Taints            []v1.Taint
+}
+
+func (k Kubeadm) Script() (string, error) {
+	caCertHash, err := caCertHash(lo.FromPtr(k.CABundle))
+	if err != nil {
+		return "", fmt.Errorf("hashing the cluster CA certificate, %w", err)
+	}
+	kubeletExtraArgs := lo.MapKeys(KubeletConfigToMap(k.KubeletConfig), func(_ string, flag string) string { return strings.TrimPrefix(flag, "--") })
+	if len(k.Labels) > 0 {
+		labels := lo.MapToSlice(k.Labels, func(key, value string) string { return key + "=" + value })
+		sort.Strings(labels)
+		kubeletExtraArgs["node-labels"] = strings.Join(labels, ",")
+	}
+	if len(k.KubeletFeatureGates) > 0 {
+		kubeletExtraArgs["feature-gates"] = featureGatesFlag(k.KubeletFeatureGates)
+	}
+	if k.KubeletCgroupDriver != "" {
+		kubeletExtraArgs["cgroup-driver"] = k.KubeletCgroupDriver
+	}
+
+	var buffer bytes.Buffer
+	if err := kubeadmTemplate.Execute(&buffer, kubeadmVariables{
+		APIServerEndpoint: net.JoinHostPort(k.APIServerName, strconv.Itoa(int(lo.Ternary(k.APIServerPort > 0, k.APIServerPort, 443)))),
+		BootstrapToken:    k.BootstrapToken,
+		CACertHash:        caCertHash,
+		KubeletExtraArgs:  kubeletExtraArgs,
+		Taints:            k.Taints,
+	}); err != nil {
+		return "", fmt.Errorf("error executing kubeadm bootstrap template: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// caCertHash returns the hash kubeadm discovers the cluster CA by, the hex SHA-256 of the public key of the
+// (first) certificate of the base64 encoded PEM bundle
+func caCertHash(caBundle string) (string, error) {
+	pemBundle, err := base64.StdEncoding.DecodeString(caBundle)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(pemBundle)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no PEM certificate in the CA bundle")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hash[:]), nil
+}
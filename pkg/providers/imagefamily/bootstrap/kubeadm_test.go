@@ -0,0 +1,119 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+)
+
+// testCA is a self-signed CA certificate
+const testCA = `-----BEGIN CERTIFICATE-----
+MIIBjTCCATOgAwIBAgIUOvXpWBY/fQNYiIVvJ3ifmWwORiUwCgYIKoZIzj0EAwIw
+GzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTAgFw0yNjEwMTQxNTUzNDVaGA8y
+MTI2MDkyMDE1NTM0NVowGzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTBZMBMG
+ByqGSM49AgEGCCqGSM49AwEHA0IABF3oQJQ84Is34S6pq5geRZgGlpOrTgRg7P8n
+hvlNFCtYDeH7EI5zgoAxRMGp/+ILPo08v2wSUBrdxPEa+AMsH9ejUzBRMB0GA1Ud
+DgQWBBSaqkZWlhj9Ff73G2fXFG+xpN77MzAfBgNVHSMEGDAWgBSaqkZWlhj9Ff73
+G2fXFG+xpN77MzAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCIQDy
+25z+n1qmkFFg1taG5EviqA4ThRMJTs8W20C+QQJ9KgIgGCrryOXiFz9YQ/5JrumK
+fU91JhEvQB21twyI7M6djdQ=
+-----END CERTIFICATE-----`
+
+func renderProfile(t *testing.T, profile string, a AKS) string {
+	t.Helper()
+	encoded, err := ForProfile(profile, a).Script()
+	if err != nil {
+		t.Fatalf("unexpected error rendering script of profile %q: %v", profile, err)
+	}
+	script, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding script: %v", err)
+	}
+	return string(script)
+}
+
+func TestForProfile(t *testing.T) {
+	for _, profile := range []string{"", ProfileAKS, "unknown"} {
+		if _, ok := ForProfile(profile, testAKS()).(AKS); !ok {
+			t.Errorf("expected profile %q to bootstrap with AKS", profile)
+		}
+	}
+	if _, ok := ForProfile(ProfileKubeadm, testAKS()).(Kubeadm); !ok {
+		t.Errorf("expected profile %q to bootstrap with kubeadm", ProfileKubeadm)
+	}
+}
+
+func TestProfileScripts(t *testing.T) {
+	a := testAKS()
+	a.CABundle = lo.ToPtr(base64.StdEncoding.EncodeToString([]byte(testCA)))
+	a.APIServerName = "api.internal.example.com"
+	a.KubeletClientTLSBootstrapToken = "abcdef.0123456789abcdef"
+	a.Labels = map[string]string{"team": "platform", "karpenter.sh/nodepool": "default"}
+	a.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	a.KubeletConfig = &corev1beta1.KubeletConfiguration{MaxPods: lo.ToPtr(int32(50))}
+
+	aks := renderProfile(t, ProfileAKS, a)
+	kubeadm := renderProfile(t, ProfileKubeadm, a)
+
+	for _, e := range []string{"provision_start.sh", "KUBELET_FLAGS="} {
+		if !strings.Contains(aks, e) {
+			t.Errorf("expected the AKS script to contain %q", e)
+		}
+		if strings.Contains(kubeadm, e) {
+			t.Errorf("expected the kubeadm script not to contain %q", e)
+		}
+	}
+	for _, e := range []string{
+		"kubeadm join --config /etc/kubernetes/kubeadm-join.yaml",
+		"kind: JoinConfiguration",
+		`apiServerEndpoint: "api.internal.example.com:443"`,
+		`token: "abcdef.0123456789abcdef"`,
+		`node-labels: "karpenter.sh/nodepool=default,team=platform"`,
+		`max-pods: "50"`,
+		`- key: "dedicated"`,
+		`value: "gpu"`,
+		`effect: "NoSchedule"`,
+	} {
+		if !strings.Contains(kubeadm, e) {
+			t.Errorf("expected the kubeadm script to contain %q, got:\n%s", e, kubeadm)
+		}
+	}
+	if strings.Contains(aks, "kubeadm join") {
+		t.Errorf("expected the AKS script not to join with kubeadm")
+	}
+	if !regexp.MustCompile(`caCertHashes:\n\s+- "sha256:[0-9a-f]{64}"`).MatchString(kubeadm) {
+		t.Errorf("expected the kubeadm script to discover the CA by the hash of its public key, got:\n%s", kubeadm)
+	}
+
+	a.APIServerPort = 6443
+	if kubeadm := renderProfile(t, ProfileKubeadm, a); !strings.Contains(kubeadm, `apiServerEndpoint: "api.internal.example.com:6443"`) {
+		t.Errorf("expected the kubeadm script to join the API server port, got:\n%s", kubeadm)
+	}
+}
+
+func TestKubeadmInvalidCABundle(t *testing.T) {
+	if _, err := ForProfile(ProfileKubeadm, testAKS()).Script(); err == nil {
+		t.Errorf("expected an error for a CA bundle without a PEM certificate")
+	}
+}
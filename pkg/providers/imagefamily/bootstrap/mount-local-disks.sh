@@ -0,0 +1,35 @@
+#!/bin/bash
+# Formats and mounts each local NVMe disk of the VM at <discovery path>/nvme<index>, for a local static provisioner
+# discovering its mount points. Disks which already have a filesystem are mounted as is.
+# With "raid0", multiple disks are striped into a single RAID 0 array mounted at <discovery path>/raid0 instead.
+DISCOVERY_PATH="$1"
+RAID0="$2"
+disks=($(lsblk -dnpo NAME,MODEL | awk '/Microsoft NVMe Direct Disk/ {print $1}' | sort -V))
+
+mount_disk() {
+    local disk="$1" target="$2"
+    if ! blkid "${disk}" >/dev/null 2>&1; then
+        mkfs.ext4 -F -q "${disk}"
+    fi
+    mkdir -p "${target}"
+    if ! mountpoint -q "${target}"; then
+        echo "UUID=$(blkid -s UUID -o value "${disk}") ${target} ext4 defaults,nofail 0 2" >> /etc/fstab
+        mount "${target}"
+    fi
+}
+
+if [ "${RAID0}" = "raid0" ] && [ "${#disks[@]}" -gt 1 ]; then
+    array=/dev/md/local-nvme
+    if [ ! -e "${array}" ]; then
+        mdadm --create "${array}" --level=0 --raid-devices="${#disks[@]}" --run "${disks[@]}"
+    fi
+    mount_disk "${array}" "${DISCOVERY_PATH}/raid0"
+    exit 0
+fi
+
+index=0
+for disk in "${disks[@]}"; do
+    target="${DISCOVERY_PATH}/nvme${index}"
+    index=$((index + 1))
+    mount_disk "${disk}" "${target}"
+done
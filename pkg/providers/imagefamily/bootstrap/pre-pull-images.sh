@@ -0,0 +1,27 @@
+#!/bin/bash
+# Pulls the given images into the CRI image store of containerd, with the credentials of their registry in the kubelet
+# credential file, if any. Images which fail to pull are logged and skipped rather than failing node bootstrapping.
+CREDENTIALS=/var/lib/kubelet/config.json
+for image in "$@"; do
+    registry="${image%%/*}"
+    if [[ "${image}" != */* || ( "${registry}" != *.* && "${registry}" != *:* && "${registry}" != localhost ) ]]; then
+        registry=https://index.docker.io/v1/
+    fi
+    auth=()
+    if [ -f "${CREDENTIALS}" ] && credential=$(jq -er --arg registry "${registry}" '.auths[$registry].auth' "${CREDENTIALS}" 2>/dev/null); then
+        auth=(--auth "${credential}")
+    fi
+    pulled=false
+    for i in $(seq 1 5); do
+        if timeout 600 crictl --runtime-endpoint unix:///run/containerd/containerd.sock pull "${auth[@]}" "${image}" >/dev/null; then
+            pulled=true
+            break
+        fi
+        sleep 10
+    done
+    if [ "${pulled}" = true ]; then
+        echo "pre-pulled ${image}"
+    else
+        echo "pre-pulling ${image} failed"
+    fi
+done
@@ -0,0 +1,11 @@
+#!/bin/bash
+# Powers the node off once Azure schedules its spot eviction (a Preempt scheduled event, at least 30 seconds ahead),
+# for the kubelet to gracefully shut down pods before the VM is evicted.
+# See https://learn.microsoft.com/azure/virtual-machines/linux/scheduled-events
+while true; do
+    if curl -sf -H Metadata:true "http://169.254.169.254/metadata/scheduledevents?api-version=2020-07-01" | grep -q '"EventType": *"Preempt"'; then
+        systemctl poweroff
+        exit 0
+    fi
+    sleep 5
+done
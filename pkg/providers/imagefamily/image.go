@@ -20,15 +20,19 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
 	"k8s.io/client-go/kubernetes"
 	"knative.dev/pkg/logging"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 )
@@ -40,6 +44,7 @@ type Provider struct {
 	kubernetesInterface    kubernetes.Interface
 	imageCache             *cache.Cache
 	imageVersionsClient    CommunityGalleryImageVersionsAPI
+	galleryImagesClient    GalleryImagesAPI
 }
 
 const (
@@ -49,14 +54,19 @@ const (
 	imageCacheCleaningInterval = time.Hour * 1
 
 	imageIDFormat = "/CommunityGalleries/%s/images/%s/versions/%s"
+
+	galleryImageResourceType        = "Microsoft.Compute/galleries/images"
+	galleryImageVersionResourceType = "Microsoft.Compute/galleries/images/versions"
 )
 
-func NewProvider(kubernetesInterface kubernetes.Interface, kubernetesVersionCache *cache.Cache, versionsClient CommunityGalleryImageVersionsAPI, location string) *Provider {
+func NewProvider(kubernetesInterface kubernetes.Interface, kubernetesVersionCache *cache.Cache, versionsClient CommunityGalleryImageVersionsAPI,
+	galleryImagesClient GalleryImagesAPI, location string) *Provider {
 	return &Provider{
 		kubernetesVersionCache: kubernetesVersionCache,
 		imageCache:             cache.New(imageExpirationInterval, imageCacheCleaningInterval),
 		location:               location,
 		imageVersionsClient:    versionsClient,
+		galleryImagesClient:    galleryImagesClient,
 		cm:                     pretty.NewChangeMonitor(),
 		kubernetesInterface:    kubernetesInterface,
 	}
@@ -64,17 +74,71 @@ func NewProvider(kubernetesInterface kubernetes.Interface, kubernetesVersionCach
 
 // Get returns Image ID for the given instance type. Images may vary due to architecture, accelerator, etc
 func (p *Provider) Get(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType, imageFamily ImageFamily) (string, error) {
-	defaultImages := imageFamily.DefaultImages()
+	defaultImages := filterConfidentialImages(imageFamily.DefaultImages(), utils.IsConfidentialSKU(instanceType.Name))
+	defaultImages = orderDefaultImages(defaultImages, nodeClass.Spec.IsMinimalImagePreferred() && supportsMinimalImage(instanceType))
+	if generation := nodeClass.Spec.GetImageHyperVGeneration(); generation != "" {
+		defaultImages = filterImageGeneration(defaultImages, generation)
+	}
+	imageSelector := nodeClass.Spec.ImageSelector
 	for _, defaultImage := range defaultImages {
 		if err := instanceType.Requirements.Compatible(defaultImage.Requirements, v1alpha2.AllowUndefinedLabels); err == nil {
 			communityImageName, publicGalleryURL := defaultImage.CommunityImage, defaultImage.PublicGalleryURL
-			return p.GetImageID(ctx, communityImageName, publicGalleryURL, nodeClass.Spec.GetImageVersion())
+			if len(imageSelector) == 0 {
+				return p.GetImageID(ctx, communityImageName, publicGalleryURL, nodeClass.Spec.GetImageVersion())
+			}
+			imageID, err := p.GetImageIDBySelector(ctx, communityImageName, publicGalleryURL, imageSelector)
+			if err != nil {
+				return "", err
+			}
+			if imageID != "" {
+				return imageID, nil
+			}
 		}
 	}
 
+	if len(imageSelector) > 0 {
+		return "", fmt.Errorf("no compatible images matching selector %v found for instance type %s", imageSelector, instanceType.Name)
+	}
+	if generation := lo.FromPtr(nodeClass.Spec.ImageGeneration); generation != "" {
+		return "", fmt.Errorf("no compatible %s images found for instance type %s", generation, instanceType.Name)
+	}
 	return "", fmt.Errorf("no compatible images found for instance type %s", instanceType.Name)
 }
 
+// filterImageGeneration keeps the images of the Hyper-V generation
+func filterImageGeneration(defaultImages []DefaultImageOutput, generation string) []DefaultImageOutput {
+	return lo.Filter(defaultImages, func(image DefaultImageOutput, _ int) bool {
+		return image.Requirements.Get(v1alpha2.LabelSKUHyperVGeneration).Has(generation)
+	})
+}
+
+// filterConfidentialImages keeps the confidential images for confidential VM sizes, which cannot boot other images, and drops them otherwise
+func filterConfidentialImages(defaultImages []DefaultImageOutput, confidential bool) []DefaultImageOutput {
+	return lo.Filter(defaultImages, func(image DefaultImageOutput, _ int) bool {
+		return image.Confidential == confidential
+	})
+}
+
+// HasConfidentialImages returns whether the image family provides images for confidential VM sizes
+func HasConfidentialImages(imageFamily ImageFamily) bool {
+	return lo.ContainsBy(imageFamily.DefaultImages(), func(image DefaultImageOutput) bool { return image.Confidential })
+}
+
+// orderDefaultImages moves minimal images ahead of the other images when they are preferred, and drops them otherwise
+func orderDefaultImages(defaultImages []DefaultImageOutput, preferMinimal bool) []DefaultImageOutput {
+	minimal, full := lo.FilterReject(defaultImages, func(image DefaultImageOutput, _ int) bool { return image.Minimal })
+	if !preferMinimal {
+		return full
+	}
+	return append(minimal, full...)
+}
+
+// supportsMinimalImage returns whether the minimal images ship what bootstrapping the instance type needs;
+// they do not include the GPU driver prerequisites
+func supportsMinimalImage(instanceType *cloudprovider.InstanceType) bool {
+	return !utils.IsNvidiaEnabledSKU(instanceType.Name)
+}
+
 func (p *Provider) KubeServerVersion(ctx context.Context) (string, error) {
 	if version, ok := p.kubernetesVersionCache.Get(kubernetesVersionCacheKey); ok {
 		return version.(string), nil
@@ -91,7 +155,7 @@ func (p *Provider) KubeServerVersion(ctx context.Context) (string, error) {
 	return version, nil
 }
 
-// Input versionName == "" to get the latest version
+// Input versionName == "" to get the latest version; a given version must be available in the gallery
 func (p *Provider) GetImageID(ctx context.Context, communityImageName, publicGalleryURL, versionName string) (string, error) {
 	key := fmt.Sprintf("%s/%s/%s", publicGalleryURL, communityImageName, versionName)
 	imageID, found := p.imageCache.Get(key)
@@ -100,20 +164,22 @@ func (p *Provider) GetImageID(ctx context.Context, communityImageName, publicGal
 	}
 
 	if versionName == "" {
-		pager := p.imageVersionsClient.NewListPager(p.location, publicGalleryURL, communityImageName, nil)
-		topImageVersionCandidate := armcompute.CommunityGalleryImageVersion{}
-		for pager.More() {
-			page, err := pager.NextPage(context.Background())
-			if err != nil {
-				return "", err
-			}
-			for _, imageVersion := range page.CommunityGalleryImageVersionList.Value {
-				if lo.IsEmpty(topImageVersionCandidate) || imageVersion.Properties.PublishedDate.After(*topImageVersionCandidate.Properties.PublishedDate) {
-					topImageVersionCandidate = *imageVersion
-				}
-			}
+		var err error
+		versionName, err = p.latestImageVersion(communityImageName, publicGalleryURL, func(*armcompute.CommunityGalleryImageVersion) bool { return true })
+		if err != nil {
+			return "", err
+		}
+	} else {
+		pinnedVersionName := versionName
+		availableVersionName, err := p.latestImageVersion(communityImageName, publicGalleryURL, func(imageVersion *armcompute.CommunityGalleryImageVersion) bool {
+			return lo.FromPtr(imageVersion.Name) == pinnedVersionName
+		})
+		if err != nil {
+			return "", err
+		}
+		if availableVersionName == "" {
+			return "", fmt.Errorf("image version %q is not available for image %s in gallery %s", versionName, communityImageName, publicGalleryURL)
 		}
-		versionName = lo.FromPtr(topImageVersionCandidate.Name)
 	}
 
 	selectedImageID := BuildImageID(publicGalleryURL, communityImageName, versionName)
@@ -124,6 +190,128 @@ func (p *Provider) GetImageID(ctx context.Context, communityImageName, publicGal
 	return selectedImageID, nil
 }
 
+// GetImageIDBySelector returns the latest image version whose artifact tags match all entries of the selector,
+// or an empty string if no version matches
+func (p *Provider) GetImageIDBySelector(ctx context.Context, communityImageName, publicGalleryURL string, selector map[string]string) (string, error) {
+	key := fmt.Sprintf("%s/%s/%s", publicGalleryURL, communityImageName, selectorKey(selector))
+	imageID, found := p.imageCache.Get(key)
+	if found {
+		return imageID.(string), nil
+	}
+
+	versionName, err := p.latestImageVersion(communityImageName, publicGalleryURL, func(imageVersion *armcompute.CommunityGalleryImageVersion) bool {
+		return matchesSelector(imageVersion.Properties.ArtifactTags, selector)
+	})
+	if err != nil {
+		return "", err
+	}
+	if versionName == "" {
+		return "", nil
+	}
+
+	selectedImageID := BuildImageID(publicGalleryURL, communityImageName, versionName)
+	if p.cm.HasChanged(key, selectedImageID) {
+		logging.FromContext(ctx).With("image-id", selectedImageID, "image-selector", selector).Info("discovered new image id")
+	}
+	p.imageCache.Set(key, selectedImageID, imageExpirationInterval)
+	return selectedImageID, nil
+}
+
+// latestImageVersion returns the name of the most recently published image version accepted by the filter,
+// or an empty string if there is none
+func (p *Provider) latestImageVersion(communityImageName, publicGalleryURL string, filter func(*armcompute.CommunityGalleryImageVersion) bool) (string, error) {
+	pager := p.imageVersionsClient.NewListPager(p.location, publicGalleryURL, communityImageName, nil)
+	topImageVersionCandidate := armcompute.CommunityGalleryImageVersion{}
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return "", err
+		}
+		for _, imageVersion := range page.CommunityGalleryImageVersionList.Value {
+			if !filter(imageVersion) {
+				continue
+			}
+			if lo.IsEmpty(topImageVersionCandidate) || imageVersion.Properties.PublishedDate.After(*topImageVersionCandidate.Properties.PublishedDate) {
+				topImageVersionCandidate = *imageVersion
+			}
+		}
+	}
+	return lo.FromPtr(topImageVersionCandidate.Name), nil
+}
+
+func matchesSelector(tags map[string]*string, selector map[string]string) bool {
+	for k, v := range selector {
+		if tag, ok := tags[k]; !ok || lo.FromPtr(tag) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorKey renders a selector deterministically, for use in cache keys
+func selectorKey(selector map[string]string) string {
+	pairs := lo.MapToSlice(selector, func(k, v string) string { return fmt.Sprintf("%s=%s", k, v) })
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// GetSharedImageGalleryImageID validates a user-specified Azure Compute Gallery image (version) ID,
+// including that the image definition supports the given architecture, and returns the ID to launch with
+func (p *Provider) GetSharedImageGalleryImageID(ctx context.Context, imageID, arch string) (string, error) {
+	galleryImageID, err := ParseSharedImageGalleryImageID(imageID)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.ToLower(galleryImageID.String())
+	architecture, found := p.imageCache.Get(key)
+	if !found {
+		galleryImage, err := p.galleryImagesClient.Get(ctx, galleryImageID.SubscriptionID, galleryImageID.ResourceGroupName, galleryImageID.Parent.Name, galleryImageID.Name)
+		if err != nil {
+			return "", fmt.Errorf("getting shared image gallery image %s, %w", galleryImageID.String(), err)
+		}
+		// Azure defaults the architecture of gallery images to x64
+		architecture = string(armcompute.ArchitectureX64)
+		if galleryImage.Properties != nil && galleryImage.Properties.Architecture != nil {
+			architecture = string(*galleryImage.Properties.Architecture)
+		}
+		p.imageCache.Set(key, architecture, imageExpirationInterval)
+	}
+
+	if expected := galleryImageArchitecture(arch); !strings.EqualFold(architecture.(string), expected) {
+		return "", fmt.Errorf("shared image gallery image %s has architecture %s, expected %s", imageID, architecture, expected)
+	}
+	return imageID, nil
+}
+
+// ParseSharedImageGalleryImageID parses an Azure Compute Gallery image definition or image version ID,
+// returning the ID of the image definition
+func ParseSharedImageGalleryImageID(imageID string) (*arm.ResourceID, error) {
+	id, err := arm.ParseResourceID(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing shared image gallery id %q, %w", imageID, err)
+	}
+	if strings.EqualFold(id.ResourceType.String(), galleryImageVersionResourceType) {
+		id = id.Parent
+	}
+	if !strings.EqualFold(id.ResourceType.String(), galleryImageResourceType) {
+		return nil, fmt.Errorf("shared image gallery id %q is not a gallery image or image version", imageID)
+	}
+	return id, nil
+}
+
+// IsCommunityImageID returns whether the image ID refers to a community gallery image, as opposed to an Azure Compute Gallery image
+func IsCommunityImageID(imageID string) bool {
+	return strings.HasPrefix(strings.ToLower(imageID), "/communitygalleries/")
+}
+
+func galleryImageArchitecture(arch string) string {
+	if arch == corev1beta1.ArchitectureArm64 {
+		return string(armcompute.ArchitectureArm64)
+	}
+	return string(armcompute.ArchitectureX64)
+}
+
 func BuildImageID(publicGalleryURL, communityImageName, imageVersion string) string {
 	return fmt.Sprintf(imageIDFormat, publicGalleryURL, communityImageName, imageVersion)
 }
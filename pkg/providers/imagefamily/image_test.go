@@ -17,13 +17,28 @@ limitations under the License.
 package imagefamily_test
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/fake"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/Azure/karpenter-provider-azure/pkg/test"
 )
 
 func TestAzure(t *testing.T) {
@@ -55,3 +70,281 @@ var _ = Describe("Image ID Parsing", func() {
 		Entry("empty image id should not parse", "badimageid", "", "", "", true),
 	)
 })
+
+var _ = Describe("Image Selection By Selector", func() {
+	var versionsAPI *fake.CommunityGalleryImageVersionsAPI
+	var galleryImagesAPI *fake.GalleryImagesAPI
+	var imageProvider *imagefamily.Provider
+	var nodeClass *v1alpha2.AKSNodeClass
+	instanceType := &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+			scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+		),
+	}
+	imageVersion := func(name string, published time.Time, tags map[string]string) *armcompute.CommunityGalleryImageVersion {
+		return &armcompute.CommunityGalleryImageVersion{
+			Name: lo.ToPtr(name),
+			Properties: &armcompute.CommunityGalleryImageVersionProperties{
+				PublishedDate: lo.ToPtr(published),
+				ArtifactTags:  lo.MapValues(tags, func(v string, _ string) *string { return lo.ToPtr(v) }),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		versionsAPI = &fake.CommunityGalleryImageVersionsAPI{}
+		galleryImagesAPI = &fake.GalleryImagesAPI{}
+		imageProvider = imagefamily.NewProvider(nil, cache.New(time.Minute, time.Minute), versionsAPI, galleryImagesAPI, "eastus")
+		nodeClass = &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily)}}
+		now := time.Now()
+		versionsAPI.ImageVersions.Append(
+			imageVersion(olderImageVersion, now.Add(-time.Hour), map[string]string{"tier": "hardened"}),
+			imageVersion(latestImageVersion, now, map[string]string{"tier": "standard"}),
+		)
+	})
+
+	It("should select the latest version without a selector", func() {
+		imageID, err := imageProvider.Get(context.Background(), nodeClass, instanceType, &imagefamily.Ubuntu2204{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage, latestImageVersion)))
+	})
+
+	It("should select the pinned version", func() {
+		nodeClass.Spec.ImageVersion = lo.ToPtr(olderImageVersion)
+		imageID, err := imageProvider.Get(context.Background(), nodeClass, instanceType, &imagefamily.Ubuntu2204{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage, olderImageVersion)))
+	})
+
+	It("should error when the pinned version is not available", func() {
+		nodeClass.Spec.ImageVersion = lo.ToPtr("1.1686127203.20000")
+		_, err := imageProvider.Get(context.Background(), nodeClass, instanceType, &imagefamily.Ubuntu2204{})
+		Expect(err).To(MatchError(ContainSubstring(`image version "1.1686127203.20000" is not available`)))
+	})
+
+	It("should select the latest version matching the selector", func() {
+		nodeClass.Spec.ImageSelector = map[string]string{"tier": "hardened"}
+		imageID, err := imageProvider.Get(context.Background(), nodeClass, instanceType, &imagefamily.Ubuntu2204{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage, olderImageVersion)))
+	})
+
+	It("should error when no version matches the selector", func() {
+		nodeClass.Spec.ImageSelector = map[string]string{"tier": "hardened", "region": "eastus"}
+		_, err := imageProvider.Get(context.Background(), nodeClass, instanceType, &imagefamily.Ubuntu2204{})
+		Expect(err).To(MatchError(ContainSubstring("no compatible images matching selector")))
+	})
+})
+
+var _ = Describe("Minimal Image Preference", func() {
+	var imageProvider *imagefamily.Provider
+	var nodeClass *v1alpha2.AKSNodeClass
+	instanceType := func(name, arch string) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{
+			Name: name,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, arch),
+				scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+			),
+		}
+	}
+
+	BeforeEach(func() {
+		versionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+		versionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{
+			Name:       lo.ToPtr(latestImageVersion),
+			Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now())},
+		})
+		imageProvider = imagefamily.NewProvider(nil, cache.New(time.Minute, time.Minute), versionsAPI, nil, "eastus")
+		nodeClass = &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily)}}
+	})
+
+	DescribeTable("should select the image",
+		func(preferMinimal bool, instanceType *cloudprovider.InstanceType, imageFamily imagefamily.ImageFamily, galleryURL, communityImage string) {
+			nodeClass.Spec.PreferMinimalImage = lo.ToPtr(preferMinimal)
+			imageID, err := imageProvider.Get(context.Background(), nodeClass, instanceType, imageFamily)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(imageID).To(Equal(imagefamily.BuildImageID(galleryURL, communityImage, latestImageVersion)))
+		},
+		Entry("full image without the preference", false, instanceType("Standard_D2s_v3", corev1beta1.ArchitectureAmd64),
+			&imagefamily.Ubuntu2204{}, imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage),
+		Entry("minimal image with the preference", true, instanceType("Standard_D2s_v3", corev1beta1.ArchitectureAmd64),
+			&imagefamily.Ubuntu2204{}, imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2MinimalCommunityImage),
+		Entry("full image for GPU instance types", true, instanceType("Standard_NC6s_v3", corev1beta1.ArchitectureAmd64),
+			&imagefamily.Ubuntu2204{}, imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage),
+		Entry("full image when no minimal image is compatible", true, instanceType("Standard_D2ps_v5", corev1beta1.ArchitectureArm64),
+			&imagefamily.Ubuntu2204{}, imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2ArmCommunityImage),
+		Entry("full image for image families without minimal images", true, instanceType("Standard_D2s_v3", corev1beta1.ArchitectureAmd64),
+			&imagefamily.AzureLinux{}, imagefamily.AKSAzureLinuxPublicGalleryURL, imagefamily.AzureLinuxGen2CommunityImage),
+	)
+})
+
+var _ = Describe("Confidential VM Images", func() {
+	var resolver *imagefamily.Resolver
+	var nodeClass *v1alpha2.AKSNodeClass
+	instanceType := func(name string) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{
+			Name: name,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+			),
+			Overhead: &cloudprovider.InstanceTypeOverhead{},
+		}
+	}
+	resolve := func(instanceType *cloudprovider.InstanceType) (*parameters.Parameters, error) {
+		return resolver.Resolve(context.Background(), nodeClass, &corev1beta1.NodeClaim{}, instanceType, &parameters.StaticParameters{Arch: corev1beta1.ArchitectureAmd64})
+	}
+
+	BeforeEach(func() {
+		versionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+		versionsAPI.ImageVersions.Append(&armcompute.CommunityGalleryImageVersion{
+			Name:       lo.ToPtr(latestImageVersion),
+			Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now())},
+		})
+		resolver = imagefamily.New(nil, imagefamily.NewProvider(nil, cache.New(time.Minute, time.Minute), versionsAPI, nil, "eastus"))
+		nodeClass = &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily)}}
+	})
+
+	It("should resolve the confidential VM image for confidential instance types", func() {
+		templateParameters, err := resolve(instanceType("Standard_DC2as_v5"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templateParameters.ImageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CVMCommunityImage, latestImageVersion)))
+
+		// minimal images are not confidential VM images
+		nodeClass.Spec.PreferMinimalImage = lo.ToPtr(true)
+		templateParameters, err = resolve(instanceType("Standard_EC4ads_v5"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templateParameters.ImageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CVMCommunityImage, latestImageVersion)))
+	})
+	It("should not resolve the confidential VM image for other instance types", func() {
+		templateParameters, err := resolve(instanceType("Standard_D2as_v5"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templateParameters.ImageID).To(Equal(imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage, latestImageVersion)))
+	})
+	It("should error on confidential instance types with an image family without confidential VM images", func() {
+		nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+		_, err := resolve(instanceType("Standard_DC2as_v5"))
+		Expect(err).To(MatchError("confidential instance type Standard_DC2as_v5 requires a confidential VM image, which image family AzureLinux does not provide"))
+
+		_, err = resolve(instanceType("Standard_D2as_v5"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("Shared Image Gallery Image Override", func() {
+	const galleryImageID = "/subscriptions/gallery-subscription/resourceGroups/gallery-rg/providers/Microsoft.Compute/galleries/gallery/images/hardened-ubuntu"
+	var resolver *imagefamily.Resolver
+	var nodeClass *v1alpha2.AKSNodeClass
+	instanceType := func(arch string) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{
+			Name: "Standard_D2s_v3",
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, arch),
+			),
+			Overhead: &cloudprovider.InstanceTypeOverhead{},
+		}
+	}
+	staticParameters := func(arch string) *parameters.StaticParameters {
+		return &parameters.StaticParameters{Arch: arch, Labels: map[string]string{"test-label": "test-value"}}
+	}
+
+	BeforeEach(func() {
+		galleryImagesAPI := &fake.GalleryImagesAPI{}
+		galleryImagesAPI.Store("gallery-subscription", "gallery-rg", "gallery", "hardened-ubuntu", armcompute.GalleryImage{
+			Properties: &armcompute.GalleryImageProperties{Architecture: lo.ToPtr(armcompute.ArchitectureX64)},
+		})
+		resolver = imagefamily.New(nil, imagefamily.NewProvider(nil, cache.New(time.Minute, time.Minute), &fake.CommunityGalleryImageVersionsAPI{}, galleryImagesAPI, "eastus"))
+		nodeClass = &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily)}}
+	})
+
+	DescribeTable("should use the gallery image and still render parameters",
+		func(imageID string) {
+			nodeClass.Spec.SharedImageGalleryID = lo.ToPtr(imageID)
+			templateParameters, err := resolver.Resolve(context.Background(), nodeClass, &corev1beta1.NodeClaim{}, instanceType(corev1beta1.ArchitectureAmd64), staticParameters(corev1beta1.ArchitectureAmd64))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(templateParameters.ImageID).To(Equal(imageID))
+			Expect(templateParameters.UserData).ToNot(BeNil())
+			Expect(templateParameters.Labels).To(HaveKeyWithValue("test-label", "test-value"))
+		},
+		Entry("image definition", galleryImageID),
+		Entry("image version", galleryImageID+"/versions/1.0.0"),
+	)
+
+	It("should error on a malformed gallery image id", func() {
+		nodeClass.Spec.SharedImageGalleryID = lo.ToPtr("/subscriptions/gallery-subscription/resourceGroups/gallery-rg/providers/Microsoft.Compute/galleries/gallery")
+		_, err := resolver.Resolve(context.Background(), nodeClass, &corev1beta1.NodeClaim{}, instanceType(corev1beta1.ArchitectureAmd64), staticParameters(corev1beta1.ArchitectureAmd64))
+		Expect(err).To(MatchError(ContainSubstring("is not a gallery image or image version")))
+
+		nodeClass.Spec.SharedImageGalleryID = lo.ToPtr("not-a-resource-id")
+		_, err = resolver.Resolve(context.Background(), nodeClass, &corev1beta1.NodeClaim{}, instanceType(corev1beta1.ArchitectureAmd64), staticParameters(corev1beta1.ArchitectureAmd64))
+		Expect(err).To(MatchError(ContainSubstring("parsing shared image gallery id")))
+	})
+
+	It("should error when the gallery image does not match the instance architecture", func() {
+		nodeClass.Spec.SharedImageGalleryID = lo.ToPtr(galleryImageID)
+		_, err := resolver.Resolve(context.Background(), nodeClass, &corev1beta1.NodeClaim{}, instanceType(corev1beta1.ArchitectureArm64), staticParameters(corev1beta1.ArchitectureArm64))
+		Expect(err).To(MatchError(ContainSubstring("has architecture x64, expected Arm64")))
+	})
+
+	It("should identify community gallery image ids", func() {
+		Expect(imagefamily.IsCommunityImageID(testImageID)).To(BeTrue())
+		Expect(imagefamily.IsCommunityImageID(galleryImageID)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Approved Image Digests", func() {
+	const galleryImageID = "/subscriptions/gallery-subscription/resourceGroups/gallery-rg/providers/Microsoft.Compute/galleries/gallery/images/hardened-ubuntu/versions/1.0.0"
+	var resolver *imagefamily.Resolver
+	var nodeClass *v1alpha2.AKSNodeClass
+	instanceType := &cloudprovider.InstanceType{
+		Name:         "Standard_D2s_v3",
+		Requirements: scheduling.NewRequirements(scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64)),
+		Overhead:     &cloudprovider.InstanceTypeOverhead{},
+	}
+	resolve := func(approvedImageDigests ...string) (*parameters.Parameters, error) {
+		ctx := options.ToContext(context.Background(), test.Options(test.OptionsFields{ApprovedImageDigests: approvedImageDigests}))
+		return resolver.Resolve(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, &parameters.StaticParameters{Arch: corev1beta1.ArchitectureAmd64})
+	}
+
+	BeforeEach(func() {
+		galleryImagesAPI := &fake.GalleryImagesAPI{}
+		galleryImagesAPI.Store("gallery-subscription", "gallery-rg", "gallery", "hardened-ubuntu", armcompute.GalleryImage{
+			Properties: &armcompute.GalleryImageProperties{Architecture: lo.ToPtr(armcompute.ArchitectureX64)},
+		})
+		resolver = imagefamily.New(nil, imagefamily.NewProvider(nil, cache.New(time.Minute, time.Minute), &fake.CommunityGalleryImageVersionsAPI{}, galleryImagesAPI, "eastus"))
+		nodeClass = &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily), SharedImageGalleryID: lo.ToPtr(galleryImageID)}}
+	})
+
+	It("should digest the lowercase image id", func() {
+		Expect(imagefamily.ImageDigest(galleryImageID)).To(MatchRegexp("^sha256:[0-9a-f]{64}$"))
+		Expect(imagefamily.ImageDigest(galleryImageID)).To(Equal(imagefamily.ImageDigest(strings.ToUpper(galleryImageID))))
+		Expect(imagefamily.ImageDigest(galleryImageID)).ToNot(Equal(imagefamily.ImageDigest(strings.Replace(galleryImageID, "1.0.0", "1.0.1", 1))))
+	})
+	It("should allow any image without approved digests", func() {
+		templateParameters, err := resolve()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templateParameters.ImageID).To(Equal(galleryImageID))
+	})
+	It("should resolve an approved image", func() {
+		templateParameters, err := resolve("sha256:"+strings.Repeat("0", 64), imagefamily.ImageDigest(galleryImageID))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(templateParameters.ImageID).To(Equal(galleryImageID))
+	})
+	It("should error on an image that is not approved", func() {
+		_, err := resolve("sha256:" + strings.Repeat("0", 64))
+		Expect(err).To(MatchError(fmt.Sprintf("image %s with digest %s is not in approved-image-digests", galleryImageID, imagefamily.ImageDigest(galleryImageID))))
+	})
+})
+
+var _ = Describe("Resolver Kubelet Configuration", func() {
+	It("should reject a negative evictionMaxPodGracePeriod", func() {
+		nodeClaim := &corev1beta1.NodeClaim{Spec: corev1beta1.NodeClaimSpec{
+			Kubelet: &corev1beta1.KubeletConfiguration{EvictionMaxPodGracePeriod: lo.ToPtr[int32](-1)},
+		}}
+		_, err := imagefamily.New(nil, nil).Resolve(context.Background(), &v1alpha2.AKSNodeClass{}, nodeClaim, &cloudprovider.InstanceType{}, &parameters.StaticParameters{})
+		Expect(err).To(MatchError(ContainSubstring("evictionMaxPodGracePeriod must be non-negative")))
+	})
+})
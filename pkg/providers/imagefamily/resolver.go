@@ -18,6 +18,9 @@ package imagefamily
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
 
 	core "k8s.io/api/core/v1"
 	"knative.dev/pkg/logging"
@@ -25,9 +28,11 @@ import (
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	template "github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/samber/lo"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
@@ -77,8 +82,14 @@ func New(_ client.Client, imageProvider *Provider) *Resolver {
 // Resolve fills in dynamic launch template parameters
 func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceType *cloudprovider.InstanceType,
 	staticParameters *template.StaticParameters) (*template.Parameters, error) {
+	if err := validateKubeletConfig(nodeClaim.Spec.Kubelet); err != nil {
+		return nil, err
+	}
 	imageFamily := getImageFamily(nodeClass.Spec.ImageFamily, staticParameters)
-	imageID, err := r.imageProvider.Get(ctx, nodeClass, instanceType, imageFamily)
+	if err := validateConfidentialImageFamily(nodeClass, instanceType, imageFamily); err != nil {
+		return nil, err
+	}
+	imageID, err := r.getImageID(ctx, nodeClass, instanceType, imageFamily, staticParameters.Arch)
 	if err != nil {
 		metrics.ImageSelectionErrorCount.WithLabelValues(imageFamily.Name()).Inc()
 		return nil, err
@@ -94,13 +105,13 @@ func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass,
 	kubeletConfig.SystemReserved = resources.StringMap(instanceType.Overhead.SystemReserved)
 	kubeletConfig.EvictionHard = map[string]string{
 		instancetype.MemoryAvailable: instanceType.Overhead.EvictionThreshold.Memory().String()}
-	kubeletConfig.MaxPods = lo.ToPtr(getMaxPods(staticParameters.NetworkPlugin))
+	kubeletConfig.MaxPods = lo.ToPtr(getMaxPods(staticParameters.NetworkPlugin, staticParameters.KubeletMaxPods, staticParameters.MaxPods))
 	logging.FromContext(ctx).Infof("Resolved image %s for instance type %s", imageID, instanceType.Name)
 	template := &template.Parameters{
 		StaticParameters: staticParameters,
 		UserData: imageFamily.UserData(
 			kubeletConfig,
-			append(nodeClaim.Spec.Taints, nodeClaim.Spec.StartupTaints...),
+			staticParameters.Taints,
 			staticParameters.Labels,
 			staticParameters.CABundle,
 			instanceType,
@@ -111,6 +122,63 @@ func (r Resolver) Resolve(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass,
 	return template, nil
 }
 
+// getImageID returns the Azure Compute Gallery image override if specified, otherwise the image family image for the instance type,
+// provided it is approved
+func (r Resolver) getImageID(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType, imageFamily ImageFamily, arch string) (string, error) {
+	var imageID string
+	var err error
+	if sharedImageGalleryID := nodeClass.Spec.SharedImageGalleryID; sharedImageGalleryID != nil {
+		imageID, err = r.imageProvider.GetSharedImageGalleryImageID(ctx, *sharedImageGalleryID, arch)
+	} else {
+		imageID, err = r.imageProvider.Get(ctx, nodeClass, instanceType, imageFamily)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := validateImageApproved(ctx, imageID); err != nil {
+		return "", err
+	}
+	return imageID, nil
+}
+
+// ImageDigest returns the digest an image is approved by: the sha256 digest of its lowercase image ID,
+// which identifies an immutable image version
+func ImageDigest(imageID string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(strings.ToLower(imageID))))
+}
+
+// validateImageApproved checks the digest of the image is in the approved-image-digests allowlist, if one is configured
+func validateImageApproved(ctx context.Context, imageID string) error {
+	opts := options.FromContext(ctx)
+	if opts == nil || len(opts.ApprovedImageDigests) == 0 {
+		return nil
+	}
+	if digest := ImageDigest(imageID); !lo.Contains(opts.ApprovedImageDigests, digest) {
+		return fmt.Errorf("image %s with digest %s is not in approved-image-digests", imageID, digest)
+	}
+	return nil
+}
+
+// validateConfidentialImageFamily checks that confidential VM sizes are launched with a confidential VM image, either of the image family
+// or an Azure Compute Gallery image, which is expected to support the ConfidentialVM security type
+func validateConfidentialImageFamily(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType, imageFamily ImageFamily) error {
+	if !utils.IsConfidentialSKU(instanceType.Name) || nodeClass.Spec.SharedImageGalleryID != nil || HasConfidentialImages(imageFamily) {
+		return nil
+	}
+	return fmt.Errorf("confidential instance type %s requires a confidential VM image, which image family %s does not provide", instanceType.Name, imageFamily.Name())
+}
+
+// validateKubeletConfig validates the kubelet configuration fields which are not validated by the NodePool CRD
+func validateKubeletConfig(kubeletConfig *corev1beta1.KubeletConfiguration) error {
+	if kubeletConfig == nil {
+		return nil
+	}
+	if lo.FromPtr(kubeletConfig.EvictionMaxPodGracePeriod) < 0 {
+		return fmt.Errorf("evictionMaxPodGracePeriod must be non-negative, got %d", *kubeletConfig.EvictionMaxPodGracePeriod)
+	}
+	return nil
+}
+
 func getImageFamily(familyName *string, parameters *template.StaticParameters) ImageFamily {
 	switch lo.FromPtr(familyName) {
 	case v1alpha2.Ubuntu2204ImageFamily:
@@ -122,11 +190,17 @@ func getImageFamily(familyName *string, parameters *template.StaticParameters) I
 	}
 }
 
-func getMaxPods(networkPlugin string) int32 {
-	if networkPlugin == networkPluginAzure {
-		return defaultKubernetesMaxPodsAzure
+func getMaxPods(networkPlugin string, kubeletMaxPods, maxPodsCap int32) int32 {
+	maxPods := int32(defaultKubernetesMaxPods)
+	if kubeletMaxPods > 0 {
+		maxPods = kubeletMaxPods
+	} else if networkPlugin == networkPluginAzure {
+		maxPods = defaultKubernetesMaxPodsAzure
 	} else if networkPlugin == networkPluginKubenet {
-		return defaultKubernetesMaxPodsKubenet
+		maxPods = defaultKubernetesMaxPodsKubenet
+	}
+	if maxPodsCap > 0 {
+		return min(maxPods, maxPodsCap)
 	}
-	return defaultKubernetesMaxPods
+	return maxPods
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package imagefamily
 
 import (
+	"context"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	armcomputev5 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
@@ -32,9 +34,18 @@ type DefaultImageOutput struct {
 	CommunityImage   string
 	PublicGalleryURL string
 	Requirements     scheduling.Requirements
+	// Minimal images are only selected when the NodeClass prefers them, see AKSNodeClassSpec.PreferMinimalImage
+	Minimal bool
+	// Confidential images boot confidential VMs, and are the only images selected for confidential VM sizes, see utils.IsConfidentialSKU
+	Confidential bool
 }
 
 // CommunityGalleryImageVersionsAPI is used for listing community gallery image versions.
 type CommunityGalleryImageVersionsAPI interface {
 	NewListPager(location string, publicGalleryName string, galleryImageName string, options *armcomputev5.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcomputev5.CommunityGalleryImageVersionsClientListResponse]
 }
+
+// GalleryImagesAPI is used for getting Azure Compute Gallery image definitions, which may be in any subscription.
+type GalleryImagesAPI interface {
+	Get(ctx context.Context, subscriptionID string, resourceGroupName string, galleryName string, galleryImageName string) (armcomputev5.GalleryImage, error)
+}
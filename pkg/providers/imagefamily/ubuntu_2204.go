@@ -32,6 +32,9 @@ const (
 	Ubuntu2204Gen2CommunityImage    = "2204gen2containerd"
 	Ubuntu2204Gen1CommunityImage    = "2204containerd"
 	Ubuntu2204Gen2ArmCommunityImage = "2204gen2arm64containerd"
+
+	Ubuntu2204Gen2MinimalCommunityImage = "2204gen2minimalcontainerd"
+	Ubuntu2204Gen2CVMCommunityImage     = "2204gen2CVMcontainerd"
 )
 
 type Ubuntu2204 struct {
@@ -69,23 +72,90 @@ func (u Ubuntu2204) DefaultImages() []DefaultImageOutput {
 				scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
 			),
 		},
+		{
+			CommunityImage:   Ubuntu2204Gen2MinimalCommunityImage,
+			PublicGalleryURL: AKSUbuntuPublicGalleryURL,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+			),
+			Minimal: true,
+		},
+		{
+			CommunityImage:   Ubuntu2204Gen2CVMCommunityImage,
+			PublicGalleryURL: AKSUbuntuPublicGalleryURL,
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+				scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+			),
+			Confidential: true,
+		},
 	}
 }
 
 // UserData returns the default userdata script for the image Family
 func (u Ubuntu2204) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, _ *cloudprovider.InstanceType) bootstrap.Bootstrapper {
-	return bootstrap.AKS{
+	return bootstrap.ForProfile(u.Options.BootstrapProfile, bootstrap.AKS{
 		Options: bootstrap.Options{
-			ClusterName:      u.Options.ClusterName,
-			ClusterEndpoint:  u.Options.ClusterEndpoint,
-			KubeletConfig:    kubeletConfig,
-			Taints:           taints,
-			Labels:           labels,
-			CABundle:         caBundle,
-			GPUNode:          u.Options.GPUNode,
-			GPUDriverVersion: u.Options.GPUDriverVersion,
-			GPUImageSHA:      u.Options.GPUImageSHA,
-			SubnetID:         u.Options.SubnetID,
+			ClusterName:            u.Options.ClusterName,
+			ClusterEndpoint:        u.Options.ClusterEndpoint,
+			KubeletConfig:          kubeletConfig,
+			Taints:                 taints,
+			Labels:                 labels,
+			Annotations:            u.Options.Annotations,
+			CABundle:               caBundle,
+			GPUNode:                u.Options.GPUNode,
+			GPUDriverVersion:       u.Options.GPUDriverVersion,
+			GPUImageSHA:            u.Options.GPUImageSHA,
+			GPUPersistenceMode:     u.Options.GPUPersistenceMode,
+			GPUMIGProfile:          u.Options.GPUMIGProfile,
+			SubnetID:               u.Options.SubnetID,
+			Hostname:               u.Options.Hostname,
+			MTU:                    u.Options.MTU,
+			DNSServers:             u.Options.DNSServers,
+			DNSSearchDomains:       u.Options.DNSSearchDomains,
+			DisableDNSStubListener: u.Options.DisableDNSStubListener,
+			DisableIPv6:            u.Options.DisableIPv6,
+			TCPCongestionControl:   u.Options.TCPCongestionControl,
+			SandboxRuntime:         u.Options.SandboxRuntime,
+			DefaultRuntimeHandler:  u.Options.DefaultRuntimeHandler,
+			EntropySource:          u.Options.EntropySource,
+			SwapAccounting:         u.Options.SwapAccounting,
+			RoCE:                   u.Options.RoCE,
+			AdditionalCAs:          u.Options.AdditionalCAs,
+			Spot:                   u.Options.Spot,
+
+			ConntrackMax:                   u.Options.ConntrackMax,
+			ConntrackTCPTimeoutEstablished: u.Options.ConntrackTCPTimeoutEstablished,
+			ConntrackTCPTimeoutCloseWait:   u.Options.ConntrackTCPTimeoutCloseWait,
+
+			NetworkSysctls: u.Options.NetworkSysctls,
+			Sysctls:        u.Options.Sysctls,
+
+			RegistryMirrors:           u.Options.RegistryMirrors,
+			ImagePullCredentials:      u.Options.ImagePullCredentials,
+			CNIBinDir:                 u.Options.CNIBinDir,
+			CNIConfDir:                u.Options.CNIConfDir,
+			MaxConcurrentDownloads:    u.Options.MaxConcurrentDownloads,
+			LocalStorageDiscoveryPath: u.Options.LocalStorageDiscoveryPath,
+			LocalStorageRAID0:         u.Options.LocalStorageRAID0,
+
+			OOMScoreAdj:         u.Options.OOMScoreAdj,
+			KubeletFeatureGates: u.Options.KubeletFeatureGates,
+			KubeletCgroupDriver: u.Options.KubeletCgroupDriver,
+
+			ReadinessCommand:               u.Options.ReadinessCommand,
+			SystemdUnits:                   u.Options.SystemdUnits,
+			ReadinessCommandTimeoutSeconds: u.Options.ReadinessCommandTimeoutSeconds,
+			PrePullImages:                  u.Options.PrePullImages,
+			PrePullImagesInBackground:      u.Options.PrePullImagesInBackground,
+			RegistrationTimeoutSeconds:     u.Options.RegistrationTimeoutSeconds,
+			RegistrationRetryCount:         u.Options.RegistrationRetryCount,
+
+			HTTPProxy:          u.Options.HTTPProxy,
+			HTTPSProxy:         u.Options.HTTPSProxy,
+			NoProxy:            u.Options.NoProxy,
+			HTTPProxyTrustedCA: u.Options.HTTPProxyTrustedCA,
 		},
 		Arch:                           u.Options.Arch,
 		TenantID:                       u.Options.TenantID,
@@ -95,9 +165,13 @@ func (u Ubuntu2204) UserData(kubeletConfig *corev1beta1.KubeletConfiguration, ta
 		ResourceGroup:                  u.Options.ResourceGroup,
 		ClusterID:                      u.Options.ClusterID,
 		APIServerName:                  u.Options.APIServerName,
+		APIServerPort:                  u.Options.APIServerPort,
 		KubeletClientTLSBootstrapToken: u.Options.KubeletClientTLSBootstrapToken,
+		SecureTLSBootstrapping:         u.Options.SecureTLSBootstrapping,
+		OIDCIssuerURL:                  u.Options.OIDCIssuerURL,
 		NetworkPlugin:                  u.Options.NetworkPlugin,
 		NetworkPolicy:                  u.Options.NetworkPolicy,
+		ClusterDNSIP:                   u.Options.ClusterDNSIP,
 		KubernetesVersion:              u.Options.KubernetesVersion,
-	}
+	})
 }
@@ -19,6 +19,8 @@ package instance
 import (
 	"context"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	armcomputev5 "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
@@ -28,6 +30,7 @@ import (
 	"github.com/Azure/karpenter-provider-azure/pkg/auth"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instance/skuclient"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 
 	armopts "github.com/Azure/karpenter-provider-azure/pkg/utils/opts"
@@ -63,9 +66,13 @@ type AZClient struct {
 	networkInterfacesClient        NetworkInterfacesAPI
 
 	ImageVersionsClient imagefamily.CommunityGalleryImageVersionsAPI
+	GalleryImagesClient imagefamily.GalleryImagesAPI
 	// SKU CLIENT is still using track 1 because skewer does not support the track 2 path. We need to refactor this once skewer supports track 2
 	SKUClient           skuclient.SkuClient
 	LoadBalancersClient loadbalancer.LoadBalancersAPI
+	SubnetsClient       launchtemplate.SubnetsAPI
+	// ProximityPlacementGroupsClient looks up the proximity placement groups VMs are placed in
+	ProximityPlacementGroupsClient launchtemplate.ProximityPlacementGroupsAPI
 }
 
 func NewAZClientFromAPI(
@@ -74,7 +81,10 @@ func NewAZClientFromAPI(
 	virtualMachinesExtensionClient VirtualMachineExtensionsAPI,
 	interfacesClient NetworkInterfacesAPI,
 	loadBalancersClient loadbalancer.LoadBalancersAPI,
+	subnetsClient launchtemplate.SubnetsAPI,
+	proximityPlacementGroupsClient launchtemplate.ProximityPlacementGroupsAPI,
 	imageVersionsClient imagefamily.CommunityGalleryImageVersionsAPI,
+	galleryImagesClient imagefamily.GalleryImagesAPI,
 	skuClient skuclient.SkuClient,
 ) *AZClient {
 	return &AZClient{
@@ -83,8 +93,11 @@ func NewAZClientFromAPI(
 		virtualMachinesExtensionClient: virtualMachinesExtensionClient,
 		networkInterfacesClient:        interfacesClient,
 		ImageVersionsClient:            imageVersionsClient,
+		GalleryImagesClient:            galleryImagesClient,
 		SKUClient:                      skuClient,
 		LoadBalancersClient:            loadBalancersClient,
+		SubnetsClient:                  subnetsClient,
+		ProximityPlacementGroupsClient: proximityPlacementGroupsClient,
 	}
 }
 
@@ -148,6 +161,18 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *azure.Environment)
 	}
 	klog.V(5).Infof("Created load balancers client %v, using a token credential", loadBalancersClient)
 
+	subnetsClient, err := armnetwork.NewSubnetsClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Created subnets client %v, using a token credential", subnetsClient)
+
+	proximityPlacementGroupsClient, err := armcompute.NewProximityPlacementGroupsClient(cfg.SubscriptionID, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("Created proximity placement groups client %v, using a token credential", proximityPlacementGroupsClient)
+
 	// TODO: this one is not enabled for rate limiting / throttling ...
 	// TODO Move this over to track 2 when skewer is migrated
 	skuClient := skuclient.NewSkuClient(ctx, cfg, env)
@@ -157,6 +182,28 @@ func NewAZClient(ctx context.Context, cfg *auth.Config, env *azure.Environment)
 		extensionsClient,
 		interfacesClient,
 		loadBalancersClient,
+		subnetsClient,
+		proximityPlacementGroupsClient,
 		imageVersionsClient,
+		&galleryImagesClient{cred: cred, opts: opts},
 		skuClient), nil
 }
+
+// galleryImagesClient gets gallery images from the subscription of each gallery,
+// which is not necessarily the subscription of the cluster
+type galleryImagesClient struct {
+	cred azcore.TokenCredential
+	opts *arm.ClientOptions
+}
+
+func (c *galleryImagesClient) Get(ctx context.Context, subscriptionID, resourceGroupName, galleryName, galleryImageName string) (armcomputev5.GalleryImage, error) {
+	client, err := armcomputev5.NewGalleryImagesClient(subscriptionID, c.cred, c.opts)
+	if err != nil {
+		return armcomputev5.GalleryImage{}, err
+	}
+	resp, err := client.Get(ctx, resourceGroupName, galleryName, galleryImageName, nil)
+	if err != nil {
+		return armcomputev5.GalleryImage{}, err
+	}
+	return resp.GalleryImage, nil
+}
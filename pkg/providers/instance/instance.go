@@ -23,7 +23,6 @@ import (
 	"fmt"
 	"math"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -35,11 +34,14 @@ import (
 
 	"github.com/Azure/azure-kusto-go/kusto/kql"
 	"github.com/Azure/karpenter-provider-azure/pkg/cache"
+	cloudproviderevents "github.com/Azure/karpenter-provider-azure/pkg/cloudprovider/events"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/instancetype"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/loadbalancer"
 
 	corecloudprovider "sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
@@ -72,6 +74,9 @@ var (
 	ZonalAllocationFailureReason   = "ZonalAllocationFailure"
 	SKUNotAvailableReason          = "SKUNotAvailable"
 
+	// SubnetIsFullErrorCode is the error code of creating a network interface in a subnet without IPs left
+	SubnetIsFullErrorCode = "SubnetIsFull"
+
 	SubscriptionQuotaReachedTTL = 1 * time.Hour
 	SKUNotAvailableSpotTTL      = 1 * time.Hour
 	SKUNotAvailableOnDemandTTL  = 23 * time.Hour
@@ -89,6 +94,7 @@ type Provider struct {
 	subnetID               string
 	subscriptionID         string
 	unavailableOfferings   *cache.UnavailableOfferings
+	recorder               events.Recorder
 }
 
 func NewProvider(
@@ -97,6 +103,7 @@ func NewProvider(
 	launchTemplateProvider *launchtemplate.Provider,
 	loadBalancerProvider *loadbalancer.Provider,
 	offeringsCache *cache.UnavailableOfferings,
+	recorder events.Recorder,
 	location string,
 	resourceGroup string,
 	subnetID string,
@@ -113,6 +120,7 @@ func NewProvider(
 		subnetID:               subnetID,
 		subscriptionID:         subscriptionID,
 		unavailableOfferings:   offeringsCache,
+		recorder:               recorder,
 	}
 }
 
@@ -196,7 +204,7 @@ func (p *Provider) createAKSIdentifyingExtension(ctx context.Context, vmName str
 	return nil
 }
 
-func (p *Provider) newNetworkInterfaceForVM(vmName string, backendPools *loadbalancer.BackendAddressPools, instanceType *corecloudprovider.InstanceType) armnetwork.Interface {
+func (p *Provider) newNetworkInterfaceForVM(vmName string, subnetID string, backendPools *loadbalancer.BackendAddressPools, enableAcceleratedNetworking bool) armnetwork.Interface {
 	var ipv4BackendPools []*armnetwork.BackendAddressPool
 	for _, poolID := range backendPools.IPv4PoolIDs {
 		poolID := poolID
@@ -205,13 +213,6 @@ func (p *Provider) newNetworkInterfaceForVM(vmName string, backendPools *loadbal
 		})
 	}
 
-	skuAcceleratedNetworkingRequirements := scheduling.NewRequirements(scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpIn, "true"))
-
-	enableAcceleratedNetworking := false
-	if err := instanceType.Requirements.Compatible(skuAcceleratedNetworkingRequirements); err == nil {
-		enableAcceleratedNetworking = true
-	}
-
 	return armnetwork.Interface{
 		Location: to.Ptr(p.location),
 		Properties: &armnetwork.InterfacePropertiesFormat{
@@ -222,7 +223,7 @@ func (p *Provider) newNetworkInterfaceForVM(vmName string, backendPools *loadbal
 						Primary:                   to.Ptr(true),
 						PrivateIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodDynamic),
 						Subnet: &armnetwork.Subnet{
-							ID: &p.subnetID,
+							ID: &subnetID,
 						},
 						LoadBalancerBackendAddressPools: ipv4BackendPools,
 					},
@@ -238,13 +239,13 @@ func GenerateResourceName(nodeClaimName string) string {
 	return fmt.Sprintf("aks-%s", nodeClaimName)
 }
 
-func (p *Provider) createNetworkInterface(ctx context.Context, nicName string, launchTemplateConfig *launchtemplate.Template, instanceType *corecloudprovider.InstanceType) (string, error) {
+func (p *Provider) createNetworkInterface(ctx context.Context, nicName string, launchTemplateConfig *launchtemplate.Template) (string, error) {
 	backendPools, err := p.loadBalancerProvider.LoadBalancerBackendPools(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	nic := p.newNetworkInterfaceForVM(nicName, backendPools, instanceType)
+	nic := p.newNetworkInterfaceForVM(nicName, launchTemplateConfig.SubnetID, backendPools, launchTemplateConfig.AcceleratedNetworking)
 	p.applyTemplateToNic(&nic, launchTemplateConfig)
 	logging.FromContext(ctx).Debugf("Creating network interface %s", nicName)
 	res, err := createNic(ctx, p.azClient.networkInterfacesClient, p.resourceGroup, nicName, nic)
@@ -264,7 +265,6 @@ func newVMObject(
 	capacityType string,
 	location string,
 	sshPublicKey string,
-	nodeIdentities []string,
 	nodeClass *v1alpha2.AKSNodeClass,
 	launchTemplate *launchtemplate.Template,
 	instanceType *corecloudprovider.InstanceType) armcompute.VirtualMachine {
@@ -272,9 +272,14 @@ func newVMObject(
 	imageReference := armcompute.ImageReference{
 		CommunityGalleryImageID: &launchTemplate.ImageID,
 	}
+	if !imagefamily.IsCommunityImageID(launchTemplate.ImageID) {
+		imageReference = armcompute.ImageReference{
+			ID: &launchTemplate.ImageID,
+		}
+	}
 	vm := armcompute.VirtualMachine{
 		Location: to.Ptr(location),
-		Identity: ConvertToVirtualMachineIdentity(nodeIdentities),
+		Identity: ConvertToVirtualMachineIdentity(launchTemplate.NodeIdentities, launchTemplate.SystemAssignedIdentity),
 		Properties: &armcompute.VirtualMachineProperties{
 			HardwareProfile: &armcompute.HardwareProfile{
 				VMSize: to.Ptr(armcompute.VirtualMachineSizeTypes(instanceType.Name)),
@@ -325,22 +330,80 @@ func newVMObject(
 		Zones: lo.Ternary(len(zone) > 0, []*string{&zone}, []*string{}),
 		Tags:  launchTemplate.Tags,
 	}
-	setVMPropertiesStorageProfile(vm.Properties, instanceType, nodeClass)
+	setVMPropertiesStorageProfile(vm.Properties, launchTemplate)
+	setVMPropertiesSecurityProfile(vm.Properties, launchTemplate)
+	setVMPropertiesDiagnosticsProfile(vm.Properties, launchTemplate)
+	setVMPropertiesProximityPlacementGroup(vm.Properties, launchTemplate)
 	setVMPropertiesBillingProfile(vm.Properties, capacityType)
 
 	return vm
 }
 
-// setVMPropertiesStorageProfile enables ephemeral os disk for instance types that support it
-func setVMPropertiesStorageProfile(vmProperties *armcompute.VirtualMachineProperties, instanceType *corecloudprovider.InstanceType, nodeClass *v1alpha2.AKSNodeClass) {
-	// use ephemeral disk if it is large enough
-	if *nodeClass.Spec.OSDiskSizeGB <= getEphemeralMaxSizeGB(instanceType) {
+// setVMPropertiesStorageProfile enables ephemeral os disk for instance types that support it, and encrypts the VM guest state
+// of confidential VMs on their OS disk
+func setVMPropertiesStorageProfile(vmProperties *armcompute.VirtualMachineProperties, launchTemplate *launchtemplate.Template) {
+	if launchTemplate.EphemeralOSDisk {
 		vmProperties.StorageProfile.OSDisk.DiffDiskSettings = &armcompute.DiffDiskSettings{
 			Option: to.Ptr(armcompute.DiffDiskOptionsLocal),
-			// placement (cache/resource) is left to CRP
+		}
+		// without a placement requested, it is left to CRP
+		if launchTemplate.EphemeralOSDiskPlacement != "" {
+			vmProperties.StorageProfile.OSDisk.DiffDiskSettings.Placement = to.Ptr(armcompute.DiffDiskPlacement(launchTemplate.EphemeralOSDiskPlacement))
 		}
 		vmProperties.StorageProfile.OSDisk.Caching = to.Ptr(armcompute.CachingTypesReadOnly)
 	}
+	if launchTemplate.SecurityProfile != nil && launchTemplate.SecurityProfile.ConfidentialVM {
+		vmProperties.StorageProfile.OSDisk.ManagedDisk = &armcompute.ManagedDiskParameters{
+			SecurityProfile: &armcompute.VMDiskSecurityProfile{
+				SecurityEncryptionType: to.Ptr(armcompute.SecurityEncryptionTypesVMGuestStateOnly),
+			},
+		}
+	}
+}
+
+// setVMPropertiesSecurityProfile enables Trusted Launch or confidential VMs, and encryption at host, as the launch template requests
+func setVMPropertiesSecurityProfile(vmProperties *armcompute.VirtualMachineProperties, launchTemplate *launchtemplate.Template) {
+	if launchTemplate.SecurityProfile == nil {
+		return
+	}
+	vmProperties.SecurityProfile = &armcompute.SecurityProfile{}
+	if launchTemplate.SecurityProfile.TrustedLaunch || launchTemplate.SecurityProfile.ConfidentialVM {
+		securityType := armcompute.SecurityTypesTrustedLaunch
+		if launchTemplate.SecurityProfile.ConfidentialVM {
+			securityType = armcompute.SecurityTypesConfidentialVM
+		}
+		vmProperties.SecurityProfile.SecurityType = to.Ptr(securityType)
+		vmProperties.SecurityProfile.UefiSettings = &armcompute.UefiSettings{
+			SecureBootEnabled: to.Ptr(launchTemplate.SecurityProfile.SecureBoot),
+			VTpmEnabled:       to.Ptr(launchTemplate.SecurityProfile.VTPM),
+		}
+	}
+	if launchTemplate.SecurityProfile.EncryptionAtHost {
+		vmProperties.SecurityProfile.EncryptionAtHost = to.Ptr(true)
+	}
+}
+
+// setVMPropertiesDiagnosticsProfile enables boot diagnostics as the launch template requests, in managed storage unless it has a storage URI
+func setVMPropertiesDiagnosticsProfile(vmProperties *armcompute.VirtualMachineProperties, launchTemplate *launchtemplate.Template) {
+	if !launchTemplate.BootDiagnostics {
+		return
+	}
+	vmProperties.DiagnosticsProfile = &armcompute.DiagnosticsProfile{
+		BootDiagnostics: &armcompute.BootDiagnostics{
+			Enabled: to.Ptr(true),
+		},
+	}
+	if launchTemplate.BootDiagnosticsStorageURI != "" {
+		vmProperties.DiagnosticsProfile.BootDiagnostics.StorageURI = to.Ptr(launchTemplate.BootDiagnosticsStorageURI)
+	}
+}
+
+// setVMPropertiesProximityPlacementGroup places the VM in the proximity placement group of the launch template, if any
+func setVMPropertiesProximityPlacementGroup(vmProperties *armcompute.VirtualMachineProperties, launchTemplate *launchtemplate.Template) {
+	if launchTemplate.ProximityPlacementGroupID == "" {
+		return
+	}
+	vmProperties.ProximityPlacementGroup = &armcompute.SubResource{ID: to.Ptr(launchTemplate.ProximityPlacementGroupID)}
 }
 
 // setVMPropertiesBillingProfile sets a default MaxPrice of -1 for Spot
@@ -376,26 +439,29 @@ func (p *Provider) launchInstance(
 	if instanceType == nil {
 		return nil, nil, corecloudprovider.NewInsufficientCapacityError(fmt.Errorf("no instance types available"))
 	}
-	launchTemplate, err := p.getLaunchTemplate(ctx, nodeClass, nodeClaim, instanceType, capacityType)
-	if err != nil {
-		return nil, nil, fmt.Errorf("getting launch template: %w", err)
-	}
-
-	// set provisioner tag for NIC, VM, and Disk
-	setNodePoolNameTag(launchTemplate.Tags, nodeClaim)
-
 	// resourceName for the NIC, VM, and Disk
 	resourceName := GenerateResourceName(nodeClaim.Name)
 
-	// create network interface
-	nicReference, err := p.createNetworkInterface(ctx, resourceName, launchTemplate, instanceType)
+	// create network interface, in the first subnet with IPs left
+	var launchTemplate *launchtemplate.Template
+	var nicReference string
+	err := launchInSubnets(ctx, append([]string{p.subnetID}, nodeClass.Spec.FallbackSubnetIDs...), func(subnetID string) error {
+		var err error
+		launchTemplate, err = p.getLaunchTemplate(ctx, nodeClass, nodeClaim, instanceType, capacityType, subnetID)
+		if err != nil {
+			return fmt.Errorf("getting launch template: %w", err)
+		}
+		// set provisioner tag for NIC, VM, and Disk
+		setNodePoolNameTag(launchTemplate.Tags, nodeClaim)
+		nicReference, err = p.createNetworkInterface(ctx, resourceName, launchTemplate)
+		return err
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
 	sshPublicKey := options.FromContext(ctx).SSHPublicKey
-	nodeIdentityIDs := options.FromContext(ctx).NodeIdentities
-	vm := newVMObject(resourceName, nicReference, zone, capacityType, p.location, sshPublicKey, nodeIdentityIDs, nodeClass, launchTemplate, instanceType)
+	vm := newVMObject(resourceName, nicReference, zone, capacityType, p.location, sshPublicKey, nodeClass, launchTemplate, instanceType)
 
 	logging.FromContext(ctx).Debugf("Creating virtual machine %s (%s)", resourceName, instanceType.Name)
 	// Uses AZ Client to create a new virtual machine using the vm object we prepared earlier
@@ -477,17 +543,25 @@ func (p *Provider) handleResponseErrors(ctx context.Context, instanceType *corec
 	return err
 }
 
-func getEphemeralMaxSizeGB(instanceType *corecloudprovider.InstanceType) int32 {
-	reqs := instanceType.Requirements.Get(v1alpha2.LabelSKUStorageEphemeralOSMaxSize).Values()
-	if len(reqs) == 0 || len(reqs) > 1 {
-		return 0
+// launchInSubnets launches into the subnets in order, failing over to the next subnet while subnets have no IPs left
+func launchInSubnets(ctx context.Context, subnetIDs []string, launch func(subnetID string) error) error {
+	var err error
+	for i, subnetID := range subnetIDs {
+		if err = launch(subnetID); err == nil || !isSubnetExhausted(err) || i == len(subnetIDs)-1 {
+			return err
+		}
+		logging.FromContext(ctx).With("subnet", subnetID).Warnf("subnet has no IPs left, failing over to subnet %s, %s", subnetIDs[i+1], err)
 	}
-	maxSize, err := strconv.ParseFloat(reqs[0], 32)
-	if err != nil {
-		return 0
+	return err
+}
+
+// isSubnetExhausted returns whether the launch failed because the subnet has no IPs left for the VM or its pods
+func isSubnetExhausted(err error) bool {
+	if launchtemplate.IsSubnetExhaustedError(err) {
+		return true
 	}
-	// decimal places are truncated, so we round down
-	return int32(maxSize)
+	azErr := sdkerrors.IsResponseError(err)
+	return azErr != nil && azErr.ErrorCode == SubnetIsFullErrorCode
 }
 
 func cpuLimitIsZero(err error) bool {
@@ -500,13 +574,17 @@ func (p *Provider) applyTemplateToNic(nic *armnetwork.Interface, template *launc
 }
 
 func (p *Provider) getLaunchTemplate(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
-	instanceType *corecloudprovider.InstanceType, capacityType string) (*launchtemplate.Template, error) {
+	instanceType *corecloudprovider.InstanceType, capacityType string, subnetID string) (*launchtemplate.Template, error) {
 	additionalLabels := lo.Assign(GetAllSingleValuedRequirementLabels(instanceType), map[string]string{corev1beta1.CapacityTypeLabelKey: capacityType})
 
-	launchTemplate, err := p.launchTemplateProvider.GetTemplate(ctx, nodeClass, nodeClaim, instanceType, additionalLabels)
+	launchTemplate, err := p.launchTemplateProvider.GetTemplateForSubnet(ctx, nodeClass, nodeClaim, instanceType, additionalLabels, subnetID)
 	if err != nil {
 		return nil, fmt.Errorf("getting launch templates, %w", err)
 	}
+	if options.FromContext(ctx).LaunchTemplateEvents {
+		p.recorder.Publish(cloudproviderevents.NodeClaimLaunchTemplateResolved(nodeClaim, launchTemplate.ImageID,
+			instanceType.Requirements.Get(v1.LabelArchStable).Any(), launchTemplate.Hash()))
+	}
 
 	return launchTemplate, nil
 }
@@ -692,7 +770,7 @@ func createVMFromQueryResponseData(data map[string]interface{}) (*armcompute.Vir
 	return &vm, nil
 }
 
-func ConvertToVirtualMachineIdentity(nodeIdentities []string) *armcompute.VirtualMachineIdentity {
+func ConvertToVirtualMachineIdentity(nodeIdentities []string, systemAssigned bool) *armcompute.VirtualMachineIdentity {
 	var identity *armcompute.VirtualMachineIdentity
 	if len(nodeIdentities) > 0 {
 		identityMap := make(map[string]*armcompute.UserAssignedIdentitiesValue)
@@ -702,11 +780,16 @@ func ConvertToVirtualMachineIdentity(nodeIdentities []string) *armcompute.Virtua
 
 		if len(identityMap) > 0 {
 			identity = &armcompute.VirtualMachineIdentity{
-				Type:                   lo.ToPtr(armcompute.ResourceIdentityTypeUserAssigned),
+				Type:                   lo.ToPtr(lo.Ternary(systemAssigned, armcompute.ResourceIdentityTypeSystemAssignedUserAssigned, armcompute.ResourceIdentityTypeUserAssigned)),
 				UserAssignedIdentities: identityMap,
 			}
 		}
 	}
+	if identity == nil && systemAssigned {
+		identity = &armcompute.VirtualMachineIdentity{
+			Type: lo.ToPtr(armcompute.ResourceIdentityTypeSystemAssigned),
+		}
+	}
 
 	return identity
 }
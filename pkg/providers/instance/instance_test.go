@@ -18,11 +18,14 @@ package instance
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate"
 	"github.com/stretchr/testify/assert"
 	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
@@ -77,7 +80,7 @@ func TestGetPriorityCapacityAndInstanceType(t *testing.T) {
 			expectedPriority:     corev1beta1.CapacityTypeOnDemand,
 		},
 	}
-	provider := NewProvider(nil, nil, nil, nil, cache.NewUnavailableOfferings(),
+	provider := NewProvider(nil, nil, nil, nil, cache.NewUnavailableOfferings(), nil,
 		"westus-2",
 		"MC_xxxxx_yyyy-region",
 		"/subscriptions/0000000-0000-0000-0000-0000000000/resourceGroups/fake-resource-group-name/providers/Microsoft.Network/virtualNetworks/karpenter/subnets/nodesubnet",
@@ -219,3 +222,158 @@ func TestCreateVMFromQueryResponseData(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertToVirtualMachineIdentity(t *testing.T) {
+	const (
+		identity1 = "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid1"
+		identity2 = "/subscriptions/1234/resourceGroups/mcrg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myid2"
+	)
+	tc := []struct {
+		testName               string
+		nodeIdentities         []string
+		systemAssigned         bool
+		expectedType           *armcompute.ResourceIdentityType
+		expectedUserIdentities []string
+	}{
+		{testName: "no identities", expectedType: nil},
+		{testName: "user-assigned identities", nodeIdentities: []string{identity1, identity2},
+			expectedType: to.Ptr(armcompute.ResourceIdentityTypeUserAssigned), expectedUserIdentities: []string{identity1, identity2}},
+		{testName: "system-assigned identity", systemAssigned: true,
+			expectedType: to.Ptr(armcompute.ResourceIdentityTypeSystemAssigned)},
+		{testName: "system-assigned and user-assigned identities", nodeIdentities: []string{identity1, identity2}, systemAssigned: true,
+			expectedType: to.Ptr(armcompute.ResourceIdentityTypeSystemAssignedUserAssigned), expectedUserIdentities: []string{identity1, identity2}},
+	}
+
+	for _, c := range tc {
+		identity := ConvertToVirtualMachineIdentity(c.nodeIdentities, c.systemAssigned)
+		if c.expectedType == nil {
+			assert.Nil(t, identity, c.testName)
+			continue
+		}
+		assert.Equal(t, *c.expectedType, *identity.Type, c.testName)
+		assert.Len(t, identity.UserAssignedIdentities, len(c.expectedUserIdentities), c.testName)
+		for _, id := range c.expectedUserIdentities {
+			assert.Contains(t, identity.UserAssignedIdentities, id, c.testName)
+		}
+	}
+}
+
+func TestSetVMPropertiesSecurityProfile(t *testing.T) {
+	vmProperties := &armcompute.VirtualMachineProperties{}
+	setVMPropertiesSecurityProfile(vmProperties, &launchtemplate.Template{})
+	assert.Nil(t, vmProperties.SecurityProfile)
+
+	setVMPropertiesSecurityProfile(vmProperties, &launchtemplate.Template{SecurityProfile: &launchtemplate.SecurityProfile{TrustedLaunch: true, SecureBoot: true}})
+	assert.Equal(t, armcompute.SecurityTypesTrustedLaunch, *vmProperties.SecurityProfile.SecurityType)
+	assert.True(t, *vmProperties.SecurityProfile.UefiSettings.SecureBootEnabled)
+	assert.False(t, *vmProperties.SecurityProfile.UefiSettings.VTpmEnabled)
+	assert.Nil(t, vmProperties.SecurityProfile.EncryptionAtHost)
+
+	vmProperties = &armcompute.VirtualMachineProperties{}
+	setVMPropertiesSecurityProfile(vmProperties, &launchtemplate.Template{SecurityProfile: &launchtemplate.SecurityProfile{EncryptionAtHost: true}})
+	assert.Nil(t, vmProperties.SecurityProfile.SecurityType)
+	assert.Nil(t, vmProperties.SecurityProfile.UefiSettings)
+	assert.True(t, *vmProperties.SecurityProfile.EncryptionAtHost)
+
+	vmProperties = &armcompute.VirtualMachineProperties{}
+	setVMPropertiesSecurityProfile(vmProperties, &launchtemplate.Template{SecurityProfile: &launchtemplate.SecurityProfile{ConfidentialVM: true, VTPM: true}})
+	assert.Equal(t, armcompute.SecurityTypesConfidentialVM, *vmProperties.SecurityProfile.SecurityType)
+	assert.False(t, *vmProperties.SecurityProfile.UefiSettings.SecureBootEnabled)
+	assert.True(t, *vmProperties.SecurityProfile.UefiSettings.VTpmEnabled)
+}
+
+func TestSetVMPropertiesStorageProfile(t *testing.T) {
+	newVMProperties := func() *armcompute.VirtualMachineProperties {
+		return &armcompute.VirtualMachineProperties{StorageProfile: &armcompute.StorageProfile{OSDisk: &armcompute.OSDisk{}}}
+	}
+	vmProperties := newVMProperties()
+	setVMPropertiesStorageProfile(vmProperties, &launchtemplate.Template{})
+	assert.Nil(t, vmProperties.StorageProfile.OSDisk.DiffDiskSettings)
+
+	vmProperties = newVMProperties()
+	setVMPropertiesStorageProfile(vmProperties, &launchtemplate.Template{EphemeralOSDisk: true})
+	assert.Equal(t, armcompute.DiffDiskOptionsLocal, *vmProperties.StorageProfile.OSDisk.DiffDiskSettings.Option)
+	assert.Nil(t, vmProperties.StorageProfile.OSDisk.DiffDiskSettings.Placement)
+
+	vmProperties = newVMProperties()
+	setVMPropertiesStorageProfile(vmProperties, &launchtemplate.Template{EphemeralOSDisk: true, EphemeralOSDiskPlacement: "NvmeDisk"})
+	assert.Equal(t, armcompute.DiffDiskPlacement("NvmeDisk"), *vmProperties.StorageProfile.OSDisk.DiffDiskSettings.Placement)
+	assert.Nil(t, vmProperties.StorageProfile.OSDisk.ManagedDisk)
+
+	vmProperties = newVMProperties()
+	setVMPropertiesStorageProfile(vmProperties, &launchtemplate.Template{SecurityProfile: &launchtemplate.SecurityProfile{ConfidentialVM: true}})
+	assert.Equal(t, armcompute.SecurityEncryptionTypesVMGuestStateOnly, *vmProperties.StorageProfile.OSDisk.ManagedDisk.SecurityProfile.SecurityEncryptionType)
+}
+
+func TestSetVMPropertiesDiagnosticsProfile(t *testing.T) {
+	vmProperties := &armcompute.VirtualMachineProperties{}
+	setVMPropertiesDiagnosticsProfile(vmProperties, &launchtemplate.Template{})
+	assert.Nil(t, vmProperties.DiagnosticsProfile)
+
+	setVMPropertiesDiagnosticsProfile(vmProperties, &launchtemplate.Template{BootDiagnostics: true})
+	assert.True(t, *vmProperties.DiagnosticsProfile.BootDiagnostics.Enabled)
+	assert.Nil(t, vmProperties.DiagnosticsProfile.BootDiagnostics.StorageURI)
+
+	vmProperties = &armcompute.VirtualMachineProperties{}
+	setVMPropertiesDiagnosticsProfile(vmProperties, &launchtemplate.Template{BootDiagnostics: true, BootDiagnosticsStorageURI: "https://diagnostics.blob.core.windows.net/"})
+	assert.True(t, *vmProperties.DiagnosticsProfile.BootDiagnostics.Enabled)
+	assert.Equal(t, "https://diagnostics.blob.core.windows.net/", *vmProperties.DiagnosticsProfile.BootDiagnostics.StorageURI)
+}
+
+func TestSetVMPropertiesProximityPlacementGroup(t *testing.T) {
+	vmProperties := &armcompute.VirtualMachineProperties{}
+	setVMPropertiesProximityPlacementGroup(vmProperties, &launchtemplate.Template{})
+	assert.Nil(t, vmProperties.ProximityPlacementGroup)
+
+	id := "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/proximityPlacementGroups/test-ppg"
+	setVMPropertiesProximityPlacementGroup(vmProperties, &launchtemplate.Template{ProximityPlacementGroupID: id})
+	assert.Equal(t, id, *vmProperties.ProximityPlacementGroup.ID)
+}
+
+func TestLaunchInSubnets(t *testing.T) {
+	subnetIsFull := &azcore.ResponseError{ErrorCode: SubnetIsFullErrorCode}
+	cases := []struct {
+		name            string
+		errors          map[string]error
+		expectedSubnets []string
+		expectedErr     error
+	}{
+		{
+			name:            "primary subnet with IPs left",
+			expectedSubnets: []string{"primary"},
+		},
+		{
+			name:            "primary subnet exhausted",
+			errors:          map[string]error{"primary": subnetIsFull},
+			expectedSubnets: []string{"primary", "fallback-1"},
+		},
+		{
+			name:            "primary and first fallback subnets exhausted",
+			errors:          map[string]error{"primary": subnetIsFull, "fallback-1": fmt.Errorf("creating network interface, %w", subnetIsFull)},
+			expectedSubnets: []string{"primary", "fallback-1", "fallback-2"},
+		},
+		{
+			name:            "all subnets exhausted",
+			errors:          map[string]error{"primary": subnetIsFull, "fallback-1": subnetIsFull, "fallback-2": subnetIsFull},
+			expectedSubnets: []string{"primary", "fallback-1", "fallback-2"},
+			expectedErr:     subnetIsFull,
+		},
+		{
+			name:            "other errors do not fail over",
+			errors:          map[string]error{"primary": &azcore.ResponseError{ErrorCode: "InvalidParameter"}},
+			expectedSubnets: []string{"primary"},
+			expectedErr:     &azcore.ResponseError{ErrorCode: "InvalidParameter"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var subnets []string
+			err := launchInSubnets(context.Background(), []string{"primary", "fallback-1", "fallback-2"}, func(subnetID string) error {
+				subnets = append(subnets, subnetID)
+				return c.errors[subnetID]
+			})
+			assert.Equal(t, c.expectedSubnets, subnets)
+			assert.Equal(t, c.expectedErr, err)
+		})
+	}
+}
@@ -150,6 +150,28 @@ var _ = Describe("InstanceProvider", func() {
 		ZonalAndNonZonalRegions,
 	)
 
+	It("should record an event with the resolved launch template when enabled", func() {
+		ExpectApplied(ctx, env.Client, nodeClaim, nodePool, nodeClass)
+		instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, nodePool)
+		Expect(err).ToNot(HaveOccurred())
+		instanceTypes = lo.Filter(instanceTypes, func(i *corecloudprovider.InstanceType, _ int) bool { return i.Name == "Standard_D2_v2" })
+
+		// no events by default
+		_, err = azureEnv.InstanceProvider.Create(ctx, nodeClass, nodeClaim, instanceTypes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(azureEnv.EventRecorder.Calls("LaunchTemplateResolved")).To(Equal(0))
+
+		eventsCtx := options.ToContext(ctx, test.Options(test.OptionsFields{LaunchTemplateEvents: lo.ToPtr(true)}))
+		_, err = azureEnv.InstanceProvider.Create(eventsCtx, nodeClass, nodeClaim, instanceTypes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(azureEnv.EventRecorder.Calls("LaunchTemplateResolved")).To(Equal(1))
+		event := azureEnv.EventRecorder.Events()[0]
+		Expect(event.InvolvedObject).To(Equal(nodeClaim))
+		Expect(event.Type).To(Equal("Normal"))
+		Expect(event.Message).To(MatchRegexp(`^Resolved launch template, image \S+, architecture amd64, template hash [0-9]+$`))
+		Expect(event.RateLimiter).ToNot(BeNil())
+	})
+
 	It("should create VM and NIC with valid ARM tags", func() {
 		ExpectApplied(ctx, env.Client, nodePool, nodeClass)
 
@@ -172,8 +172,12 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 		scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUStoragePremiumCapable, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUEncryptionAtHostSupported, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUTrustedLaunchSupported, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageCacheDiskMaxSize, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageResourceDiskMaxSize, v1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageNVMeDiskMaxSize, v1.NodeSelectorOpDoesNotExist),
 		// all additive feature initialized elsewhere
 	)
 
@@ -185,6 +189,7 @@ func computeRequirements(sku *skewer.SKU, vmsize *skewer.VMSizeType, architectur
 
 	setRequirementsStoragePremiumCapable(requirements, sku)
 	setRequirementsEncryptionAtHostSupported(requirements, sku)
+	setRequirementsTrustedLaunchSupported(requirements, sku)
 	setRequirementsEphemeralOSDiskSupported(requirements, sku, vmsize)
 	setRequirementsAcceleratedNetworking(requirements, sku)
 	setRequirementsHyperVGeneration(requirements, sku)
@@ -207,9 +212,30 @@ func setRequirementsEncryptionAtHostSupported(requirements scheduling.Requiremen
 	}
 }
 
+func setRequirementsTrustedLaunchSupported(requirements scheduling.Requirements, sku *skewer.SKU) {
+	if trustedLaunch, _ := sku.IsTrustedLaunchEnabled(); trustedLaunch {
+		requirements[v1alpha2.LabelSKUTrustedLaunchSupported].Insert("true")
+	}
+}
+
 func setRequirementsEphemeralOSDiskSupported(requirements scheduling.Requirements, sku *skewer.SKU, vmsize *skewer.VMSizeType) {
 	if sku.IsEphemeralOSDiskSupported() && vmsize.Series != "Dlds_v5" { // Dlds_v5 does not support ephemeral OS disk, contrary to what it claims
 		requirements[v1alpha2.LabelSKUStorageEphemeralOSMaxSize].Insert(fmt.Sprint(MaxEphemeralOSDiskSizeGB(sku)))
+		setRequirementsEphemeralOSDiskPlacements(requirements, sku)
+	}
+}
+
+// setRequirementsEphemeralOSDiskPlacements records the capacity of each location ephemeral OS disks can be placed on,
+// for the OS disk size to be checked against the placement requested by the AKSNodeClass
+func setRequirementsEphemeralOSDiskPlacements(requirements scheduling.Requirements, sku *skewer.SKU) {
+	for label, sizeGB := range map[string]float64{
+		v1alpha2.LabelSKUStorageCacheDiskMaxSize:    CacheDiskSizeGB(sku),
+		v1alpha2.LabelSKUStorageResourceDiskMaxSize: ResourceDiskSizeGB(sku),
+		v1alpha2.LabelSKUStorageNVMeDiskMaxSize:     NVMeDiskSizeGB(sku),
+	} {
+		if sizeGB > 0 {
+			requirements[label].Insert(fmt.Sprint(sizeGB))
+		}
 	}
 }
 
@@ -268,7 +294,7 @@ func computeCapacity(ctx context.Context, sku *skewer.SKU, kc *corev1beta1.Kubel
 		v1.ResourceCPU:                    *cpu(sku),
 		v1.ResourceMemory:                 *memory(ctx, sku),
 		v1.ResourceEphemeralStorage:       *ephemeralStorage(nodeClass),
-		v1.ResourcePods:                   *pods(sku, kc),
+		v1.ResourcePods:                   *pods(sku, kc, nodeClass),
 		v1.ResourceName("nvidia.com/gpu"): *gpuNvidiaCount(sku),
 	}
 }
@@ -310,10 +336,12 @@ func ephemeralStorage(nodeClass *v1alpha2.AKSNodeClass) *resource.Quantity {
 	return resource.NewScaledQuantity(int64(lo.FromPtr(nodeClass.Spec.OSDiskSizeGB)), resource.Giga)
 }
 
-func pods(sku *skewer.SKU, kc *corev1beta1.KubeletConfiguration) *resource.Quantity {
+func pods(sku *skewer.SKU, kc *corev1beta1.KubeletConfiguration, nodeClass *v1alpha2.AKSNodeClass) *resource.Quantity {
 	// TODO: fine-tune pods calc
 	var count int64
 	switch {
+	case nodeClass.Spec.MaxPods != nil:
+		count = int64(*nodeClass.Spec.MaxPods)
 	case kc != nil && kc.MaxPods != nil:
 		count = int64(ptr.Int32Value(kc.MaxPods))
 	default:
@@ -32,6 +32,7 @@ import (
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	kcache "github.com/Azure/karpenter-provider-azure/pkg/cache"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
 	"github.com/patrickmn/go-cache"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -92,13 +93,14 @@ func (p *Provider) List(
 		return nil, err
 	}
 
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, options.FromContext(ctx).DefaultImageFamily)
 	// Compute fully initialized instance types hash key
 	kcHash, _ := hashstructure.Hash(kc, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	key := fmt.Sprintf("%d-%d-%016x-%s-%d",
 		p.instanceTypesSeqNum,
 		p.unavailableOfferings.SeqNum,
 		kcHash,
-		to.String(nodeClass.Spec.ImageFamily),
+		imageFamily,
 		to.Int32(nodeClass.Spec.OSDiskSizeGB),
 	)
 	if item, ok := p.cache.Get(key); ok {
@@ -125,7 +127,7 @@ func (p *Provider) List(
 			continue
 		}
 
-		if !p.isInstanceTypeSupportedByImageFamily(sku.GetName(), lo.FromPtr(nodeClass.Spec.ImageFamily)) {
+		if !p.isInstanceTypeSupportedByImageFamily(sku.GetName(), imageFamily) {
 			continue
 		}
 		result = append(result, instanceType)
@@ -299,6 +301,27 @@ func MaxEphemeralOSDiskSizeGB(sku *skewer.SKU) float64 {
 	return maxDiskBytes / float64(units.Gigabyte)
 }
 
+// nvmeDiskSizeInMiB is the capability of the size of the local NVMe disks of a SKU
+const nvmeDiskSizeInMiB = "NvmeDiskSizeInMiB"
+
+// CacheDiskSizeGB returns the size of the cache disk of a SKU, which ephemeral OS disks can be placed on
+func CacheDiskSizeGB(sku *skewer.SKU) float64 {
+	maxCachedDiskBytes, _ := sku.MaxCachedDiskBytes()
+	return math.Max(0, float64(maxCachedDiskBytes)) / float64(units.Gigabyte)
+}
+
+// ResourceDiskSizeGB returns the size of the resource (temp) disk of a SKU, which ephemeral OS disks can be placed on
+func ResourceDiskSizeGB(sku *skewer.SKU) float64 {
+	maxResourceVolumeMB, _ := sku.MaxResourceVolumeMB() // MiB, see MaxEphemeralOSDiskSizeGB
+	return math.Max(0, float64(maxResourceVolumeMB*int64(units.Mebibyte))) / float64(units.Gigabyte)
+}
+
+// NVMeDiskSizeGB returns the size of the local NVMe disks of a SKU, which ephemeral OS disks can be placed on
+func NVMeDiskSizeGB(sku *skewer.SKU) float64 {
+	nvmeDiskMiB, _ := sku.GetCapabilityIntegerQuantity(nvmeDiskSizeInMiB)
+	return math.Max(0, float64(nvmeDiskMiB*int64(units.Mebibyte))) / float64(units.Gigabyte)
+}
+
 var (
 	// https://learn.microsoft.com/en-us/azure/reliability/availability-zones-service-support#azure-regions-with-availability-zone-support
 	// (could also be obtained programmatically)
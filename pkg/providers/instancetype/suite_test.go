@@ -805,9 +805,13 @@ var _ = Describe("InstanceType Provider", func() {
 
 				Expect(reqs.Has(v1alpha2.LabelSKUStoragePremiumCapable)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUEncryptionAtHostSupported)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUTrustedLaunchSupported)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUAcceleratedNetworking)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUHyperVGeneration)).To(BeTrue())
 				Expect(reqs.Has(v1alpha2.LabelSKUStorageEphemeralOSMaxSize)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUStorageCacheDiskMaxSize)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUStorageResourceDiskMaxSize)).To(BeTrue())
+				Expect(reqs.Has(v1alpha2.LabelSKUStorageNVMeDiskMaxSize)).To(BeTrue())
 			}
 		})
 
@@ -840,6 +844,7 @@ var _ = Describe("InstanceType Provider", func() {
 				v1alpha2.LabelSKUStorageEphemeralOSMaxSize: "53.6870912",
 				v1alpha2.LabelSKUAcceleratedNetworking:     "true",
 				v1alpha2.LabelSKUEncryptionAtHostSupported: "true",
+				v1alpha2.LabelSKUTrustedLaunchSupported:    "true",
 				v1alpha2.LabelSKUStoragePremiumCapable:     "true",
 				v1alpha2.LabelSKUGPUName:                   "A100",
 				v1alpha2.LabelSKUGPUManufacturer:           "nvidia",
@@ -0,0 +1,47 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors of generating a launch template wrap one of these by the stage that failed, for callers to tell configuration
+// which nodes cannot be launched with, and which retrying does not fix, from failures of the Azure and Kubernetes APIs,
+// which may be transient. The underlying errors, such as those of ARM, are wrapped as well, for errors.As.
+var (
+	// ErrInvalidNodeClass is wrapped by the errors of AKSNodeClasses (or controller options) nodes cannot be launched with,
+	// such as an AKSNodeClass failing validation or requesting features the instance type does not support
+	ErrInvalidNodeClass = errors.New("invalid AKSNodeClass")
+	// ErrInvalidSubnet is wrapped by the errors of subnets nodes cannot be launched into, such as a malformed subnet ID
+	// or a subnet outside the virtual network of the cluster subnet; see IsSubnetExhaustedError for subnets without IPs left
+	ErrInvalidSubnet = errors.New("invalid subnet")
+	// ErrKubeVersion is wrapped by the errors of discovering the Kubernetes version of the cluster
+	ErrKubeVersion = errors.New("discovering kubernetes version failed")
+	// ErrImageResolveFailed is wrapped by the errors of resolving the image and the dynamic parameters of the launch template
+	ErrImageResolveFailed = errors.New("resolving image failed")
+	// ErrZoneUnavailable is wrapped by the errors of instance types not offered in any of the zones the nodeClaim is pinned to
+	ErrZoneUnavailable = errors.New("instance type unavailable in the requested zones")
+	// ErrUserDataRender is wrapped by the errors of rendering the user data and tags of the launch template
+	ErrUserDataRender = errors.New("rendering user data failed")
+)
+
+// invalidNodeClass wraps ErrInvalidNodeClass into the error
+func invalidNodeClass(err error) error {
+	return fmt.Errorf("%w, %w", err, ErrInvalidNodeClass)
+}
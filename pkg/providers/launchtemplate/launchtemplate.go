@@ -18,14 +18,28 @@ package launchtemplate
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/launchtemplate/parameters"
 	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"knative.dev/pkg/logging"
 
 	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
@@ -36,6 +50,7 @@ import (
 
 const (
 	karpenterManagedTagKey = "karpenter.azure.com/cluster"
+	nodeClaimTagKey        = "karpenter.sh/nodeclaim"
 
 	networkDataplaneCilium  = "cilium"
 	vnetDataPlaneLabel      = "kubernetes.azure.com/ebpf-dataplane"
@@ -44,81 +59,406 @@ const (
 	vnetPodNetworkTypeLabel = "kubernetes.azure.com/podnetwork-type"
 
 	networkModeOverlay = "overlay"
+
+	networkPluginAzure   = "azure"
+	networkPluginKubenet = "kubenet"
+
+	// maxPodsCeiling is the maximum max pods AKS allows, and maxPodsCeilingAzureNodeSubnet that with Azure CNI with pods in the node subnet
+	maxPodsCeiling                = 250
+	maxPodsCeilingAzureNodeSubnet = 30
+
+	// defaultAPIServerPort is the API server port node provisioning of the AKS contract configures the kubelet with
+	defaultAPIServerPort = 443
+
+	caBundleCacheKey = "caBundle"
+
+	// validateTimeout bounds discovering the Kubernetes version of the cluster when validating the provider at startup
+	validateTimeout = 30 * time.Second
+
+	// ARM allows 50 tags per resource, one of which is left for the nodepool tag set when launching
+	maxTemplateTags   = 49
+	maxTagKeyLength   = 512
+	maxTagValueLength = 256
+	// invalidTagKeyRunes are the characters ARM does not allow in tag keys
+	invalidTagKeyRunes = `<>%&\?/`
+
+	userAssignedIdentityResourceType = "Microsoft.ManagedIdentity/userAssignedIdentities"
+
+	// steps of launch template generation, used to identify where time is spent or a failure occurred (in logs and metrics)
+	stepValidate          = "validate"
+	stepStaticParameters  = "static-parameters"
+	stepKubeServerVersion = "kube-server-version"
+	stepResolve           = "resolve"
+	stepUserData          = "user-data"
+
+	// the default conntrack table size is scaled by node memory, within these bounds
+	conntrackEntriesPerMiB = 32
+	minDefaultConntrackMax = 131072
+	maxDefaultConntrackMax = 4194304
 )
 
+// entropySourceSupport lists the image families each entropy source can be installed on
+var entropySourceSupport = map[string][]string{
+	v1alpha2.EntropySourceRngd:    {v1alpha2.Ubuntu2204ImageFamily, v1alpha2.AzureLinuxImageFamily},
+	v1alpha2.EntropySourceHaveged: {v1alpha2.Ubuntu2204ImageFamily},
+}
+
+// tcpCongestionControlSupport lists the image families whose kernel ships each TCP congestion control algorithm
+var tcpCongestionControlSupport = map[string][]string{
+	v1alpha2.TCPCongestionControlBBR:   {v1alpha2.Ubuntu2204ImageFamily, v1alpha2.AzureLinuxImageFamily},
+	v1alpha2.TCPCongestionControlCubic: {v1alpha2.Ubuntu2204ImageFamily, v1alpha2.AzureLinuxImageFamily},
+	v1alpha2.TCPCongestionControlReno:  {v1alpha2.Ubuntu2204ImageFamily, v1alpha2.AzureLinuxImageFamily},
+	v1alpha2.TCPCongestionControlHTCP:  {v1alpha2.Ubuntu2204ImageFamily},
+	v1alpha2.TCPCongestionControlDCTCP: {v1alpha2.Ubuntu2204ImageFamily},
+}
+
+// gpuSKUSupport reports, by image family, whether nodes of the image family install the drivers of the GPUs of an instance type
+var gpuSKUSupport = map[string]func(vmSize string) bool{
+	v1alpha2.Ubuntu2204ImageFamily: utils.IsNvidiaEnabledSKU,
+	v1alpha2.AzureLinuxImageFamily: utils.IsMarinerEnabledGPUSKU,
+}
+
+// dnsStubListenerOptionalImageFamilies are the image families whose nodes can resolve names without the systemd-resolved stub listener
+var dnsStubListenerOptionalImageFamilies = []string{v1alpha2.Ubuntu2204ImageFamily}
+
+// cgroupV2ImageFamilies are the image families running the cgroup v2 unified hierarchy
+var cgroupV2ImageFamilies = []string{v1alpha2.Ubuntu2204ImageFamily}
+
+// networkProfiles are the curated network sysctls of each network profile
+var networkProfiles = map[string]map[string]string{
+	v1alpha2.NetworkProfileHighThroughput: {
+		"net.core.rmem_max":           "134217728",
+		"net.core.wmem_max":           "134217728",
+		"net.ipv4.tcp_rmem":           "4096 87380 134217728",
+		"net.ipv4.tcp_wmem":           "4096 65536 134217728",
+		"net.core.netdev_max_backlog": "30000",
+	},
+}
+
+// sandboxRuntimeSupport lists the architectures each sandbox runtime can be installed on, by image family
+var sandboxRuntimeSupport = map[string]map[string][]string{
+	v1alpha2.SandboxRuntimeGVisor: {
+		v1alpha2.Ubuntu2204ImageFamily: {corev1beta1.ArchitectureAmd64, corev1beta1.ArchitectureArm64},
+	},
+}
+
+// metadataLabels are the labels nodes are labeled with from their instance type, by the requirement they are derived from:
+// the SKU family, the availability zone (under the alternative zone label, the standard one being protected for AKS nodes)
+// and the capacity type
+var metadataLabels = map[string]string{
+	v1alpha2.LabelSKUFamily:          v1alpha2.LabelSKUFamily,
+	v1.LabelTopologyZone:             v1alpha2.AlternativeLabelTopologyZone,
+	corev1beta1.CapacityTypeLabelKey: corev1beta1.CapacityTypeLabelKey,
+}
+
+// readinessCommandTaint keeps workloads off nodes until the readiness command succeeds and the images to pre-pull in the
+// foreground are pulled, which node bootstrapping signals with an annotation for Karpenter to remove the taint
+var readinessCommandTaint = v1.Taint{Key: v1alpha2.TaintKeyReadinessCommand, Effect: v1.TaintEffectNoSchedule}
+
 type Template struct {
 	UserData string
 	ImageID  string
 	Tags     map[string]*string
+	// SubnetID is the subnet the user data is rendered for, to launch the network interface of the VM into
+	SubnetID string
+	// ProximityPlacementGroupID is the resource ID of the proximity placement group to place the VM in, empty for none
+	ProximityPlacementGroupID string
+	// Labels are the labels the node registers with, including the vnet labels of the subnet
+	Labels map[string]string
+	// Annotations are the annotations node bootstrapping applies to the node once it registers
+	Annotations map[string]string
+	// AcceleratedNetworking is whether to enable Accelerated Networking on the network interface
+	AcceleratedNetworking bool
+	// EphemeralOSDisk is whether to place the OS disk on local storage of the VM
+	EphemeralOSDisk bool
+	// EphemeralOSDiskPlacement is the local storage the ephemeral OS disk is placed on, empty to leave it to Azure
+	EphemeralOSDiskPlacement string
+	// NodeIdentities are the user-assigned identities to assign to the VM
+	NodeIdentities []string
+	// SystemAssignedIdentity is whether to enable the system-assigned identity of the VM
+	SystemAssignedIdentity bool
+	// Spot is whether the user data is rendered for spot capacity
+	Spot bool
+	// KubernetesVersion is the Kubernetes version of the cluster the node bootstraps with (e.g. 1.30.0), which the kubelet is installed at
+	KubernetesVersion string
+	// SecurityProfile is the security profile of the VM, nil for none
+	SecurityProfile *SecurityProfile
+	// BootDiagnostics is whether to enable boot diagnostics on the VM, capturing its serial console log
+	BootDiagnostics bool
+	// BootDiagnosticsStorageURI is the blob endpoint of the storage account boot diagnostics are stored in, empty for managed storage
+	BootDiagnosticsStorageURI string
+	// Provenance records the controller options and environment variables the launch template was generated with
+	Provenance *Provenance
+}
+
+// SecurityProfile contains the security features of the VM
+type SecurityProfile struct {
+	// TrustedLaunch is whether to launch the VM with Trusted Launch, with secure boot and a vTPM as configured
+	TrustedLaunch bool
+	// ConfidentialVM is whether to launch the VM as a confidential VM instead, which always has a vTPM and has secure boot as configured
+	ConfidentialVM   bool
+	SecureBoot       bool
+	VTPM             bool
+	EncryptionAtHost bool
+}
+
+// Hash returns a stable hash of the template content (UserData, ImageID and Tags),
+// independent of tag ordering, for detecting drift of existing nodes
+func (t *Template) Hash() string {
+	return fmt.Sprint(lo.Must(hashstructure.Hash(struct {
+		UserData string
+		ImageID  string
+		Tags     map[string]*string
+	}{t.UserData, t.ImageID, t.Tags}, hashstructure.FormatV2, &hashstructure.HashOptions{
+		IgnoreZeroValue: true,
+		ZeroNil:         true,
+	})))
 }
 
+// CABundleResolver discovers the current cluster CA bundle (base64 encoded)
+type CABundleResolver func() (*string, error)
+
 type Provider struct {
-	imageFamily            *imagefamily.Resolver
-	imageProvider          *imagefamily.Provider
-	caBundle               *string
-	clusterEndpoint        string
-	tenantID               string
-	subscriptionID         string
-	userAssignedIdentityID string
-	resourceGroup          string
-	location               string
-	vnetGUID               string
+	imageFamily      *imagefamily.Resolver
+	imageProvider    *imagefamily.Provider
+	caBundle         *string
+	caBundleResolver CABundleResolver
+	caBundleCache    *cache.Cache
+	subnetsAPI       SubnetsAPI
+	subnetCache      *cache.Cache
+	// proximityPlacementGroupsAPI looks up the region of proximity placement groups, cached in proximityPlacementGroupCache
+	proximityPlacementGroupsAPI  ProximityPlacementGroupsAPI
+	proximityPlacementGroupCache *cache.Cache
+	clusterEndpoint              string
+	tenantID                     string
+	subscriptionID               string
+	userAssignedIdentityID       string
+	resourceGroup                string
+	location                     string
+	vnetGUID                     string
 }
 
 // TODO: add caching of launch templates
 
-func NewProvider(_ context.Context, imageFamily *imagefamily.Resolver, imageProvider *imagefamily.Provider, caBundle *string, clusterEndpoint string,
+// NewProvider creates a launch template provider. The CA bundle is re-resolved through caBundleResolver
+// whenever the cached value in caBundleCache expires, so that rotated cluster CAs are picked up;
+// a non-nil caBundle overrides resolution entirely (e.g. for tests). The subnet nodes are launched into is looked up
+// through subnetsAPI and cached in subnetCache, to cap max pods by its available IPs with Azure CNI. The proximity placement
+// groups of AKSNodeClasses are looked up through proximityPlacementGroupsAPI and cached in proximityPlacementGroupCache,
+// to check they are in the region nodes are launched in.
+func NewProvider(_ context.Context, imageFamily *imagefamily.Resolver, imageProvider *imagefamily.Provider, caBundle *string,
+	caBundleResolver CABundleResolver, caBundleCache *cache.Cache, subnetsAPI SubnetsAPI, subnetCache *cache.Cache,
+	proximityPlacementGroupsAPI ProximityPlacementGroupsAPI, proximityPlacementGroupCache *cache.Cache, clusterEndpoint string,
 	tenantID, subscriptionID, userAssignedIdentityID, resourceGroup, location, vnetGUID string,
 ) *Provider {
 	return &Provider{
-		imageFamily:            imageFamily,
-		imageProvider:          imageProvider,
-		caBundle:               caBundle,
-		clusterEndpoint:        clusterEndpoint,
-		tenantID:               tenantID,
-		subscriptionID:         subscriptionID,
-		userAssignedIdentityID: userAssignedIdentityID,
-		resourceGroup:          resourceGroup,
-		location:               location,
-		vnetGUID:               vnetGUID,
+		imageFamily:                  imageFamily,
+		imageProvider:                imageProvider,
+		caBundle:                     caBundle,
+		caBundleResolver:             caBundleResolver,
+		caBundleCache:                caBundleCache,
+		subnetsAPI:                   subnetsAPI,
+		subnetCache:                  subnetCache,
+		proximityPlacementGroupsAPI:  proximityPlacementGroupsAPI,
+		proximityPlacementGroupCache: proximityPlacementGroupCache,
+		clusterEndpoint:              clusterEndpoint,
+		tenantID:                     tenantID,
+		subscriptionID:               subscriptionID,
+		userAssignedIdentityID:       userAssignedIdentityID,
+		resourceGroup:                resourceGroup,
+		location:                     location,
+		vnetGUID:                     vnetGUID,
+	}
+}
+
+// Validate checks the provider is configured with the cluster endpoint and the Azure tenant, subscription, node resource group
+// and location of the cluster, and that the Kubernetes version of the cluster can be discovered, so that misconfiguration fails
+// at startup rather than when launching the first node. It is bounded by validateTimeout.
+func (p *Provider) Validate(ctx context.Context) error {
+	var errs error
+	for _, field := range []lo.Tuple2[string, string]{
+		{A: "cluster endpoint", B: p.clusterEndpoint},
+		{A: "tenant ID", B: p.tenantID},
+		{A: "subscription ID", B: p.subscriptionID},
+		{A: "node resource group", B: p.resourceGroup},
+		{A: "location", B: p.location},
+	} {
+		if field.B == "" {
+			errs = multierr.Append(errs, fmt.Errorf("missing %s", field.A))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.imageProvider.KubeServerVersion(ctx)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("discovering kubernetes version, %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("discovering kubernetes version, %w", ctx.Err())
 	}
 }
 
+// GetTemplate returns the launch template of the nodeClaim for the cluster subnet
 func (p *Provider) GetTemplate(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
 	instanceType *cloudprovider.InstanceType, additionalLabels map[string]string) (*Template, error) {
-	staticParameters, err := p.getStaticParameters(ctx, instanceType, nodeClass, lo.Assign(nodeClaim.Labels, additionalLabels))
+	return p.GetTemplateForSubnet(ctx, nodeClass, nodeClaim, instanceType, additionalLabels, options.FromContext(ctx).SubnetID)
+}
+
+// GetTemplateForSubnet returns the launch template of the nodeClaim for the given subnet, the cluster subnet or
+// one of the fallback subnets of the AKSNodeClass. Failures due to the subnet having no IPs left for the node
+// are reported as such, see IsSubnetExhaustedError, and other failures wrap the error of their stage, such as ErrInvalidNodeClass.
+func (p *Provider) GetTemplateForSubnet(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	instanceType *cloudprovider.InstanceType, additionalLabels map[string]string, subnetID string) (*Template, error) {
+	start := time.Now()
+	defer func() { metrics.LaunchTemplateGenerationDuration.Observe(time.Since(start).Seconds()) }()
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("instance-type", instanceType.Name))
+
+	ctx, nodeClass, sharedParameters, err := p.getSharedTemplateParameters(ctx, nodeClass, nodeClaim, additionalLabels, subnetID)
 	if err != nil {
 		return nil, err
 	}
+	return p.getInstanceTypeTemplate(ctx, nodeClass, nodeClaim, instanceType, sharedParameters, start)
+}
 
-	kubeServerVersion, err := p.imageProvider.KubeServerVersion(ctx)
+// GetTemplates returns the launch templates of the nodeClaim for the cluster subnet by instance type name, resolving the parameters
+// the instance types share, such as the Kubernetes version, once rather than for each of them
+func (p *Provider) GetTemplates(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	instanceTypes []*cloudprovider.InstanceType, additionalLabels map[string]string) (map[string]*Template, error) {
+	start := time.Now()
+	defer func() { metrics.LaunchTemplateGenerationDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx, nodeClass, sharedParameters, err := p.getSharedTemplateParameters(ctx, nodeClass, nodeClaim, additionalLabels, options.FromContext(ctx).SubnetID)
 	if err != nil {
 		return nil, err
 	}
+	templates := make(map[string]*Template, len(instanceTypes))
+	for _, instanceType := range instanceTypes {
+		instanceTypeCtx := logging.WithLogger(ctx, logging.FromContext(ctx).With("instance-type", instanceType.Name))
+		template, err := p.getInstanceTypeTemplate(instanceTypeCtx, nodeClass, nodeClaim, instanceType, sharedParameters, start)
+		if err != nil {
+			return nil, fmt.Errorf("instance type %s, %w", instanceType.Name, err)
+		}
+		templates[instanceType.Name] = template
+	}
+	return templates, nil
+}
+
+// getSharedTemplateParameters validates the AKSNodeClass and resolves the static parameters and Kubernetes version
+// shared by the launch templates of all instance types, returning the context logging their resolution
+func (p *Provider) getSharedTemplateParameters(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	additionalLabels map[string]string, subnetID string) (context.Context, *v1alpha2.AKSNodeClass, *parameters.StaticParameters, error) {
+	log := logging.FromContext(ctx).With("aksnodeclass", nodeClass.Name, "subnet", subnetID)
+	fail := func(step string, err error) (context.Context, *v1alpha2.AKSNodeClass, *parameters.StaticParameters, error) {
+		metrics.LaunchTemplateGenerationErrorCount.WithLabelValues(step).Inc()
+		log.With("step", step).Debugf("failed generating launch template, %s", err)
+		return nil, nil, nil, err
+	}
+
+	if err := nodeClass.Validate(); err != nil {
+		return fail(stepValidate, invalidNodeClass(fmt.Errorf("validating AKSNodeClass %s, %w", nodeClass.Name, err)))
+	}
+	nodeClass = withDefaultImageFamily(ctx, nodeClass)
+
+	stepStart := time.Now()
+	staticParameters, err := p.getSharedStaticParameters(ctx, nodeClass, subnetID, lo.Assign(nodeClaim.Labels, additionalLabels), lo.Assign(nodeClass.Spec.Annotations), getRegistrationTaints(nodeClaim))
+	if err != nil {
+		return fail(stepStaticParameters, err)
+	}
+	log = log.With(stepStaticParameters+"-duration", time.Since(stepStart))
+	staticParameters.RequirementTags = getRequirementTags(ctx, nodeClaim)
+
+	stepStart = time.Now()
+	kubeServerVersion, err := p.imageProvider.KubeServerVersion(ctx)
+	if err != nil {
+		return fail(stepKubeServerVersion, fmt.Errorf("%w, %w", err, ErrKubeVersion))
+	}
+	log = log.With(stepKubeServerVersion+"-duration", time.Since(stepStart))
 	staticParameters.KubernetesVersion = kubeServerVersion
+
+	return logging.WithLogger(ctx, log), nodeClass, staticParameters, nil
+}
+
+// getInstanceTypeTemplate returns the launch template of the nodeClaim for the instance type, from the parameters its AKSNodeClass shares
+// with other instance types. Generating the launch template is timed from start.
+func (p *Provider) getInstanceTypeTemplate(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim,
+	instanceType *cloudprovider.InstanceType, sharedParameters *parameters.StaticParameters, start time.Time) (*Template, error) {
+	log := logging.FromContext(ctx)
+	fail := func(step string, err error) (*Template, error) {
+		metrics.LaunchTemplateGenerationErrorCount.WithLabelValues(step).Inc()
+		log.With("step", step).Debugf("failed generating launch template, %s", err)
+		return nil, err
+	}
+
+	staticParameters, err := getInstanceTypeStaticParameters(nodeClass, instanceType, sharedParameters)
+	if err != nil {
+		return fail(stepStaticParameters, invalidNodeClass(err))
+	}
+	staticParameters.Hostname, err = resolveHostnameTemplate(nodeClass, nodeClaim, instanceType)
+	if err != nil {
+		return fail(stepStaticParameters, invalidNodeClass(err))
+	}
+	log = log.With("arch", staticParameters.Arch)
+
+	stepStart := time.Now()
 	templateParameters, err := p.imageFamily.Resolve(ctx, nodeClass, nodeClaim, instanceType, staticParameters)
 	if err != nil {
-		return nil, err
+		return fail(stepResolve, fmt.Errorf("%w, %w", err, ErrImageResolveFailed))
 	}
-	launchTemplate, err := p.createLaunchTemplate(ctx, templateParameters)
+	if err := validateZoneAvailability(nodeClaim, instanceType, templateParameters.ImageID); err != nil {
+		return fail(stepResolve, fmt.Errorf("%w, %w", err, ErrZoneUnavailable))
+	}
+	log = log.With(stepResolve+"-duration", time.Since(stepStart))
+
+	stepStart = time.Now()
+	launchTemplate, err := p.createLaunchTemplate(ctx, templateParameters, nodeClaim)
 	if err != nil {
-		return nil, err
+		return fail(stepUserData, fmt.Errorf("%w, %w", err, ErrUserDataRender))
 	}
+	log.With(
+		stepUserData+"-duration", time.Since(stepStart),
+		"image-id", launchTemplate.ImageID,
+		"user-data-size", len(launchTemplate.UserData),
+		"duration", time.Since(start),
+	).Debugf("generated launch template")
 
 	return launchTemplate, nil
 }
 
-func (p *Provider) getStaticParameters(ctx context.Context, instanceType *cloudprovider.InstanceType, nodeClass *v1alpha2.AKSNodeClass, labels map[string]string) (*parameters.StaticParameters, error) {
-	var arch string = corev1beta1.ArchitectureAmd64
-	if err := instanceType.Requirements.Compatible(scheduling.NewRequirements(scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureArm64))); err == nil {
-		arch = corev1beta1.ArchitectureArm64
-	}
-	// TODO: make conditional on either Azure CNI Overlay or pod subnet
-	vnetLabels, err := p.getVnetInfoLabels(ctx, nodeClass)
+func (p *Provider) getStaticParameters(ctx context.Context, instanceType *cloudprovider.InstanceType, nodeClass *v1alpha2.AKSNodeClass, subnetID string,
+	labels map[string]string, annotations map[string]string, taints []v1.Taint) (*parameters.StaticParameters, error) {
+	sharedParameters, err := p.getSharedStaticParameters(ctx, nodeClass, subnetID, labels, annotations, taints)
 	if err != nil {
 		return nil, err
 	}
-	labels = lo.Assign(labels, vnetLabels)
+	return getInstanceTypeStaticParameters(nodeClass, instanceType, sharedParameters)
+}
+
+// getSharedStaticParameters returns the static parameters shared by all instance types of the AKSNodeClass,
+// see getInstanceTypeStaticParameters for those of each instance type
+func (p *Provider) getSharedStaticParameters(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass, subnetID string,
+	labels map[string]string, annotations map[string]string, taints []v1.Taint) (*parameters.StaticParameters, error) {
+	apiServerName, apiServerPort := getAPIServerHostPort(ctx, nodeClass)
+	if err := validateClusterEndpoint(p.clusterEndpoint, apiServerName); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateSubnet(ctx, subnetID); err != nil {
+		return nil, fmt.Errorf("%w, %w", err, ErrInvalidSubnet)
+	}
+	computedLabels, err := p.getVnetInfoLabels(ctx, subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", err, ErrInvalidSubnet)
+	}
 
 	// TODO: Make conditional on epbf dataplane
 	// This label is required for the cilium agent daemonset because
@@ -127,67 +467,1036 @@ func (p *Provider) getStaticParameters(ctx context.Context, instanceType *cloudp
 	//            operator: In
 	//            values:
 	//              - cilium
-	labels[vnetDataPlaneLabel] = networkDataplaneCilium
+	computedLabels[vnetDataPlaneLabel] = networkDataplaneCilium
+	if migProfile := nodeClass.Spec.GetGPUMIGProfile(); migProfile != "" {
+		computedLabels[v1alpha2.LabelGPUMIGProfile] = migProfile
+	}
+	if nodeClass.Spec.IsRuntimeHandlerLabelsEnabled() {
+		for _, handler := range nodeClass.Spec.GetRuntimeHandlers() {
+			computedLabels[v1alpha2.LabelRuntimeHandlerPrefix+handler] = "true"
+		}
+	}
+	labels, err = mergeComputedLabels(ctx, labels, computedLabels)
+	if err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if nodeClass.Spec.GetReadinessCommand() != "" || (len(nodeClass.Spec.PrePullImages) > 0 && !nodeClass.Spec.IsPrePullImagesInBackground()) {
+		taints = lo.UniqBy(append(taints, readinessCommandTaint), func(taint v1.Taint) string { return taint.ToString() })
+	}
+
+	caBundle, err := p.getCABundle()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMTU(nodeClass, options.FromContext(ctx).NetworkPlugin); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateCgroupDriver(nodeClass, options.FromContext(ctx).BootstrapProfile); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateKubeadmBootstrap(ctx, nodeClass); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateAPIServerPort(apiServerPort, options.FromContext(ctx).BootstrapProfile); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateMaxPods(nodeClass, options.FromContext(ctx).NetworkPlugin, options.FromContext(ctx).NetworkPluginMode); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateEntropySource(nodeClass); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateTCPCongestionControl(nodeClass); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateSwapAccounting(nodeClass); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if err := validateDNSStubListener(nodeClass); err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if nodeClass.Spec.IsIPv6Disabled() && options.FromContext(ctx).IPv6DualStack {
+		return nil, invalidNodeClass(fmt.Errorf("disableIPv6 is not supported on dual-stack clusters"))
+	}
+	networkSysctls, err := getNetworkProfileSysctls(nodeClass)
+	if err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	maxPods, err := p.getMaxPods(ctx, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	nodeIdentities := lo.Uniq(append(append([]string{}, options.FromContext(ctx).NodeIdentities...), nodeClass.Spec.NodeIdentities...))
+	userAssignedIdentityID, err := p.getKubeletIdentityClientID(nodeClass, nodeIdentities)
+	if err != nil {
+		return nil, invalidNodeClass(err)
+	}
+	if options.FromContext(ctx).SecureTLSBootstrapping && userAssignedIdentityID == "" {
+		return nil, invalidNodeClass(fmt.Errorf("secure TLS bootstrapping requires a kubelet identity for nodes to authenticate with"))
+	}
+	conntrackTCPTimeouts := nodeClass.Spec.GetConntrackTCPTimeouts()
+	cniBinDir, cniConfDir := nodeClass.Spec.GetCNIDirs()
+	bootDiagnostics, bootDiagnosticsStorageURI := nodeClass.Spec.GetBootDiagnostics()
+	if proximityPlacementGroupID := nodeClass.Spec.GetProximityPlacementGroupID(); proximityPlacementGroupID != "" {
+		if err := p.validateProximityPlacementGroup(ctx, proximityPlacementGroupID, p.location); err != nil {
+			return nil, err
+		}
+	}
 
 	return &parameters.StaticParameters{
 		ClusterName:                    options.FromContext(ctx).ClusterName,
 		ClusterEndpoint:                p.clusterEndpoint,
 		Tags:                           nodeClass.Spec.Tags,
 		Labels:                         labels,
-		CABundle:                       p.caBundle,
-		Arch:                           arch,
-		GPUNode:                        utils.IsNvidiaEnabledSKU(instanceType.Name),
-		GPUDriverVersion:               utils.GetGPUDriverVersion(instanceType.Name),
-		GPUImageSHA:                    utils.GetAKSGPUImageSHA(instanceType.Name),
+		Annotations:                    annotations,
+		Taints:                         taints,
+		CABundle:                       caBundle,
+		GPUPersistenceMode:             nodeClass.Spec.IsGPUPersistenceModeEnabled(),
+		GPUMIGProfile:                  nodeClass.Spec.GetGPUMIGProfile(),
 		TenantID:                       p.tenantID,
 		SubscriptionID:                 p.subscriptionID,
-		UserAssignedIdentityID:         p.userAssignedIdentityID,
+		UserAssignedIdentityID:         userAssignedIdentityID,
+		NodeIdentities:                 nodeIdentities,
+		SystemAssignedIdentity:         lo.FromPtr(nodeClass.Spec.SystemAssignedIdentity),
 		ResourceGroup:                  p.resourceGroup,
 		Location:                       p.location,
+		ProximityPlacementGroupID:      nodeClass.Spec.GetProximityPlacementGroupID(),
 		ClusterID:                      options.FromContext(ctx).ClusterID,
-		APIServerName:                  options.FromContext(ctx).GetAPIServerName(),
+		APIServerName:                  apiServerName,
+		APIServerPort:                  apiServerPort,
 		KubeletClientTLSBootstrapToken: options.FromContext(ctx).KubeletClientTLSBootstrapToken,
+		SecureTLSBootstrapping:         options.FromContext(ctx).SecureTLSBootstrapping,
+		OIDCIssuerURL:                  options.FromContext(ctx).OIDCIssuerURL,
 		NetworkPlugin:                  options.FromContext(ctx).NetworkPlugin,
 		NetworkPolicy:                  options.FromContext(ctx).NetworkPolicy,
-		SubnetID:                       options.FromContext(ctx).SubnetID,
+		ClusterDNSIP:                   options.FromContext(ctx).ClusterDNSIP,
+		BootstrapProfile:               options.FromContext(ctx).BootstrapProfile,
+		SubnetID:                       subnetID,
+		MaxPods:                        maxPods,
+		KubeletMaxPods:                 lo.FromPtr(nodeClass.Spec.MaxPods),
+		MTU:                            lo.FromPtr(nodeClass.Spec.MTU),
+		DNSServers:                     nodeClass.Spec.DNSServers,
+		DNSSearchDomains:               nodeClass.Spec.DNSSearchDomains,
+		DisableDNSStubListener:         nodeClass.Spec.IsDNSStubListenerDisabled(),
+		DisableIPv6:                    nodeClass.Spec.IsIPv6Disabled(),
+		TCPCongestionControl:           nodeClass.Spec.GetTCPCongestionControl(),
+		SecureBoot:                     nodeClass.Spec.IsSecureBootEnabled(),
+		VTPM:                           nodeClass.Spec.IsVTPMEnabled(),
+		EncryptionAtHost:               nodeClass.Spec.IsEncryptionAtHostEnabled(),
+		BootDiagnostics:                bootDiagnostics,
+		BootDiagnosticsStorageURI:      bootDiagnosticsStorageURI,
+		RegistryMirrors:                nodeClass.Spec.GetRegistryMirrors(),
+		ImagePullCredentials:           nodeClass.Spec.GetImagePullCredentials(),
+		CNIBinDir:                      cniBinDir,
+		MaxConcurrentDownloads:         nodeClass.Spec.GetMaxConcurrentDownloads(),
+		CNIConfDir:                     cniConfDir,
+		LocalStorageDiscoveryPath:      nodeClass.Spec.GetLocalStorageDiscoveryPath(),
+		OOMScoreAdj:                    nodeClass.Spec.GetOOMScoreAdj(),
+		KubeletFeatureGates:            nodeClass.Spec.GetKubeletFeatureGates(),
+		KubeletCgroupDriver:            nodeClass.Spec.GetKubeletCgroupDriver(),
+		ReadinessCommand:               nodeClass.Spec.GetReadinessCommand(),
+		ReadinessCommandTimeoutSeconds: nodeClass.Spec.GetReadinessCommandTimeoutSeconds(),
+		PrePullImages:                  nodeClass.Spec.PrePullImages,
+		PrePullImagesInBackground:      nodeClass.Spec.IsPrePullImagesInBackground(),
+		RegistrationTimeoutSeconds:     nodeClass.Spec.GetRegistrationTimeoutSeconds(),
+		RegistrationRetryCount:         nodeClass.Spec.GetRegistrationRetryCount(),
+		SystemdUnits:                   getSystemdUnits(nodeClass),
+		SandboxRuntime:                 nodeClass.Spec.GetSandboxRuntime(),
+		DefaultRuntimeHandler:          nodeClass.Spec.GetDefaultRuntimeHandler(),
+		EntropySource:                  nodeClass.Spec.GetEntropySource(),
+		SwapAccounting:                 nodeClass.Spec.IsSwapAccountingEnabled(),
+		AdditionalCAs:                  nodeClass.Spec.AdditionalCAs,
+		ConntrackTCPTimeoutEstablished: lo.FromPtr(conntrackTCPTimeouts.EstablishedSeconds),
+		ConntrackTCPTimeoutCloseWait:   lo.FromPtr(conntrackTCPTimeouts.CloseWaitSeconds),
+		NetworkSysctls:                 networkSysctls,
+		Sysctls:                        nodeClass.Spec.GetSysctls(),
+		HTTPProxy:                      options.FromContext(ctx).NodeHTTPProxy,
+		HTTPSProxy:                     options.FromContext(ctx).NodeHTTPSProxy,
+		NoProxy:                        options.FromContext(ctx).NodeNoProxy,
+		HTTPProxyTrustedCA:             options.FromContext(ctx).NodeHTTPProxyTrustedCA,
 	}, nil
 }
 
-func (p *Provider) createLaunchTemplate(_ context.Context, options *parameters.Parameters) (*Template, error) {
+// getInstanceTypeStaticParameters completes the shared static parameters for the instance type, validating the AKSNodeClass
+// can be launched on it. The shared parameters are left untouched, for other instance types to reuse.
+func getInstanceTypeStaticParameters(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType,
+	sharedParameters *parameters.StaticParameters) (*parameters.StaticParameters, error) {
+	var arch string = corev1beta1.ArchitectureAmd64
+	if err := instanceType.Requirements.Compatible(scheduling.NewRequirements(scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureArm64))); err == nil {
+		arch = corev1beta1.ArchitectureArm64
+	}
+	labels := lo.Assign(sharedParameters.Labels)
+	if !nodeClass.Spec.IsMetadataLabelsDisabled() {
+		labels = lo.Assign(getMetadataLabels(instanceType), labels)
+	}
+	ephemeralOSDisk, err := useEphemeralOSDisk(nodeClass, instanceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := setEphemeralOSDiskLabel(labels, ephemeralOSDisk); err != nil {
+		return nil, err
+	}
+	if err := validateSandboxRuntime(nodeClass, arch); err != nil {
+		return nil, err
+	}
+	if err := validateGPUInstanceType(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateGPUDriverVersion(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateGPUArchitecture(nodeClass, instanceType, arch); err != nil {
+		return nil, err
+	}
+	if err := validateImageGeneration(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateSecurityProfile(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateDefaultRuntimeHandler(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateMIGProfile(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+	if err := validateLocalStorage(nodeClass, instanceType); err != nil {
+		return nil, err
+	}
+
+	staticParameters := *sharedParameters
+	staticParameters.Labels = labels
+	staticParameters.Arch = arch
+	staticParameters.GPUNode = isGPUNode(nodeClass, instanceType)
+	staticParameters.GPUDriverVersion = getGPUDriverVersion(nodeClass, instanceType)
+	staticParameters.GPUImageSHA = getGPUImageSHA(nodeClass, instanceType)
+	staticParameters.AcceleratedNetworking = utils.IsAcceleratedNetworkingSupported(instanceType) && !nodeClass.Spec.IsAcceleratedNetworkingDisabled()
+	staticParameters.EphemeralOSDisk = ephemeralOSDisk
+	staticParameters.EphemeralOSDiskPlacement = lo.FromPtr(nodeClass.Spec.EphemeralOSDiskPlacement)
+	// the capacity type label is resolved from the nodeClaim capacity type requirement when launching
+	staticParameters.Spot = labels[corev1beta1.CapacityTypeLabelKey] == corev1beta1.CapacityTypeSpot
+	staticParameters.RoCE = nodeClass.Spec.IsRoCEEnabled() && utils.IsRDMAEnabledSKU(instanceType.Name)
+	staticParameters.ConntrackMax = getConntrackMax(nodeClass, instanceType)
+	staticParameters.ConfidentialVM = utils.IsConfidentialSKU(instanceType.Name)
+	staticParameters.LocalStorageRAID0 = nodeClass.Spec.IsLocalStorageRAID0Enabled() && utils.GetLocalNVMeDiskCount(instanceType.Name) > 1
+	return &staticParameters, nil
+}
+
+// withDefaultImageFamily returns the AKSNodeClass with the default image family of the controller when it doesn't specify one,
+// copying it rather than modifying the cached object
+func withDefaultImageFamily(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) *v1alpha2.AKSNodeClass {
+	if nodeClass.Spec.ImageFamily != nil {
+		return nodeClass
+	}
+	nodeClass = nodeClass.DeepCopy()
+	nodeClass.Spec.ImageFamily = lo.ToPtr(options.FromContext(ctx).DefaultImageFamily)
+	return nodeClass
+}
+
+// mergeComputedLabels merges the labels Karpenter computes for nodes, such as the kubernetes.azure.com/* labels of the node subnet,
+// into the labels of the nodeClaim. Computed labels take precedence: a nodeClaim label of the same key and a different value is
+// logged and overridden, or fails launching with the error label-conflict-policy. Metadata labels of the instance type are
+// merged later, with the nodeClaim labels taking precedence over them instead.
+func mergeComputedLabels(ctx context.Context, labels, computedLabels map[string]string) (map[string]string, error) {
+	conflicts := lo.Filter(lo.Keys(computedLabels), func(key string, _ int) bool {
+		value, ok := labels[key]
+		return ok && value != computedLabels[key]
+	})
+	if len(conflicts) == 0 {
+		return lo.Assign(labels, computedLabels), nil
+	}
+	sort.Strings(conflicts)
+	descriptions := lo.Map(conflicts, func(key string, _ int) string {
+		return fmt.Sprintf("%s=%s (computed %s)", key, labels[key], computedLabels[key])
+	})
+	if options.FromContext(ctx).LabelConflictPolicy == options.LabelConflictPolicyError {
+		return nil, fmt.Errorf("nodeClaim labels %s collide with labels computed for nodes", strings.Join(descriptions, ", "))
+	}
+	logging.FromContext(ctx).Warnf("overriding nodeClaim labels %s with labels computed for nodes", strings.Join(descriptions, ", "))
+	return lo.Assign(labels, computedLabels), nil
+}
+
+// getRegistrationTaints returns the taints the kubelet registers the node with: the nodeClaim taints and startup taints,
+// so that no pods can schedule onto the node before Karpenter syncs them
+func getRegistrationTaints(nodeClaim *corev1beta1.NodeClaim) []v1.Taint {
+	taints := make([]v1.Taint, 0, len(nodeClaim.Spec.Taints)+len(nodeClaim.Spec.StartupTaints))
+	taints = append(taints, nodeClaim.Spec.Taints...)
+	taints = append(taints, nodeClaim.Spec.StartupTaints...)
+	return lo.UniqBy(taints, func(taint v1.Taint) string {
+		return taint.Key + ":" + string(taint.Effect)
+	})
+}
+
+// getSystemdUnits returns the systemd units of the AKSNodeClass node bootstrapping writes
+func getSystemdUnits(nodeClass *v1alpha2.AKSNodeClass) []bootstrap.SystemdUnit {
+	return lo.Map(nodeClass.Spec.SystemdUnits, func(unit v1alpha2.SystemdUnit, _ int) bootstrap.SystemdUnit {
+		return bootstrap.SystemdUnit{Name: unit.Name, Content: unit.Content, Enabled: unit.IsEnabled()}
+	})
+}
+
+// getAPIServerHostPort returns the API server host nodes join, that of the AKSNodeClass override if set, and the port
+// other than the default 443 they join it on, 0 for none
+func getAPIServerHostPort(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (string, int32) {
+	if nodeClass.Spec.APIServerName == nil {
+		return options.FromContext(ctx).GetAPIServerName(), 0
+	}
+	host, port := nodeClass.Spec.GetAPIServerHostPort()
+	if port == defaultAPIServerPort {
+		port = 0
+	}
+	return host, port
+}
+
+// validateClusterEndpoint checks that nodes are given an API server they can join, instead of a bootstrap that fails on the node
+func validateClusterEndpoint(clusterEndpoint, apiServerName string) error {
+	if clusterEndpoint == "" {
+		return fmt.Errorf("cluster endpoint is empty")
+	}
+	endpoint, err := url.Parse(clusterEndpoint)
+	if err != nil || !endpoint.IsAbs() || endpoint.Hostname() == "" {
+		return fmt.Errorf("cluster endpoint %q is not a valid URL", clusterEndpoint)
+	}
+	if apiServerName == "" {
+		return fmt.Errorf("API server name derived from the cluster endpoint option is empty")
+	}
+	return nil
+}
+
+// getMetadataLabels returns the metadata labels of the instance type whose requirements have a single value, which the node
+// is known to launch with
+func getMetadataLabels(instanceType *cloudprovider.InstanceType) map[string]string {
+	labels := map[string]string{}
+	for key, label := range metadataLabels {
+		if requirement := instanceType.Requirements.Get(key); requirement.Operator() == v1.NodeSelectorOpIn && requirement.Len() == 1 {
+			labels[label] = requirement.Any()
+		}
+	}
+	return labels
+}
+
+// useEphemeralOSDisk returns whether the OS disk is ephemeral. With a placement requested, it always is, and the instance type
+// must have room for the OS disk in that location; otherwise it is ephemeral when it fits the local storage of the instance type.
+func useEphemeralOSDisk(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) (bool, error) {
+	osDiskSizeGB := lo.FromPtr(nodeClass.Spec.OSDiskSizeGB)
+	if nodeClass.Spec.EphemeralOSDiskPlacement == nil {
+		return utils.UseEphemeralOSDisk(instanceType, osDiskSizeGB), nil
+	}
+	placement := *nodeClass.Spec.EphemeralOSDiskPlacement
+	if maxSizeGB := utils.GetEphemeralOSDiskPlacementMaxSizeGB(instanceType, placement); maxSizeGB == 0 || osDiskSizeGB > maxSizeGB {
+		return false, fmt.Errorf("os disk of %dGB does not fit the %s of instance type %s, which has room for %dGB", osDiskSizeGB, placement, instanceType.Name, maxSizeGB)
+	}
+	return true, nil
+}
+
+// setEphemeralOSDiskLabel labels the node with its OS disk placement, which must not contradict a label already requested
+func setEphemeralOSDiskLabel(labels map[string]string, ephemeralOSDisk bool) error {
+	value := strconv.FormatBool(ephemeralOSDisk)
+	if requested, ok := labels[v1alpha2.LabelEphemeralOSDisk]; ok && requested != value {
+		return fmt.Errorf("label %s=%q conflicts with the resolved OS disk placement %q", v1alpha2.LabelEphemeralOSDisk, requested, value)
+	}
+	labels[v1alpha2.LabelEphemeralOSDisk] = value
+	return nil
+}
+
+// validateCgroupDriver checks that the kubelet and containerd can be configured with the same cgroup driver: node bootstrapping
+// of the kubeadm bootstrap profile leaves containerd to the image, configured with the systemd driver kubeadm defaults to
+func validateCgroupDriver(nodeClass *v1alpha2.AKSNodeClass, bootstrapProfile string) error {
+	if cgroupDriver := nodeClass.Spec.GetKubeletCgroupDriver(); cgroupDriver == v1alpha2.CgroupDriverCgroupfs && bootstrapProfile == bootstrap.ProfileKubeadm {
+		return fmt.Errorf("kubelet cgroupDriver %q is not supported with bootstrap profile %q, which does not configure containerd", cgroupDriver, bootstrapProfile)
+	}
+	return nil
+}
+
+// validateKubeadmBootstrap checks that nodes of the kubeadm bootstrap profile are not configured with the node bootstrapping
+// settings of the AKSNodeClass (and controller options) it does not apply, which would otherwise be dropped silently:
+// its user data only joins the node with its labels, taints and kubelet settings, leaving the rest of the node to the image
+func validateKubeadmBootstrap(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) error {
+	if options.FromContext(ctx).BootstrapProfile != bootstrap.ProfileKubeadm {
+		return nil
+	}
+	spec := nodeClass.Spec
+	fields := lo.FilterMap([]lo.Tuple2[string, bool]{
+		{A: "annotations", B: len(spec.Annotations) > 0},
+		{A: "hostnameTemplate", B: spec.HostnameTemplate != nil},
+		{A: "gpu", B: spec.GPU != nil},
+		{A: "conntrack", B: spec.Conntrack != nil},
+		{A: "mtu", B: spec.MTU != nil},
+		{A: "sandboxRuntime", B: spec.SandboxRuntime != nil},
+		{A: "runtimeHandlers", B: spec.RuntimeHandlers != nil},
+		{A: "dnsServers", B: len(spec.DNSServers) > 0},
+		{A: "dnsSearchDomains", B: len(spec.DNSSearchDomains) > 0},
+		{A: "dnsStubListener", B: spec.DNSStubListener != nil},
+		{A: "disableIPv6", B: spec.DisableIPv6 != nil},
+		{A: "networkProfile", B: spec.NetworkProfile != nil},
+		{A: "linuxConfig", B: spec.LinuxConfig != nil},
+		{A: "tcpCongestionControl", B: spec.TCPCongestionControl != nil},
+		{A: "entropySource", B: spec.EntropySource != nil},
+		{A: "swapAccounting", B: spec.SwapAccounting != nil},
+		{A: "roce", B: spec.RoCE != nil},
+		{A: "additionalCAs", B: len(spec.AdditionalCAs) > 0},
+		{A: "containerdConfig", B: spec.ContainerdConfig != nil},
+		{A: "imagePullConfig", B: len(spec.ImagePullConfig) > 0},
+		{A: "prePullImages", B: len(spec.PrePullImages) > 0 || spec.PrePullImagesInBackground != nil},
+		{A: "localStorage", B: spec.LocalStorage != nil},
+		{A: "oomScoreAdj", B: spec.OOMScoreAdj != nil},
+		{A: "readinessCommand", B: spec.ReadinessCommand != nil},
+		{A: "registration", B: spec.Registration != nil},
+		{A: "systemdUnits", B: len(spec.SystemdUnits) > 0},
+	}, func(field lo.Tuple2[string, bool], _ int) (string, bool) { return field.A, field.B })
+	if len(fields) > 0 {
+		return fmt.Errorf("AKSNodeClass %s sets %s, which bootstrap profile %q does not apply", nodeClass.Name, strings.Join(fields, ", "), bootstrap.ProfileKubeadm)
+	}
+	opts := options.FromContext(ctx)
+	flags := lo.FilterMap([]lo.Tuple2[string, bool]{
+		{A: "node-http-proxy", B: opts.NodeHTTPProxy != ""},
+		{A: "node-https-proxy", B: opts.NodeHTTPSProxy != ""},
+		{A: "node-no-proxy", B: len(opts.NodeNoProxy) > 0},
+		{A: "node-http-proxy-trusted-ca", B: opts.NodeHTTPProxyTrustedCA != ""},
+	}, func(flag lo.Tuple2[string, bool], _ int) (string, bool) { return flag.A, flag.B })
+	if len(flags) > 0 {
+		return fmt.Errorf("options %s are set, which bootstrap profile %q does not apply", strings.Join(flags, ", "), bootstrap.ProfileKubeadm)
+	}
+	return nil
+}
+
+// validateAPIServerPort checks that nodes can join the API server on a port other than 443, which only node bootstrapping
+// of the kubeadm bootstrap profile configures: node provisioning of the AKS contract joins the API server on 443
+func validateAPIServerPort(apiServerPort int32, bootstrapProfile string) error {
+	if apiServerPort != 0 && bootstrapProfile != bootstrap.ProfileKubeadm {
+		return fmt.Errorf("apiServerName port %d is only supported with bootstrap profile %q, nodes of bootstrap profile %q join the API server on %d",
+			apiServerPort, bootstrap.ProfileKubeadm, lo.Ternary(bootstrapProfile == "", bootstrap.ProfileAKS, bootstrapProfile), defaultAPIServerPort)
+	}
+	return nil
+}
+
+// validateMTU checks that a custom MTU can be applied consistently with the cluster network plugin:
+// interface MTU is always applied, but the pod network only follows it for plugins whose configuration we control or inherit.
+func validateMTU(nodeClass *v1alpha2.AKSNodeClass, networkPlugin string) error {
+	if nodeClass.Spec.MTU == nil {
+		return nil
+	}
+	if networkPlugin != networkPluginAzure && networkPlugin != networkPluginKubenet {
+		return fmt.Errorf("mtu %d is not supported with network plugin %q, only with %q and %q", *nodeClass.Spec.MTU, networkPlugin, networkPluginAzure, networkPluginKubenet)
+	}
+	return nil
+}
+
+// validateMaxPods checks that the max pods of nodes do not exceed the ceiling of the cluster network plugin,
+// which is lowest for Azure CNI with pods in the node subnet, where every pod takes an IP of the subnet
+func validateMaxPods(nodeClass *v1alpha2.AKSNodeClass, networkPlugin, networkPluginMode string) error {
+	if nodeClass.Spec.MaxPods == nil {
+		return nil
+	}
+	ceiling := int32(maxPodsCeiling)
+	if networkPlugin == networkPluginAzure && networkPluginMode != options.NetworkPluginModeOverlay {
+		ceiling = maxPodsCeilingAzureNodeSubnet
+	}
+	if *nodeClass.Spec.MaxPods > ceiling {
+		return fmt.Errorf("maxPods %d exceeds the maximum of %d with network plugin %q (mode %q)", *nodeClass.Spec.MaxPods, ceiling, networkPlugin, networkPluginMode)
+	}
+	return nil
+}
+
+// validateSandboxRuntime checks that the sandbox runtime can be installed on the image family and architecture
+func validateSandboxRuntime(nodeClass *v1alpha2.AKSNodeClass, arch string) error {
+	sandboxRuntime := nodeClass.Spec.GetSandboxRuntime()
+	if sandboxRuntime == "" {
+		return nil
+	}
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)
+	if !lo.Contains(sandboxRuntimeSupport[sandboxRuntime][imageFamily], arch) {
+		return fmt.Errorf("sandbox runtime %q is not supported with image family %q on %s", sandboxRuntime, imageFamily, arch)
+	}
+	return nil
+}
+
+// validateDefaultRuntimeHandler checks that the default runtime handler can be overridden on the instance type;
+// GPU nodes run pods with the NVIDIA container runtime by default, for them to access the GPUs
+func validateDefaultRuntimeHandler(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	defaultHandler := nodeClass.Spec.GetDefaultRuntimeHandler()
+	if defaultHandler == "" || !isGPUNode(nodeClass, instanceType) {
+		return nil
+	}
+	return fmt.Errorf("default runtime handler %q is not supported on GPU instance type %s", defaultHandler, instanceType.Name)
+}
+
+// isGPUNode returns whether nodes of the instance type install GPU drivers with the image family of the AKSNodeClass
+func isGPUNode(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) bool {
+	isSupported, ok := gpuSKUSupport[lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)]
+	return ok && isSupported(instanceType.Name)
+}
+
+// getGPUImageSHA returns the tag of the aks-gpu image GPU drivers are installed from, which only Ubuntu nodes use;
+// AzureLinux nodes install the GPU drivers from the packages of the distribution
+func getGPUImageSHA(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) string {
+	if !isGPUNode(nodeClass, instanceType) || lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily) != v1alpha2.Ubuntu2204ImageFamily {
+		return ""
+	}
+	return utils.GetAKSGPUImageSHA(instanceType.Name)
+}
+
+// validateGPUInstanceType checks that nodes of the image family install the drivers of the GPUs of the instance type,
+// rather than launching GPU nodes whose GPUs are unusable
+func validateGPUInstanceType(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	if !(utils.IsNvidiaEnabledSKU(instanceType.Name) || utils.IsMarinerEnabledGPUSKU(instanceType.Name)) || isGPUNode(nodeClass, instanceType) {
+		return nil
+	}
+	return fmt.Errorf("GPU instance type %s is not supported with image family %q", instanceType.Name, lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily))
+}
+
+// getGPUDriverVersion returns the GPU driver version the AKSNodeClass selects, defaulting to the one of the instance type
+func getGPUDriverVersion(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) string {
+	if driverVersion := nodeClass.Spec.GetGPUDriverVersion(); driverVersion != "" {
+		return driverVersion
+	}
+	return utils.GetGPUDriverVersion(instanceType.Name)
+}
+
+// validateGPUDriverVersion checks that the GPU driver version the AKSNodeClass selects can be installed on GPU nodes of the
+// instance type: only Ubuntu nodes install drivers from the aks-gpu images, which carry each version, each instance type
+// only runs the GRID or the CUDA drivers, and the image generation is left to the instance type only when the driver supports all of its generations
+func validateGPUDriverVersion(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	driverVersion := nodeClass.Spec.GetGPUDriverVersion()
+	if driverVersion == "" || !isGPUNode(nodeClass, instanceType) {
+		return nil
+	}
+	if imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily); imageFamily != v1alpha2.Ubuntu2204ImageFamily {
+		return fmt.Errorf("gpu driver version %s is not supported with image family %q", driverVersion, imageFamily)
+	}
+	if !lo.Contains(utils.GetGPUDriverVersions(instanceType.Name), driverVersion) {
+		return fmt.Errorf("gpu driver version %s is not supported by instance type %s", driverVersion, instanceType.Name)
+	}
+	if nodeClass.Spec.GetImageHyperVGeneration() == "" &&
+		!lo.Every(utils.GetGPUDriverVersionHyperVGenerations(driverVersion), instanceType.Requirements.Get(v1alpha2.LabelSKUHyperVGeneration).Values()) {
+		return fmt.Errorf("gpu driver version %s does not support all image generations of instance type %s, imageGeneration must be set", driverVersion, instanceType.Name)
+	}
+	return nil
+}
+
+// validateGPUArchitecture checks that the aks-gpu image Ubuntu GPU nodes install the GPU driver from is published for the
+// architecture of the instance type, rather than launching arm64 GPU nodes without a driver
+func validateGPUArchitecture(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType, arch string) error {
+	if getGPUImageSHA(nodeClass, instanceType) == "" {
+		return nil
+	}
+	if driverVersion := getGPUDriverVersion(nodeClass, instanceType); !lo.Contains(utils.GetGPUDriverArchitectures(driverVersion), arch) {
+		return fmt.Errorf("no %s GPU driver image exists for GPU driver %s of instance type %s", arch, driverVersion, instanceType.Name)
+	}
+	return nil
+}
+
+// validateImageGeneration checks that both the instance type and the driver of its GPUs, if any, support the image generation
+// the AKSNodeClass forces
+func validateImageGeneration(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	generation := nodeClass.Spec.GetImageHyperVGeneration()
+	if generation == "" {
+		return nil
+	}
+	if !instanceType.Requirements.Get(v1alpha2.LabelSKUHyperVGeneration).Has(generation) {
+		return fmt.Errorf("imageGeneration %s is not supported by instance type %s", *nodeClass.Spec.ImageGeneration, instanceType.Name)
+	}
+	if driverVersion := getGPUDriverVersion(nodeClass, instanceType); isGPUNode(nodeClass, instanceType) &&
+		!lo.Contains(utils.GetGPUDriverVersionHyperVGenerations(driverVersion), generation) {
+		return fmt.Errorf("imageGeneration %s is not supported by GPU driver %s of instance type %s", *nodeClass.Spec.ImageGeneration,
+			driverVersion, instanceType.Name)
+	}
+	return nil
+}
+
+// validateSecurityProfile checks that the instance type supports the security features the AKSNodeClass requests, and that
+// Trusted Launch VMs boot Gen2 images, rather than failing to create the VM. Confidential VMs have secure boot and a vTPM of their own.
+func validateSecurityProfile(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	if nodeClass.Spec.IsTrustedLaunchEnabled() && !utils.IsConfidentialSKU(instanceType.Name) {
+		if !utils.IsTrustedLaunchSupported(instanceType) {
+			return fmt.Errorf("trusted launch is not supported by instance type %s", instanceType.Name)
+		}
+		if nodeClass.Spec.GetImageHyperVGeneration() == v1alpha2.HyperVGenerationV1 {
+			return fmt.Errorf("trusted launch is not supported with imageGeneration %s", *nodeClass.Spec.ImageGeneration)
+		}
+	}
+	if nodeClass.Spec.IsEncryptionAtHostEnabled() && !utils.IsEncryptionAtHostSupported(instanceType) {
+		return fmt.Errorf("encryption at host is not supported by instance type %s", instanceType.Name)
+	}
+	return nil
+}
+
+// validateMIGProfile checks that the GPUs of the instance type can be partitioned with the Multi-Instance GPU profile
+func validateMIGProfile(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	migProfile := nodeClass.Spec.GetGPUMIGProfile()
+	if migProfile == "" {
+		return nil
+	}
+	supported := utils.GetMIGProfiles(instanceType.Name)
+	if len(supported) == 0 {
+		return fmt.Errorf("gpu migProfile %q is not supported on instance type %s, which is not MIG-capable", migProfile, instanceType.Name)
+	}
+	if !lo.Contains(supported, migProfile) {
+		return fmt.Errorf("gpu migProfile %q is not supported on instance type %s, only %s", migProfile, instanceType.Name, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// validateLocalStorage checks that the instance type has local NVMe disks to mount
+func validateLocalStorage(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) error {
+	if nodeClass.Spec.GetLocalStorageDiscoveryPath() == "" || utils.GetLocalNVMeDiskCount(instanceType.Name) > 0 {
+		return nil
+	}
+	return fmt.Errorf("localStorage is not supported on instance type %s, which has no local NVMe disks", instanceType.Name)
+}
+
+// validateEntropySource checks that the entropy source can be installed on the image family
+func validateEntropySource(nodeClass *v1alpha2.AKSNodeClass) error {
+	entropySource := nodeClass.Spec.GetEntropySource()
+	if entropySource == "" {
+		return nil
+	}
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)
+	if !lo.Contains(entropySourceSupport[entropySource], imageFamily) {
+		return fmt.Errorf("entropy source %q is not supported with image family %q", entropySource, imageFamily)
+	}
+	return nil
+}
+
+// validateTCPCongestionControl checks that the kernel of the image family ships the TCP congestion control algorithm
+func validateTCPCongestionControl(nodeClass *v1alpha2.AKSNodeClass) error {
+	algorithm := nodeClass.Spec.GetTCPCongestionControl()
+	if algorithm == "" {
+		return nil
+	}
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)
+	if !lo.Contains(tcpCongestionControlSupport[algorithm], imageFamily) {
+		return fmt.Errorf("tcp congestion control %q is not supported with image family %q", algorithm, imageFamily)
+	}
+	return nil
+}
+
+// validateDNSStubListener checks that nodes of the image family can resolve names without the systemd-resolved stub listener
+func validateDNSStubListener(nodeClass *v1alpha2.AKSNodeClass) error {
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)
+	if !nodeClass.Spec.IsDNSStubListenerDisabled() || lo.Contains(dnsStubListenerOptionalImageFamilies, imageFamily) {
+		return nil
+	}
+	return fmt.Errorf("disabling the DNS stub listener is not supported with image family %q", imageFamily)
+}
+
+// validateSwapAccounting checks that the image family runs cgroup v2, which the nodes' systemd cgroup driver
+// and containerd configuration rely on for memory+swap accounting
+func validateSwapAccounting(nodeClass *v1alpha2.AKSNodeClass) error {
+	if !nodeClass.Spec.IsSwapAccountingEnabled() {
+		return nil
+	}
+	imageFamily := lo.FromPtrOr(nodeClass.Spec.ImageFamily, v1alpha2.Ubuntu2204ImageFamily)
+	if !lo.Contains(cgroupV2ImageFamilies, imageFamily) {
+		return fmt.Errorf("swap accounting requires cgroup v2, which image family %q does not use", imageFamily)
+	}
+	return nil
+}
+
+// getKubeletIdentityClientID returns the client ID of the identity the kubelet uses: the NodeClass kubelet identity if set,
+// which must be assigned to the VM through the node identities, otherwise the default kubelet identity
+func (p *Provider) getKubeletIdentityClientID(nodeClass *v1alpha2.AKSNodeClass, nodeIdentities []string) (string, error) {
+	kubeletIdentity := nodeClass.Spec.KubeletIdentity
+	if kubeletIdentity == nil {
+		return p.userAssignedIdentityID, nil
+	}
+	resourceID, err := arm.ParseResourceID(kubeletIdentity.ResourceID)
+	if err != nil || !strings.EqualFold(resourceID.ResourceType.String(), userAssignedIdentityResourceType) {
+		return "", fmt.Errorf("kubelet identity resource ID %q is not a user-assigned identity", kubeletIdentity.ResourceID)
+	}
+	if !lo.ContainsBy(nodeIdentities, func(nodeIdentity string) bool { return strings.EqualFold(nodeIdentity, kubeletIdentity.ResourceID) }) {
+		return "", fmt.Errorf("kubelet identity %q is not one of the node identities assigned to instances", kubeletIdentity.ResourceID)
+	}
+	return kubeletIdentity.ClientID, nil
+}
+
+// getNetworkProfileSysctls returns the sysctls of the network profile with the overrides applied
+func getNetworkProfileSysctls(nodeClass *v1alpha2.AKSNodeClass) (map[string]string, error) {
+	networkProfile := nodeClass.Spec.NetworkProfile
+	if networkProfile == nil {
+		return nil, nil
+	}
+	profileSysctls, ok := networkProfiles[networkProfile.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network profile %q", networkProfile.Name)
+	}
+	sysctls := lo.Assign(profileSysctls)
+	if networkProfile.CoreRMemMax != nil {
+		sysctls["net.core.rmem_max"] = fmt.Sprint(*networkProfile.CoreRMemMax)
+	}
+	if networkProfile.CoreWMemMax != nil {
+		sysctls["net.core.wmem_max"] = fmt.Sprint(*networkProfile.CoreWMemMax)
+	}
+	if networkProfile.NetdevMaxBacklog != nil {
+		sysctls["net.core.netdev_max_backlog"] = fmt.Sprint(*networkProfile.NetdevMaxBacklog)
+	}
+	for key, value := range map[string]*string{"net.ipv4.tcp_rmem": networkProfile.TCPRMem, "net.ipv4.tcp_wmem": networkProfile.TCPWMem} {
+		if value == nil {
+			continue
+		}
+		if err := validateTCPMem(*value); err != nil {
+			return nil, fmt.Errorf("invalid %s override %q, %w", key, *value, err)
+		}
+		sysctls[key] = *value
+	}
+	return sysctls, nil
+}
+
+// validateTCPMem checks a "min default max" TCP buffer size triple is ordered
+func validateTCPMem(value string) error {
+	var minimum, defaultValue, maximum int64
+	if _, err := fmt.Sscanf(value, "%d %d %d", &minimum, &defaultValue, &maximum); err != nil {
+		return fmt.Errorf("expected \"min default max\" sizes in bytes")
+	}
+	if minimum <= 0 || minimum > defaultValue || defaultValue > maximum {
+		return fmt.Errorf("expected 0 < min <= default <= max")
+	}
+	return nil
+}
+
+// getConntrackMax returns the configured conntrack table size, defaulting to one scaled by the instance type memory
+func getConntrackMax(nodeClass *v1alpha2.AKSNodeClass, instanceType *cloudprovider.InstanceType) int32 {
+	if conntrackMax := nodeClass.Spec.GetConntrackMax(); conntrackMax != nil {
+		return *conntrackMax
+	}
+	memoryMiB := instanceType.Capacity.Memory().Value() / (1024 * 1024)
+	return int32(lo.Clamp(memoryMiB*conntrackEntriesPerMiB, minDefaultConntrackMax, maxDefaultConntrackMax))
+}
+
+// getCABundle returns the CA bundle override if set, otherwise the cluster CA bundle,
+// re-resolving it once the cached value expires
+func (p *Provider) getCABundle() (*string, error) {
+	if p.caBundle != nil {
+		return p.caBundle, nil
+	}
+	if caBundle, ok := p.caBundleCache.Get(caBundleCacheKey); ok {
+		return caBundle.(*string), nil
+	}
+	if p.caBundleResolver == nil {
+		return nil, fmt.Errorf("resolving caBundle, no resolver configured")
+	}
+	caBundle, err := p.caBundleResolver()
+	if err != nil {
+		return nil, err
+	}
+	p.caBundleCache.SetDefault(caBundleCacheKey, caBundle)
+	return caBundle, nil
+}
+
+func (p *Provider) createLaunchTemplate(ctx context.Context, params *parameters.Parameters, nodeClaim *corev1beta1.NodeClaim) (*Template, error) {
 	// render user data
-	userData, err := options.UserData.Script()
+	userData, err := params.UserData.Script()
 	if err != nil {
 		return nil, err
 	}
 
-	// merge and convert to ARM tags
-	azureTags := mergeTags(options.Tags, map[string]string{karpenterManagedTagKey: options.ClusterName})
+	// resolve the references of tag values to the nodeClaim, then merge and convert to ARM tags,
+	// with the tags of the AKSNodeClass taking precedence over the requirement tags
+	tags, err := resolveTagTemplates(params.Tags, nodeClaim)
+	if err != nil {
+		return nil, err
+	}
+	azureTags := mergeTags(getTagKeySanitizer(ctx), params.RequirementTags, tags, getNodeClaimTags(ctx, nodeClaim), getManagedTags(ctx))
+	if err := validateTags(azureTags); err != nil {
+		return nil, err
+	}
 	template := &Template{
-		UserData: userData,
-		ImageID:  options.ImageID,
-		Tags:     azureTags,
+		UserData:    userData,
+		ImageID:     params.ImageID,
+		Tags:        azureTags,
+		SubnetID:    params.SubnetID,
+		Labels:      params.Labels,
+		Annotations: params.Annotations,
+
+		ProximityPlacementGroupID: params.ProximityPlacementGroupID,
+
+		AcceleratedNetworking:    params.AcceleratedNetworking,
+		EphemeralOSDisk:          params.EphemeralOSDisk,
+		EphemeralOSDiskPlacement: params.EphemeralOSDiskPlacement,
+		NodeIdentities:           params.NodeIdentities,
+		SystemAssignedIdentity:   params.SystemAssignedIdentity,
+		Spot:                     params.Spot,
+		KubernetesVersion:        params.KubernetesVersion,
+		Provenance:               getProvenance(ctx),
+
+		BootDiagnostics:           params.BootDiagnostics,
+		BootDiagnosticsStorageURI: params.BootDiagnosticsStorageURI,
+	}
+	if params.SecureBoot || params.VTPM || params.EncryptionAtHost || params.ConfidentialVM {
+		template.SecurityProfile = &SecurityProfile{
+			TrustedLaunch:    !params.ConfidentialVM && (params.SecureBoot || params.VTPM),
+			ConfidentialVM:   params.ConfidentialVM,
+			SecureBoot:       params.SecureBoot,
+			VTPM:             params.VTPM || params.ConfidentialVM,
+			EncryptionAtHost: params.EncryptionAtHost,
+		}
 	}
 	return template, nil
 }
 
-// MergeTags takes a variadic list of maps and merges them together
-// with format acceptable to ARM (no / in keys, pointer to strings as values)
-func mergeTags(tags ...map[string]string) (result map[string]*string) {
-	return lo.MapEntries(lo.Assign(tags...), func(key string, value string) (string, *string) {
-		return strings.ReplaceAll(key, "/", "_"), to.StringPtr(value)
+// ResolveTags returns the ARM tags VMs of the AKSNodeClass are stamped with, the AKSNodeClass tags and the tags managed
+// by Karpenter, e.g. to validate them against Azure Policy ahead of provisioning. Tags which depend on the nodeClaim
+// (the requirement tags, and the NodeClaim and NodePool tags) are added on top of them when launching, and references of tag values
+// to the nodeClaim are left unresolved.
+func (p *Provider) ResolveTags(ctx context.Context, nodeClass *v1alpha2.AKSNodeClass) (map[string]*string, error) {
+	if err := nodeClass.Validate(); err != nil {
+		return nil, fmt.Errorf("validating AKSNodeClass %s, %w", nodeClass.Name, err)
+	}
+	azureTags := mergeTags(getTagKeySanitizer(ctx), nodeClass.Spec.Tags, getManagedTags(ctx))
+	if err := validateTags(azureTags); err != nil {
+		return nil, err
+	}
+	return azureTags, nil
+}
+
+// getManagedTags returns the tags Karpenter manages on every VM
+func getManagedTags(ctx context.Context) map[string]string {
+	if options.FromContext(ctx).DisableManagedClusterTag {
+		return map[string]string{}
+	}
+	return map[string]string{karpenterManagedTagKey: options.FromContext(ctx).ClusterName}
+}
+
+// getNodeClaimTags returns tags with the names of the nodeClaim and its NodePool, to trace VMs back to them,
+// unless disabled by the nodeclaim-tags option
+func getNodeClaimTags(ctx context.Context, nodeClaim *corev1beta1.NodeClaim) map[string]string {
+	tags := map[string]string{}
+	if !options.FromContext(ctx).NodeClaimTags {
+		return tags
+	}
+	if nodeClaim.Name != "" {
+		tags[nodeClaimTagKey] = sanitizeTagValue(nodeClaim.Name)
+	}
+	if nodePool := nodeClaim.Labels[corev1beta1.NodePoolLabelKey]; nodePool != "" {
+		tags[corev1beta1.NodePoolLabelKey] = sanitizeTagValue(nodePool)
+	}
+	return tags
+}
+
+// sanitizeTagValue truncates values longer than ARM allows
+func sanitizeTagValue(value string) string {
+	if len(value) > maxTagValueLength {
+		return value[:maxTagValueLength]
+	}
+	return value
+}
+
+// resolveTagTemplates replaces the references of tag values to the metadata of the nodeClaim, validated with the AKSNodeClass,
+// with their values; referencing a label or annotation the nodeClaim does not have is an error, rather than an empty tag value
+func resolveTagTemplates(tags map[string]string, nodeClaim *corev1beta1.NodeClaim) (map[string]string, error) {
+	resolved := make(map[string]string, len(tags))
+	for key, value := range tags {
+		var errs error
+		resolved[key] = v1alpha2.TagTemplateReferenceRegex.ReplaceAllStringFunc(value, func(reference string) string {
+			match := v1alpha2.TagTemplateReferenceRegex.FindStringSubmatch(reference)
+			if match[1] == "Name" {
+				return nodeClaim.Name
+			}
+			metadata, kind := nodeClaim.Labels, "label"
+			if match[1] == "Annotations" {
+				metadata, kind = nodeClaim.Annotations, "annotation"
+			}
+			metadataValue, ok := metadata[match[2]]
+			if !ok {
+				errs = multierr.Append(errs, fmt.Errorf("tag %q references %s %q, which nodeClaim %s does not have", key, kind, match[2], nodeClaim.Name))
+			}
+			return metadataValue
+		})
+		if errs != nil {
+			return nil, errs
+		}
+	}
+	return resolved, nil
+}
+
+// resolveHostnameTemplate replaces the references of the hostname template of the AKSNodeClass, validated with it, to the nodeClaim
+// and instance type with their values, leaving those to the zone, which is resolved at boot, as bootstrap.HostnameZoneReference.
+// Zone numbers are single digits, so the hostname is checked to be a valid RFC 1123 label with zone 0.
+func resolveHostnameTemplate(nodeClass *v1alpha2.AKSNodeClass, nodeClaim *corev1beta1.NodeClaim, instanceType *cloudprovider.InstanceType) (string, error) {
+	if nodeClass.Spec.HostnameTemplate == nil {
+		return "", nil
+	}
+	var errs error
+	hostname := v1alpha2.HostnameTemplateReferenceRegex.ReplaceAllStringFunc(*nodeClass.Spec.HostnameTemplate, func(reference string) string {
+		match := v1alpha2.HostnameTemplateReferenceRegex.FindStringSubmatch(reference)
+		switch match[1] {
+		case "NodeClaim.Name":
+			return nodeClaim.Name
+		case "InstanceType":
+			return strings.ReplaceAll(strings.ToLower(instanceType.Name), "_", "-")
+		case "Zone":
+			return bootstrap.HostnameZoneReference
+		}
+		value, ok := nodeClaim.Labels[match[2]]
+		if !ok {
+			errs = multierr.Append(errs, fmt.Errorf("hostnameTemplate references label %q, which nodeClaim %s does not have", match[2], nodeClaim.Name))
+		}
+		return value
 	})
+	if errs != nil {
+		return "", errs
+	}
+	if msgs := validation.IsDNS1123Label(strings.ReplaceAll(hostname, bootstrap.HostnameZoneReference, "0")); len(msgs) > 0 {
+		return "", fmt.Errorf("hostnameTemplate %q resolves to %q, which is not a valid RFC 1123 label, %s",
+			*nodeClass.Spec.HostnameTemplate, hostname, strings.Join(msgs, "; "))
+	}
+	return hostname, nil
+}
+
+// validateZoneAvailability checks the instance type is offered in one of the zones a zone-pinned nodeClaim requires, with a capacity
+// type it allows, by the SKU availability of its offerings, for the VM not to fail to be created later. Images are replicated
+// to regions rather than zones, so the image resolved for the instance type is available in every zone the SKU is offered in.
+// Instance types without offerings, whose availability is unknown, are not checked.
+func validateZoneAvailability(nodeClaim *corev1beta1.NodeClaim, instanceType *cloudprovider.InstanceType, imageID string) error {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+	zones := requirements.Get(v1.LabelTopologyZone)
+	if zones.Operator() != v1.NodeSelectorOpIn || len(instanceType.Offerings) == 0 {
+		return nil
+	}
+	if len(instanceType.Offerings.Available().Compatible(requirements)) > 0 {
+		return nil
+	}
+	requested := zones.Values()
+	sort.Strings(requested)
+	capacityTypes := requirements.Get(corev1beta1.CapacityTypeLabelKey)
+	available := lo.Uniq(lo.FilterMap(instanceType.Offerings.Available(), func(offering cloudprovider.Offering, _ int) (string, bool) {
+		return offering.Zone, offering.Zone != "" && capacityTypes.Has(offering.CapacityType)
+	}))
+	sort.Strings(available)
+	return fmt.Errorf("instance type %s with image %s is not offered in zones [%s] nodeClaim %s is pinned to, only in zones [%s]",
+		instanceType.Name, imageID, strings.Join(requested, ","), nodeClaim.Name, strings.Join(available, ","))
+}
+
+// TagKeySanitizer turns keys, such as the label keys of requirement tags, into tag keys ARM accepts
+type TagKeySanitizer func(key string) string
+
+// NewTagKeySanitizer returns a TagKeySanitizer replacing the characters ARM does not allow in tag keys with the separator,
+// which must not contain any of them, and prepending the prefix
+func NewTagKeySanitizer(separator, prefix string) TagKeySanitizer {
+	replacer := strings.NewReplacer(lo.FlatMap(strings.Split(invalidTagKeyRunes, ""), func(r string, _ int) []string {
+		return []string{r, separator}
+	})...)
+	return func(key string) string {
+		return prefix + replacer.Replace(key)
+	}
+}
+
+// DefaultTagKeySanitizer replaces the / of keys with _, the default of the tag-key-separator option
+var DefaultTagKeySanitizer = NewTagKeySanitizer("_", "")
+
+// discoveryTagKeys are the keys of the tags Karpenter discovers VMs by, which are sanitized by DefaultTagKeySanitizer
+// so that VMs are discovered regardless of the tag key sanitizer they were launched with
+var discoveryTagKeys = sets.New(karpenterManagedTagKey, corev1beta1.NodePoolLabelKey)
+
+// getTagKeySanitizer returns the TagKeySanitizer of the tag-key-separator and tag-key-prefix options
+func getTagKeySanitizer(ctx context.Context) TagKeySanitizer {
+	return NewTagKeySanitizer(options.FromContext(ctx).TagKeySeparator, options.FromContext(ctx).TagKeyPrefix)
+}
+
+// mergeTags takes a variadic list of maps and merges them together with format acceptable to ARM
+// (keys sanitized by sanitize, pointer to strings as values). Maps are merged in order, so that of keys sanitized to the same
+// ARM key, those of later maps win; within a map, the last one in sort order wins, on every run.
+func mergeTags(sanitize TagKeySanitizer, tags ...map[string]string) (result map[string]*string) {
+	result = map[string]*string{}
+	for _, t := range tags {
+		keys := lo.Keys(t)
+		sort.Strings(keys)
+		for _, key := range keys {
+			armKey := lo.Ternary(discoveryTagKeys.Has(key), DefaultTagKeySanitizer, sanitize)(key)
+			result[armKey] = to.StringPtr(t[key])
+		}
+	}
+	return result
 }
 
-func (p *Provider) getVnetInfoLabels(ctx context.Context, _ *v1alpha2.AKSNodeClass) (map[string]string, error) {
-	// TODO(bsoghigian): this should be refactored to lo.Ternary(nodeClass.Spec.VnetSubnetID != nil, lo.FromPtr(nodeClass.Spec.VnetSubnetID), os.Getenv("AZURE_SUBNET_ID")) when we add VnetSubnetID to the nodeclass
-	vnetSubnetComponents, err := utils.GetVnetSubnetIDComponents(options.FromContext(ctx).SubnetID)
+// ARMTagsToMap converts ARM tags, such as those of an existing VM, back to a plain map, with nil values as empty strings.
+// The / to _ sanitization of mergeTags is not reversible, so compare the result against tags passed through mergeTags.
+func ARMTagsToMap(tags map[string]*string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for key, value := range tags {
+		result[key] = lo.FromPtr(value)
+	}
+	return result
+}
+
+// getRequirementTags returns tags with the values of the nodeClaim requirements selected by the requirement-tags option,
+// e.g. the capacity types, architectures and zones a VM was provisioned for, keyed by the requirement key.
+// Requirements without values are not tagged.
+func getRequirementTags(ctx context.Context, nodeClaim *corev1beta1.NodeClaim) map[string]string {
+	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
+	tags := map[string]string{}
+	for _, key := range options.FromContext(ctx).RequirementTags {
+		if !requirements.Has(key) || requirements.Get(key).Operator() != v1.NodeSelectorOpIn {
+			continue
+		}
+		values := requirements.Get(key).Values()
+		sort.Strings(values)
+		tags[key] = strings.Join(values, ",")
+	}
+	return tags
+}
+
+// validateTags checks the ARM tags are within the limits of ARM, which would otherwise reject the VM
+func validateTags(tags map[string]*string) error {
+	if len(tags) > maxTemplateTags {
+		return fmt.Errorf("%d tags are more than the maximum of %d", len(tags), maxTemplateTags)
+	}
+	for key, value := range tags {
+		if len(key) > maxTagKeyLength {
+			return fmt.Errorf("tag key %q is longer than %d characters", key, maxTagKeyLength)
+		}
+		if len(lo.FromPtr(value)) > maxTagValueLength {
+			return fmt.Errorf("value of tag %q is longer than %d characters", key, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// getVnetInfoLabels returns the vnet labels expected on nodes in Azure CNI clusters, and none for kubenet,
+// which does not use them. For other network plugins (e.g. bring your own CNI) the labels are best effort:
+// if they cannot be resolved the node is launched without them, since nothing on the node requires them.
+// Without a subnet configured they are skipped, unless the cluster uses Azure CNI Overlay.
+func (p *Provider) getVnetInfoLabels(ctx context.Context, subnetID string) (map[string]string, error) {
+	networkPlugin := options.FromContext(ctx).NetworkPlugin
+	if networkPlugin == networkPluginKubenet {
+		return map[string]string{}, nil
+	}
+	if subnetID == "" && !isAzureCNIOverlay(ctx) {
+		return map[string]string{}, nil
+	}
+	vnetLabels, err := p.resolveVnetInfoLabels(ctx, subnetID)
+	if err != nil {
+		if networkPlugin == networkPluginAzure {
+			return nil, fmt.Errorf("resolving vnet labels required by %s, %w", lo.Ternary(isAzureCNIOverlay(ctx), "Azure CNI Overlay", "Azure CNI"), err)
+		}
+		logging.FromContext(ctx).Warnf("launching nodes without vnet labels, resolving them for network plugin %q failed, %s", networkPlugin, err)
+		return map[string]string{}, nil
+	}
+	return vnetLabels, nil
+}
+
+// isAzureCNIOverlay is whether pods get their IPs from the overlay rather than the node subnet
+func isAzureCNIOverlay(ctx context.Context) bool {
+	return options.FromContext(ctx).NetworkPlugin == networkPluginAzure && options.FromContext(ctx).NetworkPluginMode == options.NetworkPluginModeOverlay
+}
+
+// resolveVnetInfoLabels omits the vnet GUID label when the GUID of the vnet is unknown, rather than labeling nodes
+// with an empty GUID, which CNI components may treat as invalid. The pod network type label is only that of
+// Azure CNI Overlay, pods of other network plugins and modes are in the node subnet.
+func (p *Provider) resolveVnetInfoLabels(ctx context.Context, subnetID string) (map[string]string, error) {
+	vnetSubnetComponents, err := utils.GetVnetSubnetIDComponents(subnetID)
 	if err != nil {
 		return nil, err
 	}
 	vnetLabels := map[string]string{
-		vnetSubnetNameLabel:     vnetSubnetComponents.SubnetName,
-		vnetGUIDLabel:           p.vnetGUID,
-		vnetPodNetworkTypeLabel: networkModeOverlay,
+		vnetSubnetNameLabel: vnetSubnetComponents.SubnetName,
+	}
+	if isAzureCNIOverlay(ctx) {
+		vnetLabels[vnetPodNetworkTypeLabel] = networkModeOverlay
+	}
+	if p.vnetGUID == "" {
+		logging.FromContext(ctx).Warnf("launching nodes without the %s label, the GUID of vnet %q is unknown", vnetGUIDLabel, vnetSubnetComponents.VNetName)
+	} else {
+		vnetLabels[vnetGUIDLabel] = p.vnetGUID
 	}
 	return vnetLabels, nil
 }
@@ -0,0 +1,2261 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/logging"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/metrics"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily"
+	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	testSubnetID     = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Network/virtualNetworks/aks-vnet-12345678/subnets/aks-subnet"
+	testImageVersion = "202405.27.0"
+)
+
+// testImageVersionsAPI lists the same image versions for every community gallery image
+type testImageVersionsAPI []string
+
+func (versions testImageVersionsAPI) NewListPager(_ string, _ string, _ string, _ *armcompute.CommunityGalleryImageVersionsClientListOptions) *runtime.Pager[armcompute.CommunityGalleryImageVersionsClientListResponse] {
+	return runtime.NewPager(runtime.PagingHandler[armcompute.CommunityGalleryImageVersionsClientListResponse]{
+		More: func(armcompute.CommunityGalleryImageVersionsClientListResponse) bool { return false },
+		Fetcher: func(context.Context, *armcompute.CommunityGalleryImageVersionsClientListResponse) (armcompute.CommunityGalleryImageVersionsClientListResponse, error) {
+			return armcompute.CommunityGalleryImageVersionsClientListResponse{
+				CommunityGalleryImageVersionList: armcompute.CommunityGalleryImageVersionList{
+					Value: lo.Map(versions, func(name string, _ int) *armcompute.CommunityGalleryImageVersion {
+						return &armcompute.CommunityGalleryImageVersion{
+							Name:       lo.ToPtr(name),
+							Properties: &armcompute.CommunityGalleryImageVersionProperties{PublishedDate: lo.ToPtr(time.Now())},
+						}
+					}),
+				},
+			}, nil
+		},
+	})
+}
+
+// testKubernetesInterface serves the API server version, the only API the image provider calls
+type testKubernetesInterface struct {
+	kubernetes.Interface
+	discovery *testDiscovery
+}
+
+func newTestKubernetesInterface(serverVersion *version.Info, err error) *testKubernetesInterface {
+	return &testKubernetesInterface{discovery: &testDiscovery{serverVersion: serverVersion, err: err}}
+}
+
+func (k *testKubernetesInterface) Discovery() discovery.DiscoveryInterface {
+	return k.discovery
+}
+
+type testDiscovery struct {
+	discovery.DiscoveryInterface
+	serverVersion *version.Info
+	err           error
+	lookups       int
+}
+
+func (d *testDiscovery) ServerVersion() (*version.Info, error) {
+	d.lookups++
+	return d.serverVersion, d.err
+}
+
+func newTestProvider(caBundle *string, caBundleResolver CABundleResolver, caBundleTTL time.Duration) *Provider {
+	kubernetesInterface := newTestKubernetesInterface(&version.Info{GitVersion: "v1.30.0"}, nil)
+	// image versions are pinned on the test AKSNodeClass
+	imageProvider := imagefamily.NewProvider(kubernetesInterface, cache.New(time.Minute, time.Minute), testImageVersionsAPI{testImageVersion}, nil, "eastus")
+	return NewProvider(context.Background(), imagefamily.New(nil, imageProvider), imageProvider, caBundle, caBundleResolver, cache.New(caBundleTTL, time.Minute), nil, cache.New(time.Minute, time.Minute),
+		nil, cache.New(time.Minute, time.Minute),
+		"https://test-cluster.hcp.eastus.azmk8s.io:443", "test-tenant", "test-subscription", "test-userAssignedIdentity",
+		"test-resourceGroup", "eastus", "test-vnet-guid")
+}
+
+func TestValidate(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	assert.NoError(t, newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute).Validate(ctx))
+
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.subscriptionID = ""
+	assert.EqualError(t, p.Validate(ctx), "missing subscription ID")
+	p.tenantID = ""
+	assert.EqualError(t, p.Validate(ctx), "missing tenant ID; missing subscription ID")
+}
+
+func TestValidateKubeServerVersion(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	kubernetesInterface := newTestKubernetesInterface(nil, fmt.Errorf("connection refused"))
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.imageProvider = imagefamily.NewProvider(kubernetesInterface, cache.New(time.Minute, time.Minute), testImageVersionsAPI{testImageVersion}, nil, "eastus")
+	assert.ErrorContains(t, p.Validate(ctx), "discovering kubernetes version")
+}
+
+func TestGetCABundleOverride(t *testing.T) {
+	calls := 0
+	p := newTestProvider(lo.ToPtr("override"), func() (*string, error) {
+		calls++
+		return lo.ToPtr("resolved"), nil
+	}, time.Minute)
+
+	caBundle, err := p.getCABundle()
+	assert.NoError(t, err)
+	assert.Equal(t, "override", lo.FromPtr(caBundle))
+	assert.Equal(t, 0, calls)
+}
+
+func TestGetCABundleCached(t *testing.T) {
+	calls := 0
+	p := newTestProvider(nil, func() (*string, error) {
+		calls++
+		return lo.ToPtr(fmt.Sprintf("ca-bundle-%d", calls)), nil
+	}, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		caBundle, err := p.getCABundle()
+		assert.NoError(t, err)
+		assert.Equal(t, "ca-bundle-1", lo.FromPtr(caBundle))
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetCABundleRefreshedAfterTTL(t *testing.T) {
+	calls := 0
+	p := newTestProvider(nil, func() (*string, error) {
+		calls++
+		return lo.ToPtr(fmt.Sprintf("ca-bundle-%d", calls)), nil
+	}, 50*time.Millisecond)
+
+	caBundle, err := p.getCABundle()
+	assert.NoError(t, err)
+	assert.Equal(t, "ca-bundle-1", lo.FromPtr(caBundle))
+
+	time.Sleep(100 * time.Millisecond)
+
+	caBundle, err = p.getCABundle()
+	assert.NoError(t, err)
+	assert.Equal(t, "ca-bundle-2", lo.FromPtr(caBundle))
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetCABundleResolverError(t *testing.T) {
+	calls := 0
+	p := newTestProvider(nil, func() (*string, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("transient failure")
+		}
+		return lo.ToPtr("ca-bundle"), nil
+	}, time.Minute)
+
+	_, err := p.getCABundle()
+	assert.Error(t, err)
+
+	// errors are not cached
+	caBundle, err := p.getCABundle()
+	assert.NoError(t, err)
+	assert.Equal(t, "ca-bundle", lo.FromPtr(caBundle))
+}
+
+func newTestContext(subnetID string) (context.Context, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+	return options.ToContext(ctx, &options.Options{
+		ClusterName:        "test-cluster",
+		ClusterEndpoint:    "https://test-cluster.hcp.eastus.azmk8s.io:443",
+		ClusterID:          "test-cluster-id",
+		NetworkPlugin:      "azure",
+		NetworkPluginMode:  options.NetworkPluginModeOverlay,
+		SubnetID:           subnetID,
+		DefaultImageFamily: v1alpha2.Ubuntu2204ImageFamily,
+		NodeClaimTags:      true,
+		TagKeySeparator:    "_",
+	}), logs
+}
+
+func newTestNodeClass() *v1alpha2.AKSNodeClass {
+	return &v1alpha2.AKSNodeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-nodeclass"},
+		Spec: v1alpha2.AKSNodeClassSpec{
+			ImageFamily:  lo.ToPtr(v1alpha2.Ubuntu2204ImageFamily),
+			ImageVersion: lo.ToPtr(testImageVersion),
+		},
+	}
+}
+
+func newTestInstanceType() *cloudprovider.InstanceType {
+	return &cloudprovider.InstanceType{
+		Name: "Standard_D2s_v3",
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureAmd64),
+			scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV2),
+		),
+		Overhead: &cloudprovider.InstanceTypeOverhead{
+			EvictionThreshold: v1.ResourceList{v1.ResourceMemory: resource.MustParse("100Mi")},
+		},
+	}
+}
+
+func TestGetTemplateLogsCompletion(t *testing.T) {
+	ctx, logs := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+
+	entries := logs.FilterMessage("generated launch template").All()
+	assert.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "test-nodeclass", fields["aksnodeclass"])
+	assert.Equal(t, "Standard_D2s_v3", fields["instance-type"])
+	assert.Equal(t, corev1beta1.ArchitectureAmd64, fields["arch"])
+	assert.Equal(t, template.ImageID, fields["image-id"])
+	assert.EqualValues(t, len(template.UserData), fields["user-data-size"])
+	for _, step := range []string{stepStaticParameters, stepKubeServerVersion, stepResolve, stepUserData} {
+		assert.Contains(t, fields, step+"-duration")
+	}
+}
+
+func TestGetTemplateDefaultImageFamily(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).DefaultImageFamily = v1alpha2.AzureLinuxImageFamily
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ImageFamily = nil
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.AzureLinuxGen2CommunityImage+"/")
+	// the AKSNodeClass is not modified
+	assert.Nil(t, nodeClass.Spec.ImageFamily)
+
+	// an image family of the AKSNodeClass overrides the default
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen2CommunityImage+"/")
+}
+
+func TestGetTemplateKubernetesVersion(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	// the fake API server reports v1.30.0
+	assert.Equal(t, "1.30.0", template.KubernetesVersion)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "KUBERNETES_VERSION=1.30.0")
+}
+
+func TestGetTemplateLogsFailingStep(t *testing.T) {
+	ctx, logs := newTestContext("invalid-subnet-id")
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.Error(t, err)
+
+	entries := logs.FilterMessageSnippet("failed generating launch template").All()
+	assert.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, stepStaticParameters, fields["step"])
+	assert.Equal(t, "test-nodeclass", fields["aksnodeclass"])
+	assert.Equal(t, "Standard_D2s_v3", fields["instance-type"])
+}
+
+func TestGetTemplates(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	kubernetesInterface := newTestKubernetesInterface(&version.Info{GitVersion: "v1.30.0"}, nil)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	// the Kubernetes version is not cached, for every lookup to reach the API server
+	p.imageProvider = imagefamily.NewProvider(kubernetesInterface, cache.New(time.Nanosecond, time.Minute), testImageVersionsAPI{testImageVersion}, nil, "eastus")
+	p.imageFamily = imagefamily.New(nil, p.imageProvider)
+	versionLookups := func() int { return kubernetesInterface.discovery.lookups }
+	arm64InstanceType := newTestInstanceType()
+	arm64InstanceType.Name = "Standard_D2ps_v5"
+	arm64InstanceType.Requirements[v1.LabelArchStable] = scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureArm64)
+	gpuInstanceType := newTestInstanceType()
+	gpuInstanceType.Name = "Standard_NC6s_v3"
+	instanceTypes := []*cloudprovider.InstanceType{newTestInstanceType(), arm64InstanceType, gpuInstanceType}
+	nodeClaim := &corev1beta1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "a"}}}
+
+	templates, err := p.GetTemplates(ctx, newTestNodeClass(), nodeClaim, instanceTypes, map[string]string{"pool": "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, versionLookups())
+	assert.Len(t, templates, len(instanceTypes))
+
+	// each template is that of the instance type on its own
+	for _, instanceType := range instanceTypes {
+		template, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, instanceType, map[string]string{"pool": "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, template, templates[instanceType.Name], instanceType.Name)
+	}
+	assert.Equal(t, 1+len(instanceTypes), versionLookups())
+	assert.NotEqual(t, templates[newTestInstanceType().Name].ImageID, templates[arm64InstanceType.Name].ImageID)
+	assert.NotEqual(t, templates[newTestInstanceType().Name].UserData, templates[gpuInstanceType.Name].UserData)
+
+	// instance types the AKSNodeClass can't be launched on fail the batch
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.GPU = &v1alpha2.GPU{DriverVersion: lo.ToPtr(v1alpha2.GPUDriverVersionGRID535)}
+	_, err = p.GetTemplates(ctx, nodeClass, nodeClaim, instanceTypes, nil)
+	assert.ErrorContains(t, err, "instance type Standard_NC6s_v3, gpu driver version")
+}
+
+func TestGetConntrackMax(t *testing.T) {
+	tests := []struct {
+		name      string
+		conntrack *v1alpha2.Conntrack
+		memory    string
+		expected  int32
+	}{
+		{name: "scaled by memory", memory: "16Gi", expected: 16 * 1024 * conntrackEntriesPerMiB},
+		{name: "small instance uses minimum", memory: "1Gi", expected: minDefaultConntrackMax},
+		{name: "large instance uses maximum", memory: "1Ti", expected: maxDefaultConntrackMax},
+		{name: "configured value wins", conntrack: &v1alpha2.Conntrack{Max: lo.ToPtr[int32](65536)}, memory: "16Gi", expected: 65536},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.Conntrack = tt.conntrack
+			instanceType := newTestInstanceType()
+			instanceType.Capacity = v1.ResourceList{v1.ResourceMemory: resource.MustParse(tt.memory)}
+			assert.Equal(t, tt.expected, getConntrackMax(nodeClass, instanceType))
+		})
+	}
+}
+
+func generationDurationSampleCount(t *testing.T) uint64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.LaunchTemplateGenerationDuration)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	return families[0].GetMetric()[0].GetHistogram().GetSampleCount()
+}
+
+func TestGetTemplateObservesDuration(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	before := generationDurationSampleCount(t)
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, generationDurationSampleCount(t))
+}
+
+func TestGetTemplateCountsErrorsByStage(t *testing.T) {
+	ctx, _ := newTestContext("invalid-subnet-id")
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	metrics.LaunchTemplateGenerationErrorCount.Reset()
+
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.LaunchTemplateGenerationErrorCount.WithLabelValues(stepStaticParameters)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.LaunchTemplateGenerationErrorCount.WithLabelValues(stepResolve)))
+}
+
+func TestGetTemplateErrorsByStage(t *testing.T) {
+	stages := []error{ErrInvalidNodeClass, ErrInvalidSubnet, ErrKubeVersion, ErrImageResolveFailed, ErrUserDataRender}
+	for name, test := range map[string]struct {
+		subnetID string
+		setup    func(ctx context.Context, p *Provider, nodeClass *v1alpha2.AKSNodeClass)
+		expected error
+	}{
+		"unsupported image family": {
+			setup: func(_ context.Context, _ *Provider, nodeClass *v1alpha2.AKSNodeClass) {
+				nodeClass.Spec.ImageFamily = lo.ToPtr("Windows2022")
+			},
+			expected: ErrInvalidNodeClass,
+		},
+		"local storage without local NVMe disks": {
+			setup: func(_ context.Context, _ *Provider, nodeClass *v1alpha2.AKSNodeClass) {
+				nodeClass.Spec.LocalStorage = &v1alpha2.LocalStorage{}
+			},
+			expected: ErrInvalidNodeClass,
+		},
+		"malformed subnet ID": {
+			subnetID: "invalid-subnet-id",
+			expected: ErrInvalidSubnet,
+		},
+		"subnet outside the cluster virtual network": {
+			subnetID: strings.Replace(testSubnetID, "/virtualNetworks/aks-vnet-12345678/", "/virtualNetworks/other-vnet/", 1),
+			expected: ErrInvalidSubnet,
+		},
+		"kubernetes version discovery failing": {
+			setup: func(_ context.Context, p *Provider, _ *v1alpha2.AKSNodeClass) {
+				kubernetesInterface := newTestKubernetesInterface(nil, fmt.Errorf("connection refused"))
+				p.imageProvider = imagefamily.NewProvider(kubernetesInterface, cache.New(time.Minute, time.Minute), testImageVersionsAPI{testImageVersion}, nil, "eastus")
+			},
+			expected: ErrKubeVersion,
+		},
+		"unavailable image version": {
+			setup: func(_ context.Context, _ *Provider, nodeClass *v1alpha2.AKSNodeClass) {
+				nodeClass.Spec.ImageVersion = lo.ToPtr("1.0.0")
+			},
+			expected: ErrImageResolveFailed,
+		},
+		"tag keys too long": {
+			setup: func(ctx context.Context, _ *Provider, nodeClass *v1alpha2.AKSNodeClass) {
+				options.FromContext(ctx).TagKeyPrefix = strings.Repeat("a", 512)
+				nodeClass.Spec.Tags = map[string]string{"team": "compute"}
+			},
+			expected: ErrUserDataRender,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, _ := newTestContext(testSubnetID)
+			p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+			nodeClass := newTestNodeClass()
+			if test.setup != nil {
+				test.setup(ctx, p, nodeClass)
+			}
+
+			_, err := p.GetTemplateForSubnet(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil, lo.Ternary(test.subnetID != "", test.subnetID, testSubnetID))
+			assert.ErrorIs(t, err, test.expected)
+			for _, stage := range lo.Without(stages, test.expected) {
+				assert.NotErrorIs(t, err, stage)
+			}
+		})
+	}
+}
+
+func TestValidateMTU(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateMTU(nodeClass, "none"))
+
+	nodeClass.Spec.MTU = lo.ToPtr[int32](1400)
+	assert.NoError(t, validateMTU(nodeClass, networkPluginAzure))
+	assert.NoError(t, validateMTU(nodeClass, networkPluginKubenet))
+	assert.Error(t, validateMTU(nodeClass, "none"))
+}
+
+func TestGetTemplateRegistersWithTaints(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := &corev1beta1.NodeClaim{
+		Spec: corev1beta1.NodeClaimSpec{
+			Taints: []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}},
+			StartupTaints: []v1.Taint{
+				{Key: "node.cilium.io/agent-not-ready", Value: "true", Effect: v1.TaintEffectNoExecute},
+				{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+			},
+		},
+	}
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--register-with-taints=dedicated=gpu:NoSchedule,node.cilium.io/agent-not-ready=true:NoExecute")
+	// the nodeClaim itself is left untouched
+	assert.Len(t, nodeClaim.Spec.Taints, 1)
+}
+
+func TestGetTemplateOOMScoreAdj(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.OOMScoreAdj = &v1alpha2.OOMScoreAdj{Kubelet: lo.ToPtr(int32(-999))}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `printf '[Service]\nOOMScoreAdjust=-999\n' > /etc/systemd/system/kubelet.service.d/10-oom-score-adjust.conf`)
+	assert.NotContains(t, string(userData), "containerd.service.d/10-oom-score-adjust.conf")
+}
+
+func TestGetTemplateDNSServers(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.DNSServers = []string{"10.1.0.4"}
+	nodeClass.Spec.DNSSearchDomains = []string{"corp.example.com"}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), base64.StdEncoding.EncodeToString([]byte("[Resolve]\nDNS=10.1.0.4\nDomains=corp.example.com\n")))
+
+	// invalid DNS servers are rejected before generating the template
+	nodeClass.Spec.DNSServers = []string{"10.1.0"}
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `dnsServers entry "10.1.0" is not an IP address`)
+}
+
+func TestGetTemplateDisableIPv6(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.DisableIPv6 = lo.ToPtr(true)
+
+	_, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+
+	options.FromContext(ctx).IPv6DualStack = true
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "disableIPv6 is not supported on dual-stack clusters")
+
+	// dual-stack clusters keep IPv6 by default
+	nodeClass.Spec.DisableIPv6 = nil
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+}
+
+func TestGetTemplateDeterministic(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = lo.SliceToMap(lo.Range(20), func(i int) (string, string) { return fmt.Sprintf("tag-%d", i), fmt.Sprintf("value-%d", i) })
+	nodeClass.Spec.ContainerdConfig = &v1alpha2.ContainerdConfig{RegistryMirrors: []v1alpha2.RegistryMirror{
+		{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com"}},
+		{Registry: "ghcr.io", Endpoints: []string{"https://mirror.example.com"}},
+	}}
+	nodeClaim := &corev1beta1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: lo.SliceToMap(lo.Range(20), func(i int) (string, string) { return fmt.Sprintf("example.com/label-%d", i), "value" }),
+		},
+		Spec: corev1beta1.NodeClaimSpec{
+			Kubelet: &corev1beta1.KubeletConfiguration{
+				SystemReserved: map[string]string{"cpu": "100m", "memory": "100Mi", "ephemeral-storage": "1Gi"},
+				KubeReserved:   map[string]string{"cpu": "100m", "memory": "100Mi", "ephemeral-storage": "1Gi"},
+				EvictionHard:   map[string]string{"memory.available": "5%", "nodefs.available": "10%", "imagefs.available": "15%"},
+			},
+		},
+	}
+
+	template, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		other, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, template.UserData, other.UserData)
+		assert.Equal(t, template.Hash(), other.Hash())
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	// keys which only differ by / resolve the same way on every run
+	for i := 0; i < 10; i++ {
+		tags := mergeTags(DefaultTagKeySanitizer, map[string]string{"team/name": "slash", "team_name": "underscore", "env": "prod"}, map[string]string{"env": "test"})
+		assert.Equal(t, map[string]*string{"team_name": lo.ToPtr("underscore"), "env": lo.ToPtr("test")}, tags)
+	}
+	// of keys sanitized to the same ARM key, those of later maps win
+	tags := mergeTags(DefaultTagKeySanitizer, map[string]string{"team_name": "first"}, map[string]string{"team/name": "second"})
+	assert.Equal(t, map[string]*string{"team_name": lo.ToPtr("second")}, tags)
+}
+
+func TestMergeTagsCustomSanitizer(t *testing.T) {
+	sanitize := NewTagKeySanitizer("-", "k8s-")
+	tags := mergeTags(sanitize,
+		map[string]string{"topology.kubernetes.io/zone": "eastus-1", "team": "platform", "a<b>%c&d\\e?f": "runes"},
+		map[string]string{"karpenter.azure.com/cluster": "test-cluster", "karpenter.sh/nodepool": "default"})
+	assert.Equal(t, map[string]*string{
+		"k8s-topology.kubernetes.io-zone": lo.ToPtr("eastus-1"),
+		"k8s-team":                        lo.ToPtr("platform"),
+		"k8s-a-b--c-d-e-f":                lo.ToPtr("runes"),
+		// the tags Karpenter discovers VMs by keep their keys
+		"karpenter.azure.com_cluster": lo.ToPtr("test-cluster"),
+		"karpenter.sh_nodepool":       lo.ToPtr("default"),
+	}, tags)
+	for key := range tags {
+		assert.NotContains(t, key, "/")
+	}
+
+	// keys which collide once sanitized resolve the same way on every run
+	for i := 0; i < 10; i++ {
+		tags = mergeTags(sanitize, map[string]string{"team/name": "slash", "team-name": "dash"})
+		assert.Equal(t, map[string]*string{"k8s-team-name": lo.ToPtr("slash")}, tags)
+	}
+}
+
+func TestGetTemplateTagKeySanitizer(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).TagKeySeparator = "."
+	options.FromContext(ctx).TagKeyPrefix = "aks."
+	options.FromContext(ctx).RequirementTags = []string{corev1beta1.CapacityTypeLabelKey}
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := newTestRequirementsNodeClaim(
+		v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeSpot}},
+	)
+	nodeClaim.Name = "default-abcde"
+	nodeClaim.Labels = map[string]string{corev1beta1.NodePoolLabelKey: "default"}
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{"team": "platform"}
+
+	template, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*string{
+		"aks.karpenter.sh.capacity-type": lo.ToPtr(corev1beta1.CapacityTypeSpot),
+		"aks.team":                       lo.ToPtr("platform"),
+		"aks.karpenter.sh.nodeclaim":     lo.ToPtr("default-abcde"),
+		"karpenter.sh_nodepool":          lo.ToPtr("default"),
+		"karpenter.azure.com_cluster":    lo.ToPtr("test-cluster"),
+	}, template.Tags)
+
+	tags, err := p.ResolveTags(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", lo.FromPtr(tags["aks.team"]))
+
+	// prefixed keys must still be within the limits of ARM
+	options.FromContext(ctx).TagKeyPrefix = strings.Repeat("p", 510)
+	_, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "is longer than 512 characters")
+}
+
+func TestResolveTags(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{"team": "platform", "cost-center": "1234"}
+
+	tags, err := p.ResolveTags(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*string{
+		"team":                        lo.ToPtr("platform"),
+		"cost-center":                 lo.ToPtr("1234"),
+		"karpenter.azure.com_cluster": lo.ToPtr(options.FromContext(ctx).ClusterName),
+	}, tags)
+
+	// the tags are those of the launch template, without the nodeClaim ones
+	options.FromContext(ctx).RequirementTags = nil
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, template.Tags, tags)
+
+	options.FromContext(ctx).DisableManagedClusterTag = true
+	tags, err = p.ResolveTags(ctx, nodeClass)
+	assert.NoError(t, err)
+	assert.NotContains(t, tags, "karpenter.azure.com_cluster")
+
+	nodeClass.Spec.Tags["team"] = strings.Repeat("v", 257)
+	_, err = p.ResolveTags(ctx, nodeClass)
+	assert.ErrorContains(t, err, `value of tag "team" is longer than 256 characters`)
+}
+
+func TestARMTagsToMap(t *testing.T) {
+	tags := map[string]string{"karpenter.azure.com_cluster": "test-cluster", "team": "platform", "empty": ""}
+	assert.Equal(t, tags, ARMTagsToMap(mergeTags(DefaultTagKeySanitizer, tags)))
+	// keys with / only round-trip sanitized
+	assert.Equal(t, map[string]string{"team_name": "platform"}, ARMTagsToMap(mergeTags(DefaultTagKeySanitizer, map[string]string{"team/name": "platform"})))
+	assert.Equal(t, map[string]string{"team": "platform", "unset": ""}, ARMTagsToMap(map[string]*string{"team": lo.ToPtr("platform"), "unset": nil}))
+	assert.Empty(t, ARMTagsToMap(nil))
+}
+
+func TestGetTemplateSpot(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	templates := map[string]*Template{}
+	for _, capacityType := range []string{corev1beta1.CapacityTypeSpot, corev1beta1.CapacityTypeOnDemand} {
+		template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), map[string]string{corev1beta1.CapacityTypeLabelKey: capacityType})
+		assert.NoError(t, err)
+		templates[capacityType] = template
+	}
+	assert.True(t, templates[corev1beta1.CapacityTypeSpot].Spot)
+	assert.False(t, templates[corev1beta1.CapacityTypeOnDemand].Spot)
+	assert.NotEqual(t, templates[corev1beta1.CapacityTypeOnDemand].UserData, templates[corev1beta1.CapacityTypeSpot].UserData)
+
+	userData, err := base64.StdEncoding.DecodeString(templates[corev1beta1.CapacityTypeSpot].UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "spot-eviction-handler.service")
+	userData, err = base64.StdEncoding.DecodeString(templates[corev1beta1.CapacityTypeOnDemand].UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(userData), "spot-eviction-handler.service")
+}
+
+func TestGetTemplateReadinessCommand(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ReadinessCommand = &v1alpha2.ReadinessCommand{Command: "systemctl is-active kubelet"}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	// nodes register with the readiness taint, with the default timeout
+	assert.Contains(t, string(userData), "--register-with-taints=karpenter.azure.com/readiness-command:NoSchedule")
+	assert.Contains(t, string(userData), "if timeout 300 /bin/bash /opt/azure/containers/readiness-command.sh; then")
+}
+
+func TestGetTemplatePrePullImages(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.PrePullImages = []string{"mcr.microsoft.com/oss/kubernetes/pause:3.9", "nginx:1.27"}
+
+	userData := func() string {
+		template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+		assert.NoError(t, err)
+		userData, err := base64.StdEncoding.DecodeString(template.UserData)
+		assert.NoError(t, err)
+		return string(userData)
+	}
+
+	// nodes register with the readiness taint, removed once the images are pulled
+	assert.Contains(t, userData(), "--register-with-taints=karpenter.azure.com/readiness-command:NoSchedule")
+	assert.Contains(t, userData(), "\n/bin/bash /opt/azure/containers/pre-pull-images.sh mcr.microsoft.com/oss/kubernetes/pause:3.9 nginx:1.27\n")
+
+	nodeClass.Spec.PrePullImagesInBackground = lo.ToPtr(true)
+	assert.NotContains(t, userData(), "karpenter.azure.com/readiness-command")
+	assert.Contains(t, userData(), "systemd-run --unit=pre-pull-images /bin/bash /opt/azure/containers/pre-pull-images.sh mcr.microsoft.com/oss/kubernetes/pause:3.9 nginx:1.27\n")
+}
+
+func TestGetTemplateAPIServerName(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+
+	userData := func() string {
+		template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+		assert.NoError(t, err)
+		userData, err := base64.StdEncoding.DecodeString(template.UserData)
+		assert.NoError(t, err)
+		return string(userData)
+	}
+
+	// the API server name of the cluster endpoint by default
+	assert.Contains(t, userData(), "API_SERVER_NAME="+options.FromContext(ctx).GetAPIServerName()+"\n")
+
+	nodeClass.Spec.APIServerName = lo.ToPtr("api.internal.example.com:443")
+	assert.Contains(t, userData(), "API_SERVER_NAME=api.internal.example.com\n")
+	nodeClass.Spec.APIServerName = lo.ToPtr("api.internal.example.com")
+	assert.Contains(t, userData(), "API_SERVER_NAME=api.internal.example.com\n")
+
+	// nodes of the AKS contract join the API server on 443, other ports are left to the kubeadm profile
+	nodeClass.Spec.APIServerName = lo.ToPtr("api.internal.example.com:6443")
+	_, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, `apiServerName port 6443 is only supported with bootstrap profile "kubeadm", nodes of bootstrap profile "aks" join the API server on 443`)
+
+	nodeClass.Spec.APIServerName = lo.ToPtr("api.internal.example.com:70000")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `apiServerName port "70000" is not between 1 and 65535`)
+}
+
+func TestGetVnetInfoLabelsAzureCNIOverlay(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	labels, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		vnetSubnetNameLabel:     "aks-subnet",
+		vnetGUIDLabel:           "test-vnet-guid",
+		vnetPodNetworkTypeLabel: networkModeOverlay,
+	}, labels)
+}
+
+func TestGetVnetInfoLabelsAzureCNI(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).NetworkPluginMode = ""
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	// pods are in the node subnet, so the pod network type is not that of the overlay
+	labels, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		vnetSubnetNameLabel: "aks-subnet",
+		vnetGUIDLabel:       "test-vnet-guid",
+	}, labels)
+
+	ctx, _ = newTestContext("invalid-subnet-id")
+	options.FromContext(ctx).NetworkPluginMode = ""
+	_, err = p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.ErrorContains(t, err, "resolving vnet labels required by Azure CNI,")
+}
+
+func TestGetVnetInfoLabelsEmptyVnetGUID(t *testing.T) {
+	ctx, logs := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.vnetGUID = ""
+
+	// the label is omitted rather than empty
+	labels, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		vnetSubnetNameLabel:     "aks-subnet",
+		vnetPodNetworkTypeLabel: networkModeOverlay,
+	}, labels)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("launching nodes without the kubernetes.azure.com/nodenetwork-vnetguid label").Len())
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, template.Labels, vnetGUIDLabel)
+	assert.Equal(t, "aks-subnet", template.Labels[vnetSubnetNameLabel])
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(userData), vnetGUIDLabel)
+
+	// and present with the GUID once it is known
+	p.vnetGUID = "test-vnet-guid"
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-vnet-guid", template.Labels[vnetGUIDLabel])
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), vnetGUIDLabel+"=test-vnet-guid")
+}
+
+func TestGetVnetInfoLabelsKubenet(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).NetworkPlugin = networkPluginKubenet
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	labels, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+
+	// the subnet ID is not needed at all
+	ctx, _ = newTestContext("invalid-subnet-id")
+	options.FromContext(ctx).NetworkPlugin = networkPluginKubenet
+	labels, err = p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+}
+
+func TestGetVnetInfoLabelsAzureCNIOverlayInvalidSubnet(t *testing.T) {
+	ctx, _ := newTestContext("invalid-subnet-id")
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	_, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.ErrorContains(t, err, "resolving vnet labels required by Azure CNI Overlay")
+
+	// the labels are required, so no template is generated without them
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "resolving vnet labels required by Azure CNI Overlay")
+}
+
+func TestGetVnetInfoLabelsNoSubnet(t *testing.T) {
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	for _, tc := range []struct {
+		name              string
+		networkPlugin     string
+		networkPluginMode string
+	}{
+		{name: "Azure CNI", networkPlugin: networkPluginAzure},
+		{name: "other network plugin", networkPlugin: "none"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, logs := newTestContext("")
+			options.FromContext(ctx).NetworkPlugin = tc.networkPlugin
+			options.FromContext(ctx).NetworkPluginMode = tc.networkPluginMode
+
+			labels, err := p.getVnetInfoLabels(ctx, "")
+			assert.NoError(t, err)
+			assert.Empty(t, labels)
+			assert.Zero(t, logs.FilterMessageSnippet("launching nodes without vnet labels").Len())
+		})
+	}
+
+	// Azure CNI Overlay requires them
+	ctx, _ := newTestContext("")
+	_, err := p.getVnetInfoLabels(ctx, "")
+	assert.ErrorContains(t, err, "resolving vnet labels required by Azure CNI Overlay")
+
+	// with a subnet, they are resolved as usual
+	ctx, _ = newTestContext(testSubnetID)
+	options.FromContext(ctx).NetworkPlugin = "none"
+	labels, err := p.getVnetInfoLabels(ctx, testSubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, "aks-subnet", labels[vnetSubnetNameLabel])
+	assert.Equal(t, "test-vnet-guid", labels[vnetGUIDLabel])
+}
+
+func TestGetVnetInfoLabelsOtherNetworkPlugin(t *testing.T) {
+	ctx, logs := newTestContext(testSubnetID)
+	options.FromContext(ctx).NetworkPlugin = "none"
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	labels, err := p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, "aks-subnet", labels[vnetSubnetNameLabel])
+	assert.Zero(t, logs.FilterMessageSnippet("launching nodes without vnet labels").Len())
+
+	// the labels are best effort, so nodes are launched without them
+	ctx, logs = newTestContext("invalid-subnet-id")
+	options.FromContext(ctx).NetworkPlugin = "none"
+	labels, err = p.getVnetInfoLabels(ctx, options.FromContext(ctx).SubnetID)
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+	assert.Equal(t, 1, logs.FilterLevelExact(zapcore.WarnLevel).FilterMessageSnippet("launching nodes without vnet labels").Len())
+
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+}
+
+func TestTemplateHash(t *testing.T) {
+	tags := map[string]*string{}
+	otherTags := map[string]*string{}
+	keys := []string{"karpenter.azure.com_cluster", "karpenter.sh_nodepool", "env", "team", "cost-center"}
+	for _, key := range keys {
+		tags[key] = lo.ToPtr(key + "-value")
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		otherTags[keys[i]] = lo.ToPtr(keys[i] + "-value")
+	}
+	template := &Template{UserData: "user-data", ImageID: "image-id", Tags: tags}
+	sameTemplate := &Template{UserData: "user-data", ImageID: "image-id", Tags: otherTags}
+	assert.Equal(t, template.Hash(), sameTemplate.Hash())
+	assert.Equal(t, template.Hash(), template.Hash())
+
+	assert.NotEqual(t, template.Hash(), (&Template{UserData: "other-user-data", ImageID: "image-id", Tags: tags}).Hash())
+	assert.NotEqual(t, template.Hash(), (&Template{UserData: "user-data", ImageID: "other-image-id", Tags: tags}).Hash())
+	assert.NotEqual(t, template.Hash(), (&Template{UserData: "user-data", ImageID: "image-id", Tags: map[string]*string{"env": lo.ToPtr("other")}}).Hash())
+}
+
+func TestGetTemplateManagedClusterTag(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-cluster", lo.FromPtr(template.Tags["karpenter.azure.com_cluster"]))
+
+	options.FromContext(ctx).DisableManagedClusterTag = true
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, template.Tags, "karpenter.azure.com_cluster")
+}
+
+func TestGetTemplateClusterDNSIP(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	options.FromContext(ctx).ServiceCIDR = "172.16.0.0/16"
+	options.FromContext(ctx).ClusterDNSIP = "172.16.0.10"
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--cluster-dns=172.16.0.10 ")
+	assert.NotContains(t, string(userData), "--cluster-dns=10.0.0.10")
+}
+
+func TestGetTemplateNodeClaimTags(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := &corev1beta1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-abcde", Labels: map[string]string{corev1beta1.NodePoolLabelKey: "default"}}}
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "default-abcde", lo.FromPtr(template.Tags["karpenter.sh_nodeclaim"]))
+	assert.Equal(t, "default", lo.FromPtr(template.Tags["karpenter.sh_nodepool"]))
+
+	// they take precedence over tags of the AKSNodeClass
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{"karpenter.sh_nodeclaim": "other"}
+	template, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "default-abcde", lo.FromPtr(template.Tags["karpenter.sh_nodeclaim"]))
+
+	options.FromContext(ctx).NodeClaimTags = false
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, template.Tags, "karpenter.sh_nodeclaim")
+	assert.NotContains(t, template.Tags, "karpenter.sh_nodepool")
+}
+
+func TestSanitizeTagValue(t *testing.T) {
+	assert.Equal(t, "default", sanitizeTagValue("default"))
+	assert.Equal(t, strings.Repeat("n", maxTagValueLength), sanitizeTagValue(strings.Repeat("n", maxTagValueLength+1)))
+}
+
+func newTestRequirementsNodeClaim(requirements ...v1.NodeSelectorRequirement) *corev1beta1.NodeClaim {
+	return &corev1beta1.NodeClaim{
+		Spec: corev1beta1.NodeClaimSpec{
+			Requirements: lo.Map(requirements, func(requirement v1.NodeSelectorRequirement, _ int) corev1beta1.NodeSelectorRequirementWithMinValues {
+				return corev1beta1.NodeSelectorRequirementWithMinValues{NodeSelectorRequirement: requirement}
+			}),
+		},
+	}
+}
+
+func TestGetRequirementTags(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).RequirementTags = []string{corev1beta1.CapacityTypeLabelKey, v1.LabelArchStable, v1.LabelTopologyZone}
+
+	tests := []struct {
+		name         string
+		requirements []v1.NodeSelectorRequirement
+		expected     map[string]string
+	}{
+		{
+			name: "single values",
+			requirements: []v1.NodeSelectorRequirement{
+				{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeSpot}},
+				{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.ArchitectureArm64}},
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"eastus-1"}},
+			},
+			expected: map[string]string{
+				"karpenter.sh/capacity-type":  corev1beta1.CapacityTypeSpot,
+				"kubernetes.io/arch":          corev1beta1.ArchitectureArm64,
+				"topology.kubernetes.io/zone": "eastus-1",
+			},
+		},
+		{
+			name: "multiple values are sorted",
+			requirements: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"eastus-3", "eastus-1", "eastus-2"}},
+			},
+			expected: map[string]string{"topology.kubernetes.io/zone": "eastus-1,eastus-2,eastus-3"},
+		},
+		{
+			name: "requirements without values and unselected requirements are not tagged",
+			requirements: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpExists},
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpNotIn, Values: []string{"eastus-1"}},
+				{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"Standard_D2s_v3"}},
+			},
+			expected: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, getRequirementTags(ctx, newTestRequirementsNodeClaim(tt.requirements...)))
+		})
+	}
+
+	options.FromContext(ctx).RequirementTags = nil
+	assert.Empty(t, getRequirementTags(ctx, newTestRequirementsNodeClaim(tests[0].requirements...)))
+}
+
+func TestGetTemplateRequirementTags(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).RequirementTags = []string{corev1beta1.CapacityTypeLabelKey, v1.LabelTopologyZone}
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := newTestRequirementsNodeClaim(
+		v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeOnDemand}},
+		v1.NodeSelectorRequirement{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"eastus-2", "eastus-1"}},
+	)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{"topology.kubernetes.io_zone": "from-nodeclass"}
+
+	// tags of the AKSNodeClass take precedence
+	template, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, corev1beta1.CapacityTypeOnDemand, lo.FromPtr(template.Tags["karpenter.sh_capacity-type"]))
+	assert.Equal(t, "from-nodeclass", lo.FromPtr(template.Tags["topology.kubernetes.io_zone"]))
+
+	nodeClass.Spec.Tags = nil
+	template, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "eastus-1,eastus-2", lo.FromPtr(template.Tags["topology.kubernetes.io_zone"]))
+}
+
+func TestGetTemplateTagLimits(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).RequirementTags = []string{v1.LabelInstanceTypeStable}
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceTypes := lo.Times(30, func(i int) string { return fmt.Sprintf("Standard_D%ds_v5", i) })
+	nodeClaim := newTestRequirementsNodeClaim(v1.NodeSelectorRequirement{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: instanceTypes})
+
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `value of tag "node.kubernetes.io_instance-type" is longer than 256 characters`)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = lo.SliceToMap(lo.Range(49), func(i int) (string, string) { return fmt.Sprintf("tag-%d", i), "value" })
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "50 tags are more than the maximum of 49")
+}
+
+func TestValidateSandboxRuntime(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateSandboxRuntime(nodeClass, corev1beta1.ArchitectureAmd64))
+
+	nodeClass.Spec.SandboxRuntime = lo.ToPtr(v1alpha2.SandboxRuntimeGVisor)
+	assert.NoError(t, validateSandboxRuntime(nodeClass, corev1beta1.ArchitectureAmd64))
+	assert.NoError(t, validateSandboxRuntime(nodeClass, corev1beta1.ArchitectureArm64))
+
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	assert.ErrorContains(t, validateSandboxRuntime(nodeClass, corev1beta1.ArchitectureAmd64), `sandbox runtime "gvisor" is not supported with image family "AzureLinux"`)
+}
+
+func TestGetTemplateLocalStorage(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.LocalStorage = &v1alpha2.LocalStorage{}
+
+	storageInstanceType := newTestInstanceType()
+	storageInstanceType.Name = "Standard_L16s_v3"
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, storageInstanceType, nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "/bin/bash /opt/azure/containers/mount-local-disks.sh /mnt/disks")
+
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "localStorage is not supported on instance type Standard_D2s_v3, which has no local NVMe disks")
+
+	// without localStorage, the local disks of storage optimized instance types are left alone
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, storageInstanceType, nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(userData), "mount-local-disks.sh")
+}
+
+func TestGetTemplateLocalStorageRAID0(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.LocalStorage = &v1alpha2.LocalStorage{RAID0: lo.ToPtr(true)}
+
+	for vmSize, raid0 := range map[string]bool{
+		"Standard_L16as_v3": true,
+		// a single disk is mounted as is
+		"Standard_L8s_v3": false,
+	} {
+		instanceType := newTestInstanceType()
+		instanceType.Name = vmSize
+		template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+		assert.NoError(t, err)
+		userData, err := base64.StdEncoding.DecodeString(template.UserData)
+		assert.NoError(t, err)
+		assert.Contains(t, string(userData), "/bin/bash /opt/azure/containers/mount-local-disks.sh /mnt/disks")
+		assert.Equal(t, raid0, strings.Contains(string(userData), "mount-local-disks.sh /mnt/disks raid0"), vmSize)
+	}
+}
+
+func TestGetTemplateMIGProfile(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.GPU = &v1alpha2.GPU{MIGProfile: lo.ToPtr(v1alpha2.MIGProfile3g)}
+
+	a100InstanceType := newTestInstanceType()
+	a100InstanceType.Name = "Standard_NC24ads_A100_v4"
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, a100InstanceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, v1alpha2.MIGProfile3g, template.Labels[v1alpha2.LabelGPUMIGProfile])
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "MIG_NODE=true")
+	assert.Contains(t, string(userData), `GPU_INSTANCE_PROFILE="MIG3g"`)
+
+	v100InstanceType := newTestInstanceType()
+	v100InstanceType.Name = "Standard_NC6s_v3"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.ErrorContains(t, err, `gpu migProfile "MIG3g" is not supported on instance type Standard_NC6s_v3, which is not MIG-capable`)
+}
+
+func TestGetTemplateAzureLinux(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.AzureLinuxGen2CommunityImage+"/versions/"+testImageVersion)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "GPU_NODE=false")
+
+	// GPU drivers are installed from the AzureLinux packages rather than the aks-gpu image
+	v100InstanceType := newTestInstanceType()
+	v100InstanceType.Name = "Standard_NC6s_v3"
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "GPU_NODE=true")
+	assert.Contains(t, string(userData), `GPU_IMAGE_SHA=""`)
+
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `GPU_IMAGE_SHA="`+utils.AKSGPUCudaSHA+`"`)
+
+	// GPUs whose drivers AzureLinux doesn't ship are rejected
+	a10InstanceType := newTestInstanceType()
+	a10InstanceType.Name = "Standard_NV6ads_A10_v5"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, a10InstanceType, nil)
+	assert.ErrorContains(t, err, `GPU instance type Standard_NV6ads_A10_v5 is not supported with image family "AzureLinux"`)
+}
+
+func TestGetTemplateImageGeneration(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ImageGeneration = lo.ToPtr(v1alpha2.ImageGenerationGen1)
+
+	// a GPU instance type supporting both generations uses the Gen1 image
+	v100InstanceType := newTestInstanceType()
+	v100InstanceType.Name = "Standard_NC6s_v3"
+	v100InstanceType.Requirements[v1alpha2.LabelSKUHyperVGeneration] = scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2)
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen1CommunityImage+"/")
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen2CommunityImage+"/")
+
+	// the GRID driver is not supported on Gen1 images
+	a10InstanceType := newTestInstanceType()
+	a10InstanceType.Name = "Standard_NV6ads_A10_v5"
+	a10InstanceType.Requirements[v1alpha2.LabelSKUHyperVGeneration] = scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, a10InstanceType, nil)
+	assert.ErrorContains(t, err, "imageGeneration Gen1 is not supported by GPU driver grid-535.161.08 of instance type Standard_NV6ads_A10_v5")
+
+	// the instance type only supports Gen2
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "imageGeneration Gen1 is not supported by instance type Standard_D2s_v3")
+}
+
+func TestGetTemplateGPUDriverVersion(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	v100InstanceType := newTestInstanceType()
+	v100InstanceType.Name = "Standard_NC6s_v3"
+
+	// the driver of the instance type is installed by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `GPU_DRIVER_VERSION="`+utils.Nvidia550CudaDriverVersion+`"`)
+
+	// the CUDA 470 driver only installs on Gen1 images
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.GPU = &v1alpha2.GPU{DriverVersion: lo.ToPtr(v1alpha2.GPUDriverVersionCUDA470)}
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.ErrorContains(t, err, "gpu driver version cuda-470.82.01 does not support all image generations of instance type Standard_NC6s_v3, imageGeneration must be set")
+	nodeClass.Spec.ImageGeneration = lo.ToPtr(v1alpha2.ImageGenerationGen1)
+	v100InstanceType.Requirements[v1alpha2.LabelSKUHyperVGeneration] = scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2)
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen1CommunityImage+"/")
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `GPU_DRIVER_VERSION="`+utils.Nvidia470CudaDriverVersion+`"`)
+
+	// the CUDA drivers fail to install on instance types needing the GRID driver
+	a10InstanceType := newTestInstanceType()
+	a10InstanceType.Name = "Standard_NV6ads_A10_v5"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, a10InstanceType, nil)
+	assert.ErrorContains(t, err, "gpu driver version cuda-470.82.01 is not supported by instance type Standard_NV6ads_A10_v5")
+
+	// the driver version is ignored for instance types without a GPU
+	nodeClass.Spec.ImageGeneration = nil
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+
+	// AzureLinux nodes install the GPU drivers of the distribution
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.ErrorContains(t, err, `gpu driver version cuda-470.82.01 is not supported with image family "AzureLinux"`)
+
+	// the image generation is checked against the selected driver
+	nodeClass = newTestNodeClass()
+	nodeClass.Spec.GPU = &v1alpha2.GPU{DriverVersion: lo.ToPtr(v1alpha2.GPUDriverVersionCUDA470)}
+	nodeClass.Spec.ImageGeneration = lo.ToPtr(v1alpha2.ImageGenerationGen2)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, v100InstanceType, nil)
+	assert.ErrorContains(t, err, "imageGeneration Gen2 is not supported by GPU driver cuda-470.82.01 of instance type Standard_NC6s_v3")
+}
+
+func TestGetTemplateArm64GPU(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	gb200InstanceType := newTestInstanceType()
+	gb200InstanceType.Name = "Standard_ND128isr_NDR_GB200_v6"
+	gb200InstanceType.Requirements[v1.LabelArchStable] = scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, corev1beta1.ArchitectureArm64)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, gb200InstanceType, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen2ArmCommunityImage+"/")
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "GPU_NODE=true")
+	assert.Contains(t, string(userData), `GPU_DRIVER_VERSION="`+utils.Nvidia550CudaDriverVersion+`"`)
+	assert.Contains(t, string(userData), `GPU_IMAGE_SHA="`+utils.AKSGPUCudaSHA+`"`)
+
+	// the CUDA 470 driver has no arm64 image
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.GPU = &v1alpha2.GPU{DriverVersion: lo.ToPtr(v1alpha2.GPUDriverVersionCUDA470)}
+	nodeClass.Spec.ImageGeneration = lo.ToPtr(v1alpha2.ImageGenerationGen1)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, gb200InstanceType, nil)
+	assert.ErrorContains(t, err, "no arm64 GPU driver image exists for GPU driver cuda-470.82.01 of instance type Standard_ND128isr_NDR_GB200_v6")
+}
+
+func TestGetTemplateSecurityProfile(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceType := newTestInstanceType()
+	instanceType.Requirements.Add(
+		scheduling.NewRequirement(v1alpha2.LabelSKUTrustedLaunchSupported, v1.NodeSelectorOpIn, "true"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUEncryptionAtHostSupported, v1.NodeSelectorOpIn, "true"),
+	)
+
+	// no security profile by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, template.SecurityProfile)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.SecurityProfile = &v1alpha2.SecurityProfile{SecureBoot: lo.ToPtr(true), VTPM: lo.ToPtr(true), EncryptionAtHost: lo.ToPtr(true)}
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &SecurityProfile{TrustedLaunch: true, SecureBoot: true, VTPM: true, EncryptionAtHost: true}, template.SecurityProfile)
+
+	// instance types without Trusted Launch or encryption at host are rejected
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "trusted launch is not supported by instance type Standard_D2s_v3")
+	nodeClass.Spec.SecurityProfile = &v1alpha2.SecurityProfile{EncryptionAtHost: lo.ToPtr(true)}
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "encryption at host is not supported by instance type Standard_D2s_v3")
+
+	// Trusted Launch boots Gen2 images only
+	nodeClass.Spec.SecurityProfile = &v1alpha2.SecurityProfile{VTPM: lo.ToPtr(true)}
+	nodeClass.Spec.ImageGeneration = lo.ToPtr(v1alpha2.ImageGenerationGen1)
+	instanceType.Requirements[v1alpha2.LabelSKUHyperVGeneration] = scheduling.NewRequirement(v1alpha2.LabelSKUHyperVGeneration, v1.NodeSelectorOpIn, v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.ErrorContains(t, err, "trusted launch is not supported with imageGeneration Gen1")
+}
+
+func TestGetTemplateConfidentialVM(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceType := newTestInstanceType()
+	instanceType.Name = "Standard_DC2as_v5"
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &SecurityProfile{ConfidentialVM: true, VTPM: true}, template.SecurityProfile)
+	assert.Contains(t, template.ImageID, "/images/"+imagefamily.Ubuntu2204Gen2CVMCommunityImage+"/")
+
+	// secure boot is requested on the confidential VM rather than with Trusted Launch, which the instance type does not support
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.SecurityProfile = &v1alpha2.SecurityProfile{SecureBoot: lo.ToPtr(true)}
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &SecurityProfile{ConfidentialVM: true, SecureBoot: true, VTPM: true}, template.SecurityProfile)
+
+	// Azure Linux has no confidential VM images
+	nodeClass = newTestNodeClass()
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.ErrorContains(t, err, "confidential instance type Standard_DC2as_v5 requires a confidential VM image, which image family AzureLinux does not provide")
+}
+
+func TestGetTemplateMetadataLabels(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceType := newTestInstanceType()
+	instanceType.Requirements.Add(
+		scheduling.NewRequirement(v1alpha2.LabelSKUFamily, v1.NodeSelectorOpIn, "D"),
+		scheduling.NewRequirement(v1.LabelTopologyZone, v1.NodeSelectorOpIn, "eastus-1"),
+		scheduling.NewRequirement(corev1beta1.CapacityTypeLabelKey, v1.NodeSelectorOpIn, corev1beta1.CapacityTypeOnDemand, corev1beta1.CapacityTypeSpot),
+	)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "D", template.Labels[v1alpha2.LabelSKUFamily])
+	assert.Equal(t, "eastus-1", template.Labels[v1alpha2.AlternativeLabelTopologyZone])
+	// the capacity type is not known until launch
+	assert.NotContains(t, template.Labels, corev1beta1.CapacityTypeLabelKey)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), v1alpha2.AlternativeLabelTopologyZone+"=eastus-1")
+
+	// requested labels take precedence
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, map[string]string{v1alpha2.AlternativeLabelTopologyZone: "eastus-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eastus-2", template.Labels[v1alpha2.AlternativeLabelTopologyZone])
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.MetadataLabels = lo.ToPtr(false)
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, template.Labels, v1alpha2.LabelSKUFamily)
+	assert.NotContains(t, template.Labels, v1alpha2.AlternativeLabelTopologyZone)
+}
+
+func TestGetTemplateSecureTLSBootstrapping(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).KubeletClientTLSBootstrapToken = "test-token"
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	// nodes join with the bootstrap token by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `TLS_BOOTSTRAP_TOKEN="test-token"`)
+	assert.Contains(t, string(userData), `ENABLE_SECURE_TLS_BOOTSTRAPPING="false"`)
+
+	options.FromContext(ctx).SecureTLSBootstrapping = true
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(userData), "test-token")
+	assert.Contains(t, string(userData), `TLS_BOOTSTRAP_TOKEN=""`)
+	assert.Contains(t, string(userData), `ENABLE_SECURE_TLS_BOOTSTRAPPING="true"`)
+
+	// nodes authenticate with the kubelet identity
+	p.userAssignedIdentityID = ""
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "secure TLS bootstrapping requires a kubelet identity")
+}
+
+func TestGetTemplateOIDCIssuerURL(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	issuer := "https://eastus.oic.prod-aks.azure.com/00000000-0000-0000-0000-000000000000/11111111-1111-1111-1111-111111111111/"
+	options.FromContext(ctx).OIDCIssuerURL = issuer
+
+	params, err := p.getStaticParameters(ctx, newTestInstanceType(), newTestNodeClass(), testSubnetID, map[string]string{}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, issuer, params.OIDCIssuerURL)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), fmt.Sprintf("OIDC_ISSUER_URL=%q", issuer))
+}
+
+func TestGetTemplateTagTemplates(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{
+		"team":  "{{ .NodeClaim.Labels.team }}",
+		"owner": "{{.NodeClaim.Annotations.example.com/owner}}@{{ .NodeClaim.Name }}",
+	}
+	nodeClaim := &corev1beta1.NodeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default-abcde",
+		Labels:      map[string]string{"team": "payments"},
+		Annotations: map[string]string{"example.com/owner": "alice"},
+	}}
+
+	template, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", lo.FromPtr(template.Tags["team"]))
+	assert.Equal(t, "alice@default-abcde", lo.FromPtr(template.Tags["owner"]))
+
+	// referencing a label the nodeClaim does not have
+	nodeClass.Spec.Tags["cost-center"] = "{{ .NodeClaim.Labels.cost-center }}"
+	_, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `tag "cost-center" references label "cost-center", which nodeClaim default-abcde does not have`)
+
+	// referencing a field of the nodeClaim which is not supported
+	nodeClass.Spec.Tags = map[string]string{"team": "{{ .NodeClaim.Spec.NodeClassRef }}"}
+	_, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `value of tag "team", "{{ .NodeClaim.Spec.NodeClassRef }}" has an invalid reference`)
+}
+
+func TestGetTemplateRuntimeHandlers(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	// the runtime handlers are not labeled by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, template.Labels, v1alpha2.LabelRuntimeHandlerPrefix+v1alpha2.RuntimeHandlerRunc)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.SandboxRuntime = lo.ToPtr(v1alpha2.SandboxRuntimeGVisor)
+	nodeClass.Spec.RuntimeHandlers = &v1alpha2.RuntimeHandlers{Default: lo.ToPtr(v1alpha2.RuntimeHandlerRunsc), Labels: lo.ToPtr(true)}
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", template.Labels[v1alpha2.LabelRuntimeHandlerPrefix+v1alpha2.RuntimeHandlerRunc])
+	assert.Equal(t, "true", template.Labels[v1alpha2.LabelRuntimeHandlerPrefix+v1alpha2.RuntimeHandlerRunsc])
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), v1alpha2.LabelRuntimeHandlerPrefix+v1alpha2.RuntimeHandlerRunsc+"=true")
+
+	// GPU nodes keep the NVIDIA container runtime as their default
+	gpuInstanceType := newTestInstanceType()
+	gpuInstanceType.Name = "Standard_NC6s_v3"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, gpuInstanceType, nil)
+	assert.ErrorContains(t, err, `default runtime handler "runsc" is not supported on GPU instance type Standard_NC6s_v3`)
+}
+
+func TestGetTemplateSysctls(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.LinuxConfig = &v1alpha2.LinuxConfig{Sysctls: map[string]string{"net.core.somaxconn": "16384", "fs.inotify.max_user_watches": "1048576"}}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	sysctlContent := regexp.MustCompile(`SYSCTL_CONTENT="([^"]*)"`).FindStringSubmatch(string(userData))
+	assert.Len(t, sysctlContent, 2)
+	sysctls, err := base64.StdEncoding.DecodeString(sysctlContent[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(sysctls), "fs.inotify.max_user_watches=1048576\nnet.core.somaxconn=16384\n")
+
+	nodeClass.Spec.LinuxConfig.Sysctls["kernel.panic"] = "10"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `linuxConfig sysctl "kernel.panic" is not allowed`)
+}
+
+func TestGetTemplateMaxConcurrentDownloads(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ContainerdConfig = &v1alpha2.ContainerdConfig{MaxConcurrentDownloads: lo.ToPtr(int32(8))}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	containerdConfigContent := regexp.MustCompile(`CONTAINERD_CONFIG_CONTENT="([^"]*)"`).FindStringSubmatch(string(userData))
+	assert.Len(t, containerdConfigContent, 2)
+	containerdConfig, err := base64.StdEncoding.DecodeString(containerdConfigContent[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(containerdConfig), "max_concurrent_downloads = 8\n")
+
+	nodeClass.Spec.ContainerdConfig.MaxConcurrentDownloads = lo.ToPtr(int32(-1))
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "containerdConfig maxConcurrentDownloads -1 is not positive")
+}
+
+func TestGetTemplateAnnotations(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Annotations = map[string]string{"example.com/owner": "team-a", "example.com/description": "it's a node"}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, nodeClass.Spec.Annotations, template.Annotations)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `annotate node "$(hostname | tr '[:upper:]' '[:lower:]')" --overwrite 'example.com/description=it'\''s a node' 'example.com/owner=team-a'`)
+
+	// the annotations are not shared with the AKSNodeClass
+	template.Annotations["example.com/owner"] = "team-b"
+	assert.Equal(t, "team-a", nodeClass.Spec.Annotations["example.com/owner"])
+
+	nodeClass.Spec.Annotations = map[string]string{"-invalid": "value"}
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `annotation key "-invalid" is invalid`)
+}
+
+func TestGetNetworkProfileSysctls(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	sysctls, err := getNetworkProfileSysctls(nodeClass)
+	assert.NoError(t, err)
+	assert.Empty(t, sysctls)
+
+	nodeClass.Spec.NetworkProfile = &v1alpha2.NetworkProfile{Name: v1alpha2.NetworkProfileHighThroughput}
+	sysctls, err = getNetworkProfileSysctls(nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"net.core.rmem_max":           "134217728",
+		"net.core.wmem_max":           "134217728",
+		"net.ipv4.tcp_rmem":           "4096 87380 134217728",
+		"net.ipv4.tcp_wmem":           "4096 65536 134217728",
+		"net.core.netdev_max_backlog": "30000",
+	}, sysctls)
+
+	nodeClass.Spec.NetworkProfile.CoreRMemMax = lo.ToPtr[int32](67108864)
+	nodeClass.Spec.NetworkProfile.TCPWMem = lo.ToPtr("8192 65536 67108864")
+	nodeClass.Spec.NetworkProfile.NetdevMaxBacklog = lo.ToPtr[int32](100000)
+	sysctls, err = getNetworkProfileSysctls(nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, "67108864", sysctls["net.core.rmem_max"])
+	assert.Equal(t, "134217728", sysctls["net.core.wmem_max"])
+	assert.Equal(t, "8192 65536 67108864", sysctls["net.ipv4.tcp_wmem"])
+	assert.Equal(t, "100000", sysctls["net.core.netdev_max_backlog"])
+	// the curated profile itself is left untouched
+	assert.Equal(t, "134217728", networkProfiles[v1alpha2.NetworkProfileHighThroughput]["net.core.rmem_max"])
+
+	nodeClass.Spec.NetworkProfile.TCPRMem = lo.ToPtr("4096 87380 1024")
+	_, err = getNetworkProfileSysctls(nodeClass)
+	assert.ErrorContains(t, err, "invalid net.ipv4.tcp_rmem override")
+
+	nodeClass.Spec.NetworkProfile = &v1alpha2.NetworkProfile{Name: "low-latency"}
+	_, err = getNetworkProfileSysctls(nodeClass)
+	assert.ErrorContains(t, err, `unknown network profile "low-latency"`)
+}
+
+func TestGetTemplateAcceleratedNetworking(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	supportingInstanceType := newTestInstanceType()
+	supportingInstanceType.Requirements.Add(scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpIn, "true"))
+	nonSupportingInstanceType := newTestInstanceType()
+	nonSupportingInstanceType.Requirements.Add(scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpDoesNotExist))
+
+	tests := []struct {
+		name                  string
+		instanceType          *cloudprovider.InstanceType
+		acceleratedNetworking *bool
+		expected              bool
+	}{
+		{"supporting SKU", supportingInstanceType, nil, true},
+		{"non-supporting SKU", nonSupportingInstanceType, nil, false},
+		{"supporting SKU disabled by the NodeClass", supportingInstanceType, lo.ToPtr(false), false},
+		{"non-supporting SKU enabled by the NodeClass", nonSupportingInstanceType, lo.ToPtr(true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.AcceleratedNetworking = tt.acceleratedNetworking
+			template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, tt.instanceType, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, template.AcceleratedNetworking)
+		})
+	}
+}
+
+func TestGetTemplateEphemeralOSDisk(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	ephemeralInstanceType := newTestInstanceType()
+	ephemeralInstanceType.Requirements.Add(scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpIn, "141.5"))
+	managedInstanceType := newTestInstanceType()
+	managedInstanceType.Requirements.Add(scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpDoesNotExist))
+
+	tests := []struct {
+		name         string
+		instanceType *cloudprovider.InstanceType
+		osDiskSizeGB int32
+		expected     bool
+	}{
+		{"fits on local storage", ephemeralInstanceType, 128, true},
+		{"larger than local storage", ephemeralInstanceType, 256, false},
+		{"no local storage", managedInstanceType, 128, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.OSDiskSizeGB = lo.ToPtr(tt.osDiskSizeGB)
+			params, err := p.getStaticParameters(ctx, tt.instanceType, nodeClass, testSubnetID, map[string]string{}, nil, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprint(tt.expected), params.Labels[v1alpha2.LabelEphemeralOSDisk])
+			template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, tt.instanceType, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, template.EphemeralOSDisk)
+		})
+	}
+}
+
+func TestGetTemplateEphemeralOSDiskPlacement(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceType := newTestInstanceType()
+	instanceType.Requirements.Add(
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpIn, "274.877906944"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageCacheDiskMaxSize, v1.NodeSelectorOpIn, "274.877906944"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageResourceDiskMaxSize, v1.NodeSelectorOpIn, "68.719476736"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageNVMeDiskMaxSize, v1.NodeSelectorOpIn, "959.923519488"),
+	)
+
+	tests := []struct {
+		name         string
+		placement    string
+		osDiskSizeGB int32
+		err          string
+	}{
+		{name: "cache disk", placement: v1alpha2.EphemeralOSDiskPlacementCacheDisk, osDiskSizeGB: 128},
+		{name: "resource disk", placement: v1alpha2.EphemeralOSDiskPlacementResourceDisk, osDiskSizeGB: 64},
+		{name: "NVMe disk", placement: v1alpha2.EphemeralOSDiskPlacementNVMeDisk, osDiskSizeGB: 512},
+		{name: "larger than the resource disk", placement: v1alpha2.EphemeralOSDiskPlacementResourceDisk, osDiskSizeGB: 128,
+			err: "os disk of 128GB does not fit the ResourceDisk of instance type Standard_D2s_v3, which has room for 68GB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.OSDiskSizeGB = lo.ToPtr(tt.osDiskSizeGB)
+			nodeClass.Spec.EphemeralOSDiskPlacement = lo.ToPtr(tt.placement)
+			template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, instanceType, nil)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, template.EphemeralOSDisk)
+			assert.Equal(t, tt.placement, template.EphemeralOSDiskPlacement)
+			assert.Equal(t, "true", template.Labels[v1alpha2.LabelEphemeralOSDisk])
+		})
+	}
+
+	// without a placement, Azure places the OS disk
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, template.EphemeralOSDiskPlacement)
+}
+
+func TestSetEphemeralOSDiskLabel(t *testing.T) {
+	labels := map[string]string{v1alpha2.LabelEphemeralOSDisk: "true"}
+	assert.NoError(t, setEphemeralOSDiskLabel(labels, true))
+	assert.Equal(t, "true", labels[v1alpha2.LabelEphemeralOSDisk])
+	assert.ErrorContains(t, setEphemeralOSDiskLabel(labels, false),
+		`label karpenter.azure.com/ephemeral-os-disk="true" conflicts with the resolved OS disk placement "false"`)
+}
+
+func TestGetTemplateKubeletIdentity(t *testing.T) {
+	const (
+		nodeIdentity    = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/vm-identity"
+		kubeletIdentity = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet-identity"
+		clientID        = "11111111-2222-3333-4444-555555555555"
+	)
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).NodeIdentities = []string{nodeIdentity, kubeletIdentity}
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	userDataFor := func(nodeClass *v1alpha2.AKSNodeClass) (string, error) {
+		template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+		if err != nil {
+			return "", err
+		}
+		userData, err := base64.StdEncoding.DecodeString(template.UserData)
+		return string(userData), err
+	}
+
+	userData, err := userDataFor(newTestNodeClass())
+	assert.NoError(t, err)
+	assert.Contains(t, userData, "USER_ASSIGNED_IDENTITY_ID=test-userAssignedIdentity\n")
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.KubeletIdentity = &v1alpha2.KubeletIdentity{ClientID: clientID, ResourceID: strings.ToUpper(kubeletIdentity)}
+	userData, err = userDataFor(nodeClass)
+	assert.NoError(t, err)
+	assert.Contains(t, userData, "USER_ASSIGNED_IDENTITY_ID="+clientID+"\n")
+
+	nodeClass.Spec.KubeletIdentity.ResourceID = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/other-identity"
+	_, err = userDataFor(nodeClass)
+	assert.ErrorContains(t, err, "is not one of the node identities assigned to instances")
+
+	nodeClass.Spec.KubeletIdentity.ResourceID = testSubnetID
+	_, err = userDataFor(nodeClass)
+	assert.ErrorContains(t, err, "is not a user-assigned identity")
+}
+
+func TestValidateEntropySource(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateEntropySource(nodeClass))
+
+	for _, entropySource := range []string{v1alpha2.EntropySourceRngd, v1alpha2.EntropySourceHaveged} {
+		nodeClass.Spec.EntropySource = lo.ToPtr(entropySource)
+		assert.NoError(t, validateEntropySource(nodeClass))
+	}
+
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	nodeClass.Spec.EntropySource = lo.ToPtr(v1alpha2.EntropySourceRngd)
+	assert.NoError(t, validateEntropySource(nodeClass))
+	nodeClass.Spec.EntropySource = lo.ToPtr(v1alpha2.EntropySourceHaveged)
+	assert.ErrorContains(t, validateEntropySource(nodeClass), `entropy source "haveged" is not supported with image family "AzureLinux"`)
+}
+
+func TestValidateTCPCongestionControl(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateTCPCongestionControl(nodeClass))
+
+	nodeClass.Spec.TCPCongestionControl = lo.ToPtr(v1alpha2.TCPCongestionControlHTCP)
+	assert.NoError(t, validateTCPCongestionControl(nodeClass))
+
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	assert.ErrorContains(t, validateTCPCongestionControl(nodeClass), `tcp congestion control "htcp" is not supported with image family "AzureLinux"`)
+	nodeClass.Spec.TCPCongestionControl = lo.ToPtr(v1alpha2.TCPCongestionControlBBR)
+	assert.NoError(t, validateTCPCongestionControl(nodeClass))
+}
+
+func TestValidateDNSStubListener(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateDNSStubListener(nodeClass))
+	nodeClass.Spec.DNSStubListener = lo.ToPtr(false)
+	assert.NoError(t, validateDNSStubListener(nodeClass))
+
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	assert.ErrorContains(t, validateDNSStubListener(nodeClass), `disabling the DNS stub listener is not supported with image family "AzureLinux"`)
+	nodeClass.Spec.DNSStubListener = lo.ToPtr(true)
+	assert.NoError(t, validateDNSStubListener(nodeClass))
+}
+
+func TestValidateSwapAccounting(t *testing.T) {
+	nodeClass := newTestNodeClass()
+	assert.NoError(t, validateSwapAccounting(nodeClass))
+	nodeClass.Spec.SwapAccounting = lo.ToPtr(true)
+	assert.NoError(t, validateSwapAccounting(nodeClass))
+
+	nodeClass.Spec.ImageFamily = lo.ToPtr(v1alpha2.AzureLinuxImageFamily)
+	assert.ErrorContains(t, validateSwapAccounting(nodeClass), `swap accounting requires cgroup v2, which image family "AzureLinux" does not use`)
+	nodeClass.Spec.SwapAccounting = lo.ToPtr(false)
+	assert.NoError(t, validateSwapAccounting(nodeClass))
+}
+
+func TestGetTemplateNodeIdentities(t *testing.T) {
+	const (
+		defaultIdentity   = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/default-identity"
+		workloadIdentity1 = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/workload-identity-1"
+		workloadIdentity2 = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/workload-identity-2"
+	)
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).NodeIdentities = []string{defaultIdentity}
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{defaultIdentity}, template.NodeIdentities)
+	assert.False(t, template.SystemAssignedIdentity)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.NodeIdentities = []string{workloadIdentity1, defaultIdentity, workloadIdentity2}
+	nodeClass.Spec.SystemAssignedIdentity = lo.ToPtr(true)
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{defaultIdentity, workloadIdentity1, workloadIdentity2}, template.NodeIdentities)
+	assert.True(t, template.SystemAssignedIdentity)
+	// the cluster node identities are left untouched
+	assert.Equal(t, []string{defaultIdentity}, options.FromContext(ctx).NodeIdentities)
+}
+
+func TestGetTemplateClusterEndpoint(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	p.clusterEndpoint = ""
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "cluster endpoint is empty")
+
+	p.clusterEndpoint = "test-cluster.hcp.eastus.azmk8s.io"
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `cluster endpoint "test-cluster.hcp.eastus.azmk8s.io" is not a valid URL`)
+
+	p.clusterEndpoint = "https://test-cluster.hcp.eastus.azmk8s.io:443"
+	options.FromContext(ctx).ClusterEndpoint = ""
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "API server name derived from the cluster endpoint option is empty")
+}
+
+func TestValidateClusterEndpoint(t *testing.T) {
+	assert.NoError(t, validateClusterEndpoint("https://test-cluster.hcp.eastus.azmk8s.io:443", "test-cluster.hcp.eastus.azmk8s.io"))
+	assert.Error(t, validateClusterEndpoint("https://", "test-cluster.hcp.eastus.azmk8s.io"))
+	assert.Error(t, validateClusterEndpoint("://bad", "test-cluster.hcp.eastus.azmk8s.io"))
+}
+
+func TestGetTemplateImageVersion(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, imagefamily.BuildImageID(imagefamily.AKSUbuntuPublicGalleryURL, imagefamily.Ubuntu2204Gen2CommunityImage, testImageVersion), template.ImageID)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ImageVersion = lo.ToPtr("202401.09.0")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, fmt.Sprintf(`image version "202401.09.0" is not available for image %s in gallery %s`, imagefamily.Ubuntu2204Gen2CommunityImage, imagefamily.AKSUbuntuPublicGalleryURL))
+}
+
+func TestGetTemplateValidatesNodeClass(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Tags = map[string]string{"team/name": "platform"}
+
+	_, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `validating AKSNodeClass test-nodeclass, tag key "team/name" must not contain any of`)
+}
+
+func TestGetTemplateRoCE(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	rdmaInstanceType := newTestInstanceType()
+	rdmaInstanceType.Name = "Standard_HB120rs_v3"
+
+	tests := []struct {
+		name         string
+		instanceType *cloudprovider.InstanceType
+		roce         *bool
+		expected     bool
+	}{
+		{"RDMA capable SKU", rdmaInstanceType, lo.ToPtr(true), true},
+		{"RDMA capable SKU without RoCE", rdmaInstanceType, nil, false},
+		{"SKU without RDMA", newTestInstanceType(), lo.ToPtr(true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.RoCE = tt.roce
+			params, err := p.getStaticParameters(ctx, tt.instanceType, nodeClass, testSubnetID, map[string]string{}, nil, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, params.RoCE)
+			template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, tt.instanceType, nil)
+			assert.NoError(t, err)
+			userData, err := base64.StdEncoding.DecodeString(template.UserData)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, strings.Contains(string(userData), "rdma-core"))
+		})
+	}
+}
+
+func TestGetTemplateRegistryMirrors(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ContainerdConfig = &v1alpha2.ContainerdConfig{
+		RegistryMirrors: []v1alpha2.RegistryMirror{
+			{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com"}},
+			{Registry: "registry.k8s.io", Endpoints: []string{"https://mirror.example.com"}},
+		},
+	}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `/etc/containerd/certs.d/docker.io/hosts.toml`)
+	assert.Contains(t, string(userData), `/etc/containerd/certs.d/registry.k8s.io/hosts.toml`)
+
+	nodeClass.Spec.ContainerdConfig.RegistryMirrors[1].Endpoints = []string{"mirror.example.com"}
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, `registry mirror endpoint "mirror.example.com" of "registry.k8s.io" is not an http(s) URL`)
+}
+
+func TestGetTemplateSystemdUnits(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	content := "[Unit]\nDescription=Node health agent\n\n[Service]\nExecStart=/usr/local/bin/node-health-agent\n"
+	nodeClass.Spec.SystemdUnits = []v1alpha2.SystemdUnit{
+		{Name: "node-health-agent.service", Content: content},
+		{Name: "node-health-report.service", Content: "[Service]\nExecStart=/usr/local/bin/node-health-report\n", Enabled: lo.ToPtr(false)},
+	}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `echo "`+base64.StdEncoding.EncodeToString([]byte(content))+`" | base64 -d > "/etc/systemd/system/node-health-agent.service"`)
+	assert.Contains(t, string(userData), `base64 -d > "/etc/systemd/system/node-health-report.service"`)
+	// units are enabled by default
+	assert.Contains(t, string(userData), "systemctl enable --now node-health-agent.service\n")
+
+	nodeClass.Spec.SystemdUnits[0].Name = "kubelet.service"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, `systemdUnits name "kubelet.service" is a unit of node bootstrapping`)
+}
+
+func TestGetTemplateBootDiagnostics(t *testing.T) {
+	tests := map[string]struct {
+		bootDiagnostics    *v1alpha2.BootDiagnostics
+		expectedEnabled    bool
+		expectedStorageURI string
+	}{
+		"not configured": {},
+		"enabled in managed storage": {
+			bootDiagnostics: &v1alpha2.BootDiagnostics{Enabled: lo.ToPtr(true)},
+			expectedEnabled: true,
+		},
+		"enabled by default": {
+			bootDiagnostics: &v1alpha2.BootDiagnostics{},
+			expectedEnabled: true,
+		},
+		"enabled in a storage account": {
+			bootDiagnostics:    &v1alpha2.BootDiagnostics{StorageURI: lo.ToPtr("https://diagnostics.blob.core.windows.net/")},
+			expectedEnabled:    true,
+			expectedStorageURI: "https://diagnostics.blob.core.windows.net/",
+		},
+		"disabled": {
+			bootDiagnostics: &v1alpha2.BootDiagnostics{Enabled: lo.ToPtr(false)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, _ := newTestContext(testSubnetID)
+			p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.BootDiagnostics = tc.bootDiagnostics
+
+			template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedEnabled, template.BootDiagnostics)
+			assert.Equal(t, tc.expectedStorageURI, template.BootDiagnosticsStorageURI)
+		})
+	}
+
+	ctx, _ := newTestContext(testSubnetID)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.BootDiagnostics = &v1alpha2.BootDiagnostics{StorageURI: lo.ToPtr("https://diagnostics.blob.core.windows.net/?sv=2022-11-02&sig=secret")}
+	_, err := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute).GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+}
+
+func TestGetTemplateLabelConflicts(t *testing.T) {
+	ctx, logs := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := &corev1beta1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+		vnetSubnetNameLabel: "user-subnet",
+		vnetDataPlaneLabel:  networkDataplaneCilium,
+		"team":              "payments",
+	}}}
+
+	// computed labels win over colliding nodeClaim labels, which are logged
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aks-subnet", template.Labels[vnetSubnetNameLabel])
+	assert.Equal(t, "payments", template.Labels["team"])
+	entries := logs.FilterMessage("overriding nodeClaim labels kubernetes.azure.com/network-subnet=user-subnet (computed aks-subnet) with labels computed for nodes").All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+
+	options.FromContext(ctx).LabelConflictPolicy = options.LabelConflictPolicyError
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, "nodeClaim labels kubernetes.azure.com/network-subnet=user-subnet (computed aks-subnet) collide with labels computed for nodes")
+
+	// labels of the same value as the computed ones do not collide
+	delete(nodeClaim.Labels, vnetSubnetNameLabel)
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, networkDataplaneCilium, template.Labels[vnetDataPlaneLabel])
+}
+
+func TestGetTemplateHostname(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClaim := &corev1beta1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-x7k2p", Labels: map[string]string{"team": "payments", "owner": "Payments_Team"}}}
+
+	// hostnames are left to AKS defaults
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(userData), "hostnamectl")
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.HostnameTemplate = lo.ToPtr("{{ .NodeClaim.Labels.team }}-{{ .InstanceType }}-z{{ .Zone }}-{{.NodeClaim.Name}}")
+	template, err = p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `hostnamectl set-hostname "payments-standard-d2s-v3-z${HOSTNAME_ZONE:-0}-default-x7k2p"`)
+	assert.Contains(t, string(userData), "metadata/instance/compute/zone")
+
+	for _, tc := range []struct {
+		name             string
+		hostnameTemplate string
+		err              string
+	}{
+		{name: "label value of invalid characters", hostnameTemplate: "{{ .NodeClaim.Labels.owner }}-{{ .NodeClaim.Name }}",
+			err: `hostnameTemplate "{{ .NodeClaim.Labels.owner }}-{{ .NodeClaim.Name }}" resolves to "Payments_Team-default-x7k2p", which is not a valid RFC 1123 label`},
+		{name: "longer than 63 characters", hostnameTemplate: "{{ .InstanceType }}-" + strings.Repeat("a", 40) + "-{{ .NodeClaim.Name }}",
+			err: "must be no more than 63 characters"},
+		{name: "ending with a hyphen", hostnameTemplate: "{{ .NodeClaim.Name }}-",
+			err: `resolves to "default-x7k2p-", which is not a valid RFC 1123 label`},
+		{name: "missing label", hostnameTemplate: "{{ .NodeClaim.Labels.cost-center }}-{{ .NodeClaim.Name }}",
+			err: `hostnameTemplate references label "cost-center", which nodeClaim default-x7k2p does not have`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.HostnameTemplate = lo.ToPtr(tc.hostnameTemplate)
+			_, err := p.GetTemplate(ctx, nodeClass, nodeClaim, newTestInstanceType(), nil)
+			assert.ErrorIs(t, err, ErrInvalidNodeClass)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestGetTemplateZoneAvailability(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	instanceType := newTestInstanceType()
+	instanceType.Offerings = cloudprovider.Offerings{
+		{Zone: "eastus-1", CapacityType: corev1beta1.CapacityTypeOnDemand, Available: true},
+		{Zone: "eastus-2", CapacityType: corev1beta1.CapacityTypeSpot, Available: true},
+		{Zone: "eastus-3", CapacityType: corev1beta1.CapacityTypeOnDemand, Available: false},
+	}
+	zonePinned := func(zones ...string) *corev1beta1.NodeClaim {
+		nodeClaim := newTestRequirementsNodeClaim(
+			v1.NodeSelectorRequirement{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: zones},
+			v1.NodeSelectorRequirement{Key: corev1beta1.CapacityTypeLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{corev1beta1.CapacityTypeOnDemand}},
+		)
+		nodeClaim.Name = "test-nodeclaim"
+		return nodeClaim
+	}
+
+	// available in one of the zones
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), zonePinned("eastus-1"), instanceType, nil)
+	assert.NoError(t, err)
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), zonePinned("eastus-1", "eastus-3"), instanceType, nil)
+	assert.NoError(t, err)
+
+	// offered in the zone only with another capacity type, or unavailable there
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), zonePinned("eastus-2", "eastus-3"), instanceType, nil)
+	assert.ErrorIs(t, err, ErrZoneUnavailable)
+	assert.ErrorContains(t, err, "instance type Standard_D2s_v3 with image ")
+	assert.ErrorContains(t, err, " is not offered in zones [eastus-2,eastus-3] nodeClaim test-nodeclaim is pinned to, only in zones [eastus-1]")
+
+	// nodeClaims not pinned to zones are not checked
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, instanceType, nil)
+	assert.NoError(t, err)
+	_, err = p.GetTemplate(ctx, newTestNodeClass(), newTestRequirementsNodeClaim(
+		v1.NodeSelectorRequirement{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpNotIn, Values: []string{"eastus-1"}},
+	), instanceType, nil)
+	assert.NoError(t, err)
+}
+
+func TestGetTemplateCgroupDriver(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.Kubelet = &v1alpha2.Kubelet{CgroupDriver: lo.ToPtr(v1alpha2.CgroupDriverCgroupfs)}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--cgroup-driver=cgroupfs ")
+	assert.Contains(t, string(userData), `NEEDS_CGROUPV2="false"`)
+
+	// the images of the kubeadm bootstrap profile configure containerd themselves
+	options.FromContext(ctx).BootstrapProfile = bootstrap.ProfileKubeadm
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, `kubelet cgroupDriver "cgroupfs" is not supported with bootstrap profile "kubeadm"`)
+
+	nodeClass.Spec.Kubelet.CgroupDriver = lo.ToPtr("docker")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, `kubelet cgroupDriver "docker" is not one of systemd, cgroupfs`)
+}
+
+func TestGetTemplateKubeadmUnsupportedSettings(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).BootstrapProfile = bootstrap.ProfileKubeadm
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	for _, tc := range []struct {
+		name     string
+		modify   func(spec *v1alpha2.AKSNodeClassSpec)
+		expected string
+	}{
+		{name: "mtu", modify: func(spec *v1alpha2.AKSNodeClassSpec) { spec.MTU = lo.ToPtr[int32](1400) }, expected: "sets mtu,"},
+		{name: "several settings", modify: func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.DNSServers = []string{"10.0.0.10"}
+			spec.PrePullImages = []string{"nginx:1.27"}
+			spec.ReadinessCommand = &v1alpha2.ReadinessCommand{Command: "true"}
+		}, expected: "sets dnsServers, prePullImages, readinessCommand,"},
+		{name: "hostname template", modify: func(spec *v1alpha2.AKSNodeClassSpec) {
+			spec.HostnameTemplate = lo.ToPtr("{{ .NodeClaim.Name }}")
+		}, expected: "sets hostnameTemplate,"},
+		{name: "swap accounting", modify: func(spec *v1alpha2.AKSNodeClassSpec) { spec.SwapAccounting = lo.ToPtr(true) }, expected: "sets swapAccounting,"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeClass := newTestNodeClass()
+			tc.modify(&nodeClass.Spec)
+			_, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+			assert.ErrorIs(t, err, ErrInvalidNodeClass)
+			assert.ErrorContains(t, err, tc.expected+` which bootstrap profile "kubeadm" does not apply`)
+		})
+	}
+
+	// so are the controller options of node bootstrapping
+	options.FromContext(ctx).NodeHTTPProxy = "http://proxy.internal:3128"
+	options.FromContext(ctx).NodeNoProxy = []string{"10.0.0.0/8"}
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, `options node-http-proxy, node-no-proxy are set, which bootstrap profile "kubeadm" does not apply`)
+
+	// the AKS contract applies them
+	options.FromContext(ctx).BootstrapProfile = bootstrap.ProfileAKS
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.MTU = lo.ToPtr[int32](1400)
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+}
+
+func TestGetTemplateBootstrapProfile(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	caBundle := base64.StdEncoding.EncodeToString([]byte(`-----BEGIN CERTIFICATE-----
+MIIBjTCCATOgAwIBAgIUOvXpWBY/fQNYiIVvJ3ifmWwORiUwCgYIKoZIzj0EAwIw
+GzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTAgFw0yNjEwMTQxNTUzNDVaGA8y
+MTI2MDkyMDE1NTM0NVowGzEZMBcGA1UEAwwQVGVzdCBJbnRlcm5hbCBDQTBZMBMG
+ByqGSM49AgEGCCqGSM49AwEHA0IABF3oQJQ84Is34S6pq5geRZgGlpOrTgRg7P8n
+hvlNFCtYDeH7EI5zgoAxRMGp/+ILPo08v2wSUBrdxPEa+AMsH9ejUzBRMB0GA1Ud
+DgQWBBSaqkZWlhj9Ff73G2fXFG+xpN77MzAfBgNVHSMEGDAWgBSaqkZWlhj9Ff73
+G2fXFG+xpN77MzAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCIQDy
+25z+n1qmkFFg1taG5EviqA4ThRMJTs8W20C+QQJ9KgIgGCrryOXiFz9YQ/5JrumK
+fU91JhEvQB21twyI7M6djdQ=
+-----END CERTIFICATE-----`))
+	p := newTestProvider(lo.ToPtr(caBundle), nil, time.Minute)
+
+	// nodes bootstrap with the AKS contract by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "provision_start.sh")
+	assert.NotContains(t, string(userData), "kubeadm join")
+
+	options.FromContext(ctx).BootstrapProfile = bootstrap.ProfileKubeadm
+	options.FromContext(ctx).KubeletClientTLSBootstrapToken = "abcdef.0123456789abcdef"
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "kubeadm join --config /etc/kubernetes/kubeadm-join.yaml")
+	assert.Contains(t, string(userData), `apiServerEndpoint: "test-cluster.hcp.eastus.azmk8s.io:443"`)
+	assert.Contains(t, string(userData), `token: "abcdef.0123456789abcdef"`)
+	assert.NotContains(t, string(userData), "provision_start.sh")
+
+	// which joins the API server on the port of the API server name
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.APIServerName = lo.ToPtr("api.internal.example.com:6443")
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), `apiServerEndpoint: "api.internal.example.com:6443"`)
+
+	// kubeadm discovers the cluster CA by the hash of the public key, which a CA bundle without a certificate has not
+	_, err = newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute).GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrUserDataRender)
+}
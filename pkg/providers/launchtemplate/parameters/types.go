@@ -17,35 +17,142 @@ limitations under the License.
 package parameters
 
 import (
+	v1 "k8s.io/api/core/v1"
+
 	"github.com/Azure/karpenter-provider-azure/pkg/providers/imagefamily/bootstrap"
 )
 
 // StaticParameters define the static launch template parameters
 type StaticParameters struct {
-	ClusterName                    string
-	ClusterEndpoint                string
-	CABundle                       *string
-	Arch                           string
-	GPUNode                        bool
-	GPUDriverVersion               string
-	GPUImageSHA                    string
-	TenantID                       string
-	SubscriptionID                 string
-	UserAssignedIdentityID         string
-	Location                       string
+	ClusterName            string
+	ClusterEndpoint        string
+	CABundle               *string
+	Arch                   string
+	GPUNode                bool
+	GPUDriverVersion       string
+	GPUImageSHA            string
+	GPUPersistenceMode     bool
+	GPUMIGProfile          string
+	TenantID               string
+	SubscriptionID         string
+	UserAssignedIdentityID string
+	NodeIdentities         []string
+	SystemAssignedIdentity bool
+	Location               string
+	// ProximityPlacementGroupID is the resource ID of the proximity placement group of the VM, empty for none
+	ProximityPlacementGroupID      string
 	ResourceGroup                  string
 	ClusterID                      string
 	APIServerName                  string
+	APIServerPort                  int32
 	KubeletClientTLSBootstrapToken string
-	NetworkPlugin                  string
-	NetworkPolicy                  string
-	KubernetesVersion              string
+	// SecureTLSBootstrapping joins the node with secure TLS bootstrapping rather than the bootstrap token
+	SecureTLSBootstrapping bool
+	// OIDCIssuerURL is the OIDC issuer of the cluster for workload identity, empty if it has none
+	OIDCIssuerURL string
+	NetworkPlugin string
+	NetworkPolicy string
+	// ClusterDNSIP is the IP of the kube-dns service, which the kubelet points pods at
+	ClusterDNSIP      string
+	KubernetesVersion string
+	// BootstrapProfile is the bootstrap contract nodes join the cluster with, see bootstrap.Profiles
+	BootstrapProfile string
+
+	// Conntrack
+	ConntrackMax                   int32
+	ConntrackTCPTimeoutEstablished int32
+	ConntrackTCPTimeoutCloseWait   int32
+
+	NetworkSysctls map[string]string
+	// Sysctls are the kernel parameters of the AKSNodeClass, taking precedence over the network sysctls
+	Sysctls map[string]string
+
+	RegistryMirrors map[string][]string
+	// ImagePullCredentials are the base64 encoded username:password credentials of each private registry, secret
+	ImagePullCredentials map[string]string
+	// CNIBinDir and CNIConfDir are the CNI directories of containerd, empty for the defaults
+	// LocalStorageDiscoveryPath is the directory local NVMe disks are mounted in, empty when they are not mounted
+	LocalStorageDiscoveryPath string
+	// LocalStorageRAID0 stripes the local NVMe disks into a RAID 0 array, for instance types with more than one
+	LocalStorageRAID0 bool
+	CNIBinDir         string
+	CNIConfDir        string
+	// MaxConcurrentDownloads is the number of layers containerd pulls concurrently, 0 for the containerd default
+	MaxConcurrentDownloads int32
+
+	// OOMScoreAdj is the OOM score adjustment of each system daemon
+	OOMScoreAdj map[string]int32
+	// KubeletFeatureGates enables or disables kubelet feature gates by name
+	KubeletFeatureGates map[string]bool
+	// KubeletCgroupDriver is the cgroup driver of the kubelet and containerd, empty for the default of the node image
+	KubeletCgroupDriver string
+
+	ReadinessCommand               string
+	ReadinessCommandTimeoutSeconds int32
+	// PrePullImages are pulled into containerd once the node has started, before the readiness taint is removed
+	// unless PrePullImagesInBackground
+	PrePullImages             []string
+	PrePullImagesInBackground bool
+
+	RegistrationTimeoutSeconds int32
+	RegistrationRetryCount     int32
+
+	SystemdUnits []bootstrap.SystemdUnit
 
 	// VNET
 	SubnetID string
+	// Hostname is the hostname nodes set at boot, resolved from the hostname template of the AKSNodeClass
+	// but for references to the zone, empty for the default hostname
+	Hostname         string
+	MTU              int32
+	DNSServers       []string
+	DNSSearchDomains []string
+	// DisableDNSStubListener points /etc/resolv.conf at the upstream DNS servers rather than the systemd-resolved stub
+	DisableDNSStubListener bool
+	DisableIPv6            bool
+	// TCPCongestionControl is the default TCP congestion control algorithm, empty for the kernel default
+	TCPCongestionControl string
+	// MaxPods caps the max pods of the network plugin, 0 for no cap
+	MaxPods int32
+	// KubeletMaxPods overrides the max pods of the network plugin, 0 for its default
+	KubeletMaxPods int32
+
+	AcceleratedNetworking bool
+	EphemeralOSDisk       bool
+	// EphemeralOSDiskPlacement is the local storage the ephemeral OS disk is placed on, empty to leave it to Azure
+	EphemeralOSDiskPlacement string
+	Spot                     bool
+	// SecureBoot and VTPM launch the VM with Trusted Launch
+	SecureBoot       bool
+	VTPM             bool
+	EncryptionAtHost bool
+	// ConfidentialVM launches the VM with the ConfidentialVM security type, for confidential VM sizes
+	ConfidentialVM bool
+	// BootDiagnostics enables boot diagnostics on the VM, stored at BootDiagnosticsStorageURI, or managed storage if empty
+	BootDiagnostics           bool
+	BootDiagnosticsStorageURI string
+
+	SandboxRuntime string
+	// DefaultRuntimeHandler is the containerd runtime handler of pods selecting no RuntimeClass, empty for runc
+	DefaultRuntimeHandler string
+	EntropySource         string
+	SwapAccounting        bool
+	RoCE                  bool
+	// AdditionalCAs are PEM encoded CA certificates the node trusts in addition to the cluster CA
+	AdditionalCAs []string
+
+	// Proxy
+	HTTPProxy          string
+	HTTPSProxy         string
+	NoProxy            []string
+	HTTPProxyTrustedCA string
 
-	Tags   map[string]string
-	Labels map[string]string
+	Tags map[string]string
+	// RequirementTags are the tags of the nodeClaim requirements, which tags of the AKSNodeClass take precedence over
+	RequirementTags map[string]string
+	Labels          map[string]string
+	Annotations     map[string]string
+	Taints          []v1.Taint
 }
 
 // Parameters adds the dynamically generated launch template parameters
@@ -0,0 +1,98 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// Provenance records the inputs of a launch template which come from the controller rather than the AKSNodeClass and
+// nodeClaim, for auditing which configuration the user data was rendered with. Secrets are redacted.
+type Provenance struct {
+	// Options are the values of the controller options the launch template was generated with, by flag name
+	Options map[string]string
+	// EnvironmentVariables are the environment variables of the controller these options were set with, by name;
+	// options set with flags or left to their defaults have none
+	EnvironmentVariables map[string]string
+}
+
+// getProvenance returns the provenance of the launch templates generated with the options of the context
+func getProvenance(ctx context.Context) *Provenance {
+	opts := options.FromContext(ctx)
+	values := map[string]string{
+		"cluster-name":                  opts.ClusterName,
+		"cluster-endpoint":              opts.ClusterEndpoint,
+		"kubelet-bootstrap-token":       lo.Ternary(opts.KubeletClientTLSBootstrapToken != "", redacted, ""),
+		"secure-tls-bootstrapping":      strconv.FormatBool(opts.SecureTLSBootstrapping),
+		"oidc-issuer-url":               opts.OIDCIssuerURL,
+		"network-plugin":                opts.NetworkPlugin,
+		"network-policy":                opts.NetworkPolicy,
+		"network-plugin-mode":           opts.NetworkPluginMode,
+		"ipv6-dual-stack":               strconv.FormatBool(opts.IPv6DualStack),
+		"cluster-dns-ip":                opts.ClusterDNSIP,
+		"bootstrap-profile":             opts.BootstrapProfile,
+		"vnet-subnet-id":                opts.SubnetID,
+		"node-identities":               strings.Join(opts.NodeIdentities, ","),
+		"disable-managed-cluster-tag":   strconv.FormatBool(opts.DisableManagedClusterTag),
+		"nodeclaim-tags":                strconv.FormatBool(opts.NodeClaimTags),
+		"requirement-tags":              strings.Join(opts.RequirementTags, ","),
+		"tag-key-separator":             opts.TagKeySeparator,
+		"tag-key-prefix":                opts.TagKeyPrefix,
+		"approved-image-digests":        strings.Join(opts.ApprovedImageDigests, ","),
+		"default-image-family":          opts.DefaultImageFamily,
+		"label-conflict-policy":         opts.LabelConflictPolicy,
+		"startup-taint-removal-timeout": opts.StartupTaintRemovalTimeout.String(),
+		"node-http-proxy":               redactURLCredentials(opts.NodeHTTPProxy),
+		"node-https-proxy":              redactURLCredentials(opts.NodeHTTPSProxy),
+		"node-no-proxy":                 strings.Join(opts.NodeNoProxy, ","),
+		"node-http-proxy-trusted-ca":    opts.NodeHTTPProxyTrustedCA,
+	}
+	environmentVariables := map[string]string{}
+	for flag := range values {
+		// options fall back to the environment variable of their flag name, see options.Options.Parse
+		name := strings.ReplaceAll(strings.ToUpper(flag), "-", "_")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		switch flag {
+		case "kubelet-bootstrap-token":
+			value = redacted
+		case "node-http-proxy", "node-https-proxy":
+			value = redactURLCredentials(value)
+		}
+		environmentVariables[name] = value
+	}
+	return &Provenance{Options: values, EnvironmentVariables: environmentVariables}
+}
+
+// redactURLCredentials masks the password of the URL, such as that of a proxy
+func redactURLCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,73 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
+)
+
+type ProximityPlacementGroupsAPI interface {
+	Get(ctx context.Context, resourceGroupName string, proximityPlacementGroupName string, options *armcompute.ProximityPlacementGroupsClientGetOptions) (armcompute.ProximityPlacementGroupsClientGetResponse, error)
+}
+
+// validateProximityPlacementGroup checks VMs launched in the location can be placed in the proximity placement group,
+// which must be in the same subscription and region
+func (p *Provider) validateProximityPlacementGroup(ctx context.Context, proximityPlacementGroupID, location string) error {
+	resourceID, err := arm.ParseResourceID(proximityPlacementGroupID)
+	if err != nil {
+		return invalidNodeClass(fmt.Errorf("parsing proximity placement group ID %s, %w", proximityPlacementGroupID, err))
+	}
+	if !strings.EqualFold(resourceID.SubscriptionID, p.subscriptionID) {
+		return invalidNodeClass(fmt.Errorf("proximity placement group %s is not in the subscription %s of the cluster", proximityPlacementGroupID, p.subscriptionID))
+	}
+	proximityPlacementGroupLocation, err := p.getProximityPlacementGroupLocation(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("getting proximity placement group %s, %w", proximityPlacementGroupID, err)
+	}
+	if !strings.EqualFold(proximityPlacementGroupLocation, location) {
+		return invalidNodeClass(fmt.Errorf("proximity placement group %s is in %s, not in the location %s nodes are launched in",
+			proximityPlacementGroupID, proximityPlacementGroupLocation, location))
+	}
+	return nil
+}
+
+// getProximityPlacementGroupLocation returns the region of the proximity placement group, which is cached as it cannot change
+func (p *Provider) getProximityPlacementGroupLocation(ctx context.Context, resourceID *arm.ResourceID) (string, error) {
+	key := strings.ToLower(resourceID.String())
+	if location, ok := p.proximityPlacementGroupCache.Get(key); ok {
+		return location.(string), nil
+	}
+	if p.proximityPlacementGroupsAPI == nil {
+		return "", fmt.Errorf("no proximity placement groups client configured")
+	}
+	resp, err := p.proximityPlacementGroupsAPI.Get(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+	if err != nil {
+		return "", err
+	}
+	location := lo.FromPtr(resp.Location)
+	if location == "" {
+		return "", fmt.Errorf("proximity placement group has no location")
+	}
+	p.proximityPlacementGroupCache.SetDefault(key, location)
+	return location, nil
+}
@@ -0,0 +1,90 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+)
+
+const testProximityPlacementGroupID = "/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/proximityPlacementGroups/test-ppg"
+
+// testProximityPlacementGroupsAPI returns proximity placement groups in the regions of their names, counting its lookups
+type testProximityPlacementGroupsAPI struct {
+	locations map[string]string
+	calls     *int
+}
+
+func (api testProximityPlacementGroupsAPI) Get(_ context.Context, _ string, name string, _ *armcompute.ProximityPlacementGroupsClientGetOptions) (armcompute.ProximityPlacementGroupsClientGetResponse, error) {
+	*api.calls++
+	location, ok := api.locations[name]
+	if !ok {
+		return armcompute.ProximityPlacementGroupsClientGetResponse{}, fmt.Errorf("not found")
+	}
+	return armcompute.ProximityPlacementGroupsClientGetResponse{
+		ProximityPlacementGroup: armcompute.ProximityPlacementGroup{Location: lo.ToPtr(location)},
+	}, nil
+}
+
+func TestGetTemplateProximityPlacementGroup(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	calls := 0
+	p.proximityPlacementGroupsAPI = testProximityPlacementGroupsAPI{
+		locations: map[string]string{"test-ppg": "EastUS", "westus2-ppg": "westus2"},
+		calls:     &calls,
+	}
+
+	// VMs are not placed in a proximity placement group by default
+	template, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, template.ProximityPlacementGroupID)
+	assert.Zero(t, calls)
+
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ProximityPlacementGroupID = lo.ToPtr(testProximityPlacementGroupID)
+	template, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testProximityPlacementGroupID, template.ProximityPlacementGroupID)
+	// the region of the proximity placement group is cached
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	nodeClass.Spec.ProximityPlacementGroupID = lo.ToPtr("/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/proximityPlacementGroups/westus2-ppg")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, "is in westus2, not in the location eastus nodes are launched in")
+
+	nodeClass.Spec.ProximityPlacementGroupID = lo.ToPtr("/subscriptions/other-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/proximityPlacementGroups/test-ppg")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.ErrorContains(t, err, "is not in the subscription test-subscription of the cluster")
+
+	// failing to look up the proximity placement group does not make the AKSNodeClass invalid
+	nodeClass.Spec.ProximityPlacementGroupID = lo.ToPtr("/subscriptions/test-subscription/resourceGroups/test-resourceGroup/providers/Microsoft.Compute/proximityPlacementGroups/missing-ppg")
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorContains(t, err, "getting proximity placement group")
+	assert.NotErrorIs(t, err, ErrInvalidNodeClass)
+}
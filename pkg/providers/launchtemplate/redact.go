@@ -0,0 +1,57 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"encoding/base64"
+	"regexp"
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+const redacted = "<redacted>"
+
+var (
+	// secretVariableRegex matches the assignments of the bootstrap script variables holding credentials and CA material
+	secretVariableRegex = regexp.MustCompile(`(?m)^((?:TLS_BOOTSTRAP_TOKEN|KUBE_CA_CRT|KUBELET_CLIENT_CONTENT|KUBELET_CLIENT_CERT_CONTENT|` +
+		`SERVICE_PRINCIPAL_FILE_CONTENT|CUSTOM_SEARCH_REALM_PASSWORD|APISERVER_PUBLIC_KEY|CUSTOM_CA_CERT_[0-9]+)=).*$`)
+	// base64BlobRegex matches the base64 payloads written to files by the bootstrap script, which may embed user secrets
+	base64BlobRegex = regexp.MustCompile(`echo "[A-Za-z0-9+/=]+" \| base64 -d`)
+)
+
+// Redacted returns a copy of the template safe to log: the bootstrap token, CA material and other credentials in the
+// user data are masked, as are the base64 payloads the user data writes to files
+func (t *Template) Redacted() *Template {
+	out := *t
+	out.Tags = lo.Assign(t.Tags)
+	out.Labels = lo.Assign(t.Labels)
+	out.NodeIdentities = slices.Clone(t.NodeIdentities)
+	if t.Provenance != nil {
+		// the provenance is redacted already
+		out.Provenance = &Provenance{Options: lo.Assign(t.Provenance.Options), EnvironmentVariables: lo.Assign(t.Provenance.EnvironmentVariables)}
+	}
+	userData, err := base64.StdEncoding.DecodeString(t.UserData)
+	if err != nil {
+		out.UserData = redacted
+		return &out
+	}
+	userData = secretVariableRegex.ReplaceAll(userData, []byte(`${1}"`+redacted+`"`))
+	userData = base64BlobRegex.ReplaceAll(userData, []byte(`echo "`+redacted+`" | base64 -d`))
+	out.UserData = base64.StdEncoding.EncodeToString(userData)
+	return &out
+}
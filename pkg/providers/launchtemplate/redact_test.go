@@ -0,0 +1,94 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+func TestTemplateRedacted(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).KubeletClientTLSBootstrapToken = "abcdef.0123456789abcdef"
+	p := newTestProvider(lo.ToPtr("Y2EtYnVuZGxl"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.ReadinessCommand = &v1alpha2.ReadinessCommand{Command: "curl -H 'Authorization: Bearer s3cr3t' https://health.example.com"}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	readinessCommand := base64.StdEncoding.EncodeToString([]byte(nodeClass.Spec.ReadinessCommand.Command))
+	assert.Contains(t, string(userData), "abcdef.0123456789abcdef")
+	assert.Contains(t, string(userData), readinessCommand)
+
+	redactedTemplate := template.Redacted()
+	redactedUserData, err := base64.StdEncoding.DecodeString(redactedTemplate.UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(redactedUserData), "abcdef.0123456789abcdef")
+	assert.NotContains(t, string(redactedUserData), "Y2EtYnVuZGxl")
+	assert.NotContains(t, string(redactedUserData), readinessCommand)
+	assert.Contains(t, string(redactedUserData), `TLS_BOOTSTRAP_TOKEN="<redacted>"`)
+	assert.Contains(t, string(redactedUserData), `KUBE_CA_CRT="<redacted>"`)
+	assert.Contains(t, string(redactedUserData), `echo "<redacted>" | base64 -d > /opt/azure/containers/readiness-command.sh`)
+	// non-sensitive content is kept
+	assert.Contains(t, string(redactedUserData), "SUBNET=aks-subnet")
+	assert.Contains(t, string(redactedUserData), "--max-pods=")
+	assert.Equal(t, template.ImageID, redactedTemplate.ImageID)
+	assert.Equal(t, template.Labels, redactedTemplate.Labels)
+
+	// the template itself is left untouched
+	userData, err = base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "abcdef.0123456789abcdef")
+	redactedTemplate.Labels["example.com/label"] = "value"
+	assert.NotContains(t, template.Labels, "example.com/label")
+}
+
+func TestTemplateRedactedImagePullConfig(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("Y2EtYnVuZGxl"), nil, time.Minute)
+	nodeClass := newTestNodeClass()
+	auth := base64.StdEncoding.EncodeToString([]byte("puller:s3cr3t"))
+	nodeClass.Spec.ImagePullConfig = []v1alpha2.ImagePullConfig{{Registry: "registry.example.com", Auth: auth}}
+
+	template, err := p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	config := base64.StdEncoding.EncodeToString([]byte(`{"auths":{"registry.example.com":{"auth":"` + auth + `"}}}`))
+	assert.Contains(t, string(userData), `echo "`+config+`" | base64 -d > /var/lib/kubelet/config.json`)
+
+	redactedUserData, err := base64.StdEncoding.DecodeString(template.Redacted().UserData)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(redactedUserData), config)
+	assert.NotContains(t, string(redactedUserData), auth)
+	assert.Contains(t, string(redactedUserData), `echo "<redacted>" | base64 -d > /var/lib/kubelet/config.json`)
+
+	nodeClass.Spec.ImagePullConfig[0].Registry = "registry.example.com/team"
+	_, err = p.GetTemplate(ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.ErrorIs(t, err, ErrInvalidNodeClass)
+	assert.NotContains(t, err.Error(), auth)
+}
@@ -0,0 +1,149 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+	"github.com/Azure/karpenter-provider-azure/pkg/utils"
+)
+
+const (
+	// azureReservedSubnetIPs is the number of addresses Azure reserves in every subnet,
+	// see https://learn.microsoft.com/azure/virtual-network/virtual-networks-faq#are-there-any-restrictions-on-using-ip-addresses-within-these-subnets
+	azureReservedSubnetIPs = 5
+	// maxIPConfigurationsPerNIC is the maximum number of IP configurations of a network interface,
+	// one of which is the primary IP of the node
+	maxIPConfigurationsPerNIC = 256
+	// minSubnetMaxPods is the minimum max-pods AKS allows for Azure CNI
+	minSubnetMaxPods = 10
+)
+
+// errSubnetExhausted is wrapped by the errors of subnets without IPs left for another node
+var errSubnetExhausted = errors.New("subnet exhausted")
+
+// IsSubnetExhaustedError returns whether generating a launch template failed because its subnet has no IPs left for the node
+func IsSubnetExhaustedError(err error) bool {
+	return errors.Is(err, errSubnetExhausted)
+}
+
+type SubnetsAPI interface {
+	Get(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, options *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error)
+}
+
+// getMaxPods returns the max-pods cap for the subnet nodes are launched into with Azure CNI, where every pod takes
+// an IP of the subnet, and 0 (no cap) for other network plugins and modes, such as Azure CNI Overlay
+func (p *Provider) getMaxPods(ctx context.Context, subnetID string) (int32, error) {
+	if options.FromContext(ctx).NetworkPlugin != networkPluginAzure || options.FromContext(ctx).NetworkPluginMode == options.NetworkPluginModeOverlay {
+		return 0, nil
+	}
+	availableIPs, err := p.getSubnetAvailableIPs(ctx, subnetID)
+	if err != nil {
+		return 0, fmt.Errorf("getting available IPs of subnet %s, %w", subnetID, err)
+	}
+	maxPods, err := subnetMaxPods(availableIPs)
+	if err != nil {
+		return 0, fmt.Errorf("subnet %s, %w", subnetID, err)
+	}
+	logging.FromContext(ctx).With("subnet", subnetID, "available-ips", availableIPs).Debugf("capping max pods at %d", maxPods)
+	return maxPods, nil
+}
+
+// subnetMaxPods caps max-pods by the IP configurations of the node's network interface and by the IPs left in the subnet,
+// both of which are shared with the node itself
+func subnetMaxPods(availableIPs int64) (int32, error) {
+	maxPods := lo.Min([]int64{maxIPConfigurationsPerNIC - 1, availableIPs - 1})
+	if maxPods < minSubnetMaxPods {
+		return 0, fmt.Errorf("%d available IPs are not enough for a node with at least %d pods, %w", availableIPs, minSubnetMaxPods, errSubnetExhausted)
+	}
+	return int32(maxPods), nil
+}
+
+// getSubnetAvailableIPs returns the number of unused IPs in the subnet. The result is cached briefly, so that launching many nodes at once
+// does not look up the subnet for each of them; nodes launched within the cache TTL are not accounted for.
+func (p *Provider) getSubnetAvailableIPs(ctx context.Context, subnetID string) (int64, error) {
+	if availableIPs, ok := p.subnetCache.Get(subnetID); ok {
+		return availableIPs.(int64), nil
+	}
+	if p.subnetsAPI == nil {
+		return 0, fmt.Errorf("no subnets client configured")
+	}
+	subnetParts, err := utils.GetVnetSubnetIDComponents(subnetID)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.subnetsAPI.Get(ctx, subnetParts.ResourceGroupName, subnetParts.VNetName, subnetParts.SubnetName, nil)
+	if err != nil {
+		return 0, err
+	}
+	availableIPs, err := availableSubnetIPs(resp.Subnet)
+	if err != nil {
+		return 0, err
+	}
+	p.subnetCache.SetDefault(subnetID, availableIPs)
+	return availableIPs, nil
+}
+
+// validateSubnet checks nodes can be launched into the subnet: the cluster subnet, or a fallback subnet in its virtual network,
+// which the vnet labels of nodes (such as the vnet GUID) are resolved for
+func validateSubnet(ctx context.Context, subnetID string) error {
+	clusterSubnetID := options.FromContext(ctx).SubnetID
+	if strings.EqualFold(subnetID, clusterSubnetID) {
+		return nil
+	}
+	subnetParts, err := utils.GetVnetSubnetIDComponents(subnetID)
+	if err != nil {
+		return err
+	}
+	clusterSubnetParts, err := utils.GetVnetSubnetIDComponents(clusterSubnetID)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(subnetParts.SubscriptionID, clusterSubnetParts.SubscriptionID) || !strings.EqualFold(subnetParts.ResourceGroupName, clusterSubnetParts.ResourceGroupName) ||
+		!strings.EqualFold(subnetParts.VNetName, clusterSubnetParts.VNetName) {
+		return fmt.Errorf("subnet %s is not in the virtual network of the cluster subnet %s", subnetID, clusterSubnetID)
+	}
+	return nil
+}
+
+func availableSubnetIPs(subnet armnetwork.Subnet) (int64, error) {
+	if subnet.Properties == nil {
+		return 0, fmt.Errorf("subnet has no properties")
+	}
+	addressPrefix := lo.FromPtr(subnet.Properties.AddressPrefix)
+	if addressPrefix == "" && len(subnet.Properties.AddressPrefixes) > 0 {
+		addressPrefix = lo.FromPtr(subnet.Properties.AddressPrefixes[0])
+	}
+	_, ipNet, err := net.ParseCIDR(addressPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("parsing address prefix %q, %w", addressPrefix, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits != 8*net.IPv4len {
+		return 0, fmt.Errorf("address prefix %q is not IPv4", addressPrefix)
+	}
+	return lo.Max([]int64{0, int64(1)<<(bits-ones) - azureReservedSubnetIPs - int64(len(subnet.Properties.IPConfigurations))}), nil
+}
@@ -0,0 +1,233 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+	"github.com/Azure/karpenter-provider-azure/pkg/operator/options"
+)
+
+// testSubnetsAPI returns a subnet with the given address prefix and number of used IPs, counting its lookups
+type testSubnetsAPI struct {
+	addressPrefix string
+	usedIPs       int
+	calls         *int
+}
+
+func (api testSubnetsAPI) Get(_ context.Context, _ string, _ string, _ string, _ *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+	*api.calls++
+	return armnetwork.SubnetsClientGetResponse{
+		Subnet: armnetwork.Subnet{
+			Properties: &armnetwork.SubnetPropertiesFormat{
+				AddressPrefix:    lo.ToPtr(api.addressPrefix),
+				IPConfigurations: make([]*armnetwork.IPConfiguration, api.usedIPs),
+			},
+		},
+	}, nil
+}
+
+func newTestNodeSubnetContext() context.Context {
+	ctx, _ := newTestContext(testSubnetID)
+	options.FromContext(ctx).NetworkPluginMode = ""
+	return ctx
+}
+
+func TestGetMaxPodsOverlay(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+
+	// the subnet is not looked up at all
+	maxPods, err := p.getMaxPods(ctx, testSubnetID)
+	assert.NoError(t, err)
+	assert.Zero(t, maxPods)
+}
+
+func TestGetMaxPodsNodeSubnet(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		addressPrefix string
+		usedIPs       int
+		maxPods       int32
+		err           string
+	}{
+		{name: "large subnet is capped by the network interface", addressPrefix: "10.224.0.0/16", usedIPs: 1000, maxPods: 255},
+		{name: "near-exhausted subnet is capped by its available IPs", addressPrefix: "10.224.0.0/24", usedIPs: 230, maxPods: 20},
+		{name: "exhausted subnet", addressPrefix: "10.224.0.0/24", usedIPs: 245, err: "6 available IPs are not enough for a node with at least 10 pods"},
+		{name: "overcommitted subnet", addressPrefix: "10.224.0.0/28", usedIPs: 20, err: "0 available IPs are not enough"},
+		{name: "IPv6 subnet", addressPrefix: "fd00::/64", err: `address prefix "fd00::/64" is not IPv4`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+			p.subnetsAPI = testSubnetsAPI{addressPrefix: tc.addressPrefix, usedIPs: tc.usedIPs, calls: &calls}
+
+			maxPods, err := p.getMaxPods(newTestNodeSubnetContext(), testSubnetID)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.maxPods, maxPods)
+		})
+	}
+}
+
+func TestGetMaxPodsNodeSubnetCached(t *testing.T) {
+	calls := 0
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.subnetsAPI = testSubnetsAPI{addressPrefix: "10.224.0.0/24", usedIPs: 230, calls: &calls}
+
+	for i := 0; i < 3; i++ {
+		maxPods, err := p.getMaxPods(newTestNodeSubnetContext(), testSubnetID)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(20), maxPods)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetTemplateNodeSubnetMaxPods(t *testing.T) {
+	calls := 0
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.subnetsAPI = testSubnetsAPI{addressPrefix: "10.224.0.0/24", usedIPs: 230, calls: &calls}
+
+	template, err := p.GetTemplate(newTestNodeSubnetContext(), newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--max-pods=20")
+}
+
+// testSubnetsByNameAPI returns the subnet with the name looked up
+type testSubnetsByNameAPI map[string]testSubnetsAPI
+
+func (api testSubnetsByNameAPI) Get(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, options *armnetwork.SubnetsClientGetOptions) (armnetwork.SubnetsClientGetResponse, error) {
+	return api[subnetName].Get(ctx, resourceGroupName, virtualNetworkName, subnetName, options)
+}
+
+func TestGetTemplateForFallbackSubnet(t *testing.T) {
+	ctx, _ := newTestContext(testSubnetID)
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	fallbackSubnetID := strings.Replace(testSubnetID, "/subnets/aks-subnet", "/subnets/fallback-subnet", 1)
+
+	template, err := p.GetTemplateForSubnet(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil, fallbackSubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, fallbackSubnetID, template.SubnetID)
+	assert.Equal(t, "fallback-subnet", template.Labels[vnetSubnetNameLabel])
+	assert.Equal(t, "test-vnet-guid", template.Labels[vnetGUIDLabel])
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "SUBNET=fallback-subnet")
+	assert.Contains(t, string(userData), vnetSubnetNameLabel+"=fallback-subnet")
+
+	// the cluster subnet is used by default
+	template, err = p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testSubnetID, template.SubnetID)
+	assert.Equal(t, "aks-subnet", template.Labels[vnetSubnetNameLabel])
+
+	// the vnet labels are those of the cluster virtual network
+	otherVnetSubnetID := strings.Replace(testSubnetID, "/virtualNetworks/aks-vnet-12345678/", "/virtualNetworks/other-vnet/", 1)
+	_, err = p.GetTemplateForSubnet(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil, otherVnetSubnetID)
+	assert.ErrorContains(t, err, "is not in the virtual network of the cluster subnet")
+}
+
+func TestGetTemplateForFallbackSubnetPrimaryExhausted(t *testing.T) {
+	calls := 0
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.subnetsAPI = testSubnetsByNameAPI{
+		"aks-subnet":      {addressPrefix: "10.224.0.0/24", usedIPs: 245, calls: &calls},
+		"fallback-subnet": {addressPrefix: "10.225.0.0/24", usedIPs: 230, calls: &calls},
+	}
+	ctx := newTestNodeSubnetContext()
+	fallbackSubnetID := strings.Replace(testSubnetID, "/subnets/aks-subnet", "/subnets/fallback-subnet", 1)
+
+	_, err := p.GetTemplate(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.True(t, IsSubnetExhaustedError(err))
+
+	template, err := p.GetTemplateForSubnet(ctx, newTestNodeClass(), &corev1beta1.NodeClaim{}, newTestInstanceType(), nil, fallbackSubnetID)
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback-subnet", template.Labels[vnetSubnetNameLabel])
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--max-pods=20")
+
+	// other failures are not exhaustion
+	_, err = p.GetTemplate(ctx, &v1alpha2.AKSNodeClass{Spec: v1alpha2.AKSNodeClassSpec{ImageFamily: lo.ToPtr("Windows2022")}}, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.Error(t, err)
+	assert.False(t, IsSubnetExhaustedError(err))
+}
+
+func TestGetTemplateMaxPods(t *testing.T) {
+	overlayCtx, _ := newTestContext(testSubnetID)
+	kubenetCtx, _ := newTestContext(testSubnetID)
+	options.FromContext(kubenetCtx).NetworkPlugin = networkPluginKubenet
+	for _, tc := range []struct {
+		name    string
+		ctx     context.Context
+		maxPods int32
+		err     string
+	}{
+		{name: "overlay allows more than the node subnet ceiling", ctx: overlayCtx, maxPods: 200},
+		{name: "kubenet", ctx: kubenetCtx, maxPods: 150},
+		{name: "node subnet within its ceiling", ctx: newTestNodeSubnetContext(), maxPods: 30},
+		{name: "node subnet over its ceiling", ctx: newTestNodeSubnetContext(), maxPods: 31, err: `maxPods 31 exceeds the maximum of 30 with network plugin "azure"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+			p.subnetsAPI = testSubnetsAPI{addressPrefix: "10.224.0.0/16", calls: &calls}
+			nodeClass := newTestNodeClass()
+			nodeClass.Spec.MaxPods = lo.ToPtr(tc.maxPods)
+
+			template, err := p.GetTemplate(tc.ctx, nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			userData, err := base64.StdEncoding.DecodeString(template.UserData)
+			assert.NoError(t, err)
+			assert.Contains(t, string(userData), fmt.Sprintf("--max-pods=%d", tc.maxPods))
+		})
+	}
+}
+
+func TestGetTemplateMaxPodsCappedBySubnet(t *testing.T) {
+	calls := 0
+	p := newTestProvider(lo.ToPtr("ca-bundle"), nil, time.Minute)
+	p.subnetsAPI = testSubnetsAPI{addressPrefix: "10.224.0.0/24", usedIPs: 230, calls: &calls}
+	nodeClass := newTestNodeClass()
+	nodeClass.Spec.MaxPods = lo.ToPtr[int32](30)
+
+	template, err := p.GetTemplate(newTestNodeSubnetContext(), nodeClass, &corev1beta1.NodeClaim{}, newTestInstanceType(), nil)
+	assert.NoError(t, err)
+	userData, err := base64.StdEncoding.DecodeString(template.UserData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "--max-pods=20")
+}
@@ -56,15 +56,23 @@ type Environment struct {
 	VirtualMachineExtensionsAPI *fake.VirtualMachineExtensionsAPI
 	NetworkInterfacesAPI        *fake.NetworkInterfacesAPI
 	CommunityImageVersionsAPI   *fake.CommunityGalleryImageVersionsAPI
+	GalleryImagesAPI            *fake.GalleryImagesAPI
 	MockSkuClientSignalton      *fake.MockSkuClientSingleton
 	PricingAPI                  *fake.PricingAPI
 	LoadBalancersAPI            *fake.LoadBalancersAPI
+	SubnetsAPI                  *fake.SubnetsAPI
+	ProximityPlacementGroupsAPI *fake.ProximityPlacementGroupsAPI
 
 	// Cache
-	KubernetesVersionCache    *cache.Cache
-	InstanceTypeCache         *cache.Cache
-	LoadBalancerCache         *cache.Cache
-	UnavailableOfferingsCache *azurecache.UnavailableOfferings
+	KubernetesVersionCache       *cache.Cache
+	InstanceTypeCache            *cache.Cache
+	LoadBalancerCache            *cache.Cache
+	SubnetCache                  *cache.Cache
+	ProximityPlacementGroupCache *cache.Cache
+	UnavailableOfferingsCache    *azurecache.UnavailableOfferings
+
+	// Events
+	EventRecorder *coretest.EventRecorder
 
 	// Providers
 	InstanceTypesProvider  *instancetype.Provider
@@ -98,17 +106,23 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 	pricingAPI := &fake.PricingAPI{}
 	skuClientSingleton := &fake.MockSkuClientSingleton{SKUClient: &fake.ResourceSKUsAPI{Location: region}}
 	communityImageVersionsAPI := &fake.CommunityGalleryImageVersionsAPI{}
+	galleryImagesAPI := &fake.GalleryImagesAPI{}
 	loadBalancersAPI := &fake.LoadBalancersAPI{}
+	subnetsAPI := &fake.SubnetsAPI{}
+	proximityPlacementGroupsAPI := &fake.ProximityPlacementGroupsAPI{}
 
 	// Cache
 	kubernetesVersionCache := cache.New(azurecache.KubernetesVersionTTL, azurecache.DefaultCleanupInterval)
 	instanceTypeCache := cache.New(instancetype.InstanceTypesCacheTTL, azurecache.DefaultCleanupInterval)
 	loadBalancerCache := cache.New(loadbalancer.LoadBalancersCacheTTL, azurecache.DefaultCleanupInterval)
+	subnetCache := cache.New(azurecache.SubnetTTL, azurecache.DefaultCleanupInterval)
+	proximityPlacementGroupCache := cache.New(azurecache.ProximityPlacementGroupTTL, azurecache.DefaultCleanupInterval)
 	unavailableOfferingsCache := azurecache.NewUnavailableOfferings()
+	eventRecorder := coretest.NewEventRecorder()
 
 	// Providers
 	pricingProvider := pricing.NewProvider(ctx, pricingAPI, region, make(chan struct{}))
-	imageFamilyProvider := imagefamily.NewProvider(env.KubernetesInterface, kubernetesVersionCache, communityImageVersionsAPI, region)
+	imageFamilyProvider := imagefamily.NewProvider(env.KubernetesInterface, kubernetesVersionCache, communityImageVersionsAPI, galleryImagesAPI, region)
 	imageFamilyResolver := imagefamily.New(env.Client, imageFamilyProvider)
 	instanceTypesProvider := instancetype.NewProvider(region, instanceTypeCache, skuClientSingleton, pricingProvider, unavailableOfferingsCache)
 	launchTemplateProvider := launchtemplate.NewProvider(
@@ -116,6 +130,12 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		imageFamilyResolver,
 		imageFamilyProvider,
 		ptr.String("ca-bundle"),
+		nil,
+		cache.New(azurecache.CABundleTTL, azurecache.DefaultCleanupInterval),
+		subnetsAPI,
+		subnetCache,
+		proximityPlacementGroupsAPI,
+		proximityPlacementGroupCache,
 		testOptions.ClusterEndpoint,
 		"test-tenant",
 		"test-subscription",
@@ -135,7 +155,10 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		virtualMachinesExtensionsAPI,
 		networkInterfacesAPI,
 		loadBalancersAPI,
+		subnetsAPI,
+		proximityPlacementGroupsAPI,
 		communityImageVersionsAPI,
+		galleryImagesAPI,
 		skuClientSingleton,
 	)
 	instanceProvider := instance.NewProvider(
@@ -144,6 +167,7 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		launchTemplateProvider,
 		loadBalancerProvider,
 		unavailableOfferingsCache,
+		eventRecorder,
 		region,
 		resourceGroup,
 		testOptions.SubnetID,
@@ -156,13 +180,20 @@ func NewRegionalEnvironment(ctx context.Context, env *coretest.Environment, regi
 		VirtualMachineExtensionsAPI: virtualMachinesExtensionsAPI,
 		NetworkInterfacesAPI:        networkInterfacesAPI,
 		LoadBalancersAPI:            loadBalancersAPI,
+		SubnetsAPI:                  subnetsAPI,
+		ProximityPlacementGroupsAPI: proximityPlacementGroupsAPI,
+		GalleryImagesAPI:            galleryImagesAPI,
 		MockSkuClientSignalton:      skuClientSingleton,
 		PricingAPI:                  pricingAPI,
 
-		KubernetesVersionCache:    kubernetesVersionCache,
-		InstanceTypeCache:         instanceTypeCache,
-		UnavailableOfferingsCache: unavailableOfferingsCache,
-		LoadBalancerCache:         loadBalancerCache,
+		KubernetesVersionCache:       kubernetesVersionCache,
+		InstanceTypeCache:            instanceTypeCache,
+		UnavailableOfferingsCache:    unavailableOfferingsCache,
+		LoadBalancerCache:            loadBalancerCache,
+		SubnetCache:                  subnetCache,
+		ProximityPlacementGroupCache: proximityPlacementGroupCache,
+
+		EventRecorder: eventRecorder,
 
 		InstanceTypesProvider:  instanceTypesProvider,
 		InstanceProvider:       instanceProvider,
@@ -182,7 +213,10 @@ func (env *Environment) Reset() {
 	env.VirtualMachineExtensionsAPI.Reset()
 	env.NetworkInterfacesAPI.Reset()
 	env.LoadBalancersAPI.Reset()
+	env.SubnetsAPI.Reset()
+	env.ProximityPlacementGroupsAPI.Reset()
 	env.CommunityImageVersionsAPI.Reset()
+	env.GalleryImagesAPI.Reset()
 	env.MockSkuClientSignalton.Reset()
 	env.PricingAPI.Reset()
 	env.PricingProvider.Reset()
@@ -191,6 +225,10 @@ func (env *Environment) Reset() {
 	env.InstanceTypeCache.Flush()
 	env.UnavailableOfferingsCache.Flush()
 	env.LoadBalancerCache.Flush()
+	env.SubnetCache.Flush()
+	env.ProximityPlacementGroupCache.Flush()
+
+	env.EventRecorder.Reset()
 }
 
 func (env *Environment) Zones() []string {
@@ -18,10 +18,12 @@ package test
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/samber/lo"
 
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 	azoptions "github.com/Azure/karpenter-provider-azure/pkg/operator/options"
 )
 
@@ -30,12 +32,33 @@ type OptionsFields struct {
 	ClusterEndpoint                *string
 	ClusterID                      *string
 	KubeletClientTLSBootstrapToken *string
+	SecureTLSBootstrapping         *bool
+	BootstrapProfile               *string
+	OIDCIssuerURL                  *string
 	SSHPublicKey                   *string
 	NetworkPlugin                  *string
 	NetworkPolicy                  *string
+	NetworkPluginMode              *string
+	IPv6DualStack                  *bool
+	ServiceCIDR                    *string
+	ClusterDNSIP                   *string
 	VMMemoryOverheadPercent        *float64
 	NodeIdentities                 []string
 	SubnetID                       *string
+	DisableManagedClusterTag       *bool
+	NodeClaimTags                  *bool
+	TagKeySeparator                *string
+	TagKeyPrefix                   *string
+	RequirementTags                []string
+	ApprovedImageDigests           []string
+	DefaultImageFamily             *string
+	LabelConflictPolicy            *string
+	StartupTaintRemovalTimeout     *time.Duration
+	LaunchTemplateEvents           *bool
+	NodeHTTPProxy                  *string
+	NodeHTTPSProxy                 *string
+	NodeNoProxy                    []string
+	NodeHTTPProxyTrustedCA         *string
 }
 
 func Options(overrides ...OptionsFields) *azoptions.Options {
@@ -50,11 +73,32 @@ func Options(overrides ...OptionsFields) *azoptions.Options {
 		ClusterEndpoint:                lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
 		ClusterID:                      lo.FromPtrOr(options.ClusterID, "00000000"),
 		KubeletClientTLSBootstrapToken: lo.FromPtrOr(options.KubeletClientTLSBootstrapToken, "test-token"),
+		SecureTLSBootstrapping:         lo.FromPtrOr(options.SecureTLSBootstrapping, false),
+		BootstrapProfile:               lo.FromPtrOr(options.BootstrapProfile, "aks"),
+		OIDCIssuerURL:                  lo.FromPtrOr(options.OIDCIssuerURL, ""),
 		SSHPublicKey:                   lo.FromPtrOr(options.SSHPublicKey, "test-ssh-public-key"),
 		NetworkPlugin:                  lo.FromPtrOr(options.NetworkPlugin, "azure"),
 		NetworkPolicy:                  lo.FromPtrOr(options.NetworkPolicy, "cilium"),
+		NetworkPluginMode:              lo.FromPtrOr(options.NetworkPluginMode, azoptions.NetworkPluginModeOverlay),
+		IPv6DualStack:                  lo.FromPtrOr(options.IPv6DualStack, false),
+		ServiceCIDR:                    lo.FromPtrOr(options.ServiceCIDR, "10.0.0.0/16"),
+		ClusterDNSIP:                   lo.FromPtrOr(options.ClusterDNSIP, "10.0.0.10"),
 		VMMemoryOverheadPercent:        lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
 		NodeIdentities:                 options.NodeIdentities,
 		SubnetID:                       lo.FromPtrOr(options.SubnetID, "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/sillygeese/providers/Microsoft.Network/virtualNetworks/karpentervnet/subnets/karpentersub"),
+		DisableManagedClusterTag:       lo.FromPtrOr(options.DisableManagedClusterTag, false),
+		NodeClaimTags:                  lo.FromPtrOr(options.NodeClaimTags, true),
+		TagKeySeparator:                lo.FromPtrOr(options.TagKeySeparator, "_"),
+		TagKeyPrefix:                   lo.FromPtrOr(options.TagKeyPrefix, ""),
+		RequirementTags:                options.RequirementTags,
+		ApprovedImageDigests:           options.ApprovedImageDigests,
+		DefaultImageFamily:             lo.FromPtrOr(options.DefaultImageFamily, v1alpha2.Ubuntu2204ImageFamily),
+		LabelConflictPolicy:            lo.FromPtrOr(options.LabelConflictPolicy, azoptions.LabelConflictPolicyWarn),
+		StartupTaintRemovalTimeout:     lo.FromPtrOr(options.StartupTaintRemovalTimeout, 0),
+		LaunchTemplateEvents:           lo.FromPtrOr(options.LaunchTemplateEvents, false),
+		NodeHTTPProxy:                  lo.FromPtrOr(options.NodeHTTPProxy, ""),
+		NodeHTTPSProxy:                 lo.FromPtrOr(options.NodeHTTPSProxy, ""),
+		NodeNoProxy:                    options.NodeNoProxy,
+		NodeHTTPProxyTrustedCA:         lo.FromPtrOr(options.NodeHTTPProxyTrustedCA, ""),
 	}
 }
@@ -18,13 +18,17 @@ package utils
 
 import (
 	"strings"
+
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 )
 
 // TODO: Get these from agentbaker
 const (
-	Nvidia470CudaDriverVersion = "cuda-470.82.01"
-	Nvidia550CudaDriverVersion = "cuda-550.54.15"
-	Nvidia535GridDriverVersion = "grid-535.161.08"
+	Nvidia470CudaDriverVersion = v1alpha2.GPUDriverVersionCUDA470
+	Nvidia550CudaDriverVersion = v1alpha2.GPUDriverVersionCUDA550
+	Nvidia535GridDriverVersion = v1alpha2.GPUDriverVersionGRID535
 
 	// These SHAs will change once we update aks-gpu images in aks-gpu repository. We do that fairly rarely at this time.
 	// So for now these will be kept here like this and periodically bump them
@@ -101,6 +105,8 @@ var (
 		// A100
 		"standard_nd96ams_v4":      true,
 		"standard_nd96ams_a100_v4": true,
+		// GB200, arm64
+		"standard_nd128isr_ndr_gb200_v6": true,
 	}
 
 	// List of GPU SKUs currently enabled and validated for Mariner. Will expand the support
@@ -121,6 +127,35 @@ var (
 	}
 )
 
+// migProfiles are the Multi-Instance GPU profiles of A100 GPUs, by the GPU_INSTANCE_PROFILE names of the AKS bootstrap
+var migProfiles = []string{"MIG1g", "MIG2g", "MIG3g", "MIG4g", "MIG7g"}
+
+// MIGEnabledSKUs are the VM SKUs whose GPUs support Multi-Instance GPU partitioning, with their supported profiles
+var MIGEnabledSKUs = map[string][]string{
+	// A100 40GB
+	"standard_nd96asr_v4":       migProfiles,
+	"standard_nd112asr_a100_v4": migProfiles,
+	"standard_nd120asr_a100_v4": migProfiles,
+	// A100 80GB
+	"standard_nd96amsr_a100_v4":  migProfiles,
+	"standard_nd112amsr_a100_v4": migProfiles,
+	"standard_nd120amsr_a100_v4": migProfiles,
+	// A100 PCIE 80GB
+	"standard_nc24ads_a100_v4": migProfiles,
+	"standard_nc48ads_a100_v4": migProfiles,
+	"standard_nc96ads_a100_v4": migProfiles,
+	// A100
+	"standard_nd96ams_v4":      migProfiles,
+	"standard_nd96ams_a100_v4": migProfiles,
+}
+
+// GetMIGProfiles returns the Multi-Instance GPU profiles supported by a VM SKU, none if its GPUs are not MIG-capable
+func GetMIGProfiles(vmSize string) []string {
+	vmSize = strings.ToLower(vmSize)
+	vmSize = strings.TrimSuffix(vmSize, "_promo")
+	return MIGEnabledSKUs[vmSize]
+}
+
 // IsNvidiaEnabledSKU determines if an VM SKU has nvidia driver support
 func IsNvidiaEnabledSKU(vmSize string) bool {
 	// Trim the optional _Promo suffix.
@@ -151,6 +186,49 @@ func GetGPUDriverVersion(size string) string {
 	return Nvidia550CudaDriverVersion
 }
 
+// GetGPUDriverVersions returns the GPU driver versions that can be installed on a VM SKU: only the GRID driver on sizes that
+// need it, only the CUDA 470 driver on the NCv1 series, and the CUDA drivers on other sizes
+func GetGPUDriverVersions(size string) []string {
+	if useGridDrivers(size) {
+		return []string{Nvidia535GridDriverVersion}
+	}
+	if isStandardNCv1(size) {
+		return []string{Nvidia470CudaDriverVersion}
+	}
+	return []string{Nvidia550CudaDriverVersion, Nvidia470CudaDriverVersion}
+}
+
+// gpuDriverHyperVGenerations are the Hyper-V generations of the images each GPU driver version installs on:
+// the CUDA 470 driver of the Gen1-only NCv1 series, and the GRID driver, which NVv5 needs, on Gen2 images only
+var gpuDriverHyperVGenerations = map[string][]string{
+	Nvidia470CudaDriverVersion: {v1alpha2.HyperVGenerationV1},
+	Nvidia550CudaDriverVersion: {v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2},
+	Nvidia535GridDriverVersion: {v1alpha2.HyperVGenerationV2},
+}
+
+// GetGPUDriverHyperVGenerations returns the Hyper-V generations of the images the GPU driver of a VM SKU installs on
+func GetGPUDriverHyperVGenerations(size string) []string {
+	return GetGPUDriverVersionHyperVGenerations(GetGPUDriverVersion(size))
+}
+
+// GetGPUDriverVersionHyperVGenerations returns the Hyper-V generations of the images a GPU driver version installs on
+func GetGPUDriverVersionHyperVGenerations(driverVersion string) []string {
+	return gpuDriverHyperVGenerations[driverVersion]
+}
+
+// gpuDriverArchitectures are the architectures the aks-gpu image of each GPU driver version is published for:
+// only the CUDA 550 driver has an arm64 image, for arm64 GPU sizes such as GB200
+var gpuDriverArchitectures = map[string][]string{
+	Nvidia470CudaDriverVersion: {corev1beta1.ArchitectureAmd64},
+	Nvidia550CudaDriverVersion: {corev1beta1.ArchitectureAmd64, corev1beta1.ArchitectureArm64},
+	Nvidia535GridDriverVersion: {corev1beta1.ArchitectureAmd64},
+}
+
+// GetGPUDriverArchitectures returns the architectures a GPU driver version can be installed on from its aks-gpu image
+func GetGPUDriverArchitectures(driverVersion string) []string {
+	return gpuDriverArchitectures[driverVersion]
+}
+
 func isStandardNCv1(size string) bool {
 	tmp := strings.ToLower(size)
 	return strings.HasPrefix(tmp, "standard_nc") && !strings.Contains(tmp, "_v")
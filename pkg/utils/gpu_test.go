@@ -20,6 +20,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	corev1beta1 "sigs.k8s.io/karpenter/pkg/apis/v1beta1"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 )
 
 func TestGetAKSGPUImageSHA(t *testing.T) {
@@ -116,3 +119,86 @@ func TestIsMarinerEnabledGPUSKU(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMIGProfiles(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name   string
+		input  string
+		output []string
+	}{
+		{"A100 SKU", "Standard_ND96asr_v4", []string{"MIG1g", "MIG2g", "MIG3g", "MIG4g", "MIG7g"}},
+		{"A100 PCIE SKU with Promo", "standard_nc24ads_a100_v4_promo", []string{"MIG1g", "MIG2g", "MIG3g", "MIG4g", "MIG7g"}},
+		{"V100 SKU", "standard_nc6s_v3", nil},
+		{"Non-GPU SKU", "standard_d2_v2", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GetMIGProfiles(test.input)
+			assert.Equal(test.output, result, "Failed for input: %s", test.input)
+		})
+	}
+}
+
+func TestGetGPUDriverHyperVGenerations(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name   string
+		size   string
+		output []string
+	}{
+		{"CUDA Driver - NC Series v1", "standard_nc6s", []string{v1alpha2.HyperVGenerationV1}},
+		{"CUDA Driver - NC Series v3", "standard_nc6s_v3", []string{v1alpha2.HyperVGenerationV1, v1alpha2.HyperVGenerationV2}},
+		{"GRID Driver - NV Series v5", "standard_nv6ads_a10_v5", []string{v1alpha2.HyperVGenerationV2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GetGPUDriverHyperVGenerations(test.size)
+			assert.Equal(test.output, result, "Failed for size: %s", test.size)
+		})
+	}
+}
+
+func TestGetGPUDriverVersions(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name   string
+		size   string
+		output []string
+	}{
+		{"GRID Driver - NV Series v5", "standard_nv6ads_a10_v5", []string{Nvidia535GridDriverVersion}},
+		{"CUDA Driver - NC Series v1", "standard_nc6s", []string{Nvidia470CudaDriverVersion}},
+		{"CUDA Driver - NC Series v3", "standard_nc6s_v3", []string{Nvidia550CudaDriverVersion, Nvidia470CudaDriverVersion}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GetGPUDriverVersions(test.size)
+			assert.Equal(test.output, result, "Failed for size: %s", test.size)
+			assert.Contains(result, GetGPUDriverVersion(test.size), "Failed for size: %s", test.size)
+		})
+	}
+}
+
+func TestGetGPUDriverArchitectures(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name   string
+		size   string
+		output []string
+	}{
+		{"CUDA Driver - NC Series v3", "standard_nc6s_v3", []string{corev1beta1.ArchitectureAmd64, corev1beta1.ArchitectureArm64}},
+		{"CUDA Driver - GB200", "Standard_ND128isr_NDR_GB200_v6", []string{corev1beta1.ArchitectureAmd64, corev1beta1.ArchitectureArm64}},
+		{"CUDA Driver - NC Series v1", "standard_nc6s", []string{corev1beta1.ArchitectureAmd64}},
+		{"GRID Driver - NV Series v5", "standard_nv6ads_a10_v5", []string{corev1beta1.ArchitectureAmd64}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GetGPUDriverArchitectures(GetGPUDriverVersion(test.size))
+			assert.Equal(test.output, result, "Failed for size: %s", test.size)
+		})
+	}
+}
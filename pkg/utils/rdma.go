@@ -0,0 +1,34 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// vmSizeRegex captures the additive features of a VM size, e.g. "asr" in Standard_ND96asr_v4
+// see https://learn.microsoft.com/azure/virtual-machines/vm-naming-conventions
+var vmSizeRegex = regexp.MustCompile(`^standard_[a-z]+[0-9]+(?:-[0-9]+)?([a-z]*)(?:_[a-z0-9]+)*$`)
+
+// IsRDMAEnabledSKU determines if a VM SKU has an RDMA capable network interface, denoted by the "r" additive feature
+func IsRDMAEnabledSKU(vmSize string) bool {
+	vmSize = strings.ToLower(vmSize)
+	vmSize = strings.TrimSuffix(vmSize, "_promo")
+	matches := vmSizeRegex.FindStringSubmatch(vmSize)
+	return matches != nil && strings.ContainsRune(matches[1], 'r')
+}
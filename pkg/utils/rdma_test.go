@@ -0,0 +1,48 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRDMAEnabledSKU(t *testing.T) {
+	tests := []struct {
+		vmSize   string
+		expected bool
+	}{
+		{"Standard_ND96asr_v4", true},
+		{"Standard_ND96isr_H100_v5", true},
+		{"Standard_HB120rs_v3", true},
+		{"Standard_HB120-96rs_v3", true},
+		{"Standard_NC24rs_v3", true},
+		{"Standard_H16r", true},
+		{"Standard_NC24rs_v3_Promo", true},
+		{"Standard_D2s_v3", false},
+		{"Standard_NC24ads_A100_v4", false},
+		{"Standard_E96-48ds_v5", false},
+		{"Standard_D2ps_v5", false},
+		{"not-a-vm-size", false},
+	}
+	for _, test := range tests {
+		t.Run(test.vmSize, func(t *testing.T) {
+			assert.Equal(t, test.expected, IsRDMAEnabledSKU(test.vmSize))
+		})
+	}
+}
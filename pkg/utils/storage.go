@@ -0,0 +1,54 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+)
+
+// LocalNVMeDiskSKUs are the storage optimized VM SKUs with local NVMe disks, with their number of disks,
+// see https://learn.microsoft.com/azure/virtual-machines/sizes/storage-optimized/lsv3-series
+var LocalNVMeDiskSKUs = map[string]int{
+	// Lsv2
+	"standard_l8s_v2":  1,
+	"standard_l16s_v2": 2,
+	"standard_l32s_v2": 4,
+	"standard_l48s_v2": 6,
+	"standard_l64s_v2": 8,
+	"standard_l80s_v2": 10,
+	// Lsv3
+	"standard_l8s_v3":  1,
+	"standard_l16s_v3": 2,
+	"standard_l32s_v3": 4,
+	"standard_l48s_v3": 6,
+	"standard_l64s_v3": 8,
+	"standard_l80s_v3": 10,
+	// Lasv3
+	"standard_l8as_v3":  1,
+	"standard_l16as_v3": 2,
+	"standard_l32as_v3": 4,
+	"standard_l48as_v3": 6,
+	"standard_l64as_v3": 8,
+	"standard_l80as_v3": 10,
+}
+
+// GetLocalNVMeDiskCount returns the number of local NVMe disks of a VM SKU
+func GetLocalNVMeDiskCount(vmSize string) int {
+	vmSize = strings.ToLower(vmSize)
+	vmSize = strings.TrimSuffix(vmSize, "_promo")
+	return LocalNVMeDiskSKUs[vmSize]
+}
@@ -0,0 +1,44 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLocalNVMeDiskCount(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name   string
+		input  string
+		output int
+	}{
+		{"Lsv3 SKU", "Standard_L16s_v3", 2},
+		{"Lasv3 SKU", "standard_l80as_v3", 10},
+		{"SKU without local NVMe disks", "Standard_D2s_v3", 0},
+		{"Empty SKU", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GetLocalNVMeDiskCount(test.input)
+			assert.Equal(test.output, result, "Failed for input: %s", test.input)
+		})
+	}
+}
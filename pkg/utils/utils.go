@@ -20,11 +20,85 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 
+	v1 "k8s.io/api/core/v1"
 	"knative.dev/pkg/logging"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
 )
 
+// IsAcceleratedNetworkingSupported returns whether the instance type SKU supports Accelerated Networking (SR-IOV)
+func IsAcceleratedNetworkingSupported(instanceType *cloudprovider.InstanceType) bool {
+	return instanceType.Requirements.Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpIn, "true"))) == nil
+}
+
+func IsTrustedLaunchSupported(instanceType *cloudprovider.InstanceType) bool {
+	return instanceType.Requirements.Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha2.LabelSKUTrustedLaunchSupported, v1.NodeSelectorOpIn, "true"))) == nil
+}
+
+// confidentialVMSizeRegex matches the AMD SEV-SNP confidential VM sizes (the DCasv5, DCadsv5, ECasv5 and ECadsv5 series and their
+// confidential container variants), see https://learn.microsoft.com/azure/confidential-computing/virtual-machine-solutions
+var confidentialVMSizeRegex = regexp.MustCompile(`^standard_[de]c[0-9]+ad?s(?:_cc)?_v5$`)
+
+// IsConfidentialSKU returns whether the VM size is a confidential VM, which must launch with the ConfidentialVM security type
+// and boot a confidential VM image
+func IsConfidentialSKU(vmSize string) bool {
+	return confidentialVMSizeRegex.MatchString(strings.ToLower(vmSize))
+}
+
+func IsEncryptionAtHostSupported(instanceType *cloudprovider.InstanceType) bool {
+	return instanceType.Requirements.Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha2.LabelSKUEncryptionAtHostSupported, v1.NodeSelectorOpIn, "true"))) == nil
+}
+
+// UseEphemeralOSDisk returns whether the OS disk of the instance type is placed on local (ephemeral) storage,
+// which is the case when the instance type supports ephemeral OS disks large enough for the OS disk size
+func UseEphemeralOSDisk(instanceType *cloudprovider.InstanceType, osDiskSizeGB int32) bool {
+	maxSizeGB := ephemeralOSDiskMaxSizeGB(instanceType)
+	return maxSizeGB > 0 && osDiskSizeGB <= maxSizeGB
+}
+
+// ephemeralOSDiskPlacementLabels are the instance type requirements of the capacity of each ephemeral OS disk placement
+var ephemeralOSDiskPlacementLabels = map[string]string{
+	v1alpha2.EphemeralOSDiskPlacementCacheDisk:    v1alpha2.LabelSKUStorageCacheDiskMaxSize,
+	v1alpha2.EphemeralOSDiskPlacementResourceDisk: v1alpha2.LabelSKUStorageResourceDiskMaxSize,
+	v1alpha2.EphemeralOSDiskPlacementNVMeDisk:     v1alpha2.LabelSKUStorageNVMeDiskMaxSize,
+}
+
+// GetEphemeralOSDiskPlacementMaxSizeGB returns the largest ephemeral OS disk the instance type can place in the given location,
+// which is 0 when the instance type does not support ephemeral OS disks there
+func GetEphemeralOSDiskPlacementMaxSizeGB(instanceType *cloudprovider.InstanceType, placement string) int32 {
+	label, ok := ephemeralOSDiskPlacementLabels[placement]
+	if !ok {
+		return 0
+	}
+	return requirementSizeGB(instanceType, label)
+}
+
+func ephemeralOSDiskMaxSizeGB(instanceType *cloudprovider.InstanceType) int32 {
+	return requirementSizeGB(instanceType, v1alpha2.LabelSKUStorageEphemeralOSMaxSize)
+}
+
+func requirementSizeGB(instanceType *cloudprovider.InstanceType, label string) int32 {
+	reqs := instanceType.Requirements.Get(label).Values()
+	if len(reqs) == 0 || len(reqs) > 1 {
+		return 0
+	}
+	maxSize, err := strconv.ParseFloat(reqs[0], 32)
+	if err != nil {
+		return 0
+	}
+	// decimal places are truncated, so we round down
+	return int32(maxSize)
+}
+
 // GetVMName parses the provider ID stored on the node to get the vmName
 // associated with a node
 func GetVMName(providerID string) (string, error) {
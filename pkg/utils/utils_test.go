@@ -0,0 +1,94 @@
+/*
+Portions Copyright (c) Microsoft Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/Azure/karpenter-provider-azure/pkg/apis/v1alpha2"
+)
+
+func TestIsAcceleratedNetworkingSupported(t *testing.T) {
+	tests := []struct {
+		name        string
+		requirement *scheduling.Requirement
+		expected    bool
+	}{
+		{"supporting SKU", scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpIn, "true"), true},
+		{"non-supporting SKU", scheduling.NewRequirement(v1alpha2.LabelSKUAcceleratedNetworking, v1.NodeSelectorOpDoesNotExist), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instanceType := &cloudprovider.InstanceType{Requirements: scheduling.NewRequirements(test.requirement)}
+			assert.Equal(t, test.expected, IsAcceleratedNetworkingSupported(instanceType))
+		})
+	}
+}
+
+func TestIsConfidentialSKU(t *testing.T) {
+	for vmSize, expected := range map[string]bool{
+		"Standard_DC2as_v5":     true,
+		"Standard_DC4ads_v5":    true,
+		"Standard_EC96as_v5":    true,
+		"standard_ec8ads_v5":    true,
+		"Standard_DC4as_cc_v5":  true,
+		"Standard_DC2s_v3":      false, // Intel SGX, not a confidential VM
+		"Standard_DC1s_v2":      false,
+		"Standard_D2as_v5":      false,
+		"Standard_E4ads_v5":     false,
+		"Standard_DC2as_v5_foo": false,
+	} {
+		assert.Equal(t, expected, IsConfidentialSKU(vmSize), vmSize)
+	}
+}
+
+func TestUseEphemeralOSDisk(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirement  *scheduling.Requirement
+		osDiskSizeGB int32
+		expected     bool
+	}{
+		{"fits on local storage", scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpIn, "128.9"), 128, true},
+		{"larger than local storage", scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpIn, "127.9"), 128, false},
+		{"no local storage", scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpDoesNotExist), 128, false},
+		{"no local storage and no OS disk size", scheduling.NewRequirement(v1alpha2.LabelSKUStorageEphemeralOSMaxSize, v1.NodeSelectorOpDoesNotExist), 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instanceType := &cloudprovider.InstanceType{Requirements: scheduling.NewRequirements(test.requirement)}
+			assert.Equal(t, test.expected, UseEphemeralOSDisk(instanceType, test.osDiskSizeGB))
+		})
+	}
+}
+
+func TestGetEphemeralOSDiskPlacementMaxSizeGB(t *testing.T) {
+	instanceType := &cloudprovider.InstanceType{Requirements: scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageCacheDiskMaxSize, v1.NodeSelectorOpIn, "274.877906944"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageResourceDiskMaxSize, v1.NodeSelectorOpIn, "68.719476736"),
+		scheduling.NewRequirement(v1alpha2.LabelSKUStorageNVMeDiskMaxSize, v1.NodeSelectorOpDoesNotExist),
+	)}
+	assert.Equal(t, int32(274), GetEphemeralOSDiskPlacementMaxSizeGB(instanceType, v1alpha2.EphemeralOSDiskPlacementCacheDisk))
+	assert.Equal(t, int32(68), GetEphemeralOSDiskPlacementMaxSizeGB(instanceType, v1alpha2.EphemeralOSDiskPlacementResourceDisk))
+	assert.Equal(t, int32(0), GetEphemeralOSDiskPlacementMaxSizeGB(instanceType, v1alpha2.EphemeralOSDiskPlacementNVMeDisk))
+	assert.Equal(t, int32(0), GetEphemeralOSDiskPlacementMaxSizeGB(instanceType, "TempDisk"))
+}